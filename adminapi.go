@@ -0,0 +1,547 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//apiMember is a group member as the admin API shows it
+type apiMember struct {
+	GID  string `json:"gid"`
+	Name string `json:"name,omitempty"`
+}
+
+//apiGroup is a group as the admin API shows it
+type apiGroup struct {
+	Name        string      `json:"name"`
+	Members     []apiMember `json:"members"`
+	Private     bool        `json:"private"`
+	Room        string      `json:"room,omitempty"`
+	RoomRemoved bool        `json:"roomRemoved,omitempty"`
+	Managed     bool        `json:"managed,omitempty"`
+}
+
+//apiSchedule is a scheduled message as the admin API shows it
+type apiSchedule struct {
+	Room      string    `json:"room"`
+	Label     string    `json:"label"`
+	Group     string    `json:"group"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+	Recurring bool      `json:"recurring"`
+	Thread    string    `json:"thread,omitempty"`
+	Creator   string    `json:"creator,omitempty"`
+	Paused    bool      `json:"paused,omitempty"`
+}
+
+//newAPIGroup lays out the group for the admin API
+func newAPIGroup(group *Group) apiGroup {
+	members := make([]apiMember, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, apiMember{GID: member.GID, Name: Users.Name(member.GID, member.Name)})
+	}
+
+	return apiGroup{
+		Name:        group.Name,
+		Members:     members,
+		Private:     group.IsPrivate,
+		Room:        group.PrivacyRoomID,
+		RoomRemoved: group.RoomRemoved,
+		Managed:     Manifest.Manages(group.Name),
+	}
+}
+
+//adminRequest handles one request to the admin API. The groups and schedules
+//are changed through the same methods as the chat commands, as the admin
+//client that sent the request. Each handler reads its body before taking
+//stateLock, so a slow client can't hold up the rest of the bot.
+type adminRequest struct {
+	w         http.ResponseWriter
+	r         *http.Request
+	groups    GroupMgr
+	scheduler ScheduleMgr
+	msgObj    messageResponse
+}
+
+// AdminAPI returns a handler for the admin API, where admin
+// clients can manage every group and scheduled message
+func AdminAPI(Groups GroupMgr, Scheduler ScheduleMgr, clients *APIClients) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, baseRoute+"api/v1"), "/")
+
+		if path == "openapi.json" && r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(openAPIDocument))
+			return
+		}
+
+		client := clients.Authenticate(bearerToken(r))
+		if client == nil {
+			log.Printf("Unauthorized API request received from: %s\n", r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "a valid API token is required")
+			return
+		}
+
+		if !client.Admin {
+			writeAPIError(w, http.StatusForbidden, "an admin token is required")
+			return
+		}
+
+		req := &adminRequest{w: w, r: r, groups: Groups, scheduler: Scheduler}
+		req.msgObj.Message.Sender = User{Name: client.Name, GID: "clients/" + client.Name, Type: "BOT"}
+		req.msgObj.FromMaster = true
+
+		parts := strings.Split(path, "/")
+
+		switch {
+		case path == "groups":
+			req.route(req.listGroups, req.createGroup, nil, nil)
+		case parts[0] == "groups" && len(parts) == 2:
+			req.route(req.getGroup, nil, nil, req.disbandGroup)
+		case parts[0] == "groups" && len(parts) == 3 && parts[2] == "members":
+			req.route(nil, req.addMembers, nil, req.removeMembers)
+		case parts[0] == "groups" && len(parts) > 3 && parts[2] == "members":
+			req.route(nil, nil, nil, req.removeMember)
+		case parts[0] == "groups" && len(parts) == 3 && parts[2] == "privacy":
+			req.route(nil, nil, req.setPrivacy, nil)
+		case path == "schedules":
+			req.route(req.listSchedules, req.createSchedule, nil, nil)
+		case parts[0] == "schedules" && len(parts) > 1:
+			req.route(req.getSchedule, nil, nil, req.removeSchedule)
+		case path == "webhooks/deliveries":
+			req.route(req.listDeliveries, nil, nil, nil)
+		default:
+			writeAPIError(w, http.StatusNotFound, "no such endpoint")
+		}
+	}
+}
+
+//route runs the handler for the request's method
+func (req *adminRequest) route(get, post, put, del func()) {
+	handlers := map[string]func(){
+		http.MethodGet:    get,
+		http.MethodPost:   post,
+		http.MethodPut:    put,
+		http.MethodDelete: del,
+	}
+
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		if handlers[method] != nil {
+			allowed = append(allowed, method)
+		}
+	}
+
+	handler := handlers[req.r.Method]
+	if handler == nil {
+		req.w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(req.w, http.StatusMethodNotAllowed, req.r.Method+" is not allowed here")
+		return
+	}
+
+	handler()
+}
+
+//segment returns part of the path after /api/v1/
+func (req *adminRequest) segment(i int) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.r.URL.Path, baseRoute+"api/v1"), "/"), "/")
+	if i >= len(parts) {
+		return ""
+	}
+
+	return parts[i]
+}
+
+//decode reads the request's JSON body, replying with an error if it can't
+func (req *adminRequest) decode(body interface{}) bool {
+	return decodeAPIBody(req.w, req.r, body)
+}
+
+//groupOr404 finds the group named in the path, replying with an error if it
+//doesn't exist
+func (req *adminRequest) groupOr404() *Group {
+	name := req.segment(1)
+	if !req.groups.IsGroup(name) {
+		writeAPIError(req.w, http.StatusNotFound, "group "+name+" does not exist")
+		return nil
+	}
+
+	return req.groups.GetGroup(name)
+}
+
+//unmanaged checks the group isn't managed by the groups manifest, which is
+//the only way it can be changed, replying with an error if it is
+func (req *adminRequest) unmanaged(group *Group) bool {
+	if Manifest.Manages(group.Name) {
+		writeAPIError(req.w, http.StatusConflict, "group "+group.Name+" is managed by the groups manifest")
+		return false
+	}
+
+	return true
+}
+
+//withMembers gives the request's message mentions of the members, so they're
+//added or removed the same as when they're mentioned in chat
+func (req *adminRequest) withMembers(members []apiMember) messageResponse {
+	msgObj := req.msgObj
+
+	for _, member := range members {
+		msgObj.Message.Mentions = append(msgObj.Message.Mentions, annotation{
+			Type:   "USER_MENTION",
+			Called: userMention{User{Name: Users.Name(member.GID, member.Name), GID: member.GID, Type: "HUMAN"}},
+		})
+	}
+
+	return msgObj
+}
+
+//validMembers checks every member has a GID, replying with an error if not
+func (req *adminRequest) validMembers(members []apiMember) bool {
+	if len(members) == 0 {
+		writeAPIError(req.w, http.StatusBadRequest, "members are required")
+		return false
+	}
+
+	for _, member := range members {
+		if !strings.HasPrefix(member.GID, "users/") {
+			writeAPIError(req.w, http.StatusBadRequest, "member gid must be a user, such as users/123")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (req *adminRequest) listGroups() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	groups := make([]apiGroup, 0)
+	for _, name := range req.groups.VisibleGroups(req.msgObj) {
+		groups = append(groups, newAPIGroup(req.groups.GetGroup(name)))
+	}
+
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"groups": groups})
+}
+
+func (req *adminRequest) getGroup() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if group := req.groupOr404(); group != nil {
+		writeAPIResponse(req.w, http.StatusOK, newAPIGroup(group))
+	}
+}
+
+func (req *adminRequest) createGroup() {
+	var body struct {
+		Name    string      `json:"name"`
+		Members []apiMember `json:"members"`
+	}
+
+	if !req.decode(&body) {
+		return
+	}
+
+	if len(body.Members) > 0 && !req.validMembers(body.Members) {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if req.groups.IsGroup(body.Name) {
+		writeAPIError(req.w, http.StatusConflict, "group "+body.Name+" already exists")
+		return
+	}
+
+	msg := req.groups.Create(body.Name, "", req.withMembers(body.Members))
+
+	group := req.groups.GetGroup(body.Name)
+	if group == nil {
+		writeAPIError(req.w, http.StatusBadRequest, msg)
+		return
+	}
+
+	writeAPIResponse(req.w, http.StatusCreated, map[string]interface{}{"message": msg, "group": newAPIGroup(group)})
+}
+
+func (req *adminRequest) disbandGroup() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	group := req.groupOr404()
+	if group == nil || !req.unmanaged(group) {
+		return
+	}
+
+	msg := req.groups.Disband(group.Name, req.msgObj)
+	writeAPIResponse(req.w, http.StatusOK, map[string]string{"message": msg})
+}
+
+func (req *adminRequest) addMembers() {
+	var body struct {
+		Members []apiMember `json:"members"`
+	}
+
+	if !req.decode(&body) || !req.validMembers(body.Members) {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	group := req.groupOr404()
+	if group == nil || !req.unmanaged(group) {
+		return
+	}
+
+	msg := req.groups.AddMembers(group.Name, "", req.withMembers(body.Members))
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"message": msg, "group": newAPIGroup(group)})
+}
+
+func (req *adminRequest) removeMembers() {
+	var body struct {
+		Members []apiMember `json:"members"`
+	}
+
+	if !req.decode(&body) || !req.validMembers(body.Members) {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	group := req.groupOr404()
+	if group == nil || !req.unmanaged(group) {
+		return
+	}
+
+	msg := req.groups.RemoveMembers(group.Name, "", req.withMembers(body.Members))
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"message": msg, "group": newAPIGroup(group)})
+}
+
+//removeMember removes the one member in the path, whose GID has a slash in it
+func (req *adminRequest) removeMember() {
+	member := apiMember{GID: req.segment(3) + "/" + req.segment(4)}
+	if !req.validMembers([]apiMember{member}) {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	group := req.groupOr404()
+	if group == nil || !req.unmanaged(group) {
+		return
+	}
+
+	msg := req.groups.RemoveMembers(group.Name, "", req.withMembers([]apiMember{member}))
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"message": msg, "group": newAPIGroup(group)})
+}
+
+//setPrivacy makes the group public, or restricts it to the room given. Since
+//restricting a group in chat toggles it, it's only called when the group needs
+//to change.
+func (req *adminRequest) setPrivacy() {
+	var body struct {
+		Private bool   `json:"private"`
+		Room    string `json:"room"`
+	}
+
+	if !req.decode(&body) {
+		return
+	}
+
+	if body.Private && !strings.HasPrefix(body.Room, "spaces/") {
+		writeAPIError(req.w, http.StatusBadRequest, "room is required to make a group private, such as spaces/AAAA")
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	group := req.groupOr404()
+	if group == nil || !req.unmanaged(group) {
+		return
+	}
+
+	var msg string
+
+	if group.IsPrivate && (!body.Private || group.PrivacyRoomID != body.Room) {
+		msg = req.groups.Restrict(group.Name, req.msgObj)
+	}
+
+	if body.Private && !group.IsPrivate {
+		msgObj := req.msgObj
+		msgObj.Room = space{GID: body.Room, Type: "ROOM"}
+
+		msg = req.groups.Restrict(group.Name, msgObj)
+	}
+
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"message": msg, "group": newAPIGroup(group)})
+}
+
+//groupNameByID finds the name of the group a schedule is for
+func (req *adminRequest) groupNameByID(id uint) string {
+	if id == 0 {
+		return ""
+	}
+
+	for _, name := range req.groups.VisibleGroups(req.msgObj) {
+		if group := req.groups.GetGroup(name); group != nil && group.Model.ID == id {
+			return group.Name
+		}
+	}
+
+	return ""
+}
+
+//newAPISchedule lays out the schedule for the admin API
+func (req *adminRequest) newAPISchedule(schedule *Schedule) apiSchedule {
+	return apiSchedule{
+		Room:      strings.Split(schedule.SessKey, ":")[0],
+		Label:     schedule.MessageLabel,
+		Group:     req.groupNameByID(schedule.GroupID),
+		Message:   schedule.MessageText,
+		Time:      schedule.ExecuteOn,
+		Recurring: schedule.IsRecurring,
+		Thread:    schedule.ThreadKey,
+		Creator:   schedule.Creator,
+		Paused:    schedule.IsPaused,
+	}
+}
+
+//findSchedule finds the schedule in the path, which is the room followed by
+//the label
+func (req *adminRequest) findSchedule() *Schedule {
+	path := strings.Trim(strings.TrimPrefix(req.r.URL.Path, baseRoute+"api/v1/schedules"), "/")
+
+	split := strings.LastIndex(path, "/")
+	if split < 0 {
+		return nil
+	}
+
+	room, label := path[:split], path[split+1:]
+	for _, schedule := range req.scheduler.Upcoming(room) {
+		if schedule.MessageLabel == label {
+			return schedule
+		}
+	}
+
+	return nil
+}
+
+func (req *adminRequest) listSchedules() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	schedules := make([]apiSchedule, 0)
+	for _, schedule := range req.scheduler.Upcoming(req.r.URL.Query().Get("room")) {
+		schedules = append(schedules, req.newAPISchedule(schedule))
+	}
+
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"schedules": schedules})
+}
+
+func (req *adminRequest) getSchedule() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	schedule := req.findSchedule()
+	if schedule == nil {
+		writeAPIError(req.w, http.StatusNotFound, "schedule does not exist")
+		return
+	}
+
+	writeAPIResponse(req.w, http.StatusOK, req.newAPISchedule(schedule))
+}
+
+func (req *adminRequest) createSchedule() {
+	var body apiSchedule
+	if !req.decode(&body) {
+		return
+	}
+
+	switch {
+	case !strings.HasPrefix(body.Room, "spaces/"):
+		writeAPIError(req.w, http.StatusBadRequest, "room is required, such as spaces/AAAA")
+		return
+	case body.Thread != "" && !strings.HasPrefix(body.Thread, body.Room+"/threads/"):
+		writeAPIError(req.w, http.StatusBadRequest, "thread must be in the room, such as "+body.Room+"/threads/BBBB")
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	subAction := "onetime"
+	if body.Recurring {
+		subAction = "recurring"
+	}
+
+	args := Arguments{
+		"action":    "schedule",
+		"subAction": subAction,
+		"label":     body.Label,
+		"groupName": body.Group,
+		"message":   body.Message,
+	}
+
+	if !body.Time.IsZero() {
+		args["dateTime"] = body.Time.Format(time.RFC3339)
+	}
+
+	if err := checkScheduleArgs(req.groups, args); err != nil {
+		writeAPIError(req.w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgObj := req.msgObj
+	msgObj.Room = space{GID: body.Room, Type: "ROOM"}
+	msgObj.Message.Thread.Name = body.Thread
+
+	var msg string
+	if body.Recurring {
+		msg = req.scheduler.CreateRecurring(args, req.groups, msgObj)
+	} else {
+		msg = req.scheduler.CreateOnetime(args, req.groups, msgObj)
+	}
+
+	response := map[string]interface{}{"message": msg}
+	for _, schedule := range req.scheduler.Upcoming(body.Room) {
+		if schedule.MessageLabel == body.Label {
+			response["schedule"] = req.newAPISchedule(schedule)
+		}
+	}
+
+	writeAPIResponse(req.w, http.StatusCreated, response)
+}
+
+func (req *adminRequest) removeSchedule() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	schedule := req.findSchedule()
+	if schedule == nil {
+		writeAPIError(req.w, http.StatusNotFound, "schedule does not exist")
+		return
+	}
+
+	msgObj := req.msgObj
+	msgObj.Room = space{GID: strings.Split(schedule.SessKey, ":")[0], Type: "ROOM"}
+
+	msg := req.scheduler.Remove(Arguments{"label": schedule.MessageLabel}, msgObj)
+	writeAPIResponse(req.w, http.StatusOK, map[string]string{"message": msg})
+}
+
+func (req *adminRequest) listDeliveries() {
+	deliveries := Webhooks.Deliveries()
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+
+	writeAPIResponse(req.w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdminAPI(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	otherRoomGID := genRoomGID(10)
+
+	Groups := GroupMap{"backend": &Group{Name: "backend", Members: []Member{{GID: "users/1"}}}}
+	Groups["backend"].Model.ID = 7
+	Schedules := make(ScheduleMap)
+
+	clients := &APIClients{clients: []APIClient{
+		{Name: "ops", TokenHash: hashToken("admin-token"), Admin: true},
+		{Name: "jenkins", TokenHash: hashToken("jenkins-token")},
+	}}
+
+	server := httptest.NewServer(AdminAPI(Groups, Schedules, clients))
+	defer server.Close()
+
+	call := func(t *testing.T, method, path, token string, body interface{}) (int, map[string]interface{}) {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+
+		req, _ := http.NewRequest(method, server.URL+"/api/v1/"+path, bytes.NewBuffer(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error calling the API: %q", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var got map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		return resp.StatusCode, got
+	}
+
+	admin := func(t *testing.T, method, path string, body interface{}, status int) map[string]interface{} {
+		got, resp := call(t, method, path, "admin-token", body)
+		if got != status {
+			t.Fatalf("Incorrect status for %s %s\nGot: %d %+v\nWanted: %d", method, path, got, resp, status)
+		}
+
+		return resp
+	}
+
+	t.Run("The OpenAPI document is served", func(t *testing.T) {
+		status, doc := call(t, http.MethodGet, "openapi.json", "", nil)
+		if status != http.StatusOK || doc["paths"] == nil {
+			t.Fatalf("OpenAPI document not served\nGot: %d", status)
+		}
+	})
+
+	t.Run("Admin tokens are required", func(t *testing.T) {
+		if status, _ := call(t, http.MethodGet, "groups", "", nil); status != http.StatusUnauthorized {
+			t.Fatalf("Incorrect status without a token %d", status)
+		}
+
+		if status, _ := call(t, http.MethodGet, "groups", "jenkins-token", nil); status != http.StatusForbidden {
+			t.Fatalf("Incorrect status for a client that isn't an admin %d", status)
+		}
+	})
+
+	t.Run("Groups are created", func(t *testing.T) {
+		resp := admin(t, http.MethodPost, "groups", map[string]interface{}{
+			"name":    "oncall",
+			"members": []apiMember{{GID: "users/2", Name: "Two"}, {GID: "users/3"}},
+		}, http.StatusCreated)
+
+		if !Groups.IsGroup("oncall") || memberGIDs(Groups["oncall"].Members) != "users/2,users/3" {
+			t.Fatalf("Group not created\nGot: %+v", resp)
+		}
+
+		admin(t, http.MethodPost, "groups", map[string]string{"name": "oncall"}, http.StatusConflict)
+		admin(t, http.MethodPost, "groups", map[string]string{"name": "not a name"}, http.StatusBadRequest)
+		admin(t, http.MethodPost, "groups", map[string]interface{}{"name": "other", "members": []apiMember{{GID: "2"}}}, http.StatusBadRequest)
+		admin(t, http.MethodPost, "groups", map[string]string{"name": strings.Repeat("a", maxAPIBody)}, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("Groups are shown", func(t *testing.T) {
+		resp := admin(t, http.MethodGet, "groups/OnCall", nil, http.StatusOK)
+		if resp["name"] != "oncall" || len(resp["members"].([]interface{})) != 2 {
+			t.Fatalf("Incorrect group\nGot: %+v", resp)
+		}
+
+		admin(t, http.MethodGet, "groups/nothere", nil, http.StatusNotFound)
+		admin(t, http.MethodPut, "groups/oncall", nil, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("Members are added and removed", func(t *testing.T) {
+		admin(t, http.MethodPost, "groups/oncall/members", map[string]interface{}{"members": []apiMember{{GID: "users/4"}, {GID: "users/2"}}}, http.StatusOK)
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/2,users/3,users/4" {
+			t.Fatalf("Members not added\nGot: %q", got)
+		}
+
+		admin(t, http.MethodDelete, "groups/oncall/members/users/3", nil, http.StatusOK)
+		admin(t, http.MethodDelete, "groups/oncall/members", map[string]interface{}{"members": []apiMember{{GID: "users/4"}}}, http.StatusOK)
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/2" {
+			t.Fatalf("Members not removed\nGot: %q", got)
+		}
+
+		admin(t, http.MethodPost, "groups/oncall/members", map[string]interface{}{"members": []apiMember{}}, http.StatusBadRequest)
+		admin(t, http.MethodPost, "groups/nothere/members", map[string]interface{}{"members": []apiMember{{GID: "users/4"}}}, http.StatusNotFound)
+	})
+
+	t.Run("Privacy is set", func(t *testing.T) {
+		group := Groups["oncall"]
+
+		admin(t, http.MethodPut, "groups/oncall/privacy", map[string]interface{}{"private": true, "room": roomGID}, http.StatusOK)
+		if !group.IsPrivate || group.PrivacyRoomID != roomGID {
+			t.Fatalf("Group not restricted\nGot: %+v", group)
+		}
+
+		admin(t, http.MethodPut, "groups/oncall/privacy", map[string]interface{}{"private": true, "room": otherRoomGID}, http.StatusOK)
+		if !group.IsPrivate || group.PrivacyRoomID != otherRoomGID {
+			t.Fatalf("Group not moved to the other room\nGot: %+v", group)
+		}
+
+		resp := admin(t, http.MethodGet, "groups", nil, http.StatusOK)
+		if len(resp["groups"].([]interface{})) != 2 {
+			t.Fatalf("Private groups should be listed for admins\nGot: %+v", resp)
+		}
+
+		admin(t, http.MethodPut, "groups/oncall/privacy", map[string]interface{}{"private": false}, http.StatusOK)
+		if group.IsPrivate || group.PrivacyRoomID != "" {
+			t.Fatalf("Group not made public\nGot: %+v", group)
+		}
+
+		admin(t, http.MethodPut, "groups/oncall/privacy", map[string]interface{}{"private": true}, http.StatusBadRequest)
+	})
+
+	t.Run("Schedules are created, shown and removed", func(t *testing.T) {
+		sendOn := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		resp := admin(t, http.MethodPost, "schedules", apiSchedule{
+			Room:    roomGID,
+			Label:   "standup",
+			Group:   "backend",
+			Message: "standup in 5",
+			Time:    sendOn,
+			Thread:  roomGID + "/threads/1",
+		}, http.StatusCreated)
+
+		schedule := Schedules[roomGID+":standup"]
+		if schedule == nil || !schedule.ExecuteOn.Equal(sendOn) || schedule.GroupID != 7 || schedule.ThreadKey != roomGID+"/threads/1" {
+			t.Fatalf("Schedule not created\nGot: %+v", resp)
+		}
+		defer schedule.stopTimer()
+
+		got := admin(t, http.MethodGet, "schedules/"+roomGID+"/standup", nil, http.StatusOK)
+		if got["group"] != "backend" || got["message"] != "standup in 5" || got["creator"] != "ops" {
+			t.Fatalf("Incorrect schedule\nGot: %+v", got)
+		}
+
+		if list := admin(t, http.MethodGet, "schedules?room="+otherRoomGID, nil, http.StatusOK); len(list["schedules"].([]interface{})) != 0 {
+			t.Fatalf("Schedules of other rooms should not be listed\nGot: %+v", list)
+		}
+
+		admin(t, http.MethodPost, "schedules", apiSchedule{Room: roomGID, Label: "soon", Group: "backend", Message: "hi", Time: time.Now()}, http.StatusBadRequest)
+		admin(t, http.MethodPost, "schedules", apiSchedule{Room: roomGID, Label: "nogroup", Group: "nothere", Message: "hi", Time: sendOn}, http.StatusBadRequest)
+		admin(t, http.MethodPost, "schedules", apiSchedule{Label: "noroom", Group: "backend", Message: "hi", Time: sendOn}, http.StatusBadRequest)
+
+		admin(t, http.MethodDelete, "schedules/"+roomGID+"/standup", nil, http.StatusOK)
+		if _, exists := Schedules[roomGID+":standup"]; exists || !schedule.IsFinished {
+			t.Fatal("Schedule not removed")
+		}
+
+		admin(t, http.MethodDelete, "schedules/"+roomGID+"/standup", nil, http.StatusNotFound)
+	})
+
+	t.Run("Groups are disbanded", func(t *testing.T) {
+		admin(t, http.MethodDelete, "groups/oncall", nil, http.StatusOK)
+		if Groups.IsGroup("oncall") {
+			t.Fatal("Group not disbanded")
+		}
+
+		admin(t, http.MethodDelete, "groups/oncall", nil, http.StatusNotFound)
+	})
+
+	t.Run("A slow body doesn't hold the lock", func(t *testing.T) {
+		body := &stalledBody{reading: make(chan struct{}), release: make(chan struct{})}
+		defer close(body.release)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/groups/backend/members", body)
+		req.Header.Set("Authorization", "Bearer admin-token")
+
+		go AdminAPI(Groups, Schedules, clients)(httptest.NewRecorder(), req)
+		<-body.reading
+
+		locked := make(chan struct{})
+		go func() {
+			stateLock.Lock()
+			stateLock.Unlock()
+			close(locked)
+		}()
+
+		select {
+		case <-locked:
+		case <-time.After(time.Second * 5):
+			t.Fatal("Lock held while the body was being read")
+		}
+	})
+}
+
+//stalledBody is a request body that blocks once it's read, until released
+type stalledBody struct {
+	reading chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *stalledBody) Read(p []byte) (int, error) {
+	b.once.Do(func() { close(b.reading) })
+	<-b.release
+
+	return 0, io.EOF
+}
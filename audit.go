@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//historyLimit is how many audit entries the history command shows
+const historyLimit = 10
+
+//AuditEntry defines the database schema for the audit trail. Every change to
+//a group or schedule records who made it, where, and what the group's members
+//were before and after. Before and After hold comma separated member GIDs.
+type AuditEntry struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	ActorGID  string    `gorm:"not null"`
+	RoomGID   string    `gorm:"not null"`
+	Action    string    `gorm:"not null"`
+	GroupName string    `gorm:"not null;index"`
+	Schedule  string    `gorm:"not null;index"`
+	Before    string    `gorm:"type:text"`
+	After     string    `gorm:"type:text"`
+	Detail    string    `gorm:"type:varchar(4000)"`
+}
+
+//newAuditEntry starts an audit entry for the sender of the message
+func newAuditEntry(action, groupName string, msgObj messageResponse) *AuditEntry {
+	return &AuditEntry{
+		CreatedAt: time.Now(),
+		ActorGID:  msgObj.Message.Sender.GID,
+		RoomGID:   msgObj.Room.GID,
+		Action:    action,
+		GroupName: strings.ToLower(groupName),
+	}
+}
+
+//auditGroup records a change to the group's members or settings. before are
+//the members the group had before the change, and the group's current members
+//are taken as after.
+func auditGroup(action string, group *Group, before []Member, msgObj messageResponse, detail string) {
+	entry := newGroupAudit(action, group, before, msgObj, detail)
+
+	go Logger.SaveAuditEntry(entry)
+	Webhooks.Fire(entry)
+}
+
+//newGroupAudit builds the audit entry for a change to the group, without
+//saving it
+func newGroupAudit(action string, group *Group, before []Member, msgObj messageResponse, detail string) *AuditEntry {
+	entry := newAuditEntry(action, group.Name, msgObj)
+	entry.Before = memberGIDs(before)
+	entry.After = memberGIDs(group.Members)
+	entry.Detail = detail
+
+	return entry
+}
+
+//auditSchedule records a change to the schedule stored under schedKey
+func auditSchedule(action, groupName, schedKey string, msgObj messageResponse, detail string) {
+	entry := newAuditEntry(action, groupName, msgObj)
+	entry.Schedule = schedKey
+	entry.Detail = detail
+
+	go Logger.SaveAuditEntry(entry)
+}
+
+//memberGIDs joins the GIDs of the members so they can be stored in one column
+func memberGIDs(members []Member) string {
+	gids := make([]string, 0, len(members))
+	for _, member := range members {
+		gids = append(gids, member.GID)
+	}
+
+	return strings.Join(gids, ",")
+}
+
+//membersFromGIDs turns a stored list of GIDs back into members. People who
+//aren't in the user directory are named by their GID.
+func membersFromGIDs(gids string) []Member {
+	var members []Member
+	for _, gid := range strings.Split(gids, ",") {
+		if gid != "" {
+			members = append(members, Member{GID: gid, Name: Users.Name(gid, gid)})
+		}
+	}
+
+	return members
+}
+
+//String lays the entry out as when, who, and what happened, followed by any
+//member changes in the same form as a membership diff.
+func (e AuditEntry) String() string {
+	text := fmt.Sprintf("%s %s %s",
+		e.CreatedAt.Format("2006-01-02 15:04 MST"),
+		Users.Name(e.ActorGID, e.ActorGID),
+		e.Action,
+	)
+
+	if e.Detail != "" {
+		text += " " + e.Detail
+	}
+
+	diff := diffMembers(e.GroupName, membersFromGIDs(e.Before), membersFromGIDs(e.After))
+	if diff.HasChanges() {
+		text += strings.TrimPrefix(diff.String(), diff.GroupName+":")
+	}
+
+	return text
+}
+
+//History method shows the latest changes made to the group, newest first.
+//Disbanded groups can only be looked up by admins and auditors, since there's
+//no longer a group to check the privacy of.
+func (gm GroupMap) History(groupName string, msgObj messageResponse) string {
+	if groupName == "" {
+		return fmt.Sprintf("You'd need to pass a group name for me to look up its history. ```%s```", usage("history"))
+	}
+
+	saveName, meta := gm.checkGroup(groupName, msgObj)
+	if !strings.Contains(meta, "name") {
+		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
+	}
+
+	if !strings.Contains(meta, "exist") && !msgObj.FromMaster && !auditing(msgObj) {
+		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
+	}
+
+	if strings.Contains(meta, "private") && !strings.Contains(meta, "audit") {
+		return fmt.Sprintf("The group %q is private, and you may not view it.", groupName)
+	}
+
+	//Only a group that no longer exists shows the history of every group
+	//that's had its name
+	entries := Logger.GetGroupHistory(saveName, strings.Contains(meta, "exist"), historyLimit)
+	if len(entries) == 0 {
+		return fmt.Sprintf("I don't have any history for %q.", groupName)
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+
+	return fmt.Sprintf("Here are the latest changes to %q: ```%s```", groupName, strings.Join(lines, "\n"))
+}
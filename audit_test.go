@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemberGIDs(t *testing.T) {
+	members := []Member{{GID: genUserGID(0)}, {GID: genUserGID(0)}}
+
+	t.Run("Round trips member GIDs", func(t *testing.T) {
+		got := membersFromGIDs(memberGIDs(members))
+
+		if len(got) != len(members) {
+			t.Fatalf("Incorrect number of members\nWanted: %d\nGot: %d", len(members), len(got))
+		}
+
+		for i := range members {
+			if got[i].GID != members[i].GID {
+				t.Fatalf("Incorrect member GID\nWanted: %q\nGot: %q", members[i].GID, got[i].GID)
+			}
+		}
+	})
+
+	t.Run("Empty list has no members", func(t *testing.T) {
+		if got := membersFromGIDs(memberGIDs(nil)); len(got) != 0 {
+			t.Fatalf("Expected no members, got: %+v", got)
+		}
+	})
+}
+
+func TestAuditEntryString(t *testing.T) {
+	Logger.Active(false)
+
+	actor := User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"}
+	removed := genUserGID(0)
+	kept := genUserGID(0)
+
+	Users.Observe(actor)
+
+	entry := AuditEntry{
+		CreatedAt: time.Now(),
+		ActorGID:  actor.GID,
+		Action:    "remove",
+		GroupName: "oncall",
+		Before:    kept + "," + removed,
+		After:     kept,
+	}
+
+	text := entry.String()
+
+	t.Run("Shows who made the change", func(t *testing.T) {
+		if !strings.Contains(text, actor.Name+" remove") {
+			t.Fatalf("Actor and action not shown\nGot: %q", text)
+		}
+	})
+
+	t.Run("Shows the removed member", func(t *testing.T) {
+		if !strings.Contains(text, "- "+removed) || strings.Contains(text, kept) {
+			t.Fatalf("Incorrect member changes shown\nGot: %q", text)
+		}
+	})
+}
+
+func TestHistory(t *testing.T) {
+	Logger.Active(false)
+
+	Groups := make(GroupMap)
+	saveName := strings.ToLower(genRandName(10))
+
+	Groups[saveName] = &Group{
+		Name:          saveName,
+		IsPrivate:     true,
+		PrivacyRoomID: genRoomGID(0),
+	}
+
+	msgObj := messageResponse{
+		Message: message{Sender: User{GID: genUserGID(0)}},
+		Room:    space{GID: genRoomGID(0), Type: "ROOM"},
+	}
+
+	t.Run("Asks for a group name", func(t *testing.T) {
+		if text := Groups.History("", msgObj); !strings.Contains(text, "pass a group name") {
+			t.Fatalf("Group name not asked for\nGot: %q", text)
+		}
+	})
+
+	t.Run("Hides private groups", func(t *testing.T) {
+		if text := Groups.History(saveName, msgObj); !strings.Contains(text, "is private") {
+			t.Fatalf("Private group history was shown\nGot: %q", text)
+		}
+	})
+
+	t.Run("Hides disbanded groups from regular users", func(t *testing.T) {
+		if text := Groups.History(genRandName(10), msgObj); !strings.Contains(text, "does not seem to exist") {
+			t.Fatalf("Disbanded group history was shown\nGot: %q", text)
+		}
+	})
+
+	t.Run("Shows disbanded groups to admins", func(t *testing.T) {
+		adminMsg := msgObj
+		adminMsg.FromMaster = true
+
+		if text := Groups.History(genRandName(10), adminMsg); !strings.Contains(text, "don't have any history") {
+			t.Fatalf("Disbanded group history was not looked up\nGot: %q", text)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//Reply is the message sent back to Google Chat. Replies with cards keep their
+//text as the fallback, which is shown wherever the cards can't be, such as
+//notifications.
+type Reply struct {
+	Text           string          `json:"text,omitempty"`
+	FallbackText   string          `json:"fallbackText,omitempty"`
+	CardsV2        []CardV2        `json:"cardsV2,omitempty"`
+	ActionResponse *ActionResponse `json:"actionResponse,omitempty"`
+}
+
+//CardV2 is a card along with the ID it's sent under
+type CardV2 struct {
+	CardID string `json:"cardId"`
+	Card   Card   `json:"card"`
+}
+
+//Card is laid out as a header followed by sections of widgets
+type Card struct {
+	Header   *CardHeader   `json:"header,omitempty"`
+	Sections []CardSection `json:"sections"`
+}
+
+//CardHeader is the title shown at the top of a card
+type CardHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+//CardSection groups widgets under an optional header. Collapsible sections
+//only show their first UncollapsibleWidgetsCount widgets until expanded.
+type CardSection struct {
+	Header                    string   `json:"header,omitempty"`
+	Collapsible               bool     `json:"collapsible,omitempty"`
+	UncollapsibleWidgetsCount int      `json:"uncollapsibleWidgetsCount,omitempty"`
+	Widgets                   []Widget `json:"widgets"`
+}
+
+//Widget holds exactly one of the kinds of widget
+type Widget struct {
+	DecoratedText *DecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *TextParagraph `json:"textParagraph,omitempty"`
+	ButtonList    *ButtonList    `json:"buttonList,omitempty"`
+}
+
+//DecoratedText is a key/value widget, with the key as the top label. It can
+//have a button at its end.
+type DecoratedText struct {
+	TopLabel    string  `json:"topLabel,omitempty"`
+	Text        string  `json:"text"`
+	BottomLabel string  `json:"bottomLabel,omitempty"`
+	WrapText    bool    `json:"wrapText,omitempty"`
+	Button      *Button `json:"button,omitempty"`
+}
+
+//TextParagraph is a block of text
+type TextParagraph struct {
+	Text string `json:"text"`
+}
+
+//ButtonList is a row of buttons
+type ButtonList struct {
+	Buttons []Button `json:"buttons"`
+}
+
+//Button runs the action when it's clicked
+type Button struct {
+	Text    string  `json:"text"`
+	OnClick OnClick `json:"onClick"`
+}
+
+//OnClick is what happens when a button is clicked
+type OnClick struct {
+	Action *CardAction `json:"action,omitempty"`
+}
+
+//CardAction names the command a button runs, and the arguments it's run with.
+//Google sends these back in a CARD_CLICKED event.
+type CardAction struct {
+	Function   string            `json:"function"`
+	Parameters []ActionParameter `json:"parameters,omitempty"`
+}
+
+//ActionParameter is one of the arguments of a card action
+type ActionParameter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+//newReply builds the reply for a command. The card is used when there is one
+//and cards are turned on, otherwise the text is sent as is.
+func newReply(text string, card *CardV2) Reply {
+	if !UseCards || card == nil {
+		return Reply{Text: text}
+	}
+
+	return Reply{FallbackText: text, CardsV2: []CardV2{*card}}
+}
+
+//writeReply sends the reply as the response to Google's request
+func writeReply(w http.ResponseWriter, reply Reply) {
+	jsonResp, err := json.Marshal(reply)
+	checkError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s", string(jsonResp))
+}
+
+//commandButton builds a button that runs the command as if the person who
+//clicked it had typed it. The parameters are passed in order after the
+//command's name.
+func commandButton(text, command string, params ...ActionParameter) Button {
+	return Button{
+		Text: text,
+		OnClick: OnClick{Action: &CardAction{
+			Function:   command,
+			Parameters: params,
+		}},
+	}
+}
+
+//helpCard lays out every command that isn't hidden, a section for each
+func helpCard() *CardV2 {
+	card := Card{
+		Header: &CardHeader{
+			Title:    BotName,
+			Subtitle: strings.Trim(usage("usageShort"), "`"),
+		},
+	}
+
+	for _, cmd := range Commands.commands {
+		if cmd.Hidden {
+			continue
+		}
+
+		section := CardSection{Header: cmd.Name}
+
+		commands := []*Command{cmd}
+		prefix := ""
+		if len(cmd.Subcommands) > 0 {
+			commands = cmd.Subcommands
+			prefix = cmd.Name + " "
+		}
+
+		for _, c := range commands {
+			section.Widgets = append(section.Widgets, Widget{DecoratedText: &DecoratedText{
+				TopLabel: c.usageLine(prefix),
+				Text:     c.Help,
+				WrapText: true,
+			}})
+		}
+
+		card.Sections = append(card.Sections, section)
+	}
+
+	card.Sections = append(card.Sections, CardSection{Widgets: []Widget{{ButtonList: &ButtonList{Buttons: []Button{
+		commandButton("List groups", "list"),
+		commandButton("Scheduled messages", "schedule", ActionParameter{Key: "subAction", Value: "list"}),
+	}}}}})
+
+	return &CardV2{CardID: "help", Card: card}
+}
+
+//ListCard method lays out the same groups as List. With no groupName each
+//usable group gets a button for its details, otherwise the group's members are
+//listed. nil is returned whenever List would reply with an error.
+func (gm GroupMap) ListCard(groupName string, msgObj messageResponse) *CardV2 {
+	if groupName == "" {
+		var widgets []Widget
+
+		names := make([]string, 0, len(gm))
+		for name := range gm {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if _, meta := gm.checkGroup(name, msgObj); strings.Contains(meta, "private") && !strings.Contains(meta, "audit") {
+				continue
+			}
+
+			group := gm[name]
+			details := commandButton("Details", "list", ActionParameter{Key: "groupName", Value: group.Name})
+
+			widgets = append(widgets, Widget{DecoratedText: &DecoratedText{
+				Text:        group.Name,
+				BottomLabel: groupSummary(group),
+				Button:      &details,
+			}})
+		}
+
+		if len(widgets) == 0 {
+			return nil
+		}
+
+		return &CardV2{
+			CardID: "groups",
+			Card: Card{
+				Header:   &CardHeader{Title: "Groups", Subtitle: "Private groups you can't use here aren't listed"},
+				Sections: []CardSection{{Widgets: widgets}},
+			},
+		}
+	}
+
+	saveName, meta := gm.checkGroup(groupName, msgObj)
+	if !strings.Contains(meta, "exist") || (strings.Contains(meta, "private") && !strings.Contains(meta, "audit")) {
+		return nil
+	}
+
+	group := gm[saveName]
+
+	section := CardSection{Header: "Members"}
+	if len(group.Members) > 10 {
+		section.Collapsible = true
+		section.UncollapsibleWidgetsCount = 10
+	}
+
+	for _, member := range group.Members {
+		section.Widgets = append(section.Widgets, Widget{DecoratedText: &DecoratedText{
+			Text:        member.Name,
+			BottomLabel: member.GID,
+		}})
+	}
+
+	if len(section.Widgets) == 0 {
+		section.Widgets = []Widget{{TextParagraph: &TextParagraph{Text: "This group has no members."}}}
+	}
+
+	return &CardV2{
+		CardID: "group",
+		Card: Card{
+			Header:   &CardHeader{Title: group.Name, Subtitle: groupSummary(group)},
+			Sections: []CardSection{section},
+		},
+	}
+}
+
+//groupSummary describes the group's size and privacy in a few words
+func groupSummary(group *Group) string {
+	summary := fmt.Sprintf("%d members", len(group.Members))
+	if len(group.Members) == 1 {
+		summary = "1 member"
+	}
+
+	if group.IsPrivate {
+		summary += ", private"
+	}
+
+	if group.RoomRemoved {
+		summary += ", room removed"
+	}
+
+	return summary
+}
+
+//ListCard lays out the room's upcoming scheduled messages, soonest first. nil
+//is returned when there aren't any.
+func (sm ScheduleMap) ListCard(msgObj messageResponse) *CardV2 {
+	var schedules []*Schedule
+	for schedKey, schedule := range sm {
+		if !schedule.IsFinished && strings.Split(schedKey, ":")[0] == msgObj.Room.GID {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	if len(schedules) == 0 {
+		return nil
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ExecuteOn.Before(schedules[j].ExecuteOn)
+	})
+
+	var sections []CardSection
+	for _, schedule := range schedules {
+		sendOn := "Sends " + schedule.ExecuteOn.Format("Mon Jan 2, 2006 3:04 PM MST")
+		if schedule.IsRecurring {
+			sendOn += ", weekly"
+		}
+
+		if schedule.IsPaused {
+			sendOn += ", paused"
+		}
+
+		sections = append(sections, CardSection{
+			Header: schedule.MessageLabel,
+			Widgets: []Widget{
+				{DecoratedText: &DecoratedText{TopLabel: sendOn, Text: schedule.MessageText, WrapText: true}},
+				{DecoratedText: &DecoratedText{TopLabel: "Created by", Text: schedule.Creator}},
+			},
+		})
+	}
+
+	return &CardV2{
+		CardID: "schedules",
+		Card: Card{
+			Header:   &CardHeader{Title: "Scheduled messages", Subtitle: "Upcoming messages for this room"},
+			Sections: sections,
+		},
+	}
+}
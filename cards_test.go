@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewReply(t *testing.T) {
+	useCards := UseCards
+	defer func() { UseCards = useCards }()
+
+	card := &CardV2{CardID: "test"}
+
+	t.Run("Card sent with text as the fallback", func(t *testing.T) {
+		UseCards = true
+		reply := newReply("some text", card)
+
+		if reply.Text != "" || reply.FallbackText != "some text" || len(reply.CardsV2) != 1 {
+			t.Fatalf("Card reply not built\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Text sent alone without a card", func(t *testing.T) {
+		UseCards = true
+
+		if reply := newReply("some text", nil); reply.Text != "some text" || reply.CardsV2 != nil {
+			t.Fatalf("Text reply not built\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Text sent alone when cards are off", func(t *testing.T) {
+		UseCards = false
+
+		if reply := newReply("some text", card); reply.Text != "some text" || reply.CardsV2 != nil {
+			t.Fatalf("Text reply not built\nGot: %+v", reply)
+		}
+	})
+}
+
+func TestHelpCard(t *testing.T) {
+	card := helpCard()
+
+	var headers []string
+	for _, section := range card.Card.Sections {
+		if section.Header != "" {
+			headers = append(headers, section.Header)
+		}
+	}
+
+	if strings.Join(headers, " ") != "create add remove disband restrict unsync list whois history notify schedule export admin help" {
+		t.Fatalf("Incorrect sections\nGot: %q", headers)
+	}
+
+	schedule := card.Card.Sections[10]
+	if len(schedule.Widgets) != 4 || schedule.Widgets[0].DecoratedText.TopLabel != "schedule onetime <label> <time RFC3339> <groupName> <Message>" {
+		t.Fatalf("Subcommands not laid out\nGot: %+v", schedule.Widgets[0].DecoratedText)
+	}
+}
+
+func TestListCard(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	msgObj := messageResponse{Room: space{GID: roomGID, Type: "ROOM"}, Message: message{Sender: User{GID: genUserGID(0)}}}
+
+	Groups := GroupMap{
+		"backend": &Group{Name: "Backend", Members: []Member{{Name: "Some One", GID: "users/1"}}},
+		"secret":  &Group{Name: "Secret", IsPrivate: true, PrivacyRoomID: genRoomGID(10)},
+		"local":   &Group{Name: "Local", IsPrivate: true, PrivacyRoomID: roomGID},
+	}
+
+	t.Run("Lists usable groups with buttons", func(t *testing.T) {
+		card := Groups.ListCard("", msgObj)
+		if card == nil {
+			t.Fatal("No card returned")
+		}
+
+		var names []string
+		for _, widget := range card.Card.Sections[0].Widgets {
+			names = append(names, widget.DecoratedText.Text)
+
+			action := widget.DecoratedText.Button.OnClick.Action
+			if action.Function != "list" || action.Parameters[0].Value != widget.DecoratedText.Text {
+				t.Fatalf("Incorrect button\nGot: %+v", action)
+			}
+		}
+
+		if strings.Join(names, " ") != "Backend Local" {
+			t.Fatalf("Incorrect groups listed\nGot: %q", names)
+		}
+	})
+
+	t.Run("Shows a group's members", func(t *testing.T) {
+		card := Groups.ListCard("BACKEND", msgObj)
+		if card == nil {
+			t.Fatal("No card returned")
+		}
+
+		member := card.Card.Sections[0].Widgets[0].DecoratedText
+		if card.Card.Header.Subtitle != "1 member" || member.Text != "Some One" || member.BottomLabel != "users/1" {
+			t.Fatalf("Incorrect group details\nGot: %+v %+v", card.Card.Header, member)
+		}
+	})
+
+	t.Run("No card for private or missing groups", func(t *testing.T) {
+		if Groups.ListCard("secret", msgObj) != nil || Groups.ListCard("missing", msgObj) != nil {
+			t.Fatal("Card should not be returned")
+		}
+	})
+}
+
+func TestScheduleListCard(t *testing.T) {
+	roomGID := genRoomGID(10)
+	now := time.Now()
+
+	Schedules := ScheduleMap{
+		roomGID + ":later":       &Schedule{MessageLabel: "later", MessageText: "Later", ExecuteOn: now.Add(2 * time.Hour)},
+		roomGID + ":sooner":      &Schedule{MessageLabel: "sooner", MessageText: "Sooner", ExecuteOn: now.Add(time.Hour), IsRecurring: true},
+		roomGID + ":done":        &Schedule{MessageLabel: "done", ExecuteOn: now, IsFinished: true},
+		genRoomGID(10) + ":else": &Schedule{MessageLabel: "else", ExecuteOn: now},
+	}
+
+	card := Schedules.ListCard(messageResponse{Room: space{GID: roomGID}})
+	if card == nil {
+		t.Fatal("No card returned")
+	}
+
+	sections := card.Card.Sections
+	if len(sections) != 2 || sections[0].Header != "sooner" || sections[1].Header != "later" {
+		t.Fatalf("Incorrect schedules listed\nGot: %+v", sections)
+	}
+
+	if !strings.HasSuffix(sections[0].Widgets[0].DecoratedText.TopLabel, ", weekly") {
+		t.Fatalf("Recurring schedule not marked\nGot: %q", sections[0].Widgets[0].DecoratedText.TopLabel)
+	}
+
+	if (ScheduleMap{}).ListCard(messageResponse{Room: space{GID: roomGID}}) != nil {
+		t.Fatal("Card should not be returned without schedules")
+	}
+}
+
+func TestCardResponses(t *testing.T) {
+	Logger.Active(false)
+
+	useCards := UseCards
+	defer func() { UseCards = useCards }()
+	UseCards = true
+
+	Groups := GroupMap{"backend": &Group{Name: "backend", Members: []Member{{Name: "Some One", GID: "users/1"}}}}
+	server := httptest.NewServer(getRequestHandler(Groups, ScheduleMap{}))
+	defer server.Close()
+
+	post := func(t *testing.T, event map[string]interface{}) Reply {
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Error posting data: %q", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var reply Reply
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+
+		return reply
+	}
+
+	room := map[string]string{"name": "spaces/spaceName", "type": "ROOM"}
+	person := map[string]string{"name": "users/1234567890", "displayName": "Person Name", "type": "HUMAN"}
+
+	t.Run("Messages get cards", func(t *testing.T) {
+		reply := post(t, map[string]interface{}{
+			"type":    "MESSAGE",
+			"space":   room,
+			"message": map[string]interface{}{"sender": person, "text": BotName + " list"},
+		})
+
+		if len(reply.CardsV2) != 1 || reply.CardsV2[0].CardID != "groups" || !strings.Contains(reply.FallbackText, "backend") {
+			t.Fatalf("Card not sent\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Errors are sent as text", func(t *testing.T) {
+		reply := post(t, map[string]interface{}{
+			"type":    "MESSAGE",
+			"space":   room,
+			"message": map[string]interface{}{"sender": person, "text": BotName + " list nothere"},
+		})
+
+		if reply.CardsV2 != nil || !strings.Contains(reply.Text, "does not seem to exist") {
+			t.Fatalf("Text not sent\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Clicked buttons run their command", func(t *testing.T) {
+		reply := post(t, map[string]interface{}{
+			"type":    "CARD_CLICKED",
+			"space":   room,
+			"user":    person,
+			"message": map[string]interface{}{"sender": map[string]string{"name": "users/bot", "type": "BOT"}},
+			"action": map[string]interface{}{
+				"actionMethodName": "list",
+				"parameters":       []map[string]string{{"key": "groupName", "value": "backend"}},
+			},
+		})
+
+		if len(reply.CardsV2) != 1 || reply.CardsV2[0].CardID != "group" {
+			t.Fatalf("Button's command not run\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Added to a room gets the help card", func(t *testing.T) {
+		reply := post(t, map[string]interface{}{"type": "ADDED_TO_SPACE", "space": room})
+
+		if len(reply.CardsV2) != 1 || reply.CardsV2[0].CardID != "help" || !strings.Contains(reply.Text, "Here's what I'm about") {
+			t.Fatalf("Help card not sent\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Cards can be turned off", func(t *testing.T) {
+		UseCards = false
+		defer func() { UseCards = true }()
+
+		reply := post(t, map[string]interface{}{
+			"type":    "MESSAGE",
+			"space":   room,
+			"message": map[string]interface{}{"sender": person, "text": fmt.Sprintf("%s list", BotName)},
+		})
+
+		if reply.CardsV2 != nil || !strings.Contains(reply.Text, "backend") {
+			t.Fatalf("Text not sent\nGot: %+v", reply)
+		}
+	})
+}
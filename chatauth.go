@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -15,11 +16,9 @@ import (
 // Grabbing config information for contact with Hangouts Chat's api.
 var serviceKeyPath = os.Getenv("CHAT_SERVICE_KEY_PATH")
 
-// The first time the token is receieved and validated, it'll be set to this
-// variable. So as to not make a request every time someone makes uses the
-// bot. If I find out that more than one token is used ( which I don't think
-// there should be ), I'll make this into an arrally
-var cachedAuthToken string
+// Every token is validated on its own, but google's keys are cached by the
+// validator so a request isn't made every time someone uses the bot.
+var jwtValidator = newValidator(&http.Client{Timeout: keyFetchTimeout}, Config.Audience)
 
 func getChatService(client *http.Client) *chat.Service {
 	service, err := chat.New(client)
@@ -30,12 +29,12 @@ func getChatService(client *http.Client) *chat.Service {
 	return service
 }
 
-func getChatClient() *http.Client {
+func getChatClient() (*http.Client, error) {
 	ctx := context.Background()
 
 	data, err := ioutil.ReadFile(serviceKeyPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	creds, err := google.CredentialsFromJSON(
@@ -44,27 +43,38 @@ func getChatClient() *http.Client {
 		"https://www.googleapis.com/auth/chat.bot",
 	)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return oauth2.NewClient(ctx, creds.TokenSource)
+	return oauth2.NewClient(ctx, creds.TokenSource), nil
 }
 
-func isValidRequest(authToken string) bool {
-	if authToken == cachedAuthToken {
-		return true
+//setupChat builds the one client the bot talks to the Chat API with, and
+//sends messages and lists room members with it. Only when SERVICE_SEND is true
+//is the Chat API used, since that needs the service account's key, otherwise
+//messages are only logged and rooms can't be listed.
+func setupChat(config HGNConfig) error {
+	if config.ServiceSend != "true" {
+		return nil
 	}
 
+	client, err := getChatClient()
+	if err != nil {
+		return fmt.Errorf("couldn't set up the Chat API with the key at CHAT_SERVICE_KEY_PATH: %s", err.Error())
+	}
+
+	Messages = newChatMessenger(client, config.ChatAPIURL)
+	Rooms = newChatRoster(client, config.ChatAPIURL)
+
+	return nil
+}
+
+func isValidRequest(authToken string) bool {
 	verified, err := validateJWT(authToken)
 	if err != nil {
 		log.Println("Error validating auth token: ", err.Error())
 		return false
 	}
 
-	if verified {
-		cachedAuthToken = authToken
-		return true
-	}
-
-	return false
+	return verified
 }
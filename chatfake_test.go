@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	chat "google.golang.org/api/chat/v1"
+)
+
+//fakeChat stands in for Google's Chat REST API, keeping the messages posted to
+//it so tests can check what would've been sent, and listing the memberships
+//set for each room
+type fakeChat struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	messages    []SentMessage
+	memberships map[string][]*chat.Membership
+	failWith    int
+}
+
+//newFakeChat starts the stand-in, which should be closed once the test is done
+func newFakeChat() *fakeChat {
+	fc := &fakeChat{memberships: make(map[string][]*chat.Membership)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/spaces/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/members") {
+			fc.listMembers(w, r)
+			return
+		}
+
+		fc.createMessage(w, r)
+	})
+
+	fc.Server = httptest.NewServer(mux)
+
+	return fc
+}
+
+//messenger sends through the stand-in
+func (fc *fakeChat) messenger() *ChatMessenger {
+	return newChatMessenger(fc.Client(), fc.URL)
+}
+
+//roster lists room members through the stand-in
+func (fc *fakeChat) roster() *ChatRoster {
+	return newChatRoster(fc.Client(), fc.URL)
+}
+
+//setMembers sets who's in the room. Users are joined unless their Type is
+//given as a membership state, such as INVITED.
+func (fc *fakeChat) setMembers(room string, users ...User) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	var memberships []*chat.Membership
+	for _, user := range users {
+		state, userType := "JOINED", user.Type
+		if userType != "HUMAN" && userType != "BOT" {
+			state, userType = userType, "HUMAN"
+		}
+
+		memberships = append(memberships, &chat.Membership{
+			Name:   room + "/members/" + strings.TrimPrefix(user.GID, "users/"),
+			State:  state,
+			Member: &chat.User{Name: user.GID, DisplayName: user.Name, Type: userType},
+		})
+	}
+
+	fc.memberships[room] = memberships
+}
+
+//listMembers handles spaces.members.list, two memberships to a page
+func (fc *fakeChat) listMembers(w http.ResponseWriter, r *http.Request) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.failWith != 0 {
+		http.Error(w, `{"error": {"message": "failed"}}`, fc.failWith)
+		return
+	}
+
+	room := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/members")
+	memberships, exist := fc.memberships[room]
+	if !exist {
+		http.Error(w, `{"error": {"message": "not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	end := start + 2
+
+	page := chat.ListMembershipsResponse{}
+	if end < len(memberships) {
+		page.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(memberships)
+	}
+
+	if start < end {
+		page.Memberships = memberships[start:end]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+//createMessage handles spaces.messages.create
+func (fc *fakeChat) createMessage(w http.ResponseWriter, r *http.Request) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	parent := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if r.Method != http.MethodPost || !strings.HasSuffix(parent, "/messages") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if fc.failWith != 0 {
+		http.Error(w, `{"error": {"message": "failed"}}`, fc.failWith)
+		return
+	}
+
+	var msg struct {
+		Text   string `json:"text"`
+		Thread struct {
+			Name string `json:"name"`
+		} `json:"thread"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	room := strings.TrimSuffix(parent, "/messages")
+	fc.messages = append(fc.messages, SentMessage{Room: room, Thread: msg.Thread.Name, Text: msg.Text})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":   room + "/messages/1",
+		"text":   msg.Text,
+		"thread": map[string]string{"name": msg.Thread.Name},
+	})
+}
+
+//sent lists the messages posted so far
+func (fc *fakeChat) sent() []SentMessage {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	return append([]SentMessage(nil), fc.messages...)
+}
+
+//SentMessage is a message kept by the MessageRecorder
+type SentMessage struct {
+	Room   string
+	Thread string
+	Text   string
+}
+
+//MessageRecorder keeps the messages it's given in memory rather than sending
+//them
+type MessageRecorder struct {
+	mu       sync.Mutex
+	messages []SentMessage
+	Err      error
+}
+
+//Send records the message, failing with Err if it's set
+func (mr *MessageRecorder) Send(room, thread, text string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.Err != nil {
+		return mr.Err
+	}
+
+	mr.messages = append(mr.messages, SentMessage{Room: room, Thread: thread, Text: text})
+	return nil
+}
+
+//Messages lists every message recorded so far
+func (mr *MessageRecorder) Messages() []SentMessage {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return append([]SentMessage(nil), mr.messages...)
+}
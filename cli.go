@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//cliUsage is printed when the command line is called with a command it
+//doesn't know
+const cliUsage = `Usage:
+  hgnotify                    runs the bot
+  hgnotify export [--json] [groupName...]
+                              prints the groups, or every group, as YAML or JSON
+  hgnotify import [--merge|--replace|--skip] [--dry-run] [--offline] [file]
+                              loads the groups from an export, read from stdin
+                              when there's no file or it's -
+`
+
+//cliMsgObj is who changes made from the command line are made by. It can see
+//and change every group, the same as the bot's admin.
+var cliMsgObj = messageResponse{
+	Message:    message{Sender: User{Name: "hgnotify", GID: "cli", Type: "HUMAN"}},
+	FromMaster: true,
+}
+
+//runCLI runs the command given on the command line against the groups, in
+//place of running the bot, and returns the code to exit with.
+func runCLI(args []string, Groups GroupMap, stdin io.Reader, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "export":
+		return cliExport(args[1:], Groups, stdout, stderr)
+	case "import":
+		return cliImport(args[1:], Groups, stdin, stdout, stderr)
+	}
+
+	fmt.Fprintf(stderr, "Unknown command %q\n%s", args[0], cliUsage)
+	return 2
+}
+
+//cliExport prints the named groups, or every group, as YAML or JSON
+func cliExport(args []string, Groups GroupMap, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print JSON instead of YAML")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	doc, err := Groups.exportGroups(flags.Args(), cliMsgObj)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	data, err := marshalExport(doc, *asJSON)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	stdout.Write(data)
+	if *asJSON {
+		fmt.Fprintln(stdout)
+	}
+
+	return 0
+}
+
+//cliImport loads the groups from an export, printing what was changed. There's
+//nobody to confirm with, so --dry-run is how to check the changes first. A
+//running bot only reads the database at startup, so without replicas to feed
+//the changes to, the import is refused unless --offline says the bot is
+//stopped.
+func cliImport(args []string, Groups GroupMap, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	policies := map[string]*bool{
+		ImportMerge:   flags.Bool(ImportMerge, false, "add the missing members to groups that exist (default)"),
+		ImportReplace: flags.Bool(ImportReplace, false, "make groups that exist match the import"),
+		ImportSkip:    flags.Bool(ImportSkip, false, "leave groups that exist alone"),
+	}
+	dryRun := flags.Bool("dry-run", false, "only print what would change")
+	offline := flags.Bool("offline", false, "the bot is stopped, so the database can be changed directly")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	policy := ImportMerge
+	picked := 0
+	for name, set := range policies {
+		if *set {
+			policy = name
+			picked++
+		}
+	}
+
+	if picked > 1 || flags.NArg() > 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if path := flags.Arg(0); path != "" && path != "-" {
+		data, err = ioutil.ReadFile(path)
+	} else {
+		data, err = ioutil.ReadAll(stdin)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	//The groups manifest has to be read to know which groups to leave to it
+	if Manifest.Path != "" {
+		manifest, modTime, err := Manifest.load()
+		if err != nil {
+			fmt.Fprintf(stderr, "Couldn't read the groups manifest, %s\n", err.Error())
+			return 1
+		}
+
+		Manifest.track(manifest, modTime, false)
+	}
+
+	plan, err := previewImport(Groups, string(data), policy)
+	if err != nil {
+		fmt.Fprintf(stderr, "Couldn't read the import, %s\n", err.Error())
+		return 1
+	}
+
+	if !plan.HasChanges() {
+		fmt.Fprintln(stdout, "Nothing to import, the groups already match.")
+		return 0
+	}
+
+	fmt.Fprintln(stdout, plan.String())
+
+	if *dryRun {
+		fmt.Fprintln(stdout, "Dry run, nothing was changed.")
+		return 0
+	}
+
+	if ReplicaID == "" && !*offline {
+		fmt.Fprintln(stderr, "A running bot wouldn't see the import until it restarts, and could overwrite it. Stop the bot and pass --offline, or set HGNOTIFY_REPLICA_ID so the running replicas pick up the changes.")
+		return 1
+	}
+
+	Groups.applyImport(plan, importDetail, cliMsgObj)
+	pendingSaves.Wait()
+
+	fmt.Fprintln(stdout, "Imported.")
+
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	Groups := GroupMap{
+		"backend": &Group{Name: "backend", Members: []Member{{GID: "users/1"}}},
+		"oncall":  &Group{Name: "oncall", IsPrivate: true, PrivacyRoomID: roomGID},
+	}
+
+	run := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(args, Groups, strings.NewReader(stdin), &stdout, &stderr)
+
+		return code, stdout.String(), stderr.String()
+	}
+
+	t.Run("Exports every group", func(t *testing.T) {
+		code, out, _ := run("", "export")
+
+		if code != 0 || !strings.Contains(out, "groupName: backend") || !strings.Contains(out, "room: "+roomGID) {
+			t.Fatalf("Incorrect export\nGot: %d %q", code, out)
+		}
+	})
+
+	t.Run("Exports as JSON", func(t *testing.T) {
+		if code, out, _ := run("", "export", "--json", "backend"); code != 0 || !strings.HasPrefix(out, "{") || strings.Contains(out, "oncall") {
+			t.Fatalf("Incorrect export\nGot: %d %q", code, out)
+		}
+
+		if code, _, errOut := run("", "export", "nothere"); code != 1 || errOut == "" {
+			t.Fatalf("Missing group should fail\nGot: %d", code)
+		}
+	})
+
+	t.Run("Imports from stdin", func(t *testing.T) {
+		data := "groups:\n  - groupName: backend\n    members:\n      - gchatID: users/2\n"
+
+		code, out, _ := run(data, "import", "--replace", "--dry-run")
+		if code != 0 || !strings.Contains(out, "Dry run") || memberGIDs(Groups["backend"].Members) != "users/1" {
+			t.Fatalf("Dry run should not change the group\nGot: %d %q", code, out)
+		}
+
+		code, _, errOut := run(data, "import", "--replace", "-")
+		if code != 1 || !strings.Contains(errOut, "--offline") || memberGIDs(Groups["backend"].Members) != "users/1" {
+			t.Fatalf("Import should be refused while the bot may be running\nGot: %d %q", code, errOut)
+		}
+
+		code, out, _ = run(data, "import", "--replace", "--offline", "-")
+		if code != 0 || memberGIDs(Groups["backend"].Members) != "users/2" {
+			t.Fatalf("Group not imported\nGot: %d %q", code, out)
+		}
+	})
+
+	t.Run("Imports with replicas running", func(t *testing.T) {
+		replicaID := ReplicaID
+		defer func() { ReplicaID = replicaID }()
+		ReplicaID = "replica-cli"
+
+		data := "groups:\n  - groupName: backend\n    members:\n      - gchatID: users/3\n"
+
+		if code, out, _ := run(data, "import", "--merge"); code != 0 || memberGIDs(Groups["backend"].Members) != "users/2,users/3" {
+			t.Fatalf("Group not imported\nGot: %d %q", code, out)
+		}
+	})
+
+	t.Run("Rejects bad usage", func(t *testing.T) {
+		if code, _, _ := run("", "import", "--merge", "--skip"); code != 2 {
+			t.Fatalf("Two policies should be rejected\nGot: %d", code)
+		}
+
+		if code, _, _ := run("", "serve"); code != 2 {
+			t.Fatalf("Unknown command should be rejected\nGot: %d", code)
+		}
+
+		if code, _, _ := run("groups: [", "import"); code != 1 {
+			t.Fatalf("Invalid import should fail\nGot: %d", code)
+		}
+	})
+}
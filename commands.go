@@ -0,0 +1,702 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//Permission is what's required of the sender to use a command
+type Permission int
+
+//PermAnyone commands can be used by everybody. PermStaff commands need the
+//sender to be an admin, or to have been granted any role. PermAdmin commands
+//can only be used by an admin from a DM.
+const (
+	PermAnyone Permission = iota
+	PermStaff
+	PermAdmin
+)
+
+//Arg describes one of the words a command takes, in order. Rest arguments
+//take the remainder of the message as it was typed. Any argument can also be
+//given as an option, --name=value, where the name is Option, or the argument's
+//name in lowercase if that isn't set.
+type Arg struct {
+	Name     string
+	Display  string
+	Option   string
+	Optional bool
+	Rest     bool
+}
+
+//optionName is the name the argument can be given as an option by
+func (a Arg) optionName() string {
+	if a.Option != "" {
+		return a.Option
+	}
+
+	return strings.ToLower(a.Name)
+}
+
+//Command describes something the bot can be asked to do. ParseArgs, usage,
+//and inspectMessage all work off of the registered commands, so a new command
+//only has to be added to the registry.
+type Command struct {
+	Name       string
+	Aliases    []string
+	Args       []Arg
+	Flags      map[string]string
+	Permission Permission
+	Help       string
+
+	//Hidden commands are left out of the help text, and anyone who isn't
+	//allowed to use one is told it doesn't exist. Implicit commands can't be
+	//called by name, such as notify, which is called by a group's name.
+	Hidden   bool
+	Implicit bool
+
+	//Parse replaces the usual parsing of Args for commands that need more
+	//than that. tokens are the arguments of the message, starting with the
+	//bot's name. Check is called after the usual parsing, on the command or
+	//subcommand that was picked, for commands whose arguments need checking.
+	Parse   func(Groups GroupMgr, msgObj messageResponse, tokens []Token, args Arguments) error
+	Check   func(Groups GroupMgr, args Arguments) error
+	Handler func(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string
+
+	//Card lays out the command's reply as a card, with the handler's text
+	//kept as the fallback. It's called after the handler, and returns nil
+	//when the text should be sent on its own.
+	Card func(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) *CardV2
+
+	//Confirm returns what to ask the sender before running a destructive
+	//command, or an empty string if it can run straight away. The command
+	//only runs once the sender clicks the confirmation card.
+	Confirm func(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string
+
+	//Lookup reads what the command needs from outside the bot into the
+	//message's Lookups, before the handler runs.
+	Lookup func(msgObj *messageResponse, args Arguments)
+
+	//Subcommands are picked by the subAction argument
+	Subcommands []*Command
+}
+
+//CommandRegistry holds every command, in the order they are listed in the
+//help text.
+type CommandRegistry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+//Commands is the registry of everything the bot can do. It's filled in by
+//init, since the handlers refer back to the registry for their usage text.
+var Commands *CommandRegistry
+
+func init() {
+	Commands = newCommandRegistry(defaultCommands()...)
+}
+
+//newCommandRegistry registers the commands under their names and aliases
+func newCommandRegistry(commands ...*Command) *CommandRegistry {
+	cr := &CommandRegistry{
+		commands: commands,
+		byName:   make(map[string]*Command),
+	}
+
+	for _, cmd := range commands {
+		cr.byName[cmd.Name] = cmd
+
+		for _, alias := range cmd.Aliases {
+			cr.byName[alias] = cmd
+		}
+	}
+
+	return cr
+}
+
+//Lookup finds the command called by the given word. Implicit commands are
+//never found this way.
+func (cr *CommandRegistry) Lookup(word string) *Command {
+	cmd, exist := cr.byName[strings.ToLower(word)]
+	if !exist || cmd.Implicit {
+		return nil
+	}
+
+	return cmd
+}
+
+//Get finds the command by its name, including implicit commands
+func (cr *CommandRegistry) Get(name string) *Command {
+	return cr.byName[name]
+}
+
+//Names returns the name and aliases of every command that can be called by
+//name and isn't hidden.
+func (cr *CommandRegistry) Names() []string {
+	var names []string
+	for _, cmd := range cr.commands {
+		if cmd.Hidden || cmd.Implicit {
+			continue
+		}
+
+		names = append(names, cmd.Name)
+		names = append(names, cmd.Aliases...)
+	}
+
+	return names
+}
+
+//Usage returns the usage text for a single command. Subcommands are looked
+//up as command:subcommand.
+func (cr *CommandRegistry) Usage(option string) string {
+	parts := strings.SplitN(option, ":", 2)
+
+	cmd := cr.Get(parts[0])
+	if cmd == nil {
+		return ""
+	}
+
+	if len(parts) == 2 {
+		sub := cmd.subcommand(parts[1])
+		if sub == nil {
+			return ""
+		}
+
+		return sub.usage(cmd.Name + " ")
+	}
+
+	return cmd.usage("")
+}
+
+//Help returns the usage text of every command that isn't hidden
+func (cr *CommandRegistry) Help() string {
+	var text string
+	for _, cmd := range cr.commands {
+		if !cmd.Hidden {
+			text += cmd.usage("") + "\n"
+		}
+	}
+
+	return text
+}
+
+//usage lays out how to call the command, followed by its help text. Commands
+//with subcommands list each of them instead.
+func (c *Command) usage(prefix string) string {
+	if len(c.Subcommands) > 0 {
+		lines := make([]string, 0, len(c.Subcommands))
+		for _, sub := range c.Subcommands {
+			lines = append(lines, sub.usage(prefix+c.Name+" "))
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	return fmt.Sprintf("\n%s\n  %s", c.usageLine(prefix), c.Help)
+}
+
+//usageLine is how to call the command, without its help text
+func (c *Command) usageLine(prefix string) string {
+	line := prefix + c.Name
+
+	if c.Implicit {
+		line = ""
+	}
+
+	for _, alias := range c.Aliases {
+		line += "|" + alias
+	}
+
+	for _, arg := range c.Args {
+		display := arg.Display
+		if display == "" {
+			display = arg.Name
+		}
+
+		if arg.Optional {
+			display = "[" + display + "]"
+		}
+
+		line = strings.TrimSpace(line + " " + display)
+	}
+
+	return line
+}
+
+//subcommand finds the subcommand with the given name
+func (c *Command) subcommand(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+//Allowed tells if the sender of the message may use the command
+func (c *Command) Allowed(msgObj messageResponse) bool {
+	sender := msgObj.Message.Sender.GID
+
+	switch c.Permission {
+	case PermAdmin:
+		return msgObj.FromMaster
+	case PermStaff:
+		return msgObj.FromMaster || Roles.IsAdmin(sender) || Roles.HasRole(sender)
+	default:
+		return true
+	}
+}
+
+//parseArgs fills in the arguments for the command from the tokens of the
+//message. Flags are picked out from anywhere before a rest argument, and the
+//ones starting with -- aren't counted as arguments. Options fill in the
+//argument they name, and the words left over fill in the arguments that are
+//still empty, in order. For commands with subcommands the first word picks the
+//subcommand, and its arguments are used instead.
+func (c *Command) parseArgs(Groups GroupMgr, msgObj messageResponse, tokens []Token, args Arguments) error {
+	if c.Parse != nil {
+		return c.Parse(Groups, msgObj, tokens, args)
+	}
+
+	//Every command has always been handed the word after it as the group
+	//name, so that's still the default.
+	args["groupName"] = ""
+
+	cmd := c
+	if len(c.Subcommands) > 0 {
+		args["subAction"] = ""
+		cmd = nil
+	}
+
+	var (
+		words  int
+		filled = make(map[string]bool)
+	)
+
+	for _, token := range tokens[2:] {
+		if key, exist := c.Flags[strings.ToLower(token.Value)]; exist {
+			args[key] = key
+
+			if token.isOption() {
+				continue
+			}
+		} else if token.isOption() {
+			name, value := token.option()
+
+			arg := cmd.option(name)
+			if arg == nil {
+				return fmt.Errorf("Unknown option %q for %s ```%s```", "--"+name, c.Name, c.usage(""))
+			}
+
+			args[arg.Name] = value
+			filled[arg.Name] = true
+
+			continue
+		}
+
+		if words == 0 && !filled["groupName"] {
+			args["groupName"] = token.Value
+		}
+		words++
+
+		if cmd == nil {
+			args["subAction"] = strings.ToLower(token.Value)
+
+			if cmd = c.subcommand(args["subAction"]); cmd == nil {
+				return fmt.Errorf("Unknown %s subaction %q called ```%s```", c.Name, args["subAction"], c.usage(""))
+			}
+
+			continue
+		}
+
+		arg := cmd.nextArg(filled)
+		if arg == nil {
+			continue
+		}
+
+		filled[arg.Name] = true
+
+		if arg.Rest {
+			args[arg.Name] = token.restValue()
+			break
+		}
+
+		args[arg.Name] = token.Value
+	}
+
+	if cmd == nil {
+		return fmt.Errorf("Not enough arguments for %s action ```%s```", c.Name, c.usage(""))
+	}
+
+	for _, arg := range cmd.Args {
+		if !filled[arg.Name] {
+			args[arg.Name] = ""
+		}
+	}
+
+	if cmd.Check != nil {
+		return cmd.Check(Groups, args)
+	}
+
+	return nil
+}
+
+//option finds the argument that can be given as the named option. A nil
+//command has no options, which is the case before a subcommand is picked.
+func (c *Command) option(name string) *Arg {
+	if c == nil {
+		return nil
+	}
+
+	for i := range c.Args {
+		if c.Args[i].optionName() == name {
+			return &c.Args[i]
+		}
+	}
+
+	return nil
+}
+
+//nextArg finds the first argument that hasn't been filled in yet
+func (c *Command) nextArg(filled map[string]bool) *Arg {
+	for i := range c.Args {
+		if !filled[c.Args[i].Name] {
+			return &c.Args[i]
+		}
+	}
+
+	return nil
+}
+
+//run calls the command's handler, or the handler of the subcommand picked by
+//the subAction argument.
+func (c *Command) run(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string {
+	cmd := c.picked(args)
+	if cmd == nil || cmd.Handler == nil {
+		return fmt.Sprintf("Unknown %s subaction %q called", c.Name, args["subAction"])
+	}
+
+	return cmd.Handler(Groups, Scheduler, msgObj, args)
+}
+
+//card lays out the reply of the command, or the subcommand picked by the
+//subAction argument, if it has a card.
+func (c *Command) card(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) *CardV2 {
+	cmd := c.picked(args)
+	if cmd == nil || cmd.Card == nil {
+		return nil
+	}
+
+	return cmd.Card(Groups, Scheduler, msgObj, args)
+}
+
+//confirm returns what to ask before running the command, or the subcommand
+//picked by the subAction argument, if it needs confirming.
+func (c *Command) confirm(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string {
+	cmd := c.picked(args)
+	if cmd == nil || cmd.Confirm == nil {
+		return ""
+	}
+
+	return cmd.Confirm(Groups, Scheduler, msgObj, args)
+}
+
+//picked returns the subcommand picked by the subAction argument, or the
+//command itself if it has no subcommands.
+func (c *Command) picked(args Arguments) *Command {
+	if len(c.Subcommands) > 0 {
+		return c.subcommand(args["subAction"])
+	}
+
+	return c
+}
+
+//defaultCommands lists every command the bot knows, in the order they show up
+//in the help text.
+func defaultCommands() []*Command {
+	groupArg := Arg{Name: "groupName"}
+	mentionsArg := Arg{Name: "mentions"}
+	selfFlag := map[string]string{"self": "self"}
+	dryRunFlag := map[string]string{"--dry-run": "dryRun"}
+
+	labelArg := Arg{Name: "label", Display: "<label>"}
+	scheduleArgs := []Arg{
+		labelArg,
+		{Name: "dateTime", Display: "<time RFC3339>", Option: "time"},
+		{Name: "groupName", Display: "<groupName>", Option: "group"},
+		{Name: "message", Display: "<Message>", Rest: true},
+	}
+
+	return []*Command{
+		{
+			Name:  "create",
+			Args:  []Arg{groupArg, {Name: "mentions", Optional: true}},
+			Flags: map[string]string{"self": "self", "--from-room": "fromRoom", "--sync": "sync"},
+			Help:  `Create a group containing mentioned members. While I'm not sure why you would, you can initialize an empty group. Add "self" to the list of mentions to add yourself. People can be given by email too, such as a list pasted from a spreadsheet. Add --from-room instead to fill it with everyone in the room, and --sync along with it to keep it matching the room's members.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				if args["fromRoom"] != "" {
+					return Groups.CreateFromRoom(args["groupName"], args["sync"], msgObj)
+				}
+
+				return Groups.Create(args["groupName"], args["self"], msgObj)
+			},
+			Lookup: lookupCreate,
+		},
+		{
+			Name:  "add",
+			Args:  []Arg{groupArg, mentionsArg},
+			Flags: selfFlag,
+			Help:  `Add mentioned members to the specified GroupName. This can only be used for groups that already exist. If you intend to create a new group use create. Add "self" to the list of mentions to add yourself. People can be given by email too, and I'll say which emails I couldn't find.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.AddMembers(args["groupName"], args["self"], msgObj)
+			},
+			Lookup: lookupMembers,
+		},
+		{
+			Name:  "remove",
+			Args:  []Arg{groupArg, mentionsArg},
+			Flags: selfFlag,
+			Help:  `Remove mentioned members from the specified GroupName. Add "self" to the list of mentions to remove yourself.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.RemoveMembers(args["groupName"], args["self"], msgObj)
+			},
+			Confirm: confirmRemove,
+		},
+		{
+			Name:    "disband",
+			Aliases: []string{"delete"},
+			Args:    []Arg{groupArg},
+			Help:    `Delete a group. CAUTION: This can be done to a group containing members. I'd recommend only using delete when necessary.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Disband(args["groupName"], msgObj)
+			},
+			Confirm: func(Groups GroupMgr, _ ScheduleMgr, _ messageResponse, args Arguments) string {
+				if !Groups.IsGroup(args["groupName"]) {
+					return ""
+				}
+
+				return fmt.Sprintf("Disband the group %q? Its members will be lost.", args["groupName"])
+			},
+		},
+		{
+			Name: "restrict",
+			Args: []Arg{groupArg},
+			Help: `Toggles group privacy, this disallows any interaction with the group outside the room it was restricted in. (Default: Public)`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Restrict(args["groupName"], msgObj)
+			},
+		},
+		{
+			Name: "unsync",
+			Args: []Arg{groupArg},
+			Help: `Stops keeping a group created with --from-room --sync matching the room's members. Its members are left as they are, and can be changed again.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Unsync(args["groupName"], msgObj)
+			},
+		},
+		{
+			Name: "list",
+			Args: []Arg{{Name: "groupName", Optional: true}},
+			Help: `If used with no groupName, you will receive a list of all groups you can currently use. This will not show any private group that you do not have access to. If used with a groupName, you will see more information about the group specified.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.List(args["groupName"], msgObj)
+			},
+			Card: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) *CardV2 {
+				return Groups.ListCard(args["groupName"], msgObj)
+			},
+		},
+		{
+			Name: "whois",
+			Args: []Arg{mentionsArg},
+			Help: `Lists every group the mentioned people belong to. Private groups from other rooms are left out.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, _ Arguments) string {
+				return Groups.Whois(msgObj)
+			},
+		},
+		{
+			Name: "history",
+			Args: []Arg{groupArg},
+			Help: `Shows the latest changes made to the group, who made them, and which members were added or removed.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.History(args["groupName"], msgObj)
+			},
+		},
+		{
+			Name:     "notify",
+			Args:     []Arg{groupArg},
+			Implicit: true,
+			Help:     `Replaces groupName with mentions for the group members along with the following/surrounding/leading message.`,
+			Parse:    parseNotifyArgs,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Notify(args["groupName"], msgObj)
+			},
+		},
+		{
+			Name: "schedule",
+			Subcommands: []*Command{
+				{
+					Name:  "onetime",
+					Args:  scheduleArgs,
+					Check: checkScheduleArgs,
+					Help:  `Schedules a message to be sent to the specified group at the given time. If you'd like to edit the created message, just reuse the label and that will update the message. The timestamp passed would need to be written in RFC3339 format, ex: 2020-08-25T22:57:00-05:00 (YYYY-MM-DDTHH:MM:SS-TZ).`,
+					Handler: func(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string {
+						return Scheduler.CreateOnetime(args, Groups, msgObj)
+					},
+				},
+				{
+					Name:  "recurring",
+					Args:  scheduleArgs,
+					Check: checkScheduleArgs,
+					Help:  `Schedules a message to be sent to the specified group at the given time on a weekly cycle. More specifically, the message will repeat on a 7 day cycle until it's removed. If you'd like to edit the created message, just reuse the label and that will update the message. The timestamp passed would need to be written in RFC3339 format, ex: 2020-08-25T22:57:00-05:00 (YYYY-MM-DDTHH:MM:SS-TZ).`,
+					Handler: func(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string {
+						return Scheduler.CreateRecurring(args, Groups, msgObj)
+					},
+				},
+				{
+					Name:  "remove",
+					Args:  []Arg{labelArg},
+					Check: checkScheduleArgs,
+					Help:  `Removes the given label and stops the schedule from executing.`,
+					Handler: func(_ GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) string {
+						return Scheduler.Remove(args, msgObj)
+					},
+					Confirm: func(_ GroupMgr, _ ScheduleMgr, _ messageResponse, args Arguments) string {
+						return fmt.Sprintf("Remove the scheduled message %q?", args["label"])
+					},
+				},
+				{
+					Name: "list",
+					Help: `Lists information about the scheduled events for the room`,
+					Handler: func(_ GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, _ Arguments) string {
+						return Scheduler.List(msgObj)
+					},
+					Card: func(_ GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, _ Arguments) *CardV2 {
+						return Scheduler.ListCard(msgObj)
+					},
+				},
+			},
+		},
+		{
+			Name:  "export",
+			Args:  []Arg{{Name: "groupNames", Display: "groupName...", Optional: true, Rest: true}},
+			Flags: map[string]string{"--json": "json"},
+			Help:  `Exports the named groups, or every group you can see, to load somewhere else with import. Private groups are exported along with the room they're restricted to. Add --json for JSON instead of YAML.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Export(args["groupNames"], args["json"], msgObj)
+			},
+		},
+		{
+			Name:       "import",
+			Args:       []Arg{{Name: "data", Display: "<export>", Rest: true}},
+			Flags:      map[string]string{"--merge": ImportMerge, "--replace": ImportReplace, "--skip": ImportSkip, "--dry-run": "dryRun"},
+			Permission: PermAdmin,
+			Hidden:     true,
+			Check:      checkImportArgs,
+			Help:       `Loads groups from an export, pasted after the command. Groups that don't exist are created. Existing groups get the missing members added with --merge (the default), are made to match the export with --replace, or are left alone with --skip. Add --dry-run to only show what would change.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.Import(args["data"], args["policy"], args["dryRun"], msgObj)
+			},
+			Confirm: confirmImport,
+		},
+		{
+			Name:       "reload",
+			Flags:      dryRunFlag,
+			Permission: PermAdmin,
+			Hidden:     true,
+			Help:       `Makes the groups listed in the groups manifest match it, and shows what was changed. Add --dry-run to only show what would change.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.ReloadManifest(args["dryRun"], msgObj)
+			},
+			Confirm: confirmReload,
+		},
+		{
+			Name:       "dirsync",
+			Args:       []Arg{{Name: "groupName", Optional: true}},
+			Flags:      dryRunFlag,
+			Permission: PermAdmin,
+			Hidden:     true,
+			Help:       `Makes the group, or every group synced with the directory, match it, and shows what was changed. Add --dry-run to only show what would change.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.SyncDirectory(args["groupName"], args["dryRun"], msgObj)
+			},
+			Confirm: confirmDirectorySync,
+			Lookup:  lookupDirectory,
+		},
+		{
+			Name:       "admin",
+			Permission: PermStaff,
+			Subcommands: []*Command{
+				{
+					Name:    "grant",
+					Args:    []Arg{{Name: "role", Display: "<admin|moderator|auditor>"}, mentionsArg},
+					Help:    `Gives the mentioned people the role. Admins and auditors are granted by an admin from a DM. Moderators are granted in the room they'll moderate, and may manage every group restricted to that room. Auditors can see every group, but can't change them.`,
+					Handler: manageRoles,
+				},
+				{
+					Name:    "revoke",
+					Args:    []Arg{{Name: "role", Display: "<admin|moderator|auditor>"}, mentionsArg},
+					Help:    `Takes the role away from the mentioned people.`,
+					Handler: manageRoles,
+				},
+				{
+					Name:    "list",
+					Help:    `Lists who has been granted which roles.`,
+					Handler: manageRoles,
+				},
+			},
+		},
+		{
+			Name:       "syncgroup",
+			Args:       []Arg{groupArg},
+			Flags:      dryRunFlag,
+			Permission: PermStaff,
+			Hidden:     true,
+			Help:       `Syncs the group's members in memory with the database. Add --dry-run to only show what would change.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.SyncGroupMembers(args["groupName"], args["dryRun"], msgObj)
+			},
+		},
+		{
+			Name:       "syncallgroups",
+			Flags:      dryRunFlag,
+			Permission: PermStaff,
+			Hidden:     true,
+			Help:       `Syncs every group's members in memory with the database. Add --dry-run to only show what would change.`,
+			Handler: func(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+				return Groups.SyncAllGroups(args["dryRun"], msgObj)
+			},
+		},
+		{
+			Name: "help",
+			Help: `Reprint's this message. Use "usage" instead for a link to it.`,
+			Handler: func(GroupMgr, ScheduleMgr, messageResponse, Arguments) string {
+				return usage("")
+			},
+			Card: func(GroupMgr, ScheduleMgr, messageResponse, Arguments) *CardV2 {
+				return helpCard()
+			},
+		},
+		{
+			Name:   "usage",
+			Hidden: true,
+			Help:   `Sends a link to this message.`,
+			Handler: func(GroupMgr, ScheduleMgr, messageResponse, Arguments) string {
+				return getUsageWithLink(usage(""))
+			},
+		},
+		{
+			Name:     "usageShort",
+			Hidden:   true,
+			Implicit: true,
+			Handler: func(GroupMgr, ScheduleMgr, messageResponse, Arguments) string {
+				return usage("usageShort")
+			},
+		},
+	}
+}
+
+//manageRoles hands the admin subcommands off to the role directory
+func manageRoles(_ GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+	return Roles.Manage(args["subAction"], args["role"], msgObj)
+}
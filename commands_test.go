@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	registry := newCommandRegistry(
+		&Command{Name: "make", Aliases: []string{"mk"}, Args: []Arg{{Name: "groupName"}}, Help: "Makes a thing"},
+		&Command{Name: "secret", Hidden: true, Help: "Does secret things"},
+		&Command{Name: "implied", Implicit: true, Args: []Arg{{Name: "groupName"}}, Help: "Happens on its own"},
+		&Command{Name: "sched", Subcommands: []*Command{
+			{Name: "once", Args: []Arg{{Name: "label", Display: "<label>"}, {Name: "message", Rest: true}}, Help: "Once"},
+			{Name: "list", Help: "Lists"},
+		}},
+	)
+
+	t.Run("Looks up commands by name and alias", func(t *testing.T) {
+		for _, word := range []string{"make", "MK", "secret"} {
+			if registry.Lookup(word) == nil {
+				t.Fatalf("Command %q not found", word)
+			}
+		}
+	})
+
+	t.Run("Implicit commands aren't looked up by name", func(t *testing.T) {
+		if registry.Lookup("implied") != nil {
+			t.Fatal("Implicit command should not be found by name")
+		}
+
+		if registry.Get("implied") == nil {
+			t.Fatal("Implicit command should be found by Get")
+		}
+	})
+
+	t.Run("Help leaves out hidden commands", func(t *testing.T) {
+		help := registry.Help()
+
+		if strings.Contains(help, "secret") {
+			t.Fatalf("Hidden command in help\nGot: %q", help)
+		}
+
+		for _, wanted := range []string{"make|mk groupName", "\ngroupName\n  Happens on its own", "sched once <label> message", "sched list"} {
+			if !strings.Contains(help, wanted) {
+				t.Fatalf("Help missing %q\nGot: %q", wanted, help)
+			}
+		}
+	})
+
+	t.Run("Usage for a single subcommand", func(t *testing.T) {
+		if got := registry.Usage("sched:list"); got != "\nsched list\n  Lists" {
+			t.Fatalf("Incorrect subcommand usage\nGot: %q", got)
+		}
+	})
+
+	t.Run("Names leave out hidden and implicit commands", func(t *testing.T) {
+		names := strings.Join(registry.Names(), " ")
+
+		if names != "make mk sched" {
+			t.Fatalf("Incorrect names\nGot: %q", names)
+		}
+	})
+}
+
+func TestCommandParseArgs(t *testing.T) {
+	Groups := make(GroupMap)
+
+	t.Run("Fills in positional, rest, and flag args", func(t *testing.T) {
+		cmd := &Command{
+			Name:  "say",
+			Args:  []Arg{{Name: "groupName"}, {Name: "message", Rest: true}},
+			Flags: map[string]string{"--loud": "loud"},
+		}
+
+		args := make(Arguments)
+		tokens := tokenize(BotName + " say oncall --loud hello there everyone")
+
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokens, args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["groupName"] != "oncall" || args["message"] != "hello there everyone" || args["loud"] != "loud" {
+			t.Fatalf("Args not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Missing args are left empty", func(t *testing.T) {
+		cmd := &Command{Name: "say", Args: []Arg{{Name: "groupName"}, {Name: "message", Rest: true}}}
+
+		args := make(Arguments)
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokenize(BotName+" say"), args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["groupName"] != "" || args["message"] != "" {
+			t.Fatalf("Missing args should be empty\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Picks the subcommand", func(t *testing.T) {
+		args := make(Arguments)
+		tokens := tokenize(BotName + " admin Grant moderator @Someone")
+
+		if err := Commands.Get("admin").parseArgs(Groups, messageResponse{}, tokens, args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["subAction"] != "grant" || args["role"] != "moderator" {
+			t.Fatalf("Subcommand args not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Rejects unknown subcommand", func(t *testing.T) {
+		tokens := tokenize(BotName + " admin promote")
+
+		if err := Commands.Get("admin").parseArgs(Groups, messageResponse{}, tokens, make(Arguments)); err == nil {
+			t.Fatal("Unknown subcommand should be rejected")
+		}
+	})
+
+	t.Run("Options fill in their args", func(t *testing.T) {
+		cmd := &Command{
+			Name: "say",
+			Args: []Arg{{Name: "groupName", Option: "group"}, {Name: "label"}, {Name: "message", Rest: true}},
+		}
+
+		args := make(Arguments)
+		tokens := tokenize(BotName + ` say --group=oncall --label="the label" hello  there` + "\neveryone")
+
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokens, args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["groupName"] != "oncall" || args["label"] != "the label" || args["message"] != "hello  there\neveryone" {
+			t.Fatalf("Options not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Rejects unknown options", func(t *testing.T) {
+		cmd := &Command{Name: "say", Args: []Arg{{Name: "groupName"}}}
+
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokenize(BotName+" say --loud=yes oncall"), make(Arguments)); err == nil {
+			t.Fatal("Unknown option should be rejected")
+		}
+	})
+
+	t.Run("Options after the rest are part of it", func(t *testing.T) {
+		cmd := &Command{Name: "say", Args: []Arg{{Name: "groupName"}, {Name: "message", Rest: true}}}
+
+		args := make(Arguments)
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokenize(BotName+" say oncall use --force next time"), args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["message"] != "use --force next time" {
+			t.Fatalf("Rest not kept whole\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Checks the picked subcommand", func(t *testing.T) {
+		checked := ""
+		cmd := &Command{
+			Name: "thing",
+			Subcommands: []*Command{{
+				Name:  "do",
+				Args:  []Arg{{Name: "label"}},
+				Check: func(_ GroupMgr, args Arguments) error { checked = args["label"]; return nil },
+			}},
+		}
+
+		if err := cmd.parseArgs(Groups, messageResponse{}, tokenize(BotName+" thing do it"), make(Arguments)); err != nil {
+			t.Fatal(err)
+		}
+
+		if checked != "it" {
+			t.Fatalf("Subcommand not checked\nGot: %q", checked)
+		}
+	})
+}
+
+func TestCommandAllowed(t *testing.T) {
+	roles := Roles
+	defer func() { Roles = roles }()
+
+	Roles = newRoleDirectory()
+
+	msgObj := messageResponse{Message: message{Sender: User{GID: genUserGID(0)}}}
+	staff := &Command{Name: "staff", Permission: PermStaff}
+	admin := &Command{Name: "admin", Permission: PermAdmin}
+
+	if staff.Allowed(msgObj) || admin.Allowed(msgObj) {
+		t.Fatal("Regular user should not be allowed")
+	}
+
+	Roles.Grant(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAuditor})
+
+	if !staff.Allowed(msgObj) {
+		t.Fatal("User with a role should be allowed staff commands")
+	}
+
+	if admin.Allowed(msgObj) {
+		t.Fatal("Auditor should not be allowed admin commands")
+	}
+
+	msgObj.FromMaster = true
+
+	if !admin.Allowed(msgObj) {
+		t.Fatal("Admin should be allowed admin commands")
+	}
+}
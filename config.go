@@ -1,6 +1,9 @@
 package main
 
-import "os"
+import (
+	"errors"
+	"os"
+)
 
 //HGNConfig struct used to consume configuration details
 type HGNConfig struct {
@@ -8,8 +11,34 @@ type HGNConfig struct {
 	CertKeyFile string
 	UseSSL      string
 
-	BotName  string
-	MasterID string
+	BotName       string
+	MasterID      string
+	VerifyRequest string
+	Audience      string
+	UseCards      string
+
+	SlashCommands string
+
+	ServiceSend string
+	ChatAPIURL  string
+
+	APIClients string
+	Webhooks   string
+
+	ReconcileInterval  string
+	ReconcileDirection string
+
+	GroupsManifest   string
+	ManifestInterval string
+
+	DirectorySync    string
+	RoomSyncInterval string
+
+	ReplicaID string
+
+	RateLimitSender string
+	RateLimitGroup  string
+	RateLimitRoom   string
 }
 
 //DBConfig struct used to consume Configuration details
@@ -33,11 +62,47 @@ func initConfig() (config HGNConfig) {
 		CertKeyFile: os.Getenv("HGNOTIFY_CERT_KEY_FILE"),
 		UseSSL:      os.Getenv("HGNOTIFY_USE_SSL"),
 
-		BotName:  os.Getenv("HGNOTIFY_BOT_NAME"),
-		MasterID: os.Getenv("HGNOTIFY_MASTER_GID"),
+		BotName:       os.Getenv("HGNOTIFY_BOT_NAME"),
+		MasterID:      os.Getenv("HGNOTIFY_MASTER_GID"),
+		VerifyRequest: os.Getenv("VERIFY_REQUEST"),
+		Audience:      os.Getenv("HGNOTIFY_AUDIENCE"),
+		UseCards:      os.Getenv("HGNOTIFY_USE_CARDS"),
+
+		SlashCommands: os.Getenv("HGNOTIFY_SLASH_COMMANDS"),
+
+		ServiceSend: os.Getenv("SERVICE_SEND"),
+		ChatAPIURL:  os.Getenv("HGNOTIFY_CHAT_API_URL"),
+
+		APIClients: os.Getenv("HGNOTIFY_API_CLIENTS"),
+		Webhooks:   os.Getenv("HGNOTIFY_WEBHOOKS"),
+
+		ReconcileInterval:  os.Getenv("HGNOTIFY_RECONCILE_INTERVAL"),
+		ReconcileDirection: os.Getenv("HGNOTIFY_RECONCILE_DIRECTION"),
+
+		GroupsManifest:   os.Getenv("HGNOTIFY_GROUPS_MANIFEST"),
+		ManifestInterval: os.Getenv("HGNOTIFY_MANIFEST_INTERVAL"),
+
+		DirectorySync:    os.Getenv("HGNOTIFY_DIRECTORY_SYNC"),
+		RoomSyncInterval: os.Getenv("HGNOTIFY_ROOM_SYNC_INTERVAL"),
+
+		ReplicaID: os.Getenv("HGNOTIFY_REPLICA_ID"),
+
+		RateLimitSender: os.Getenv("HGNOTIFY_RATE_LIMIT_SENDER"),
+		RateLimitGroup:  os.Getenv("HGNOTIFY_RATE_LIMIT_GROUP"),
+		RateLimitRoom:   os.Getenv("HGNOTIFY_RATE_LIMIT_ROOM"),
 	}
 }
 
+//checkConfig catches settings the bot can't run with, so it fails when it
+//starts rather than on every request.
+func checkConfig(config HGNConfig) error {
+	if config.VerifyRequest == "true" && config.Audience == "" {
+		return errors.New("VERIFY_REQUEST is true but HGNOTIFY_AUDIENCE isn't set, set it to the bot's project number so Google's requests can be verified")
+	}
+
+	return nil
+}
+
 //loadDBConfig specifically loads configuration information
 //for the database as oppposed to the bot/connections
 func initDBConfig() (config DBConfig) {
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//confirmTTL is how long a confirmation card can be clicked before the action
+//has to be asked for again.
+const confirmTTL = 5 * time.Minute
+
+//The functions of the buttons on a confirmation card
+const (
+	confirmFunction = "confirm"
+	cancelFunction  = "cancel"
+)
+
+//ActionResponse tells Google whether a reply to a click is a new message, or
+//replaces the message holding the card that was clicked.
+type ActionResponse struct {
+	Type string `json:"type"`
+}
+
+//pendingAction is a destructive command waiting to be confirmed. The message
+//it was asked for in is kept, so it runs as if it had just been sent.
+type pendingAction struct {
+	Args      Arguments
+	MsgObj    messageResponse
+	ExpiresAt time.Time
+}
+
+//ConfirmationStore holds the actions waiting on a click of their confirmation
+//card. They are only kept in memory, so a confirmation that lands on another
+//replica, or after a restart, is treated as expired.
+type ConfirmationStore struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	pending map[string]*pendingAction
+}
+
+//newConfirmationStore initializes an empty confirmation store
+func newConfirmationStore() *ConfirmationStore {
+	return &ConfirmationStore{
+		now:     time.Now,
+		pending: make(map[string]*pendingAction),
+	}
+}
+
+//Ask holds on to the command and replies with a card asking its sender to
+//confirm or cancel it.
+func (cs *ConfirmationStore) Ask(prompt string, msgObj messageResponse, args Arguments) Reply {
+	token := newConfirmToken()
+
+	cs.mu.Lock()
+	cs.prune()
+	cs.pending[token] = &pendingAction{
+		Args:      args,
+		MsgObj:    msgObj,
+		ExpiresAt: cs.now().Add(confirmTTL),
+	}
+	cs.mu.Unlock()
+
+	tokenParam := ActionParameter{Key: "token", Value: token}
+
+	card := &CardV2{
+		CardID: "confirm",
+		Card: Card{
+			Header: &CardHeader{Title: "Please confirm", Subtitle: fmt.Sprintf("Only %s can confirm this", msgObj.Message.Sender.Name)},
+			Sections: []CardSection{{Widgets: []Widget{
+				{TextParagraph: &TextParagraph{Text: prompt}},
+				{ButtonList: &ButtonList{Buttons: []Button{
+					commandButton("Confirm", confirmFunction, tokenParam),
+					commandButton("Cancel", cancelFunction, tokenParam),
+				}}},
+			}}},
+		},
+	}
+
+	return Reply{FallbackText: prompt, CardsV2: []CardV2{*card}}
+}
+
+//Resolve handles a click of a confirmation card's buttons. Only the one who
+//asked for the action may confirm or cancel it. Confirming runs the action,
+//and either way the card is replaced with the outcome.
+func (cs *ConfirmationStore) Resolve(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse) Reply {
+	var token string
+	for _, param := range msgObj.Action.Parameters {
+		if param.Key == "token" {
+			token = param.Value
+		}
+	}
+
+	cs.mu.Lock()
+	cs.prune()
+
+	pending, exist := cs.pending[token]
+	if !exist {
+		cs.mu.Unlock()
+		return Reply{Text: "That confirmation has expired, please ask me again.", ActionResponse: &ActionResponse{Type: "UPDATE_MESSAGE"}}
+	}
+
+	if pending.MsgObj.Message.Sender.GID != msgObj.User.GID {
+		cs.mu.Unlock()
+		return Reply{Text: fmt.Sprintf("Only %s can confirm or cancel that.", pending.MsgObj.Message.Sender.Name), ActionResponse: &ActionResponse{Type: "NEW_MESSAGE"}}
+	}
+
+	delete(cs.pending, token)
+	cs.mu.Unlock()
+
+	if msgObj.Action.MethodName != confirmFunction {
+		return Reply{Text: "Okay, I've cancelled that.", ActionResponse: &ActionResponse{Type: "UPDATE_MESSAGE"}}
+	}
+
+	text := inspectMessage(Groups, Scheduler, pending.MsgObj, pending.Args)
+	return Reply{Text: text, ActionResponse: &ActionResponse{Type: "UPDATE_MESSAGE"}}
+}
+
+//prune drops every action that has expired. The lock must already be held.
+func (cs *ConfirmationStore) prune() {
+	now := cs.now()
+	for token, pending := range cs.pending {
+		if !now.Before(pending.ExpiresAt) {
+			delete(cs.pending, token)
+		}
+	}
+}
+
+//newConfirmToken makes a token that can't be guessed, so a confirmation can
+//only come from the card it was sent on.
+func newConfirmToken() string {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	checkError(err)
+
+	return hex.EncodeToString(b)
+}
+
+//confirmRemove asks for confirmation when more than one member is being
+//removed from a group at once.
+func confirmRemove(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+	if !Groups.IsGroup(args["groupName"]) {
+		return ""
+	}
+
+	var count int
+	seen := checkSeen()
+
+	for _, mention := range msgObj.Message.Mentions {
+		user := mention.Called.User
+		if user.Type != "BOT" && mention.Type == "USER_MENTION" && !seen(user.GID) {
+			count++
+		}
+	}
+
+	if args["self"] != "" && !seen(msgObj.Message.Sender.GID) {
+		count++
+	}
+
+	if count < 2 {
+		return ""
+	}
+
+	return fmt.Sprintf("Remove %d members from the group %q?", count, args["groupName"])
+}
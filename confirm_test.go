@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfirmations(t *testing.T) {
+	Logger.Active(false)
+
+	useCards, confirmations := UseCards, Confirmations
+	defer func() { UseCards, Confirmations = useCards, confirmations }()
+
+	UseCards = true
+
+	requester := User{Name: "Requester", GID: genUserGID(0), Type: "HUMAN"}
+	room := space{GID: genRoomGID(0), Type: "ROOM"}
+
+	newGroups := func() GroupMap {
+		return GroupMap{"oncall": &Group{Name: "oncall", Members: []Member{{GID: "users/1"}}}}
+	}
+
+	ask := func(t *testing.T, Groups GroupMap, text string) string {
+		msgObj := messageResponse{Room: room, Message: message{Sender: requester, Text: text}}
+
+		reply := respond(Groups, ScheduleMap{}, &msgObj)
+		if len(reply.CardsV2) != 1 || reply.CardsV2[0].CardID != "confirm" {
+			t.Fatalf("Confirmation not asked for\nGot: %+v", reply)
+		}
+
+		buttons := reply.CardsV2[0].Card.Sections[0].Widgets[1].ButtonList.Buttons
+		return buttons[0].OnClick.Action.Parameters[0].Value
+	}
+
+	click := func(Groups GroupMap, function, token string, by User) Reply {
+		msgObj := messageResponse{
+			Type:   "CARD_CLICKED",
+			Room:   room,
+			User:   by,
+			Action: cardAction{MethodName: function, Parameters: []ActionParameter{{Key: "token", Value: token}}},
+		}
+
+		return Confirmations.Resolve(Groups, ScheduleMap{}, msgObj)
+	}
+
+	t.Run("Disband waits for confirmation", func(t *testing.T) {
+		Confirmations = newConfirmationStore()
+		Groups := newGroups()
+
+		token := ask(t, Groups, BotName+" disband oncall")
+		if !Groups.IsGroup("oncall") {
+			t.Fatal("Group disbanded before it was confirmed")
+		}
+
+		reply := click(Groups, confirmFunction, token, requester)
+		if Groups.IsGroup("oncall") || reply.ActionResponse.Type != "UPDATE_MESSAGE" {
+			t.Fatalf("Group not disbanded once confirmed\nGot: %+v", reply)
+		}
+
+		if reply = click(Groups, confirmFunction, token, requester); !strings.Contains(reply.Text, "expired") {
+			t.Fatalf("Confirmation should only work once\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Cancel drops the action", func(t *testing.T) {
+		Confirmations = newConfirmationStore()
+		Groups := newGroups()
+
+		token := ask(t, Groups, BotName+" disband oncall")
+
+		if reply := click(Groups, cancelFunction, token, requester); !strings.Contains(reply.Text, "cancelled") || !Groups.IsGroup("oncall") {
+			t.Fatalf("Action not cancelled\nGot: %+v", reply)
+		}
+
+		if reply := click(Groups, confirmFunction, token, requester); !strings.Contains(reply.Text, "expired") || !Groups.IsGroup("oncall") {
+			t.Fatalf("Cancelled action should not run\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Only the requester can confirm", func(t *testing.T) {
+		Confirmations = newConfirmationStore()
+		Groups := newGroups()
+
+		token := ask(t, Groups, BotName+" disband oncall")
+		other := User{Name: "Other", GID: genUserGID(0), Type: "HUMAN"}
+
+		if reply := click(Groups, confirmFunction, token, other); !strings.Contains(reply.Text, "Only Requester") || !Groups.IsGroup("oncall") {
+			t.Fatalf("Someone else confirmed the action\nGot: %+v", reply)
+		}
+
+		if click(Groups, confirmFunction, token, requester); Groups.IsGroup("oncall") {
+			t.Fatal("Requester could not confirm after someone else tried")
+		}
+	})
+
+	t.Run("Confirmations expire", func(t *testing.T) {
+		Confirmations = newConfirmationStore()
+		Groups := newGroups()
+
+		token := ask(t, Groups, BotName+" disband oncall")
+		Confirmations.now = func() time.Time { return time.Now().Add(confirmTTL) }
+
+		if reply := click(Groups, confirmFunction, token, requester); !strings.Contains(reply.Text, "expired") || !Groups.IsGroup("oncall") {
+			t.Fatalf("Expired action should not run\nGot: %+v", reply)
+		}
+	})
+
+	t.Run("Nothing to confirm without cards", func(t *testing.T) {
+		UseCards = false
+		defer func() { UseCards = true }()
+
+		Groups := newGroups()
+		msgObj := messageResponse{Room: room, Message: message{Sender: requester, Text: BotName + " disband oncall"}}
+
+		if respond(Groups, ScheduleMap{}, &msgObj); Groups.IsGroup("oncall") {
+			t.Fatal("Group should be disbanded straight away")
+		}
+	})
+
+	t.Run("Missing groups aren't confirmed", func(t *testing.T) {
+		msgObj := messageResponse{Room: room, Message: message{Sender: requester, Text: BotName + " disband nothere"}}
+
+		if reply := respond(GroupMap{}, ScheduleMap{}, &msgObj); reply.CardsV2 != nil {
+			t.Fatalf("Missing group should not be confirmed\nGot: %+v", reply)
+		}
+	})
+}
+
+func TestConfirmRemove(t *testing.T) {
+	Groups := GroupMap{"oncall": new(Group)}
+
+	mention := func(gid string) annotation {
+		return annotation{Type: "USER_MENTION", Called: userMention{User{GID: gid, Type: "HUMAN"}}}
+	}
+
+	msgObj := messageResponse{Message: message{Sender: User{GID: "users/0"}}}
+
+	tests := []struct {
+		name     string
+		mentions []annotation
+		self     string
+		want     bool
+	}{
+		{"One member", []annotation{mention("users/1")}, "", false},
+		{"Same member twice", []annotation{mention("users/1"), mention("users/1")}, "", false},
+		{"Two members", []annotation{mention("users/1"), mention("users/2")}, "", true},
+		{"One member and self", []annotation{mention("users/1")}, "self", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msgObj.Message.Mentions = test.mentions
+			args := Arguments{"groupName": "oncall", "self": test.self}
+
+			if got := confirmRemove(Groups, nil, msgObj, args) != ""; got != test.want {
+				t.Fatalf("Confirmation should be %v", test.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +19,25 @@ const (
 	connRetryWait  = time.Second * 3
 )
 
+//syncWorkers is how many groups are synced with the database at once
+const syncWorkers = 10
+
+//pendingSaves counts the group saves still running in the background, so the
+//reconciler can wait for them before reading the groups from the database
+var pendingSaves sync.WaitGroup
+
+//saveGroup runs a save of a group's changes in the background. It's called
+//while holding stateLock, so the save is counted before anyone else can look
+//at the groups.
+func saveGroup(save func()) {
+	pendingSaves.Add(1)
+
+	go func() {
+		defer pendingSaves.Done()
+		save()
+	}()
+}
+
 //DBLogger struct just isa pointer to a gorm.DB object, it just holds
 //the DB object so that I can throw methods on it.
 type DBLogger struct {
@@ -66,8 +87,41 @@ func (db *DBLogger) SetupTables() {
 	if !db.isActive {
 		return
 	}
-	db.AutoMigrate(&Group{}, &Member{}, &NotifyLog{}, &Schedule{})
+	db.AutoMigrate(&Group{}, &Member{}, &NotifyLog{}, &Schedule{}, &ChatUser{}, &Lease{}, &ChangeLog{}, &RoleGrant{}, &AuditEntry{}, &RateCounter{}, &WebhookDelivery{})
 	db.Model(&Member{}).AddForeignKey("group_id", "groups(id)", "CASCADE", "RESTRICT")
+
+	db.migrateMemberNames()
+}
+
+//migrateMemberNames copies the names that used to be kept on every member
+//row into the chat_users table. The old column is left in place, and no
+//longer read, so the names are never lost if the copy fails. It was created
+//NOT NULL without a default, so it's made nullable for new members to be
+//saved without it. It's safe to run on every start, since users already in
+//the table are skipped.
+func (db *DBLogger) migrateMemberNames() {
+	if !db.Dialect().HasColumn("members", "name") {
+		return
+	}
+
+	err := db.Exec(`INSERT IGNORE INTO chat_users (created_at, updated_at, g_id, name, last_seen)
+		SELECT NOW(), NOW(), g_id, MAX(name), MAX(updated_at) FROM members
+		WHERE deleted_at IS NULL AND g_id <> '' GROUP BY g_id`).Error
+	if err != nil {
+		log.Printf("Error copying member names into chat_users: %s", err.Error())
+	}
+
+	var nullable string
+
+	row := db.Raw(`SELECT is_nullable FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'members' AND column_name = 'name'`).Row()
+	if err := row.Scan(&nullable); err != nil || nullable == "YES" {
+		return
+	}
+
+	if err := db.Exec("ALTER TABLE members MODIFY name varchar(255) NULL").Error; err != nil {
+		log.Printf("Error making the old member name column nullable: %s", err.Error())
+	}
 }
 
 //SaveCreatedGroup method is used to update the database whenever
@@ -77,6 +131,7 @@ func (db *DBLogger) SaveCreatedGroup(group *Group) {
 		return
 	}
 	db.Create(group)
+	db.recordChange("group", strings.ToLower(group.Name))
 }
 
 //DisbandGroup method will delete a group's entry from the database,
@@ -86,18 +141,32 @@ func (db *DBLogger) DisbandGroup(group *Group) {
 		return
 	}
 	db.Unscoped().Delete(group)
+	db.recordChange("group", strings.ToLower(group.Name))
 }
 
 //UpdatePrivacyDB method toggles the privacy settings for the specified
 //group. It's a bit different because when the restriction is removed, the
 //values entered into the database are "zero value", so gorm ignores them.
 //To get them to set the zero value I have to be specific with the query.
+//Whether the bot was removed from the group's room is saved along with it.
 func (db *DBLogger) UpdatePrivacyDB(group *Group) {
 	if !db.isActive {
 		return
 	}
 	db.Model(group).Select("is_private").Update("IsPrivate", group.IsPrivate)
 	db.Model(group).Select("privacy_room_id").Update("PrivacyRoomID", group.PrivacyRoomID)
+	db.Model(group).Select("room_removed").Update("RoomRemoved", group.RoomRemoved)
+	db.recordChange("group", strings.ToLower(group.Name))
+}
+
+//SaveRoomSync method saves the room the group is kept matching, which is
+//cleared when it stops being synced
+func (db *DBLogger) SaveRoomSync(group *Group) {
+	if !db.isActive {
+		return
+	}
+	db.Model(group).Select("sync_room_id").Update("SyncRoomID", group.SyncRoomID)
+	db.recordChange("group", strings.ToLower(group.Name))
 }
 
 //SaveMemberAddition method adds a member to the associated group
@@ -106,6 +175,7 @@ func (db *DBLogger) SaveMemberAddition(group *Group) {
 		return
 	}
 	db.Model(group).Update(group)
+	db.recordChange("group", strings.ToLower(group.Name))
 }
 
 //SaveMemberRemoval method marks the assocaited memeber as removed from
@@ -117,6 +187,7 @@ func (db *DBLogger) SaveMemberRemoval(group *Group, members []Member) {
 	for _, member := range members {
 		db.Model(group).Delete(member)
 	}
+	db.recordChange("group", strings.ToLower(group.Name))
 }
 
 //GetGroupsFromDB method syncs the database groups to the in-memory group list
@@ -132,7 +203,7 @@ func (db *DBLogger) GetGroupsFromDB(groupMap GroupMap) {
 		var members []Member
 		db.Model(&group).Related(&members)
 
-		group.Members = members
+		group.Members = withUserNames(members)
 
 		saveName := strings.ToLower(group.Name)
 		groupMap[saveName] = group
@@ -163,45 +234,251 @@ func (db *DBLogger) GetGroupByID(groupID uint) *Group {
 
 	db.Model(Member{}).Where(memberSearchTmpl).Find(&members)
 
-	group.Members = members
+	group.Members = withUserNames(members)
 
 	return group
 }
 
 //SyncAllGroups method syncs the database groups to the in-memory group list
-//during runtime. Just in case.
-func (db *DBLogger) SyncAllGroups(groups GroupMap) {
+//during runtime. Just in case. The diff for every group is returned, and when
+//dryRun is set the groups in memory are left alone.
+func (db *DBLogger) SyncAllGroups(groups GroupMap, dryRun bool) []MembershipDiff {
 	if !db.isActive {
-		return
+		return nil
 	}
 
-	//TODO: Create workergroup to have about 10 groups to be updated at a time.
-	var wg sync.WaitGroup
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		diffs []MembershipDiff
 
-	//A go routine is spawned for each group to sync. It's a bit intensive on memory
-	//but speeds up the process significatly.
-	for _, group := range groups {
+		jobs = make(chan *Group)
+	)
+
+	//Only syncWorkers groups are synced at a time, so a large number of groups
+	//doesn't turn into the same number of goroutines and db connections.
+	for i := 0; i < syncWorkers; i++ {
 		wg.Add(1)
-		go func(group *Group, wg *sync.WaitGroup) {
-			Logger.SyncGroup(group)
-			wg.Done()
-		}(group, &wg)
+		go func() {
+			defer wg.Done()
+
+			for group := range jobs {
+				diff := db.SyncGroup(group, dryRun)
+
+				mu.Lock()
+				diffs = append(diffs, diff)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		jobs <- group
 	}
+	close(jobs)
 
 	wg.Wait()
+
+	return diffs
 }
 
 //SyncGroup method syncs the members in an in-memory group to the database entries
-//this can be done during runtime. Just in case.
-func (db *DBLogger) SyncGroup(group *Group) {
+//this can be done during runtime. Just in case. The returned diff shows what
+//changed, or what would change if dryRun is set.
+func (db *DBLogger) SyncGroup(group *Group, dryRun bool) MembershipDiff {
 	if !db.isActive {
-		return
+		return MembershipDiff{GroupName: group.Name}
 	}
 
 	var members []Member
 	db.Model(&group).Related(&members)
+	members = withUserNames(members)
+
+	diff := diffMembers(group.Name, group.Members, members)
+
+	if !dryRun {
+		group.Members = members
+	}
+
+	return diff
+}
+
+//SaveMembers method creates new rows for the given members of the group. The
+//members are returned with their new IDs.
+func (db *DBLogger) SaveMembers(group *Group, members []Member) []Member {
+	if !db.isActive {
+		return members
+	}
+
+	saved := make([]Member, 0, len(members))
+	for _, member := range members {
+		row := Member{GroupID: group.ID, GID: member.GID, Name: member.Name}
+		db.Create(&row)
 
-	group.Members = members
+		saved = append(saved, row)
+	}
+	db.recordChange("group", strings.ToLower(group.Name))
+
+	return saved
+}
+
+//SaveUser method creates or updates the user's entry in the directory table.
+func (db *DBLogger) SaveUser(user *ChatUser) {
+	if !db.isActive {
+		return
+	}
+
+	db.Where(ChatUser{GID: user.GID}).
+		Assign(ChatUser{Name: user.Name, LastSeen: user.LastSeen}).
+		FirstOrCreate(&ChatUser{})
+}
+
+//GetUsersFromDB method loads the user directory from the database. This needs
+//to happen before the groups are loaded so members can be given their names.
+func (db *DBLogger) GetUsersFromDB(users *UserDirectory) {
+	if !db.isActive {
+		return
+	}
+
+	var foundUsers []*ChatUser
+	db.Find(&foundUsers)
+
+	for _, user := range foundUsers {
+		users.Load(user)
+	}
+}
+
+//SaveRoleGrant method stores a role given to a user
+func (db *DBLogger) SaveRoleGrant(grant *RoleGrant) {
+	if !db.isActive {
+		return
+	}
+
+	db.Where(RoleGrant{GID: grant.GID, Role: grant.Role, RoomGID: grant.RoomGID}).
+		FirstOrCreate(&RoleGrant{})
+	db.recordChange("role", grant.GID)
+}
+
+//DeleteRoleGrant method removes a role from a user. The row is deleted
+//outright so the role can be granted again later.
+func (db *DBLogger) DeleteRoleGrant(grant *RoleGrant) {
+	if !db.isActive {
+		return
+	}
+
+	db.Unscoped().
+		Where("g_id = ? AND role = ? AND room_g_id = ?", grant.GID, grant.Role, grant.RoomGID).
+		Delete(RoleGrant{})
+	db.recordChange("role", grant.GID)
+}
+
+//GetRolesFromDB method loads every role grant into the role directory
+func (db *DBLogger) GetRolesFromDB(roles *RoleDirectory) {
+	if !db.isActive {
+		return
+	}
+
+	var grants []RoleGrant
+	db.Find(&grants)
+
+	roles.Replace(grants)
+}
+
+//SaveAuditEntry method adds an entry to the audit trail
+func (db *DBLogger) SaveAuditEntry(entry *AuditEntry) {
+	if !db.isActive {
+		return
+	}
+
+	db.Create(entry)
+}
+
+//SaveWebhookDelivery method adds an attempt to the webhook delivery log
+func (db *DBLogger) SaveWebhookDelivery(delivery *WebhookDelivery) {
+	if !db.isActive {
+		return
+	}
+
+	db.Create(delivery)
+}
+
+//GetGroupHistory method returns the latest audit entries for the group, newest
+//first. Changes to schedules that were set up for the group are included too.
+//With current set, only the entries since the name was last disbanded are
+//returned, so a new group reusing the name can't see the old group's history.
+func (db *DBLogger) GetGroupHistory(saveName string, current bool, limit int) []AuditEntry {
+	if !db.isActive {
+		return nil
+	}
+
+	var since uint
+
+	if current {
+		var disbands []AuditEntry
+		db.Where("group_name = ? AND action = ?", saveName, "disband").Order("id desc").Limit(1).Find(&disbands)
+
+		if len(disbands) > 0 {
+			since = disbands[0].ID
+		}
+	}
+
+	var entries []AuditEntry
+	db.Where("id > ? AND (group_name = ? OR schedule IN (SELECT schedule FROM audit_entries WHERE group_name = ? AND schedule <> '' AND id > ?))", since, saveName, saveName, since).
+		Order("id desc").
+		Limit(limit).
+		Find(&entries)
+
+	return entries
+}
+
+//SaveRateCounter method creates or updates a rate limit counter. Counters are
+//saved in the background, so they can arrive out of order, and a save only
+//takes if it's for a later window, or a higher count in the same window.
+//count is updated first so it's still compared against the old reset_at.
+func (db *DBLogger) SaveRateCounter(counter *RateCounter) {
+	if !db.isActive {
+		return
+	}
+
+	db.Exec("INSERT INTO rate_counters (`key`, count, reset_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE "+
+		"count = IF(VALUES(reset_at) > reset_at OR (VALUES(reset_at) = reset_at AND VALUES(count) > count), VALUES(count), count), "+
+		"reset_at = GREATEST(reset_at, VALUES(reset_at))",
+		counter.Key, counter.Count, counter.ResetAt,
+	)
+}
+
+//PruneRateCounters method clears out the rate limit counters that have reset
+func (db *DBLogger) PruneRateCounters(now time.Time) {
+	if !db.isActive {
+		return
+	}
+
+	db.Where("reset_at <= ?", now).Delete(RateCounter{})
+}
+
+//GetRateCountersFromDB method loads the rate limit counters that haven't reset
+//yet into the limiter, and clears out the ones that have.
+func (db *DBLogger) GetRateCountersFromDB(limiter *RateLimiter) {
+	if !db.isActive {
+		return
+	}
+
+	db.PruneRateCounters(time.Now())
+
+	var counters []RateCounter
+	db.Find(&counters)
+
+	limiter.Load(counters)
+}
+
+//withUserNames fills in the member names from the user directory, since they
+//are no longer stored alongside the member.
+func withUserNames(members []Member) []Member {
+	for i := range members {
+		members[i].Name = Users.Name(members[i].GID, members[i].Name)
+	}
+
+	return members
 }
 
 //CreateLogEntry method logs usage of the bot to the database.
@@ -233,10 +510,11 @@ func (db *DBLogger) SaveSchedule(schedule *Schedule) {
 
 	if schedule.ID != 0 {
 		db.Save(schedule)
-		return
+	} else {
+		db.Create(schedule)
 	}
 
-	db.Create(schedule)
+	db.recordChange("schedule", schedule.Key())
 }
 
 // GetSchedulesFromDB Grabbing all of the schedules from the
@@ -256,13 +534,132 @@ func (db *DBLogger) GetSchedulesFromDB(sMap ScheduleMap) {
 			continue
 		}
 
-		room := strings.Split(schedule.SessKey, ":")[0]
-		label := schedule.MessageLabel
-
 		schedule.StartTimer()
 
-		sMap[room+":"+label] = &schedule
+		sMap[schedule.Key()] = &schedule
+	}
+}
+
+//GetGroupByName pulls a single group and its members from the database. nil
+//is returned if the group doesn't exist.
+func (db *DBLogger) GetGroupByName(name string) *Group {
+	if !db.isActive {
+		return nil
+	}
+
+	group := new(Group)
+	if db.Where("LOWER(name) = ?", strings.ToLower(name)).First(group).RecordNotFound() {
+		return nil
+	}
+
+	var members []Member
+	db.Model(group).Related(&members)
+
+	group.Members = withUserNames(members)
+
+	return group
+}
+
+//GetScheduleByKey pulls the latest unfinished schedule for the room:label key
+//from the database. nil is returned if there isn't one.
+func (db *DBLogger) GetScheduleByKey(schedKey string) *Schedule {
+	if !db.isActive {
+		return nil
+	}
+
+	parts := strings.SplitN(schedKey, ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	schedule := new(Schedule)
+	notFound := db.Where("sess_key LIKE ? AND message_label = ? AND is_finished = ?", parts[0]+":%", parts[1], false).
+		Order("id desc").
+		First(schedule).
+		RecordNotFound()
+
+	if notFound {
+		return nil
+	}
+
+	return schedule
+}
+
+//AcquireLease method tries to take, or renew, the named lease for the holder.
+//It returns true if the holder has the lease once it's done. Without a
+//database there is nobody to share with, so the lease is always held.
+func (db *DBLogger) AcquireLease(name, holder string, ttl time.Duration) bool {
+	if !db.isActive {
+		return true
+	}
+
+	//Expiry is worked out with the database's clock rather than each
+	//replica's, so replicas whose clocks drift apart can't both hold it.
+	seconds := int(math.Ceil(ttl.Seconds()))
+
+	db.Exec("INSERT IGNORE INTO leases (name, holder, expires_at) VALUES (?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))", name, holder, seconds)
+	db.Exec("UPDATE leases SET holder = ?, expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE name = ? AND (holder = ? OR expires_at < NOW())",
+		holder, seconds, name, holder,
+	)
+
+	var (
+		leaseHolder string
+		live        bool
+	)
+
+	row := db.Raw("SELECT holder, expires_at > NOW() FROM leases WHERE name = ?", name).Row()
+	if err := row.Scan(&leaseHolder, &live); err != nil {
+		return false
+	}
+
+	return leaseHolder == holder && live
+}
+
+//ReleaseLease method gives up the named lease, if the holder has it, so another
+//replica can pick it up without waiting for it to expire.
+func (db *DBLogger) ReleaseLease(name, holder string) {
+	if !db.isActive {
+		return
+	}
+
+	db.Exec("UPDATE leases SET expires_at = DATE_SUB(NOW(), INTERVAL 1 SECOND) WHERE name = ? AND holder = ?", name, holder)
+}
+
+//recordChange adds an entry to the change feed so other replicas know to reload
+//the changed group, schedule, or roles. Without a replica ID there are no
+//other replicas, and nothing prunes the feed, so nothing is recorded.
+func (db *DBLogger) recordChange(kind, key string) {
+	if ReplicaID == "" {
+		return
+	}
+
+	db.Create(&ChangeLog{
+		Replica: ReplicaID,
+		Kind:    kind,
+		Key:     key,
+	})
+}
+
+//GetChangesSince method returns the change feed entries created at or after
+//the given time, oldest first.
+func (db *DBLogger) GetChangesSince(since time.Time) []ChangeLog {
+	if !db.isActive {
+		return nil
+	}
+
+	var changes []ChangeLog
+	db.Where("created_at >= ?", since).Order("id asc").Find(&changes)
+
+	return changes
+}
+
+//PruneChanges method deletes change feed entries older than the given age
+func (db *DBLogger) PruneChanges(age time.Duration) {
+	if !db.isActive {
+		return
 	}
+
+	db.Where("created_at < ?", time.Now().Add(-age)).Delete(ChangeLog{})
 }
 
 //Active is the setter method for the activity of the db logger
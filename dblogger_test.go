@@ -17,7 +17,7 @@ func TestSetupTables(t *testing.T) {
 		gotTables := make([]struct{ TableName string }, 0)
 		db.Raw("SELECT table_name FROM information_schema.tables WHERE table_schema = ?;", os.Getenv("HGNOTIFY_DB_NAME")).Scan(&gotTables)
 
-		wantedTables := []string{"notify_logs", "members", "groups", "schedules"}
+		wantedTables := []string{"notify_logs", "members", "groups", "schedules", "chat_users", "role_grants", "audit_entries", "rate_counters"}
 
 		for _, wantedTable := range wantedTables {
 			var found bool
@@ -33,6 +33,34 @@ func TestSetupTables(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("Members save on a database from before the user directory", func(t *testing.T) {
+		//Members used to keep their name in a required column
+		if db.Dialect().HasColumn("members", "name") {
+			db.Exec("ALTER TABLE members MODIFY name varchar(255) NOT NULL")
+		} else {
+			db.Exec("ALTER TABLE members ADD name varchar(255) NOT NULL")
+		}
+
+		Logger.SetupTables()
+
+		group := &Group{
+			Name:    RandString(10),
+			Members: []Member{{GID: "users/" + StringWithCharset(10, "0123456789")}},
+		}
+
+		//Strict mode refuses a missing value outright, rather than warning
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		tx.Exec("SET SESSION sql_mode = 'STRICT_ALL_TABLES'")
+		err := tx.Create(group).Error
+		tx.Exec("SET SESSION sql_mode = DEFAULT")
+
+		if err != nil {
+			t.Fatalf("Member not saved after migrating\nError: %s", err.Error())
+		}
+	})
 }
 
 func TestSaveCreatedGroup(t *testing.T) {
@@ -67,8 +95,7 @@ func TestSaveCreatedGroup(t *testing.T) {
 		var gotMember Member
 		db.Raw("SELECT * FROM members WHERE group_id = (SELECT id FROM groups WHERE name = ? );", wantedGroup.Name).Scan(&gotMember)
 
-		if wantedGroup.Members[0].Name != gotMember.Name ||
-			wantedGroup.Members[0].GroupID != gotMember.GroupID ||
+		if wantedGroup.Members[0].GroupID != gotMember.GroupID ||
 			wantedGroup.Members[0].GID != gotMember.GID {
 			t.Fatalf("Incorrect group in database.\nWanted: %+v\nGot: %+v",
 				wantedGroup.Members,
@@ -139,6 +166,31 @@ func TestUpdatePrivacyDB(t *testing.T) {
 	})
 }
 
+func TestSaveRoomSyncDB(t *testing.T) {
+	db := Logger.DB
+
+	wantedName := genRandName(0)
+	wantedRoomID := genRoomGID(0)
+
+	initialGroup := &Group{Name: wantedName, SyncRoomID: wantedRoomID}
+
+	db.Model(&Group{}).Create(initialGroup)
+
+	t.Run("Correctly clears the synced room", func(t *testing.T) {
+		initialGroup.SyncRoomID = ""
+
+		Logger.SaveRoomSync(initialGroup)
+
+		var gotGroup Group
+		db.Raw("SELECT name, sync_room_id FROM groups WHERE name = ?", wantedName).
+			Scan(&gotGroup)
+
+		if gotGroup.SyncRoomID != "" {
+			t.Fatalf("Did not clear the synced room:\nGot: %+v", gotGroup)
+		}
+	})
+}
+
 func TestSaveMemberAddition(t *testing.T) {
 	db := Logger.DB
 	initGroup := &Group{Name: genRandName(0)}
@@ -146,10 +198,10 @@ func TestSaveMemberAddition(t *testing.T) {
 	db.Model(&Group{}).Create(initGroup)
 
 	t.Run("Correctly adds member to empty group", func(t *testing.T) {
-		wantedMemberName := genRandName(0)
+		wantedMemberGID := genUserGID(0)
 
 		initGroup.Members = append(initGroup.Members, Member{
-			Name: wantedMemberName,
+			GID: wantedMemberGID,
 		})
 
 		Logger.SaveMemberAddition(initGroup)
@@ -161,19 +213,19 @@ func TestSaveMemberAddition(t *testing.T) {
 			t.Fatalf("Incorrect number of members returned:\nExpected: 1\nGot: %d", len(gotMembers))
 		}
 
-		if gotMembers[0].Name != wantedMemberName {
+		if gotMembers[0].GID != wantedMemberGID {
 			t.Fatalf("Retrieved incorrect member:\nWanted: %q\nGot %q",
-				wantedMemberName,
-				gotMembers[0].Name,
+				wantedMemberGID,
+				gotMembers[0].GID,
 			)
 		}
 	})
 
 	t.Run("Correctly adds member to non empty group", func(t *testing.T) {
-		wantedMemberName := genRandName(0)
+		wantedMemberGID := genUserGID(0)
 
 		initGroup.Members = append(initGroup.Members, Member{
-			Name: wantedMemberName,
+			GID: wantedMemberGID,
 		})
 
 		Logger.SaveMemberAddition(initGroup)
@@ -185,10 +237,10 @@ func TestSaveMemberAddition(t *testing.T) {
 			t.Fatalf("Incorrect number of members returned:\nExpected: 2\nGot: %d", len(gotMembers))
 		}
 
-		if gotMembers[1].Name != wantedMemberName {
+		if gotMembers[1].GID != wantedMemberGID {
 			t.Fatalf("Retrieved incorrect member:\nWanted: %q\nGot %q",
-				wantedMemberName,
-				gotMembers[0].Name,
+				wantedMemberGID,
+				gotMembers[1].GID,
 			)
 		}
 	})
@@ -200,9 +252,9 @@ func TestSaveMemberRemoval(t *testing.T) {
 	initGroup := &Group{
 		Name: genRandName(0),
 		Members: []Member{
-			{Name: genRandName(0)},
-			{Name: genRandName(0)},
-			{Name: genRandName(0)},
+			{GID: genUserGID(0)},
+			{GID: genUserGID(0)},
+			{GID: genUserGID(0)},
 		},
 	}
 
@@ -225,7 +277,7 @@ func TestSaveMemberRemoval(t *testing.T) {
 			t.Fatalf("Incorrect number of members returned:\nExpected: 1\nGot: %d", len(gotMembers))
 		}
 
-		if gotMembers[0].Name != member3.Name {
+		if gotMembers[0].GID != member3.GID {
 			t.Fatal("Incorrect member remaining")
 		}
 	})
@@ -251,29 +303,29 @@ func TestGetGroupsFromDB(t *testing.T) {
 
 	groupNames := []string{genRandName(0), genRandName(0), genRandName(0)}
 
-	memberNames := []string{genRandName(0), genRandName(0), genRandName(0)}
+	memberGIDs := []string{genUserGID(0), genUserGID(0), genUserGID(0)}
 
 	db.Model(&Group{}).Create(&Group{
 		Name: groupNames[0],
 		Members: []Member{
-			{Name: memberNames[0]},
-			{Name: memberNames[1]},
+			{GID: memberGIDs[0]},
+			{GID: memberGIDs[1]},
 		},
 	})
 
 	db.Model(&Group{}).Create(&Group{
 		Name: groupNames[1],
 		Members: []Member{
-			{Name: memberNames[0]},
+			{GID: memberGIDs[0]},
 		},
 	})
 
 	db.Model(&Group{}).Create(&Group{
 		Name: groupNames[2],
 		Members: []Member{
-			{Name: memberNames[0]},
-			{Name: memberNames[1]},
-			{Name: memberNames[2]},
+			{GID: memberGIDs[0]},
+			{GID: memberGIDs[1]},
+			{GID: memberGIDs[2]},
 		},
 	})
 
@@ -289,7 +341,7 @@ func TestGetGroupsFromDB(t *testing.T) {
 			}
 
 			for i, member := range group.Members {
-				if member.Name != memberNames[i] {
+				if member.GID != memberGIDs[i] {
 					t.Fatal("Wanted member not associated with correct group")
 				}
 			}
@@ -329,8 +381,7 @@ func TestGetGroupByID(t *testing.T) {
 			t.Fatal("No members returned")
 		}
 
-		if wantedGroup.Members[0].Name != gotGroup.Members[0].Name ||
-			wantedGroup.Members[0].GroupID != gotGroup.Members[0].GroupID ||
+		if wantedGroup.Members[0].GroupID != gotGroup.Members[0].GroupID ||
 			wantedGroup.Members[0].GID != gotGroup.Members[0].GID {
 			t.Errorf("Incorrect member retrieved from database.\nWanted: %+v\nGot: %+v",
 				wantedGroup.Members,
@@ -357,8 +408,7 @@ func TestGetGroupByID(t *testing.T) {
 		}
 
 		for i, gotMember := range wantedGroup.Members {
-			if wantedGroup.Members[i].Name != gotMember.Name ||
-				wantedGroup.Members[i].GroupID != gotMember.GroupID ||
+			if wantedGroup.Members[i].GroupID != gotMember.GroupID ||
 				wantedGroup.Members[i].GID != gotMember.GID {
 				t.Errorf("Incorrect member retrieved from database.\nWanted: %+v\nGot: %+v",
 					wantedGroup.Members[i],
@@ -369,6 +419,211 @@ func TestGetGroupByID(t *testing.T) {
 	})
 }
 
+func TestSaveUser(t *testing.T) {
+	db := Logger.DB
+
+	wantedUser := &ChatUser{
+		GID:      genUserGID(0),
+		Name:     genRandName(0),
+		LastSeen: time.Now(),
+	}
+
+	t.Run("Correctly adds new user", func(t *testing.T) {
+		Logger.SaveUser(wantedUser)
+
+		var gotUser ChatUser
+		db.Where(&ChatUser{GID: wantedUser.GID}).First(&gotUser)
+
+		if gotUser.Name != wantedUser.Name {
+			t.Fatalf("Incorrect user in database.\nWanted: %q\nGot: %q",
+				wantedUser.Name,
+				gotUser.Name,
+			)
+		}
+	})
+
+	t.Run("Correctly updates display name", func(t *testing.T) {
+		wantedUser.Name = genRandName(0)
+
+		Logger.SaveUser(wantedUser)
+
+		var gotUsers []ChatUser
+		db.Where(&ChatUser{GID: wantedUser.GID}).Find(&gotUsers)
+
+		if len(gotUsers) != 1 {
+			t.Fatalf("Incorrect number of users returned:\nExpected: 1\nGot: %d", len(gotUsers))
+		}
+
+		if gotUsers[0].Name != wantedUser.Name {
+			t.Fatalf("Name not updated.\nWanted: %q\nGot: %q",
+				wantedUser.Name,
+				gotUsers[0].Name,
+			)
+		}
+	})
+}
+
+func TestGetUsersFromDB(t *testing.T) {
+	db := Logger.DB
+
+	wantedUser := &ChatUser{
+		GID:      genUserGID(0),
+		Name:     genRandName(0),
+		LastSeen: time.Now(),
+	}
+	db.Create(wantedUser)
+
+	t.Run("Successfully retrieves users from DB", func(t *testing.T) {
+		users := newUserDirectory()
+
+		Logger.GetUsersFromDB(users)
+
+		if gotName := users.Name(wantedUser.GID, ""); gotName != wantedUser.Name {
+			t.Fatalf("Wanted user wasn't retrieved\nGot name: %q", gotName)
+		}
+	})
+}
+
+func TestSaveRoleGrant(t *testing.T) {
+	db := Logger.DB
+
+	wantedGrant := &RoleGrant{
+		GID:     genUserGID(0),
+		Role:    RoleModerator,
+		RoomGID: genRoomGID(0),
+	}
+
+	t.Run("Correctly saves grant", func(t *testing.T) {
+		Logger.SaveRoleGrant(wantedGrant)
+		Logger.SaveRoleGrant(wantedGrant)
+
+		var gotGrants []RoleGrant
+		db.Where(&RoleGrant{GID: wantedGrant.GID}).Find(&gotGrants)
+
+		if len(gotGrants) != 1 {
+			t.Fatalf("Incorrect number of grants saved\nWanted: 1\nGot: %d", len(gotGrants))
+		}
+	})
+
+	t.Run("Successfully retrieves grants from DB", func(t *testing.T) {
+		roles := newRoleDirectory()
+
+		Logger.GetRolesFromDB(roles)
+
+		if !roles.IsModerator(wantedGrant.GID, wantedGrant.RoomGID) {
+			t.Fatal("Wanted grant wasn't retrieved")
+		}
+	})
+
+	t.Run("Correctly deletes grant", func(t *testing.T) {
+		Logger.DeleteRoleGrant(wantedGrant)
+
+		var count int
+		db.Unscoped().Model(&RoleGrant{}).Where("g_id = ?", wantedGrant.GID).Count(&count)
+
+		if count != 0 {
+			t.Fatalf("Grant was not deleted, found %d", count)
+		}
+	})
+}
+
+func TestGetGroupHistory(t *testing.T) {
+	groupName := strings.ToLower(genRandName(0))
+	schedKey := genRoomGID(0) + ":" + RandString(10)
+
+	Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "create", GroupName: groupName})
+	Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "schedule onetime", GroupName: groupName, Schedule: schedKey})
+	Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "schedule remove", Schedule: schedKey})
+	Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "create", GroupName: genRandName(0)})
+
+	t.Run("Returns group and schedule entries, newest first", func(t *testing.T) {
+		entries := Logger.GetGroupHistory(groupName, true, historyLimit)
+
+		if len(entries) != 3 {
+			t.Fatalf("Incorrect number of entries returned\nWanted: 3\nGot: %d", len(entries))
+		}
+
+		if entries[0].Action != "schedule remove" || entries[2].Action != "create" {
+			t.Fatalf("Entries returned out of order\nGot: %+v", entries)
+		}
+	})
+
+	t.Run("Limits the number of entries", func(t *testing.T) {
+		if entries := Logger.GetGroupHistory(groupName, true, 1); len(entries) != 1 {
+			t.Fatalf("Incorrect number of entries returned\nWanted: 1\nGot: %d", len(entries))
+		}
+	})
+
+	t.Run("New group with the same name only sees its own entries", func(t *testing.T) {
+		Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "disband", GroupName: groupName})
+		Logger.SaveAuditEntry(&AuditEntry{ActorGID: genUserGID(0), Action: "create", GroupName: groupName})
+
+		entries := Logger.GetGroupHistory(groupName, true, historyLimit)
+		if len(entries) != 1 || entries[0].Action != "create" {
+			t.Fatalf("Old group's entries returned\nGot: %+v", entries)
+		}
+
+		if entries := Logger.GetGroupHistory(groupName, false, historyLimit); len(entries) != 5 {
+			t.Fatalf("Incorrect number of entries for a disbanded name\nWanted: 5\nGot: %d", len(entries))
+		}
+	})
+}
+
+func TestSaveRateCounter(t *testing.T) {
+	counter := &RateCounter{
+		Key:     LimitSender + ":" + genUserGID(0),
+		Count:   1,
+		ResetAt: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+
+	t.Run("Correctly saves and updates counter", func(t *testing.T) {
+		Logger.SaveRateCounter(counter)
+
+		counter.Count = 2
+		Logger.SaveRateCounter(counter)
+
+		limiter := newRateLimiter(HGNConfig{})
+		Logger.GetRateCountersFromDB(limiter)
+
+		got, exist := limiter.counters[counter.Key]
+		if !exist {
+			t.Fatal("Counter wasn't retrieved")
+		}
+
+		if got.Count != counter.Count {
+			t.Fatalf("Counter not updated\nWanted: %d\nGot: %d", counter.Count, got.Count)
+		}
+	})
+
+	t.Run("Late saves don't overwrite newer counters", func(t *testing.T) {
+		Logger.SaveRateCounter(&RateCounter{Key: counter.Key, Count: 1, ResetAt: counter.ResetAt})
+		Logger.SaveRateCounter(&RateCounter{Key: counter.Key, Count: 5, ResetAt: counter.ResetAt.Add(-time.Minute)})
+
+		limiter := newRateLimiter(HGNConfig{})
+		Logger.GetRateCountersFromDB(limiter)
+
+		if got := limiter.counters[counter.Key]; got == nil || got.Count != 2 {
+			t.Fatalf("Counter was overwritten\nWanted: %+v\nGot: %+v", counter, got)
+		}
+	})
+
+	t.Run("Clears out counters that have reset", func(t *testing.T) {
+		reset := &RateCounter{
+			Key:     LimitSender + ":" + genUserGID(0),
+			Count:   1,
+			ResetAt: time.Now().Add(-time.Hour),
+		}
+		Logger.SaveRateCounter(reset)
+
+		limiter := newRateLimiter(HGNConfig{})
+		Logger.GetRateCountersFromDB(limiter)
+
+		if _, exist := limiter.counters[reset.Key]; exist {
+			t.Fatal("Reset counter was retrieved")
+		}
+	})
+}
+
 func TestSaveSchedule(t *testing.T) {
 	db := Logger.DB
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//MembershipDiff describes how a group's members differ between what's in
+//memory and what's in the database. Added are the members that syncing would
+//bring into memory, Removed are the ones syncing would drop from memory.
+type MembershipDiff struct {
+	GroupName string
+	Added     []Member
+	Removed   []Member
+}
+
+//diffMembers compares the current member list to the wanted one, matching
+//members on their GID.
+func diffMembers(groupName string, current, wanted []Member) MembershipDiff {
+	diff := MembershipDiff{GroupName: groupName}
+
+	currentGIDs := make(map[string]bool)
+	for _, member := range current {
+		currentGIDs[member.GID] = true
+	}
+
+	wantedGIDs := make(map[string]bool)
+	for _, member := range wanted {
+		wantedGIDs[member.GID] = true
+
+		if !currentGIDs[member.GID] {
+			diff.Added = append(diff.Added, member)
+		}
+	}
+
+	for _, member := range current {
+		if !wantedGIDs[member.GID] {
+			diff.Removed = append(diff.Removed, member)
+		}
+	}
+
+	return diff
+}
+
+//HasChanges tells if anything would change from applying the diff
+func (d MembershipDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+//String lays the diff out one member per line, with a leading + for the
+//members added and a - for the members removed.
+func (d MembershipDiff) String() string {
+	if !d.HasChanges() {
+		return fmt.Sprintf("%s: no changes", d.GroupName)
+	}
+
+	text := d.GroupName + ":"
+
+	for _, member := range d.Added {
+		text += fmt.Sprintf("\n  + %s (%s)", Users.Name(member.GID, member.Name), member.GID)
+	}
+
+	for _, member := range d.Removed {
+		text += fmt.Sprintf("\n  - %s (%s)", Users.Name(member.GID, member.Name), member.GID)
+	}
+
+	return text
+}
+
+//formatDiffs joins several group diffs together, in order of group name, and
+//leaves out the groups that had no changes.
+func formatDiffs(diffs []MembershipDiff) string {
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].GroupName < diffs[j].GroupName
+	})
+
+	var changed []string
+	for _, diff := range diffs {
+		if diff.HasChanges() {
+			changed = append(changed, diff.String())
+		}
+	}
+
+	return strings.Join(changed, "\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffMembers(t *testing.T) {
+	keptGID := genUserGID(0)
+	addedGID := genUserGID(0)
+	removedGID := genUserGID(0)
+
+	current := []Member{{GID: keptGID}, {GID: removedGID}}
+	wanted := []Member{{GID: keptGID}, {GID: addedGID}}
+
+	t.Run("Finds added and removed members", func(t *testing.T) {
+		diff := diffMembers("group", current, wanted)
+
+		if len(diff.Added) != 1 || diff.Added[0].GID != addedGID {
+			t.Fatalf("Incorrect added members\nGot: %+v", diff.Added)
+		}
+
+		if len(diff.Removed) != 1 || diff.Removed[0].GID != removedGID {
+			t.Fatalf("Incorrect removed members\nGot: %+v", diff.Removed)
+		}
+	})
+
+	t.Run("Reports no changes for matching members", func(t *testing.T) {
+		diff := diffMembers("group", current, current)
+
+		if diff.HasChanges() {
+			t.Fatalf("Should not have changes\nGot: %+v", diff)
+		}
+	})
+
+	t.Run("Lists changes by member", func(t *testing.T) {
+		gotText := diffMembers("group", current, wanted).String()
+
+		if !strings.Contains(gotText, "+ ") || !strings.Contains(gotText, "("+addedGID+")") {
+			t.Fatalf("Added member not in diff\nGot: %q", gotText)
+		}
+
+		if !strings.Contains(gotText, "- ") || !strings.Contains(gotText, "("+removedGID+")") {
+			t.Fatalf("Removed member not in diff\nGot: %q", gotText)
+		}
+	})
+}
+
+func TestFormatDiffs(t *testing.T) {
+	diffs := []MembershipDiff{
+		{GroupName: "unchanged"},
+		{GroupName: "zgroup", Added: []Member{{GID: genUserGID(0)}}},
+		{GroupName: "agroup", Removed: []Member{{GID: genUserGID(0)}}},
+	}
+
+	t.Run("Leaves out unchanged groups and sorts the rest", func(t *testing.T) {
+		gotText := formatDiffs(diffs)
+
+		if strings.Contains(gotText, "unchanged") {
+			t.Fatalf("Unchanged group should be left out\nGot: %q", gotText)
+		}
+
+		if strings.Index(gotText, "agroup") > strings.Index(gotText, "zgroup") {
+			t.Fatalf("Groups should be sorted by name\nGot: %q", gotText)
+		}
+	})
+}
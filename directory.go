@@ -0,0 +1,623 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//directoryPolicy is the import policy directory and room syncs are applied
+//with. It makes the members match the source the same as ImportReplace, but
+//leaves whether the group is private alone.
+const directoryPolicy = "directory"
+
+//directoryDetail is noted on the audit entries of the changes a directory
+//sync makes
+const directoryDetail = "from the directory"
+
+//defaultDirectoryInterval is how often the groups are synced with the
+//directory when no interval is configured
+const defaultDirectoryInterval = time.Hour
+
+//directoryMsgObj is who the changes made by a directory sync are made by
+var directoryMsgObj = messageResponse{
+	Message:    message{Sender: User{Name: "directory sync", GID: "directory", Type: "BOT"}},
+	FromMaster: true,
+}
+
+//DirectoryEntry is a person as a directory lists them. GID is their Chat user
+//id if the directory keeps it, otherwise they're looked up by Email.
+type DirectoryEntry struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	GID   string `json:"gid"`
+}
+
+//DirectorySource is somewhere the members of a group are read from
+type DirectorySource interface {
+	Entries() ([]DirectoryEntry, error)
+}
+
+//FileSource reads the members from a CSV file with an email, name, and gid
+//header, or a JSON list of entries
+type FileSource struct {
+	Path string
+}
+
+//Entries reads the file, picking the format from its extension
+func (fs FileSource) Entries() ([]DirectoryEntry, error) {
+	file, err := os.Open(fs.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(fs.Path), ".csv") {
+		return readCSVEntries(file)
+	}
+
+	return readJSONEntries(file)
+}
+
+//HTTPSource fetches the members as a JSON list of entries, the same as a
+//JSON file, sending the token as a bearer token if there is one
+type HTTPSource struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+
+	client *http.Client
+}
+
+//Entries fetches the list from the endpoint
+func (hs HTTPSource) Entries() ([]DirectoryEntry, error) {
+	client := hs.client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 30}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, hs.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if hs.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hs.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", hs.URL, resp.Status)
+	}
+
+	return readJSONEntries(resp.Body)
+}
+
+//LDAPSource searches a directory server for the members. The attributes the
+//email, name, and Chat user id are kept in can be set, and default to mail,
+//cn, and none. ldap:// connections are only encrypted with StartTLS, and the
+//server's certificate may be signed by the CAs in CAFile.
+type LDAPSource struct {
+	URL            string `yaml:"url"`
+	StartTLS       bool   `yaml:"startTLS"`
+	CAFile         string `yaml:"caFile"`
+	BindDN         string `yaml:"bindDN"`
+	BindPassword   string `yaml:"bindPassword"`
+	BaseDN         string `yaml:"baseDN"`
+	Filter         string `yaml:"filter"`
+	EmailAttribute string `yaml:"emailAttribute"`
+	NameAttribute  string `yaml:"nameAttribute"`
+	GIDAttribute   string `yaml:"gidAttribute"`
+}
+
+//Entries binds to the server and runs the search
+func (ls LDAPSource) Entries() ([]DirectoryEntry, error) {
+	emailAttribute, nameAttribute := ls.EmailAttribute, ls.NameAttribute
+	if emailAttribute == "" {
+		emailAttribute = "mail"
+	}
+	if nameAttribute == "" {
+		nameAttribute = "cn"
+	}
+
+	attributes := []string{emailAttribute, nameAttribute}
+	if ls.GIDAttribute != "" {
+		attributes = append(attributes, ls.GIDAttribute)
+	}
+
+	rootCAs, err := ls.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialLDAP(ls.URL, ls.StartTLS, rootCAs)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if ls.BindDN != "" {
+		if err := conn.Bind(ls.BindDN, ls.BindPassword); err != nil {
+			return nil, fmt.Errorf("couldn't bind as %q: %s", ls.BindDN, err.Error())
+		}
+	}
+
+	found, err := conn.Search(ls.BaseDN, ls.Filter, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []DirectoryEntry
+	for _, entry := range found {
+		entries = append(entries, DirectoryEntry{
+			Email: entry.Get(emailAttribute),
+			Name:  entry.Get(nameAttribute),
+			GID:   entry.Get(ls.GIDAttribute),
+		})
+	}
+
+	return entries, nil
+}
+
+//rootCAs reads the CAs the server's certificate may be signed by, or nothing
+//to use the system's
+func (ls LDAPSource) rootCAs() (*x509.CertPool, error) {
+	if ls.CAFile == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(ls.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", ls.CAFile)
+	}
+
+	return pool, nil
+}
+
+//readCSVEntries reads entries from CSV, matching the columns to the header
+//regardless of case or order
+func readCSVEntries(reader io.Reader) ([]DirectoryEntry, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, heading := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(heading))] = i
+	}
+
+	_, hasEmail := columns["email"]
+	_, hasGID := columns["gid"]
+	if !hasEmail && !hasGID {
+		return nil, errors.New("expected an email or gid column in the header")
+	}
+
+	cell := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	var entries []DirectoryEntry
+	for _, row := range rows[1:] {
+		entries = append(entries, DirectoryEntry{
+			Email: cell(row, "email"),
+			Name:  cell(row, "name"),
+			GID:   cell(row, "gid"),
+		})
+	}
+
+	return entries, nil
+}
+
+//readJSONEntries reads entries from a JSON list
+func readJSONEntries(reader io.Reader) ([]DirectoryEntry, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []DirectoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+//DirectoryGroup is a group kept filled from one of the sources
+type DirectoryGroup struct {
+	Group string      `yaml:"group"`
+	LDAP  *LDAPSource `yaml:"ldap"`
+	File  string      `yaml:"file"`
+	HTTP  *HTTPSource `yaml:"http"`
+}
+
+//source returns the one source the group is filled from
+func (dg DirectoryGroup) source() (DirectorySource, error) {
+	var sources []DirectorySource
+
+	if dg.LDAP != nil {
+		sources = append(sources, *dg.LDAP)
+	}
+	if dg.File != "" {
+		sources = append(sources, FileSource{Path: dg.File})
+	}
+	if dg.HTTP != nil {
+		sources = append(sources, *dg.HTTP)
+	}
+
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("expected one of ldap, file, or http for %q", dg.Group)
+	}
+
+	return sources[0], nil
+}
+
+//DirectoryPlan is what syncing with the directory would change. Problems are
+//the groups that were left alone because their source couldn't be read, and
+//the people who couldn't be matched to a Chat user.
+type DirectoryPlan struct {
+	ImportPlan
+	Problems []string
+}
+
+//String lists the changes to each group, followed by the problems
+func (dp DirectoryPlan) String() string {
+	lines := []string{dp.ImportPlan.String()}
+	if lines[0] == "" {
+		lines = nil
+	}
+
+	return strings.Join(append(lines, dp.Problems...), "\n")
+}
+
+//DirectorySync keeps groups filled from the company directory, syncing them
+//every Interval. People are matched to Chat users by the id the directory
+//keeps, or by their email through Users. Emails given in chat are resolved
+//through Users too, then through the Lookup endpoint if there is one.
+type DirectorySync struct {
+	Interval time.Duration
+	Sources  []DirectoryGroup
+	Users    map[string]string
+	Lookup   *HTTPResolver
+}
+
+//directoryConfig is the directory sync's configuration file
+type directoryConfig struct {
+	Interval string            `yaml:"interval"`
+	Sources  []DirectoryGroup  `yaml:"sources"`
+	Users    map[string]string `yaml:"users"`
+	Lookup   *HTTPResolver     `yaml:"lookup"`
+}
+
+//loadDirectorySync sets up the directory sync from its configuration file.
+//Without a file there's nothing to sync, and an interval of 0 only syncs on
+//request.
+func loadDirectorySync(path string) *DirectorySync {
+	ds := &DirectorySync{Interval: defaultDirectoryInterval, Users: make(map[string]string)}
+
+	if path == "" {
+		return ds
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading the directory sync, it is disabled: %s", err.Error())
+		return ds
+	}
+
+	var conf directoryConfig
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		log.Printf("Error parsing the directory sync, it is disabled: %s", err.Error())
+		return ds
+	}
+
+	if conf.Interval != "" {
+		interval, err := time.ParseDuration(conf.Interval)
+		if err != nil {
+			log.Printf("Invalid directory sync interval %q, groups are only synced on request: %s", conf.Interval, err)
+			interval = 0
+		}
+
+		ds.Interval = interval
+	}
+
+	for email, gid := range conf.Users {
+		if !strings.HasPrefix(gid, "users/") {
+			log.Printf("Invalid Chat user id %q for %q in the directory sync, it is skipped", gid, email)
+			continue
+		}
+
+		ds.Users[strings.ToLower(email)] = gid
+	}
+
+	if lookup := conf.Lookup; lookup != nil {
+		if strings.HasPrefix(lookup.URL, "http://") || strings.HasPrefix(lookup.URL, "https://") {
+			ds.Lookup = lookup
+		} else {
+			log.Printf("Invalid email lookup %q, it is skipped: expected an http(s) url", lookup.URL)
+		}
+	}
+
+	seen := checkSeen()
+	for _, source := range conf.Sources {
+		_, err := source.source()
+
+		switch {
+		case !groupNamePattern.MatchString(source.Group):
+			log.Printf("Invalid group name %q in the directory sync, it is skipped", source.Group)
+		case seen(strings.ToLower(source.Group)):
+			log.Printf("The group %q is synced more than once in the directory sync, only the first is used", source.Group)
+		case err != nil:
+			log.Printf("Invalid directory source, it is skipped: %s", err.Error())
+		default:
+			ds.Sources = append(ds.Sources, source)
+		}
+	}
+
+	return ds
+}
+
+//Start syncs the groups in the background on every interval. It does nothing
+//if there's nothing to sync.
+func (ds *DirectorySync) Start(Groups GroupMap) {
+	if len(ds.Sources) == 0 || ds.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(ds.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ds.run(Groups)
+		}
+	}()
+}
+
+//run syncs every group with the directory, if this replica owns the
+//scheduler. The sources are fetched without holding stateLock.
+func (ds *DirectorySync) run(Groups GroupMap) {
+	stateLock.Lock()
+	owner := ownsScheduler()
+	stateLock.Unlock()
+
+	if !owner {
+		return
+	}
+
+	fetched := ds.fetch(ds.Sources)
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if !ownsScheduler() {
+		return
+	}
+
+	plan := ds.plan(Groups, fetched)
+	Groups.applyImport(plan.ImportPlan, directoryDetail, directoryMsgObj)
+
+	if plan.HasChanges() || len(plan.Problems) > 0 {
+		log.Printf("Groups synced with the directory:\n%s", plan)
+	}
+}
+
+//directoryResult is what was read from a group's source
+type directoryResult struct {
+	Group   string
+	Entries []DirectoryEntry
+	Err     error
+}
+
+//fetch reads the entries of each group from its source
+func (ds *DirectorySync) fetch(sources []DirectoryGroup) []directoryResult {
+	var results []directoryResult
+
+	for _, dg := range sources {
+		result := directoryResult{Group: dg.Group}
+
+		source, err := dg.source()
+		if err == nil {
+			result.Entries, err = source.Entries()
+		}
+
+		result.Err = err
+		results = append(results, result)
+	}
+
+	return results
+}
+
+//Fetch reads the sources of the group, or every group
+func (ds *DirectorySync) Fetch(groupName string) ([]directoryResult, error) {
+	sources, err := ds.sourcesFor(groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds.fetch(sources), nil
+}
+
+//Manages tells if the group is synced with the directory
+func (ds *DirectorySync) Manages(groupName string) bool {
+	for _, dg := range ds.Sources {
+		if strings.EqualFold(dg.Group, groupName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//directoryReply tells the sender the group can only be changed through the
+//directory
+func directoryReply(groupName string) string {
+	return fmt.Sprintf("The group %q is synced with the company directory, so its members can only be changed there.", groupName)
+}
+
+//sourcesFor returns the source of the group, or every source when there's no
+//group name
+func (ds *DirectorySync) sourcesFor(groupName string) ([]DirectoryGroup, error) {
+	if len(ds.Sources) == 0 {
+		return nil, errors.New("there are no groups synced with the directory")
+	}
+
+	if groupName == "" {
+		return ds.Sources, nil
+	}
+
+	for _, dg := range ds.Sources {
+		if strings.EqualFold(dg.Group, groupName) {
+			return []DirectoryGroup{dg}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the group %q isn't synced with the directory", groupName)
+}
+
+//plan works out what filling the groups with the entries read would change.
+//Groups whose source couldn't be read, or listed nobody, are left as they are
+//rather than emptied.
+func (ds *DirectorySync) plan(Groups GroupMgr, results []directoryResult) DirectoryPlan {
+	var (
+		doc      GroupExport
+		problems []string
+	)
+
+	for _, result := range results {
+		if result.Err != nil {
+			problems = append(problems, fmt.Sprintf("%s: left as it is, the directory couldn't be read: %s", result.Group, result.Err.Error()))
+			continue
+		}
+
+		members, unmatched := ds.members(result.Entries)
+
+		if len(unmatched) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: no Chat user found for %s", result.Group, strings.Join(unmatched, ", ")))
+		}
+
+		if len(members) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: left as it is, the directory listed nobody", result.Group))
+			continue
+		}
+
+		doc.Groups = append(doc.Groups, ExportedGroup{Group: Group{Name: result.Group, Members: members}})
+	}
+
+	sort.Strings(problems)
+	return DirectoryPlan{ImportPlan: planImport(Groups, doc, directoryPolicy), Problems: problems}
+}
+
+//members matches the entries to Chat users, returning the members along with
+//the entries that couldn't be matched
+func (ds *DirectorySync) members(entries []DirectoryEntry) ([]Member, []string) {
+	var (
+		members   []Member
+		unmatched []string
+	)
+
+	seen := checkSeen()
+	for _, entry := range entries {
+		gid := chatUserID(entry.GID)
+
+		if gid == "" {
+			gid = ds.Users[strings.ToLower(entry.Email)]
+		}
+
+		if gid == "" {
+			who := entry.Email
+			if who == "" {
+				who = entry.Name
+			}
+
+			unmatched = append(unmatched, who)
+			continue
+		}
+
+		if !seen(gid) {
+			members = append(members, Member{Name: entry.Name, GID: gid})
+		}
+	}
+
+	return members, unmatched
+}
+
+//SyncDirectory method syncs the group, or every group, with the directory for
+//the bot's admin, replying with what was changed. Passing a dryRun only shows
+//what would change. The directory is read by the command's Lookup.
+func (gm GroupMap) SyncDirectory(groupName, dryRun string, msgObj messageResponse) string {
+	results, err := msgObj.directoryResults(groupName)
+	if err != nil {
+		return fmt.Sprintf("I couldn't sync with the directory, %s.", err.Error())
+	}
+
+	plan := Directory.plan(gm, results)
+
+	if !plan.HasChanges() {
+		text := "The groups already match the directory."
+		if len(plan.Problems) > 0 {
+			text += fmt.Sprintf(" ```%s```", plan)
+		}
+
+		return text
+	}
+
+	if dryRun != "" {
+		return fmt.Sprintf("Dry run, nothing was changed. Syncing with the directory would make these changes: ```%s```", plan)
+	}
+
+	gm.applyImport(plan.ImportPlan, directoryDetail, msgObj)
+	return fmt.Sprintf("Synced with the directory with these changes: ```%s```", plan)
+}
+
+//confirmDirectorySync asks before syncing with the directory, showing what it
+//would change
+func confirmDirectorySync(Groups GroupMgr, _ ScheduleMgr, msgObj messageResponse, args Arguments) string {
+	if args["dryRun"] != "" {
+		return ""
+	}
+
+	results, err := msgObj.directoryResults(args["groupName"])
+	if err != nil {
+		return ""
+	}
+
+	plan := Directory.plan(Groups, results)
+	if !plan.HasChanges() {
+		return ""
+	}
+
+	return fmt.Sprintf("Apply these changes from the directory? ```%s```", plan)
+}
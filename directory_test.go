@@ -0,0 +1,617 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+//fakeLDAP is a stand-in directory server. It takes a simple bind with the
+//password, and answers searches with the entries matching the filter. With a
+//TLS config it takes StartTLS, and then only answers over TLS.
+func fakeLDAP(t *testing.T, password string, entries []ldapEntry, tlsConfig *tls.Config) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveFakeLDAP(conn, password, entries, tlsConfig)
+		}
+	}()
+
+	return listener
+}
+
+func serveFakeLDAP(conn net.Conn, password string, entries []ldapEntry, tlsConfig *tls.Config) {
+	defer func() { conn.Close() }()
+
+	encrypted := false
+
+	for {
+		envelope, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		id := envelope.Children[0].Value.(int64)
+		op := envelope.Children[1]
+
+		reply := func(response *ber.Packet) {
+			message := ber.NewSequence("LDAP Message")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+			message.AppendChild(response)
+			conn.Write(message.Bytes())
+		}
+
+		if tlsConfig != nil && !encrypted && op.Tag != ldapExtendedRequest {
+			return
+		}
+
+		switch op.Tag {
+		case ldapExtendedRequest:
+			if tlsConfig == nil || op.Children[0].Data.String() != ldapStartTLSOID {
+				reply(fakeLDAPResult(ldapExtendedReply, 2))
+				continue
+			}
+
+			reply(fakeLDAPResult(ldapExtendedReply, 0))
+			conn, encrypted = tls.Server(conn, tlsConfig), true
+		case ldapBindRequest:
+			code := 0
+			if op.Children[2].Data.String() != password {
+				code = 49
+			}
+
+			reply(fakeLDAPResult(ldapBindResponse, code))
+		case ldapSearchRequest:
+			for _, entry := range entries {
+				if matchesFakeFilter(op.Children[6], entry) {
+					reply(fakeLDAPEntry(entry))
+				}
+			}
+
+			reply(fakeLDAPResult(ldapSearchDone, 0))
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func fakeLDAPResult(tag ber.Tag, code int) *ber.Packet {
+	message := ""
+	if code != 0 {
+		message = "invalid credentials"
+	}
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Message"))
+
+	return result
+}
+
+func fakeLDAPEntry(entry ldapEntry) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "Search Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.Attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	packet.AppendChild(attributes)
+	return packet
+}
+
+//matchesFakeFilter checks the entry against the and, or, not, equality,
+//substring, and presence filters
+func matchesFakeFilter(filter *ber.Packet, entry ldapEntry) bool {
+	switch filter.Tag {
+	case ldapFilterAnd:
+		for _, child := range filter.Children {
+			if !matchesFakeFilter(child, entry) {
+				return false
+			}
+		}
+
+		return true
+	case ldapFilterOr:
+		for _, child := range filter.Children {
+			if matchesFakeFilter(child, entry) {
+				return true
+			}
+		}
+
+		return false
+	case ldapFilterNot:
+		return !matchesFakeFilter(filter.Children[0], entry)
+	case ldapFilterEquality:
+		for _, value := range entry.Attributes[strings.ToLower(filter.Children[0].Data.String())] {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+
+		return false
+	case ldapFilterSubstrings:
+		for _, value := range entry.Attributes[strings.ToLower(filter.Children[0].Data.String())] {
+			if matchesFakeSubstrings(filter.Children[1].Children, strings.ToLower(value)) {
+				return true
+			}
+		}
+
+		return false
+	case ldapFilterPresent:
+		return len(entry.Attributes[strings.ToLower(filter.Data.String())]) > 0
+	}
+
+	return false
+}
+
+//matchesFakeSubstrings checks the value starts with the initial substring,
+//has the ones in the middle in order, and ends with the final one
+func matchesFakeSubstrings(substrings []*ber.Packet, value string) bool {
+	for _, substring := range substrings {
+		part := strings.ToLower(substring.Data.String())
+
+		switch substring.Tag {
+		case 0:
+			if !strings.HasPrefix(value, part) {
+				return false
+			}
+			value = value[len(part):]
+		case 1:
+			at := strings.Index(value, part)
+			if at < 0 {
+				return false
+			}
+			value = value[at+len(part):]
+		case 2:
+			if !strings.HasSuffix(value, part) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+//fakeLDAPCert gives the fake server a certificate for StartTLS, along with a
+//CA file that trusts it
+func fakeLDAPCert(t *testing.T, dir string) (*tls.Config, string) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	return &tls.Config{Certificates: server.TLS.Certificates}, caFile
+}
+
+//ldapEntries are the people in the fake directory server
+var ldapEntries = []ldapEntry{
+	{DN: "uid=ana", Attributes: map[string][]string{"mail": {"ana@example.com"}, "cn": {"Ana"}, "memberof": {"cn=backend"}, "chatid": {"users/1"}}},
+	{DN: "uid=bo", Attributes: map[string][]string{"mail": {"bo@example.com"}, "cn": {"Bo"}, "memberof": {"cn=frontend"}}},
+	{DN: "uid=cy", Attributes: map[string][]string{"cn": {"Cy"}, "memberof": {"cn=backend"}}},
+}
+
+func TestDirectorySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("Reads CSV files by their header", func(t *testing.T) {
+		path := filepath.Join(dir, "team.csv")
+		ioutil.WriteFile(path, []byte("Name, Email\nAna,ana@example.com\nBo,bo@example.com\n"), 0644)
+
+		entries, err := FileSource{Path: path}.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 2 || entries[1].Email != "bo@example.com" || entries[1].Name != "Bo" {
+			t.Fatalf("Incorrect entries\nGot: %+v", entries)
+		}
+
+		ioutil.WriteFile(path, []byte("name,phone\nAna,555\n"), 0644)
+		if _, err := (FileSource{Path: path}).Entries(); err == nil {
+			t.Fatal("CSV without an email or gid column should be rejected")
+		}
+	})
+
+	t.Run("Reads JSON files", func(t *testing.T) {
+		path := filepath.Join(dir, "team.json")
+		ioutil.WriteFile(path, []byte(`[{"email": "ana@example.com", "gid": "users/1"}]`), 0644)
+
+		entries, err := FileSource{Path: path}.Entries()
+		if err != nil || len(entries) != 1 || entries[0].GID != "users/1" {
+			t.Fatalf("Incorrect entries\nGot: %+v %v", entries, err)
+		}
+	})
+
+	t.Run("Fetches from an HTTP endpoint", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Write([]byte(`[{"email": "ana@example.com", "name": "Ana"}]`))
+		}))
+		defer server.Close()
+
+		entries, err := HTTPSource{URL: server.URL, Token: "secret"}.Entries()
+		if err != nil || len(entries) != 1 || entries[0].Name != "Ana" {
+			t.Fatalf("Incorrect entries\nGot: %+v %v", entries, err)
+		}
+
+		if _, err := (HTTPSource{URL: server.URL}).Entries(); err == nil {
+			t.Fatal("Unauthorized fetch should fail")
+		}
+	})
+
+	t.Run("Searches an LDAP server", func(t *testing.T) {
+		listener := fakeLDAP(t, "secret", ldapEntries, nil)
+		defer listener.Close()
+
+		source := LDAPSource{
+			URL:          "ldap://" + listener.Addr().String(),
+			BindDN:       "cn=hgnotify",
+			BindPassword: "secret",
+			Filter:       "(&(memberOf=cn=backend)(mail=*))",
+			GIDAttribute: "chatID",
+		}
+
+		entries, err := source.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].Email != "ana@example.com" || entries[0].Name != "Ana" || entries[0].GID != "users/1" {
+			t.Fatalf("Incorrect entries\nGot: %+v", entries)
+		}
+
+		source.BindPassword = "wrong"
+		if _, err := source.Entries(); err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+			t.Fatalf("Bad bind should fail\nGot: %v", err)
+		}
+	})
+
+	t.Run("Searches with substring filters", func(t *testing.T) {
+		listener := fakeLDAP(t, "", ldapEntries, nil)
+		defer listener.Close()
+
+		for filter, want := range map[string]string{
+			"(mail=*@example.com)":         "ana@example.com,bo@example.com",
+			"(cn=A*)":                      "ana@example.com",
+			"(mail=b*ex*.com)":             "bo@example.com",
+			"(&(cn=*o)(memberOf=*front*))": "bo@example.com",
+			"(mail=*@example.org)":         "",
+		} {
+			entries, err := LDAPSource{URL: "ldap://" + listener.Addr().String(), Filter: filter}.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var emails []string
+			for _, entry := range entries {
+				emails = append(emails, entry.Email)
+			}
+
+			if got := strings.Join(emails, ","); got != want {
+				t.Fatalf("Incorrect entries for %q\nWanted: %q\nGot: %q", filter, want, got)
+			}
+		}
+	})
+
+	t.Run("Encrypts the connection with StartTLS", func(t *testing.T) {
+		tlsConfig, caFile := fakeLDAPCert(t, dir)
+
+		listener := fakeLDAP(t, "secret", ldapEntries, tlsConfig)
+		defer listener.Close()
+
+		source := LDAPSource{
+			URL:          "ldap://" + listener.Addr().String(),
+			StartTLS:     true,
+			CAFile:       caFile,
+			BindDN:       "cn=hgnotify",
+			BindPassword: "secret",
+			Filter:       "(memberOf=cn=backend)",
+		}
+
+		if entries, err := source.Entries(); err != nil || len(entries) != 2 {
+			t.Fatalf("Incorrect entries\nGot: %+v %v", entries, err)
+		}
+
+		source.CAFile = ""
+		if _, err := source.Entries(); err == nil || !strings.Contains(err.Error(), "couldn't start TLS") {
+			t.Fatalf("Untrusted certificate should fail\nGot: %v", err)
+		}
+
+		source.StartTLS = false
+		if _, err := source.Entries(); err == nil {
+			t.Fatal("Server should refuse to answer without TLS")
+		}
+
+		source.URL, source.StartTLS = "ldaps://"+listener.Addr().String(), true
+		if _, err := source.Entries(); err == nil || !strings.Contains(err.Error(), "already encrypted") {
+			t.Fatalf("StartTLS over ldaps should fail\nGot: %v", err)
+		}
+	})
+
+	t.Run("Rejects invalid filters", func(t *testing.T) {
+		for _, filter := range []string{"(&(a=b)", "(a)", `(a=\zz)`, "(a=b))", "(!(a=b)(c=d))", "(uid>=5)", "(uid<=5)", "(cn~=Ana)", "(cn:caseExactMatch:=Ana)", "(:dn:2.4.6.8.10:=Ana)"} {
+			if _, err := compileFilter(filter); err == nil {
+				t.Fatalf("Filter %q should be rejected", filter)
+			}
+		}
+
+		for _, filter := range []string{"objectClass=*", "(|(a=b)(!(c=d)))", `(cn=A\2aB)`, "(mail=*@example.com)"} {
+			if _, err := compileFilter(filter); err != nil {
+				t.Fatalf("Filter %q should be accepted\nGot: %s", filter, err.Error())
+			}
+		}
+	})
+}
+
+func TestDirectorySync(t *testing.T) {
+	Logger.Active(false)
+
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backendPath := filepath.Join(dir, "backend.csv")
+	ioutil.WriteFile(backendPath, []byte("email,name\nana@example.com,Ana\nBo@Example.com,Bo\nnobody@example.com,Nobody\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "oncall.json"), []byte(`[{"gid": "3", "name": "Cy"}]`), 0644)
+
+	configPath := filepath.Join(dir, "directory.yml")
+	ioutil.WriteFile(configPath, []byte(`interval: 0
+lookup:
+  url: ldap://not-http
+users:
+  ana@example.com: users/1
+  bo@example.com: users/2
+  cy@example.com: 3
+sources:
+  - group: backend
+    file: `+backendPath+`
+  - group: oncall
+    file: `+filepath.Join(dir, "oncall.json")+`
+  - group: broken
+    file: `+filepath.Join(dir, "missing.csv")+`
+  - group: not a name
+    file: `+backendPath+`
+  - group: twice
+    file: `+backendPath+`
+    http:
+      url: http://localhost
+`), 0644)
+
+	directory, users := Directory, Users
+	defer func() { Directory, Users = directory, users }()
+	Directory, Users = loadDirectorySync(configPath), newUserDirectory()
+
+	roomGID := genRoomGID(10)
+	msgObj := messageResponse{Message: message{Sender: User{GID: genUserGID(0)}}, FromMaster: true}
+
+	Groups := GroupMap{
+		"backend": &Group{Name: "backend", Members: []Member{{GID: "users/1"}, {GID: "users/9"}}, IsPrivate: true, PrivacyRoomID: roomGID},
+	}
+
+	t.Run("Loads the configuration", func(t *testing.T) {
+		if Directory.Interval != 0 || len(Directory.Sources) != 3 || len(Directory.Users) != 2 || Directory.Lookup != nil {
+			t.Fatalf("Invalid sources and users should be skipped\nGot: %+v", Directory)
+		}
+	})
+
+	t.Run("Plans without changing anything", func(t *testing.T) {
+		gotText := Groups.SyncDirectory("", "dryRun", msgObj)
+
+		for _, want := range []string{
+			"Dry run",
+			"backend:\n  + Bo (users/2)\n  - users/9",
+			"oncall (new):\n  + Cy (users/3)",
+			"backend: no Chat user found for nobody@example.com",
+			"broken: left as it is, the directory couldn't be read",
+		} {
+			if !strings.Contains(gotText, want) {
+				t.Fatalf("%q not in plan\nGot: %q", want, gotText)
+			}
+		}
+
+		if Groups.IsGroup("oncall") || memberGIDs(Groups["backend"].Members) != "users/1,users/9" {
+			t.Fatal("Dry run should not change anything")
+		}
+
+		if prompt := confirmDirectorySync(Groups, nil, msgObj, Arguments{"groupName": "backend"}); !strings.Contains(prompt, "+ Bo (users/2)") || strings.Contains(prompt, "oncall") {
+			t.Fatalf("Changes not in prompt\nGot: %q", prompt)
+		}
+	})
+
+	t.Run("Makes the groups match the directory", func(t *testing.T) {
+		Directory.run(Groups)
+
+		backend := Groups["backend"]
+		if got := memberGIDs(backend.Members); got != "users/1,users/2" || !backend.IsPrivate || backend.PrivacyRoomID != roomGID {
+			t.Fatalf("Group not synced\nGot: %q %+v", got, backend)
+		}
+
+		if oncall := Groups["oncall"]; oncall == nil || memberGIDs(oncall.Members) != "users/3" || oncall.IsPrivate {
+			t.Fatalf("Group not created\nGot: %+v", oncall)
+		}
+
+		if Groups.IsGroup("broken") {
+			t.Fatal("Group that couldn't be read should not be created")
+		}
+
+		gotText := Groups.SyncDirectory("", "", msgObj)
+		if !strings.HasPrefix(gotText, "The groups already match the directory.") || !strings.Contains(gotText, "nobody@example.com") {
+			t.Fatalf("Sync should change nothing\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Syncs a single group", func(t *testing.T) {
+		Groups["oncall"].Members = nil
+
+		gotText := Groups.SyncDirectory("OnCall", "", msgObj)
+		if !strings.Contains(gotText, "+ Cy (users/3)") || strings.Contains(gotText, "backend") {
+			t.Fatalf("Only the group should be synced\nGot: %q", gotText)
+		}
+
+		if gotText := Groups.SyncDirectory("nothere", "", msgObj); !strings.Contains(gotText, "isn't synced with the directory") {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Synced groups can't be changed in chat", func(t *testing.T) {
+		for _, gotText := range []string{
+			Groups.AddMembers("backend", "self", msgObj),
+			Groups.RemoveMembers("oncall", "self", msgObj),
+			Groups.Disband("oncall", msgObj),
+		} {
+			if !strings.Contains(gotText, "synced with the company directory") {
+				t.Fatalf("Incorrect reply\nGot: %q", gotText)
+			}
+		}
+
+		if memberGIDs(Groups["oncall"].Members) != "users/3" {
+			t.Fatal("Synced group should not be changed")
+		}
+	})
+
+	t.Run("Sources that list nobody leave the group alone", func(t *testing.T) {
+		ioutil.WriteFile(backendPath, []byte("email,name\n"), 0644)
+
+		gotText := Groups.SyncDirectory("backend", "", msgObj)
+		if !strings.Contains(gotText, "the directory listed nobody") || memberGIDs(Groups["backend"].Members) != "users/1,users/2" {
+			t.Fatalf("Group should be left alone\nGot: %q", gotText)
+		}
+	})
+}
+
+//stateLockHeld tells if someone is holding stateLock, waiting a little for it
+//to be let go of
+func stateLockHeld() bool {
+	free := make(chan struct{})
+
+	go func() {
+		stateLock.Lock()
+		stateLock.Unlock()
+		close(free)
+	}()
+
+	select {
+	case <-free:
+		return false
+	case <-time.After(time.Second):
+		return true
+	}
+}
+
+func TestDirectoryLookup(t *testing.T) {
+	Logger.Active(false)
+
+	var (
+		mu      sync.Mutex
+		fetches []bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held := stateLockHeld()
+
+		mu.Lock()
+		fetches = append(fetches, held)
+		mu.Unlock()
+
+		w.Write([]byte(`[{"email": "ana@example.com", "gid": "users/1"}]`))
+	}))
+	defer server.Close()
+
+	directory, users, master, useCards, confirmations := Directory, Users, MasterID, UseCards, Confirmations
+	defer func() {
+		Directory, Users, MasterID, UseCards, Confirmations = directory, users, master, useCards, confirmations
+	}()
+
+	Directory = &DirectorySync{Sources: []DirectoryGroup{{Group: "backend", HTTP: &HTTPSource{URL: server.URL}}}}
+	Users, MasterID, Confirmations = newUserDirectory(), genUserGID(0), newConfirmationStore()
+
+	admin := User{Name: "Admin", GID: MasterID, Type: "HUMAN"}
+	dm := space{GID: genRoomGID(10), Type: "DM"}
+
+	t.Run("Reads the directory without holding the lock", func(t *testing.T) {
+		UseCards = false
+		Groups := make(GroupMap)
+
+		msgObj := messageResponse{Room: dm, Message: message{Sender: admin, Text: BotName + " dirsync"}}
+		reply := respond(Groups, ScheduleMap{}, &msgObj)
+
+		if !strings.Contains(reply.Text, "Synced with the directory") || Groups["backend"] == nil {
+			t.Fatalf("Group not synced\nGot: %q", reply.Text)
+		}
+
+		if len(fetches) != 1 || fetches[0] {
+			t.Fatalf("The directory should be read once, without stateLock\nGot: %v", fetches)
+		}
+	})
+
+	t.Run("Applies what the confirmation showed", func(t *testing.T) {
+		UseCards = true
+		fetches = nil
+		Groups := make(GroupMap)
+
+		msgObj := messageResponse{Room: dm, Message: message{Sender: admin, Text: BotName + " dirsync"}}
+		reply := respond(Groups, ScheduleMap{}, &msgObj)
+		if len(reply.CardsV2) != 1 || Groups.IsGroup("backend") {
+			t.Fatalf("Confirmation not asked for\nGot: %+v", reply)
+		}
+
+		token := reply.CardsV2[0].Card.Sections[0].Widgets[1].ButtonList.Buttons[0].OnClick.Action.Parameters[0].Value
+		click := messageResponse{
+			Type:   "CARD_CLICKED",
+			Room:   dm,
+			User:   admin,
+			Action: cardAction{MethodName: confirmFunction, Parameters: []ActionParameter{{Key: "token", Value: token}}},
+		}
+
+		if reply := Confirmations.Resolve(Groups, ScheduleMap{}, click); !strings.Contains(reply.Text, "Synced with the directory") || Groups["backend"] == nil {
+			t.Fatalf("Group not synced\nGot: %q", reply.Text)
+		}
+
+		if len(fetches) != 1 || fetches[0] {
+			t.Fatalf("The directory should be read once, without stateLock\nGot: %v", fetches)
+		}
+	})
+}
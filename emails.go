@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//emailPattern finds the email addresses in a message, however they're
+//separated
+var emailPattern = regexp.MustCompile(`[\w.%+'-]+@[\w-]+(\.[\w-]+)*\.[A-Za-z]{2,}`)
+
+//maxMessageEmails is how many emails are looked up from one message. Any
+//past it are left out, and the sender is told which.
+const maxMessageEmails = 50
+
+//emailWorkers is how many emails are looked up at once
+const emailWorkers = 10
+
+//errEmailUnknown is returned by resolvers that don't know the email
+var errEmailUnknown = errors.New("no Chat user has that email")
+
+//EmailResolver finds the Chat user with the email address
+type EmailResolver interface {
+	Resolve(email string) (User, error)
+}
+
+//newEmailResolver sets up the resolvers from the directory sync, which
+//resolves from its users, then from its lookup endpoint if there is one
+func newEmailResolver(ds *DirectorySync) EmailResolver {
+	resolvers := EmailResolvers{DirectoryUsers(ds.Users)}
+	if ds.Lookup != nil {
+		resolvers = append(resolvers, *ds.Lookup)
+	}
+
+	return resolvers
+}
+
+//EmailResolvers tries each resolver in turn, until one knows the email
+type EmailResolvers []EmailResolver
+
+//Resolve returns the user from the first resolver that knows the email. If
+//none do, the last error other than not knowing it is returned.
+func (er EmailResolvers) Resolve(email string) (User, error) {
+	lastErr := errEmailUnknown
+
+	for _, resolver := range er {
+		user, err := resolver.Resolve(email)
+		if err == nil {
+			return user, nil
+		}
+
+		if err != errEmailUnknown {
+			lastErr = err
+		}
+	}
+
+	return User{}, lastErr
+}
+
+//DirectoryUsers resolves emails from a list of emails and the Chat user ids
+//they belong to, such as the users listed for the directory sync
+type DirectoryUsers map[string]string
+
+//Resolve looks the email up, regardless of case
+func (du DirectoryUsers) Resolve(email string) (User, error) {
+	gid, exist := du[strings.ToLower(email)]
+	if !exist {
+		return User{}, errEmailUnknown
+	}
+
+	return User{GID: gid}, nil
+}
+
+//HTTPResolver looks emails up at an endpoint, which is passed the email as
+//its email query parameter. It answers with the person as a JSON entry, the
+//same as an HTTPSource lists them, or a 404 if it doesn't know them.
+type HTTPResolver struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+
+	client *http.Client
+}
+
+//Resolve asks the endpoint for the email
+func (hr HTTPResolver) Resolve(email string) (User, error) {
+	client := hr.client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+
+	lookupURL, err := url.Parse(hr.URL)
+	if err != nil {
+		return User{}, err
+	}
+
+	query := lookupURL.Query()
+	query.Set("email", email)
+	lookupURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, lookupURL.String(), nil)
+	if err != nil {
+		return User{}, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if hr.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hr.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return User{}, errEmailUnknown
+	default:
+		return User{}, fmt.Errorf("%s returned %s", hr.URL, resp.Status)
+	}
+
+	var entry DirectoryEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return User{}, err
+	}
+
+	if entry.GID == "" {
+		return User{}, errEmailUnknown
+	}
+
+	return User{Name: entry.Name, GID: chatUserID(entry.GID)}, nil
+}
+
+//chatUserID adds the users/ prefix to an id that's missing it
+func chatUserID(gid string) string {
+	if gid != "" && !strings.HasPrefix(gid, "users/") {
+		return "users/" + gid
+	}
+
+	return gid
+}
+
+//messageEmails lists the email addresses in the text once each, in the order
+//they're given
+func messageEmails(text string) []string {
+	var emails []string
+
+	seen := checkSeen()
+	for _, email := range emailPattern.FindAllString(text, -1) {
+		if !seen(strings.ToLower(email)) {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails
+}
+
+//resolvedEmail is the user found for an email, or why they weren't
+type resolvedEmail struct {
+	Email string
+	User  User
+	Err   error
+}
+
+//emailLookup is what the emails in a message were resolved to, with the
+//emails past maxMessageEmails that were skipped
+type emailLookup struct {
+	Resolved []resolvedEmail
+	Skipped  []string
+}
+
+//lookupEmails resolves the emails in the text, emailWorkers at a time, so a
+//long list doesn't take one lookup after another
+func lookupEmails(text string) *emailLookup {
+	emails := messageEmails(text)
+	lookup := new(emailLookup)
+
+	if len(emails) > maxMessageEmails {
+		emails, lookup.Skipped = emails[:maxMessageEmails], emails[maxMessageEmails:]
+	}
+
+	lookup.Resolved = make([]resolvedEmail, len(emails))
+	if len(emails) == 0 {
+		return lookup
+	}
+
+	var (
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+
+	for i := 0; i < emailWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				user, err := Emails.Resolve(emails[j])
+				lookup.Resolved[j] = resolvedEmail{Email: emails[j], User: user, Err: err}
+			}
+		}()
+	}
+
+	for i := range emails {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return lookup
+}
+
+//resolveEmails finds the Chat users for the email addresses in the message,
+//leaving out anyone who was also mentioned. The emails that couldn't be
+//resolved, and the ones skipped for being past maxMessageEmails, are returned
+//along with them. The emails are only resolved here if the command didn't
+//look them up already.
+func resolveEmails(msgObj messageResponse) (users []User, unresolved, skipped []string) {
+	lookup := msgObj.emailLookup()
+
+	mentioned := make(map[string]bool)
+	for _, mention := range msgObj.Message.Mentions {
+		mentioned[mention.Called.User.GID] = true
+	}
+
+	for _, resolved := range lookup.Resolved {
+		user, err := resolved.User, resolved.Err
+		if err != nil {
+			if err != errEmailUnknown {
+				log.Printf("Error resolving %s: %s", resolved.Email, err.Error())
+			}
+
+			unresolved = append(unresolved, resolved.Email)
+			continue
+		}
+
+		if mentioned[user.GID] {
+			continue
+		}
+		mentioned[user.GID] = true
+
+		if user.Name != "" {
+			Users.Observe(User{Name: user.Name, GID: user.GID, Type: "HUMAN"})
+		} else {
+			user.Name = Users.Name(user.GID, resolved.Email)
+		}
+
+		user.Type = "HUMAN"
+		users = append(users, user)
+	}
+
+	return users, unresolved, lookup.Skipped
+}
+
+//unresolvedText tells the sender which emails couldn't be resolved or were
+//skipped, and is empty if they all were resolved
+func unresolvedText(unresolved, skipped []string) string {
+	var text string
+
+	if len(unresolved) > 0 {
+		text += fmt.Sprintf("\nI couldn't find a Chat user for %s.", strings.Join(unresolved, ", "))
+	}
+
+	if len(skipped) > 0 {
+		text += fmt.Sprintf("\nI only look up %d emails at a time, so %s weren't added.", maxMessageEmails, strings.Join(skipped, ", "))
+	}
+
+	return text
+}
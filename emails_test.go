@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//fakeDirectory is a stand-in for a directory's lookup endpoint, answering
+//with the entry that has the email
+func fakeDirectory(entries ...DirectoryEntry) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email := r.URL.Query().Get("email")
+
+		if email == "broken@example.com" {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Email, email) {
+				json.NewEncoder(w).Encode(entry)
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	}))
+}
+
+func TestMessageEmails(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"Separated by spaces", "@HGNotify add team ana@example.com bo@example.co.uk", "ana@example.com bo@example.co.uk"},
+		{"Pasted from a spreadsheet", "@HGNotify add team\nana@example.com,\tBo.Smith+chat@example.com;cy@example.com", "ana@example.com Bo.Smith+chat@example.com cy@example.com"},
+		{"Listed twice", "@HGNotify add team ana@example.com ANA@example.com", "ana@example.com"},
+		{"Mentions aren't emails", "@HGNotify add team @Ana @Bo self", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := strings.Join(messageEmails(test.text), " "); got != test.want {
+				t.Fatalf("Incorrect emails\nWanted: %q\nGot: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestEmailResolvers(t *testing.T) {
+	server := fakeDirectory(DirectoryEntry{Email: "bo@example.com", Name: "Bo", GID: "2"})
+	defer server.Close()
+
+	resolvers := EmailResolvers{
+		DirectoryUsers{"ana@example.com": "users/1"},
+		HTTPResolver{URL: server.URL + "/lookup"},
+	}
+
+	t.Run("Resolves from the first that knows the email", func(t *testing.T) {
+		if user, err := resolvers.Resolve("ANA@example.com"); err != nil || user.GID != "users/1" {
+			t.Fatalf("Incorrect user\nGot: %+v %v", user, err)
+		}
+
+		if user, err := resolvers.Resolve("bo@example.com"); err != nil || user.GID != "users/2" || user.Name != "Bo" {
+			t.Fatalf("Incorrect user\nGot: %+v %v", user, err)
+		}
+	})
+
+	t.Run("Reports emails nobody knows", func(t *testing.T) {
+		if _, err := resolvers.Resolve("nobody@example.com"); err != errEmailUnknown {
+			t.Fatalf("Unknown email should fail\nGot: %v", err)
+		}
+
+		if _, err := resolvers.Resolve("broken@example.com"); err == nil || err == errEmailUnknown {
+			t.Fatalf("Failed lookup should be reported\nGot: %v", err)
+		}
+	})
+}
+
+func TestAddByEmail(t *testing.T) {
+	Logger.Active(false)
+
+	server := fakeDirectory(DirectoryEntry{Email: "bo@example.com", Name: "Bo", GID: "users/2"})
+	defer server.Close()
+
+	emails, users := Emails, Users
+	defer func() { Emails, Users = emails, users }()
+	Users = newUserDirectory()
+	Emails = EmailResolvers{DirectoryUsers{"ana@example.com": "users/1"}, HTTPResolver{URL: server.URL}}
+
+	Users.Observe(User{Name: "Ana", GID: "users/1", Type: "HUMAN"})
+
+	msgObj := messageResponse{Room: space{GID: genRoomGID(10)}, Message: message{Sender: User{Name: "Someone", GID: genUserGID(0)}}}
+
+	t.Run("Creates a group with the emails given", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj.Message.Text = "@HGNotify create team ana@example.com, bo@example.com, nobody@example.com"
+
+		gotText := Groups.Create("team", "", msgObj)
+
+		if got := memberGIDs(Groups["team"].Members); got != "users/1,users/2" {
+			t.Fatalf("Members not resolved\nGot: %q", got)
+		}
+
+		if !strings.Contains(gotText, "Ana and Bo") || !strings.HasSuffix(gotText, "I couldn't find a Chat user for nobody@example.com.") {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Adds people by email alongside mentions", func(t *testing.T) {
+		Groups := GroupMap{"team": &Group{Name: "team", Members: []Member{{GID: "users/1"}}}}
+
+		msgObj := msgObj
+		msgObj.Message.Text = "@HGNotify add team @Bo ana@example.com bo@example.com"
+		msgObj.Message.Mentions = []annotation{{Type: "USER_MENTION", Called: userMention{User{Name: "Bo", GID: "users/2", Type: "HUMAN"}}}}
+
+		gotText := Groups.AddMembers("team", "", msgObj)
+
+		if got := memberGIDs(Groups["team"].Members); got != "users/1,users/2" {
+			t.Fatalf("Members not added once each\nGot: %q", got)
+		}
+
+		if !strings.Contains(gotText, "added the user Bo") || !strings.Contains(gotText, "user Ana already added") {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Reports emails that couldn't be resolved", func(t *testing.T) {
+		Groups := GroupMap{"team": &Group{Name: "team"}}
+		msgObj.Message.Text = "@HGNotify add team nobody@example.com broken@example.com"
+
+		gotText := Groups.AddMembers("team", "", msgObj)
+
+		if len(Groups["team"].Members) != 0 || gotText != "I couldn't find a Chat user for nobody@example.com, broken@example.com. No users were added." {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+	})
+}
+
+//lockCheckingResolver knows everyone, noting whether stateLock was held for
+//each email
+type lockCheckingResolver struct {
+	mu   *sync.Mutex
+	held *[]bool
+}
+
+func (lr lockCheckingResolver) Resolve(email string) (User, error) {
+	held := stateLockHeld()
+
+	lr.mu.Lock()
+	*lr.held = append(*lr.held, held)
+	lr.mu.Unlock()
+
+	return User{Name: strings.Split(email, "@")[0], GID: "users/" + email}, nil
+}
+
+func TestEmailLookup(t *testing.T) {
+	Logger.Active(false)
+
+	var (
+		mu   sync.Mutex
+		held []bool
+	)
+
+	emails, users, useCards := Emails, Users, UseCards
+	defer func() { Emails, Users, UseCards = emails, users, useCards }()
+	Emails, Users, UseCards = lockCheckingResolver{mu: &mu, held: &held}, newUserDirectory(), false
+
+	msgObj := messageResponse{Room: space{GID: genRoomGID(10), Type: "ROOM"}, Message: message{Sender: User{Name: "Someone", GID: genUserGID(0)}}}
+
+	t.Run("Resolves the emails without holding the lock", func(t *testing.T) {
+		Groups := GroupMap{"team": &Group{Name: "team"}}
+		msgObj := msgObj
+		msgObj.Message.Text = BotName + " add team ana@example.com bo@example.com"
+
+		reply := respond(Groups, ScheduleMap{}, &msgObj)
+
+		if len(Groups["team"].Members) != 2 {
+			t.Fatalf("Members not added\nGot: %q", reply.Text)
+		}
+
+		if len(held) != 2 || held[0] || held[1] {
+			t.Fatalf("The emails should be resolved once each, without stateLock\nGot: %v", held)
+		}
+	})
+
+	t.Run("Skips the emails past the limit", func(t *testing.T) {
+		var list []string
+		for i := 0; i <= maxMessageEmails; i++ {
+			list = append(list, fmt.Sprintf("person%d@example.com", i))
+		}
+
+		Groups := make(GroupMap)
+		msgObj := msgObj
+		msgObj.Message.Text = BotName + " create team " + strings.Join(list, "\n")
+
+		reply := respond(Groups, ScheduleMap{}, &msgObj)
+
+		if len(Groups["team"].Members) != maxMessageEmails {
+			t.Fatalf("Incorrect members\nGot: %d", len(Groups["team"].Members))
+		}
+
+		if want := fmt.Sprintf("so person%d@example.com weren't added.", maxMessageEmails); !strings.HasSuffix(reply.Text, want) {
+			t.Fatalf("Skipped emails not reported\nGot: %q", reply.Text)
+		}
+	})
+}
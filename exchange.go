@@ -0,0 +1,577 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//The ways an import treats the groups that already exist. Merge only adds the
+//members missing from the group, replace makes the group's members and privacy
+//match the import exactly, and skip leaves the group alone. Groups that don't
+//exist are created no matter the policy.
+const (
+	ImportMerge   = "merge"
+	ImportReplace = "replace"
+	ImportSkip    = "skip"
+)
+
+//importDetail is noted on the audit entries of the changes an import makes
+const importDetail = "imported"
+
+//groupNamePattern is what a group's name has to look like to be imported
+var groupNamePattern = regexp.MustCompile(`^[\w-]{1,40}$`)
+
+//codeLanguagePattern matches the language that can open a code block
+var codeLanguagePattern = regexp.MustCompile(`^\w*$`)
+
+//GroupExport is the document groups are exported as, and imported from. The
+//groups are laid out with the same yaml tags they're listed with.
+type GroupExport struct {
+	Groups []ExportedGroup `yaml:"groups"`
+}
+
+//ExportedGroup is a group as it's exported. The room a private group is
+//restricted to is kept with it, so it stays private when it's imported.
+type ExportedGroup struct {
+	Group `yaml:",inline"`
+	Room  string `yaml:"room,omitempty"`
+}
+
+//importChange is what importing a single group would do to it. Privacy
+//describes the group's new privacy, and is empty when it's left as is.
+//Managed says what else keeps the group in line, the groups manifest, the
+//directory, or its room, and those groups are always skipped so the import
+//isn't undone by their next sync.
+type importChange struct {
+	Group   ExportedGroup
+	Exists  bool
+	Skipped bool
+	Managed string
+	Diff    MembershipDiff
+	Privacy string
+}
+
+//changed tells if the import would make any change to the group
+func (ic importChange) changed() bool {
+	return !ic.Skipped && (!ic.Exists || ic.Diff.HasChanges() || ic.Privacy != "")
+}
+
+//String lays out the change the same way as a membership diff, with the
+//group's privacy under its members.
+func (ic importChange) String() string {
+	header := ic.Group.Name
+	switch {
+	case ic.Managed != "":
+		return header + ": skipped, " + ic.Managed
+	case ic.Skipped:
+		return header + ": skipped, it already exists"
+	case !ic.Exists:
+		header += " (new)"
+	}
+
+	text := header + ":"
+
+	for _, member := range ic.Diff.Added {
+		text += "\n  + " + importedMember(member)
+	}
+
+	for _, member := range ic.Diff.Removed {
+		text += "\n  - " + importedMember(member)
+	}
+
+	if ic.Privacy != "" {
+		text += "\n  privacy: " + ic.Privacy
+	}
+
+	return text
+}
+
+//importedMember names the member for a plan. Exports don't need names, so the
+//GID is used on its own for people the bot doesn't know.
+func importedMember(member Member) string {
+	if name := Users.Name(member.GID, member.Name); name != "" {
+		return fmt.Sprintf("%s (%s)", name, member.GID)
+	}
+
+	return member.GID
+}
+
+//ImportPlan is every change an import would make, in order of group name
+type ImportPlan struct {
+	Policy  string
+	Changes []importChange
+}
+
+//HasChanges tells if applying the plan would change anything
+func (ip ImportPlan) HasChanges() bool {
+	for _, change := range ip.Changes {
+		if change.changed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+//String lists the groups the import would change or skip, leaving out the
+//ones that already match.
+func (ip ImportPlan) String() string {
+	var lines []string
+	for _, change := range ip.Changes {
+		if change.changed() || change.Skipped {
+			lines = append(lines, change.String())
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+//Export method lays out the named groups, or every group the sender can see
+//when none are named, as YAML, or JSON if asJSON is set. groupNames are
+//separated by spaces.
+func (gm GroupMap) Export(groupNames, asJSON string, msgObj messageResponse) string {
+	doc, err := gm.exportGroups(strings.Fields(groupNames), msgObj)
+	if err != nil {
+		return err.Error()
+	}
+
+	if len(doc.Groups) == 0 {
+		return "There are no groups to export currently. :("
+	}
+
+	data, err := marshalExport(doc, asJSON != "")
+	checkError(err)
+
+	text := fmt.Sprintf("Here's the export, send it back with %s import to load it: ```%s```", BotName, string(data))
+	if len(text) >= 4000 {
+		return "That export is too long for one message. Export fewer groups at a time, or use the hgnotify export command."
+	}
+
+	return text
+}
+
+//exportGroups gathers the named groups in order of name, or every group the
+//sender can see when none are named. Private groups are handled the same as
+//they are when listed.
+func (gm GroupMap) exportGroups(names []string, msgObj messageResponse) (GroupExport, error) {
+	var doc GroupExport
+
+	if len(names) == 0 {
+		for saveName := range gm {
+			if _, meta := gm.checkGroup(saveName, msgObj); !strings.Contains(meta, "private") || strings.Contains(meta, "audit") {
+				names = append(names, saveName)
+			}
+		}
+	}
+
+	seen := checkSeen()
+	for _, name := range names {
+		saveName, meta := gm.checkGroup(name, msgObj)
+		if !strings.Contains(meta, "exist") {
+			return doc, fmt.Errorf("Group %q does not seem to exist.", name)
+		}
+
+		if strings.Contains(meta, "private") && !strings.Contains(meta, "audit") {
+			return doc, fmt.Errorf("The group %q is private, and you may not view it.", name)
+		}
+
+		if seen(saveName) {
+			continue
+		}
+
+		group := gm[saveName]
+		exported := ExportedGroup{Group: *group}
+		if group.IsPrivate {
+			exported.Room = group.PrivacyRoomID
+		}
+
+		doc.Groups = append(doc.Groups, exported)
+	}
+
+	sort.Slice(doc.Groups, func(i, j int) bool {
+		return strings.ToLower(doc.Groups[i].Name) < strings.ToLower(doc.Groups[j].Name)
+	})
+
+	return doc, nil
+}
+
+//marshalExport writes out the export as YAML, or as JSON with the same keys
+func marshalExport(doc GroupExport, asJSON bool) ([]byte, error) {
+	data, err := yaml.Marshal(doc)
+	if err != nil || !asJSON {
+		return data, err
+	}
+
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(jsonCompatible(generic), "", "  ")
+}
+
+//jsonCompatible turns the maps yaml decodes into ones json can encode, since
+//yaml keys aren't always strings.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+
+	return value
+}
+
+//parseImport reads the groups out of an export, pasted as is or in a code
+//block. JSON is read as well, since it's also YAML.
+func parseImport(data string) (GroupExport, error) {
+	var doc GroupExport
+
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "```") {
+		data = strings.TrimSuffix(strings.TrimPrefix(data, "```"), "```")
+
+		//A language can be given on the line opening the code block
+		if lines := strings.SplitN(data, "\n", 2); len(lines) == 2 && codeLanguagePattern.MatchString(strings.TrimSpace(lines[0])) {
+			data = lines[1]
+		}
+	}
+
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return doc, err
+	}
+
+	if len(doc.Groups) == 0 {
+		return doc, errors.New("there are no groups in it")
+	}
+
+	seen := checkSeen()
+	for i := range doc.Groups {
+		if err := doc.Groups[i].validate(); err != nil {
+			return doc, err
+		}
+
+		if seen(strings.ToLower(doc.Groups[i].Name)) {
+			return doc, fmt.Errorf("the group %q is listed more than once", doc.Groups[i].Name)
+		}
+	}
+
+	return doc, nil
+}
+
+//validate checks the group can be loaded, and tidies it up to be loaded.
+//Members listed more than once are only kept once, and a public group's room
+//is dropped.
+func (eg *ExportedGroup) validate() error {
+	if !groupNamePattern.MatchString(eg.Name) {
+		return fmt.Errorf("%q isn't a valid group name", eg.Name)
+	}
+
+	if eg.IsPrivate && !strings.HasPrefix(eg.Room, "spaces/") {
+		return fmt.Errorf("the private group %q needs the room it's restricted to", eg.Name)
+	}
+
+	if !eg.IsPrivate {
+		eg.Room = ""
+	}
+
+	seen := checkSeen()
+	members := eg.Members[:0]
+	for _, member := range eg.Members {
+		if !strings.HasPrefix(member.GID, "users/") {
+			return fmt.Errorf("%q in %q isn't a valid member id", member.GID, eg.Name)
+		}
+
+		if !seen(member.GID) {
+			members = append(members, member)
+		}
+	}
+
+	eg.Members = members
+	eg.RoomRemoved = false
+
+	return nil
+}
+
+//planImport works out what importing the groups would change under the
+//policy, without changing anything.
+func planImport(Groups GroupMgr, doc GroupExport, policy string) ImportPlan {
+	plan := ImportPlan{Policy: policy}
+
+	for _, wanted := range doc.Groups {
+		change := importChange{Group: wanted}
+
+		existing := Groups.GetGroup(wanted.Name)
+		if existing == nil {
+			change.Diff = diffMembers(wanted.Name, nil, wanted.Members)
+			if wanted.IsPrivate {
+				change.Privacy = "private to " + wanted.Room
+			}
+
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		change.Exists = true
+		change.Group.Name = existing.Name
+
+		change.Managed = managedBy(existing, policy)
+
+		switch {
+		case change.Managed != "":
+			change.Skipped = true
+		case policy == ImportSkip:
+			change.Skipped = true
+		case policy == ImportReplace || policy == manifestPolicy:
+			change.Diff = diffMembers(existing.Name, existing.Members, wanted.Members)
+
+			if wanted.IsPrivate != existing.IsPrivate || wanted.Room != existing.PrivacyRoomID {
+				change.Privacy = "public"
+				if wanted.IsPrivate {
+					change.Privacy = "private to " + wanted.Room
+				}
+			}
+		case policy == directoryPolicy:
+			change.Diff = diffMembers(existing.Name, existing.Members, wanted.Members)
+		default:
+			change.Diff = diffMembers(existing.Name, existing.Members, wanted.Members)
+			change.Diff.Removed = nil
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		return strings.ToLower(plan.Changes[i].Group.Name) < strings.ToLower(plan.Changes[j].Group.Name)
+	})
+
+	return plan
+}
+
+//managedBy tells what keeps the group in line, other than the sync applying
+//the policy, so the import leaves the group to it. It's empty when nothing
+//does.
+func managedBy(group *Group, policy string) string {
+	switch {
+	case policy != manifestPolicy && Manifest.Manages(group.Name):
+		return "it's managed by the groups manifest"
+	case policy != directoryPolicy && Directory.Manages(group.Name):
+		return "it's synced with the company directory"
+	case policy != directoryPolicy && group.SyncRoomID != "":
+		return "it's synced with its room's members"
+	}
+
+	return ""
+}
+
+//previewImport reads the import and lays out what it would change
+func previewImport(Groups GroupMgr, data, policy string) (ImportPlan, error) {
+	doc, err := parseImport(data)
+	if err != nil {
+		return ImportPlan{}, err
+	}
+
+	return planImport(Groups, doc, policy), nil
+}
+
+//Import method loads the groups from an export, following the policy for the
+//groups that already exist. Passing a dryRun shows what would change without
+//changing anything.
+func (gm GroupMap) Import(data, policy, dryRun string, msgObj messageResponse) string {
+	plan, err := previewImport(gm, data, policy)
+	if err != nil {
+		return fmt.Sprintf("I couldn't read that import, %s. ```%s```", err.Error(), usage("import"))
+	}
+
+	if !plan.HasChanges() {
+		if skipped := plan.String(); skipped != "" {
+			return fmt.Sprintf("Nothing to import, the groups already match or were skipped. ```%s```", skipped)
+		}
+
+		return "Nothing to import, the groups already match."
+	}
+
+	if dryRun != "" {
+		return fmt.Sprintf("Dry run, nothing was changed. Importing would make these changes: ```%s```", plan)
+	}
+
+	gm.applyImport(plan, importDetail, msgObj)
+
+	return fmt.Sprintf("Imported with these changes: ```%s```", plan)
+}
+
+//applyImport makes the changes in the plan, noting detail on their audit
+//entries. Each group's changes and audit entries are saved in the background,
+//in order, the same as the chat commands save, along with the names of people
+//new to the bot. The command line waits on pendingSaves so it's fully saved
+//before it exits.
+func (gm GroupMap) applyImport(plan ImportPlan, detail string, msgObj messageResponse) {
+	for _, change := range plan.Changes {
+		if !change.changed() {
+			continue
+		}
+
+		change := change
+
+		wanted := change.Group
+		saveName := strings.ToLower(wanted.Name)
+
+		//Names from the export only fill in people the bot hasn't seen,
+		//since the ones it knows are more likely to be current.
+		for _, member := range change.Diff.Added {
+			if Users.Name(member.GID, "") != "" {
+				continue
+			}
+
+			if user := Users.observe(User{Name: member.Name, GID: member.GID, Type: "HUMAN"}); user != nil {
+				saveGroup(func() { Logger.SaveUser(user) })
+			}
+		}
+
+		if !change.Exists {
+			group := &Group{
+				Name:          wanted.Name,
+				Members:       append([]Member(nil), wanted.Members...),
+				IsPrivate:     wanted.IsPrivate,
+				PrivacyRoomID: wanted.Room,
+			}
+
+			gm[saveName] = group
+			entry := newGroupAudit("create", group, nil, msgObj, detail)
+
+			saveGroup(func() {
+				Logger.SaveCreatedGroup(group)
+				Logger.SaveAuditEntry(entry)
+			})
+			Webhooks.Fire(entry)
+
+			continue
+		}
+
+		group := gm[saveName]
+
+		var entries []*AuditEntry
+
+		if len(change.Diff.Removed) > 0 {
+			before := group.Members
+			group.Members = withoutMembers(group.Members, change.Diff.Removed)
+
+			entries = append(entries, newGroupAudit("remove", group, before, msgObj, detail))
+		}
+
+		if len(change.Diff.Added) > 0 {
+			before := group.Members
+			group.Members = append(append([]Member(nil), group.Members...), change.Diff.Added...)
+
+			entries = append(entries, newGroupAudit("add", group, before, msgObj, detail))
+		}
+
+		if change.Privacy != "" {
+			group.IsPrivate = wanted.IsPrivate
+			group.PrivacyRoomID = wanted.Room
+			group.RoomRemoved = false
+
+			privacy := "set to public"
+			if group.IsPrivate {
+				privacy = "set to private"
+			}
+
+			entries = append(entries, newGroupAudit("restrict", group, group.Members, msgObj, privacy+", "+detail))
+		}
+
+		saveGroup(func() {
+			if len(change.Diff.Removed) > 0 {
+				Logger.SaveMemberRemoval(group, change.Diff.Removed)
+			}
+
+			if len(change.Diff.Added) > 0 {
+				Logger.SaveMemberAddition(group)
+			}
+
+			if change.Privacy != "" {
+				Logger.UpdatePrivacyDB(group)
+			}
+
+			for _, entry := range entries {
+				Logger.SaveAuditEntry(entry)
+			}
+		})
+
+		for _, entry := range entries {
+			Webhooks.Fire(entry)
+		}
+	}
+}
+
+//withoutMembers returns the members, leaving out the ones removed
+func withoutMembers(members, removed []Member) []Member {
+	removedGIDs := make(map[string]bool)
+	for _, member := range removed {
+		removedGIDs[member.GID] = true
+	}
+
+	var kept []Member
+	for _, member := range members {
+		if !removedGIDs[member.GID] {
+			kept = append(kept, member)
+		}
+	}
+
+	return kept
+}
+
+//checkImportArgs picks the import policy from the flags given, merging by
+//default.
+func checkImportArgs(_ GroupMgr, args Arguments) error {
+	if strings.TrimSpace(args["data"]) == "" {
+		return fmt.Errorf("Please paste the groups to import. ```%s```", usage("import"))
+	}
+
+	args["policy"] = ImportMerge
+
+	var picked []string
+	for _, policy := range []string{ImportMerge, ImportReplace, ImportSkip} {
+		if args[policy] != "" {
+			picked = append(picked, policy)
+		}
+	}
+
+	switch len(picked) {
+	case 0:
+	case 1:
+		args["policy"] = picked[0]
+	default:
+		return fmt.Errorf("Please pick only one of --merge, --replace, or --skip. ```%s```", usage("import"))
+	}
+
+	return nil
+}
+
+//confirmImport asks before importing, showing what the import would change.
+//Imports that can't be read or wouldn't change anything don't need asking.
+func confirmImport(Groups GroupMgr, _ ScheduleMgr, _ messageResponse, args Arguments) string {
+	if args["dryRun"] != "" {
+		return ""
+	}
+
+	plan, err := previewImport(Groups, args["data"], args["policy"])
+	if err != nil || !plan.HasChanges() {
+		return ""
+	}
+
+	return fmt.Sprintf("Import these groups, with the %s policy? ```%s```", plan.Policy, plan)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	memberGID := genUserGID(0)
+
+	Groups := GroupMap{
+		"backend": &Group{Name: "Backend", Members: []Member{{Name: "Member", GID: memberGID}}},
+		"oncall":  &Group{Name: "oncall", IsPrivate: true, PrivacyRoomID: roomGID},
+	}
+
+	inRoom := messageResponse{Room: space{GID: roomGID}, Message: message{Sender: User{GID: genUserGID(0)}}}
+	elsewhere := messageResponse{Room: space{GID: genRoomGID(10)}, Message: message{Sender: User{GID: genUserGID(0)}}}
+
+	t.Run("Exports the groups that can be seen", func(t *testing.T) {
+		doc, err := Groups.exportGroups(nil, elsewhere)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(doc.Groups) != 1 || doc.Groups[0].Name != "Backend" {
+			t.Fatalf("Private group should be left out\nGot: %+v", doc.Groups)
+		}
+
+		if _, err := Groups.exportGroups([]string{"oncall"}, elsewhere); err == nil {
+			t.Fatal("Private group should not be exported from another room")
+		}
+	})
+
+	t.Run("Private groups keep their room", func(t *testing.T) {
+		gotText := Groups.Export("oncall backend", "", inRoom)
+
+		for _, want := range []string{"groupName: Backend", "gchatID: " + memberGID, "groupName: oncall", "private: true", "room: " + roomGID} {
+			if !strings.Contains(gotText, want) {
+				t.Fatalf("%q not in export\nGot: %q", want, gotText)
+			}
+		}
+
+		if strings.Index(gotText, "Backend") > strings.Index(gotText, "oncall") {
+			t.Fatalf("Groups should be sorted by name\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Exports JSON with the same keys", func(t *testing.T) {
+		doc, _ := Groups.exportGroups([]string{"backend"}, inRoom)
+		data, err := marshalExport(doc, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got map[string][]map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Export isn't JSON: %s\nGot: %s", err.Error(), data)
+		}
+
+		if got["groups"][0]["groupName"] != "Backend" || got["groups"][0]["members"] == nil {
+			t.Fatalf("Incorrect JSON export\nGot: %s", data)
+		}
+	})
+
+	t.Run("Exports read back in", func(t *testing.T) {
+		doc, _ := Groups.exportGroups([]string{"oncall", "backend"}, inRoom)
+		data, _ := marshalExport(doc, true)
+
+		got, err := parseImport(string(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.Groups) != 2 || got.Groups[1].Room != roomGID || got.Groups[0].Members[0].GID != memberGID {
+			t.Fatalf("Export not read back in\nGot: %+v", got)
+		}
+	})
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"Plain YAML", "groups:\n  - groupName: oncall\n    members:\n      - gchatID: users/1\n", true},
+		{"Code block", "```\ngroups:\n  - groupName: oncall\n```", true},
+		{"Code block with a language", "```yaml\ngroups:\n  - groupName: oncall\n```", true},
+		{"JSON on one line", "```{\"groups\": [{\"groupName\": \"oncall\"}]}```", true},
+		{"No groups", "groups: []", false},
+		{"Invalid name", "groups:\n  - groupName: not a name\n", false},
+		{"Duplicate group", "groups:\n  - groupName: oncall\n  - groupName: OnCall\n", false},
+		{"Invalid member", "groups:\n  - groupName: oncall\n    members:\n      - gchatID: 1\n", false},
+		{"Private without a room", "groups:\n  - groupName: oncall\n    private: true\n", false},
+		{"Not YAML", "groups: [", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseImport(test.data); (err == nil) != test.valid {
+				t.Fatalf("Import should be valid: %v\nGot: %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	msgObj := messageResponse{Message: message{Sender: User{GID: genUserGID(0)}}, FromMaster: true}
+
+	data := `groups:
+  - groupName: oncall
+    members:
+      - memberName: Two
+        gchatID: users/2
+      - gchatID: users/3
+    private: true
+    room: ` + roomGID + `
+  - groupName: newgroup
+    members:
+      - gchatID: users/4
+`
+
+	newGroups := func() GroupMap {
+		return GroupMap{"oncall": &Group{Name: "OnCall", Members: []Member{{GID: "users/1"}, {GID: "users/2"}}}}
+	}
+
+	t.Run("Merge only adds missing members", func(t *testing.T) {
+		Groups := newGroups()
+		Groups.Import(data, ImportMerge, "", msgObj)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/1,users/2,users/3" || Groups["oncall"].IsPrivate {
+			t.Fatalf("Group not merged\nGot: %q %+v", got, Groups["oncall"])
+		}
+
+		if got := Groups["newgroup"]; got == nil || memberGIDs(got.Members) != "users/4" {
+			t.Fatalf("New group not created\nGot: %+v", got)
+		}
+	})
+
+	t.Run("Replace matches the import", func(t *testing.T) {
+		Groups := newGroups()
+		Groups.Import(data, ImportReplace, "", msgObj)
+
+		group := Groups["oncall"]
+		if got := memberGIDs(group.Members); got != "users/2,users/3" || !group.IsPrivate || group.PrivacyRoomID != roomGID || group.Name != "OnCall" {
+			t.Fatalf("Group not replaced\nGot: %q %+v", got, group)
+		}
+	})
+
+	t.Run("Skip leaves existing groups alone", func(t *testing.T) {
+		Groups := newGroups()
+		gotText := Groups.Import(data, ImportSkip, "", msgObj)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/1,users/2" || !Groups.IsGroup("newgroup") {
+			t.Fatalf("Existing group should be skipped\nGot: %q", got)
+		}
+
+		if !strings.Contains(gotText, "OnCall: skipped") {
+			t.Fatalf("Skipped group not reported\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Dry run doesn't change anything", func(t *testing.T) {
+		Groups := newGroups()
+		gotText := Groups.Import(data, ImportReplace, "dryRun", msgObj)
+
+		if Groups.IsGroup("newgroup") || memberGIDs(Groups["oncall"].Members) != "users/1,users/2" {
+			t.Fatal("Dry run should not change the groups")
+		}
+
+		for _, want := range []string{"newgroup (new):\n  + users/4", "OnCall:\n  + users/3\n  - users/1", "privacy: private to " + roomGID} {
+			if !strings.Contains(gotText, want) {
+				t.Fatalf("%q not in preview\nGot: %q", want, gotText)
+			}
+		}
+	})
+
+	t.Run("Matching groups aren't changed", func(t *testing.T) {
+		Groups := newGroups()
+		Groups.Import(data, ImportReplace, "", msgObj)
+
+		if gotText := Groups.Import(data, ImportReplace, "", msgObj); !strings.HasPrefix(gotText, "Nothing to import") {
+			t.Fatalf("Second import should change nothing\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Synced groups are left to their sync", func(t *testing.T) {
+		origDirectory := Directory
+		defer func() { Directory = origDirectory }()
+
+		Directory = &DirectorySync{Sources: []DirectoryGroup{{Group: "oncall"}}}
+
+		Groups := newGroups()
+		gotText := Groups.Import(data, ImportReplace, "", msgObj)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/1,users/2" {
+			t.Fatalf("Directory group should be skipped\nGot: %q", got)
+		}
+
+		if !strings.Contains(gotText, "OnCall: skipped, it's synced with the company directory") {
+			t.Fatalf("Directory group not reported\nGot: %q", gotText)
+		}
+
+		Directory = &DirectorySync{}
+
+		Groups = newGroups()
+		Groups["oncall"].SyncRoomID = roomGID
+		gotText = Groups.Import(data, ImportReplace, "", msgObj)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/1,users/2" {
+			t.Fatalf("Room synced group should be skipped\nGot: %q", got)
+		}
+
+		if !strings.Contains(gotText, "OnCall: skipped, it's synced with its room's members") {
+			t.Fatalf("Room synced group not reported\nGot: %q", gotText)
+		}
+	})
+}
+
+func TestImportCommand(t *testing.T) {
+	Logger.Active(false)
+
+	Groups := GroupMap{"oncall": &Group{Name: "oncall", Members: []Member{{GID: "users/1"}}}}
+	msgObj := messageResponse{Message: message{Sender: User{GID: genUserGID(0)}}, FromMaster: true}
+
+	parse := func(t *testing.T, text string) (Arguments, error) {
+		args := make(Arguments)
+		err := Commands.Get("import").parseArgs(Groups, msgObj, tokenize(BotName+" import "+text), args)
+
+		return args, err
+	}
+
+	t.Run("Picks the policy and keeps the pasted block", func(t *testing.T) {
+		args, err := parse(t, "--replace --dry-run ```\ngroups:\n  - groupName: oncall\n```")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if args["policy"] != ImportReplace || args["dryRun"] == "" || !strings.HasPrefix(args["data"], "```\ngroups:") {
+			t.Fatalf("Args not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Merges by default", func(t *testing.T) {
+		if args, _ := parse(t, "groups: []"); args["policy"] != ImportMerge {
+			t.Fatalf("Incorrect policy %q", args["policy"])
+		}
+	})
+
+	t.Run("Rejects more than one policy", func(t *testing.T) {
+		if _, err := parse(t, "--merge --skip groups: []"); err == nil {
+			t.Fatal("Two policies should be rejected")
+		}
+	})
+
+	t.Run("Asks before importing changes", func(t *testing.T) {
+		args := Arguments{"data": "groups:\n  - groupName: oncall\n    members:\n      - gchatID: users/2\n", "policy": ImportMerge}
+
+		if prompt := confirmImport(Groups, nil, msgObj, args); !strings.Contains(prompt, "+ users/2") {
+			t.Fatalf("Changes not in prompt\nGot: %q", prompt)
+		}
+
+		args["dryRun"] = "dryRun"
+		if prompt := confirmImport(Groups, nil, msgObj, args); prompt != "" {
+			t.Fatalf("Dry runs should not be confirmed\nGot: %q", prompt)
+		}
+
+		args = Arguments{"data": "groups:\n  - groupName: oncall\n    members:\n      - gchatID: users/1\n", "policy": ImportMerge}
+		if prompt := confirmImport(Groups, nil, msgObj, args); prompt != "" {
+			t.Fatalf("Imports without changes should not be confirmed\nGot: %q", prompt)
+		}
+	})
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"fmt"
-	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/jinzhu/gorm"
@@ -23,9 +23,21 @@ type GroupMgr interface {
 	RemoveMembers(string, string, messageResponse) string
 	Restrict(string, messageResponse) string
 	Notify(string, messageResponse) string
+	Expand(string, messageResponse) (string, error)
 	List(string, messageResponse) string
-	SyncGroupMembers(string, messageResponse) string
-	SyncAllGroups(messageResponse) string
+	ListCard(string, messageResponse) *CardV2
+	Whois(messageResponse) string
+	History(string, messageResponse) string
+	VisibleGroups(messageResponse) []string
+	FlagRoom(bool, messageResponse) []string
+	SyncGroupMembers(string, string, messageResponse) string
+	SyncAllGroups(string, messageResponse) string
+	CreateFromRoom(string, string, messageResponse) string
+	Unsync(string, messageResponse) string
+	ReloadManifest(string, messageResponse) string
+	SyncDirectory(string, string, messageResponse) string
+	Export(string, string, messageResponse) string
+	Import(string, string, string, messageResponse) string
 	GetGroup(string) *Group
 	IsGroup(string) bool
 }
@@ -38,16 +50,38 @@ type Group struct {
 	Members       []Member `yaml:"members" gorm:"foreignkey:GroupID"`
 	IsPrivate     bool     `yaml:"private" gorm:"default:false;not null"`
 	PrivacyRoomID string   `yaml:"-"`
+
+	//RoomRemoved is set when the bot is removed from the room the group is
+	//restricted to, and cleared if it's added back.
+	RoomRemoved bool `yaml:"roomRemoved,omitempty" gorm:"not null;default:false"`
+
+	//SyncRoomID is the room whose members the group is kept matching, if it
+	//was created from one with --sync.
+	SyncRoomID string `yaml:"-"`
 }
 
-//Member struct used to define member information
+//Member struct used to define member information. Only the GID is stored with
+//the member, the Name is filled in from the user directory so a person's name
+//isn't copied into every group they're in.
 type Member struct {
 	gorm.Model `yaml:"-"`
 	GroupID    uint   `yaml:"-" gorm:"index:idx_members_group_id"`
-	Name       string `yaml:"memberName" gorm:"not null"`
+	Name       string `yaml:"memberName" gorm:"-"`
 	GID        string `yaml:"gchatID" gorm:"not null"`
 }
 
+//MarshalYAML makes sure the member's name is the latest one in the user
+//directory when the member is listed.
+func (m Member) MarshalYAML() (interface{}, error) {
+	return struct {
+		Name string `yaml:"memberName"`
+		GID  string `yaml:"gchatID"`
+	}{
+		Name: Users.Name(m.GID, m.Name),
+		GID:  m.GID,
+	}, nil
+}
+
 func (g *Group) manageMember(action string, memberList *string, delta, lastNameLen *int, user User) (memberToRemoveDB Member) {
 	*delta++
 	if *delta > 1 {
@@ -98,25 +132,9 @@ func (g *Group) removeMember(member User) (removed Member) {
 
 //Create method initializes a single group.
 func (gm GroupMap) Create(groupName, self string, msgObj messageResponse) string {
-	if groupName == "" {
-		return fmt.Sprintf("My apologies, you need to pass a group name to be able to create the group. ```%s```", usage("create"))
-	}
-
-	saveName, meta := gm.checkGroup(groupName, msgObj)
-	if !strings.Contains(meta, "name") {
-		return fmt.Sprintf("Cannot use %q as group name. Group names can contain letters, numbers, underscores, and dashes, maximum length is 40 characters", groupName)
-	}
-
-	if strings.Contains(meta, "private") {
-		return fmt.Sprintf("The group %q already exists and is private.", groupName)
-	}
-
-	if strings.Contains(meta, "exist") {
-		return fmt.Sprintf("Group %q seems to already exist.\nIf you'd like to remove and recreate the group please say \"%s disband %s\" followed by \"%s create %s @Members...\"",
-			groupName,
-			BotName, groupName,
-			BotName, groupName,
-		)
+	saveName, reply := gm.checkNewGroup(groupName, msgObj)
+	if reply != "" {
+		return reply
 	}
 
 	var (
@@ -145,6 +163,13 @@ func (gm GroupMap) Create(groupName, self string, msgObj messageResponse) string
 		}
 	}
 
+	emailUsers, unresolved, skipped := resolveEmails(msgObj)
+	for _, user := range emailUsers {
+		if !seen(user.Name) {
+			newGroup.manageMember("add", &newMembers, &numAdded, &lastNameLen, user)
+		}
+	}
+
 	if self != "" {
 		newGroup.manageMember("add", &newMembers, &numAdded, &lastNameLen, msgObj.Message.Sender)
 	}
@@ -155,9 +180,38 @@ func (gm GroupMap) Create(groupName, self string, msgObj messageResponse) string
 		newMembers = correctGP(newMembers, numAdded, lastNameLen)
 	}
 
-	go Logger.SaveCreatedGroup(newGroup)
+	saveGroup(func() { Logger.SaveCreatedGroup(newGroup) })
 	gm[saveName] = newGroup
-	return fmt.Sprintf("Created group %q with %s.", groupName, newMembers)
+
+	auditGroup("create", newGroup, nil, msgObj, "")
+	return fmt.Sprintf("Created group %q with %s.", groupName, newMembers) + unresolvedText(unresolved, skipped)
+}
+
+//checkNewGroup checks a group can be created with the name, returning the
+//name it's saved under, or why it can't be created
+func (gm GroupMap) checkNewGroup(groupName string, msgObj messageResponse) (saveName, reply string) {
+	if groupName == "" {
+		return "", fmt.Sprintf("My apologies, you need to pass a group name to be able to create the group. ```%s```", usage("create"))
+	}
+
+	saveName, meta := gm.checkGroup(groupName, msgObj)
+	if !strings.Contains(meta, "name") {
+		return "", fmt.Sprintf("Cannot use %q as group name. Group names can contain letters, numbers, underscores, and dashes, maximum length is 40 characters", groupName)
+	}
+
+	if strings.Contains(meta, "private") {
+		return "", fmt.Sprintf("The group %q already exists and is private.", groupName)
+	}
+
+	if strings.Contains(meta, "exist") {
+		return "", fmt.Sprintf("Group %q seems to already exist.\nIf you'd like to remove and recreate the group please say \"%s disband %s\" followed by \"%s create %s @Members...\"",
+			groupName,
+			BotName, groupName,
+			BotName, groupName,
+		)
+	}
+
+	return saveName, ""
 }
 
 //Disband method will remove a group from the list, as well, delete the group from the
@@ -178,8 +232,20 @@ func (gm GroupMap) Disband(groupName string, msgObj messageResponse) string {
 		return fmt.Sprintf("The group %q is private, and you may not mutate it.", groupName)
 	}
 
-	go Logger.DisbandGroup(gm[saveName])
+	if strings.Contains(meta, "managed") {
+		return managedReply(groupName)
+	}
+
+	if strings.Contains(meta, "directory") {
+		return directoryReply(groupName)
+	}
+
+	group := gm[saveName]
+
+	saveGroup(func() { Logger.DisbandGroup(group) })
 	delete(gm, saveName)
+
+	auditGroup("disband", &Group{Name: group.Name}, group.Members, msgObj, "")
 	return fmt.Sprintf("Group %q has been deleted, along with all its data.", groupName)
 }
 
@@ -199,6 +265,18 @@ func (gm GroupMap) AddMembers(groupName, self string, msgObj messageResponse) st
 		return fmt.Sprintf("The group %q is private, and you may not mutate it.", groupName)
 	}
 
+	if strings.Contains(meta, "managed") {
+		return managedReply(groupName)
+	}
+
+	if strings.Contains(meta, "directory") {
+		return directoryReply(groupName)
+	}
+
+	if strings.Contains(meta, "synced") {
+		return syncedReply(groupName)
+	}
+
 	var (
 		addedMembers    string
 		existingMembers string
@@ -211,9 +289,20 @@ func (gm GroupMap) AddMembers(groupName, self string, msgObj messageResponse) st
 
 		seen = checkSeen()
 
-		group = gm[saveName]
+		group  = gm[saveName]
+		before = append([]Member(nil), group.Members...)
 	)
 
+	addUser := func(user User) {
+		exist := gm.checkMember(groupName, user.GID)
+
+		if !exist {
+			group.manageMember("add", &addedMembers, &numAdded, &lastAddedNameLen, user)
+		} else {
+			group.manageMember("none", &existingMembers, &numExist, &lastExistNameLen, user)
+		}
+	}
+
 	for _, mention := range msgObj.Message.Mentions {
 		user := mention.Called.User
 
@@ -222,35 +311,35 @@ func (gm GroupMap) AddMembers(groupName, self string, msgObj messageResponse) st
 		}
 
 		if user.Type != "BOT" && mention.Type == "USER_MENTION" {
-			exist := gm.checkMember(groupName, user.GID)
+			addUser(user)
+		}
+	}
 
-			if !exist {
-				group.manageMember("add", &addedMembers, &numAdded, &lastAddedNameLen, user)
-			} else {
-				group.manageMember("none", &existingMembers, &numExist, &lastExistNameLen, user)
-			}
+	//People can also be given by email, such as ones who aren't in the room
+	emailUsers, unresolved, skipped := resolveEmails(msgObj)
+	for _, user := range emailUsers {
+		if !seen(user.Name) {
+			addUser(user)
 		}
 	}
 
 	if self != "" {
-		sender := msgObj.Message.Sender
-		exist := gm.checkMember(groupName, sender.GID)
-
-		if !exist {
-			group.manageMember("add", &addedMembers, &numAdded, &lastAddedNameLen, sender)
-		} else {
-			group.manageMember("none", &existingMembers, &numExist, &lastExistNameLen, sender)
-		}
+		addUser(msgObj.Message.Sender)
 	}
 
 	if numAdded == 0 && numExist == 0 {
-		return "No users to add. Please @ the member you'd like to add to the group."
+		if missed := unresolvedText(unresolved, skipped); missed != "" {
+			return strings.TrimSpace(missed) + " No users were added."
+		}
+
+		return "No users to add. Please @ the member you'd like to add to the group, or give their email."
 	}
 
 	if numAdded > 0 {
 		addedMembers = correctGP(addedMembers, numAdded, lastAddedNameLen)
 
-		go Logger.SaveMemberAddition(group)
+		saveGroup(func() { Logger.SaveMemberAddition(group) })
+		auditGroup("add", group, before, msgObj, "")
 		text += fmt.Sprintf("I've added the %s to the group %q.", addedMembers, groupName)
 	}
 
@@ -260,7 +349,7 @@ func (gm GroupMap) AddMembers(groupName, self string, msgObj messageResponse) st
 		text += fmt.Sprintf("\nThe %s already added the group %q. ", existingMembers, groupName)
 	}
 
-	return text
+	return text + unresolvedText(unresolved, skipped)
 }
 
 //RemoveMembers method removes the member from the group. When the member is removed from
@@ -276,6 +365,18 @@ func (gm GroupMap) RemoveMembers(groupName, self string, msgObj messageResponse)
 		return fmt.Sprintf("The group %q is private, and you may not mutate it.", groupName)
 	}
 
+	if strings.Contains(meta, "managed") {
+		return managedReply(groupName)
+	}
+
+	if strings.Contains(meta, "directory") {
+		return directoryReply(groupName)
+	}
+
+	if strings.Contains(meta, "synced") {
+		return syncedReply(groupName)
+	}
+
 	var (
 		removedMembers     string
 		nonExistantMembers string
@@ -291,7 +392,8 @@ func (gm GroupMap) RemoveMembers(groupName, self string, msgObj messageResponse)
 
 		seen = checkSeen()
 
-		group = gm[saveName]
+		group  = gm[saveName]
+		before = append([]Member(nil), group.Members...)
 	)
 
 	for _, mention := range msgObj.Message.Mentions {
@@ -360,7 +462,8 @@ func (gm GroupMap) RemoveMembers(groupName, self string, msgObj messageResponse)
 	if numRemoved > 0 {
 		removedMembers = correctGP(removedMembers, numRemoved, lastRemovedNameLen)
 
-		go Logger.SaveMemberRemoval(group, membersToRemoveDB)
+		saveGroup(func() { Logger.SaveMemberRemoval(group, membersToRemoveDB) })
+		auditGroup("remove", group, before, msgObj, "")
 		text += fmt.Sprintf("I've removed the %s from %q. ", removedMembers, groupName)
 	}
 
@@ -384,72 +487,104 @@ func (gm GroupMap) Restrict(groupName string, msgObj messageResponse) string {
 		return fmt.Sprintf("The group %q is private, and you may not mutate it.", groupName)
 	}
 
+	if strings.Contains(meta, "managed") {
+		return managedReply(groupName)
+	}
+
 	group := gm[saveName]
 
 	if group.IsPrivate {
 		group.IsPrivate = false
 		group.PrivacyRoomID = ""
+		group.RoomRemoved = false
 
-		go Logger.UpdatePrivacyDB(group)
+		saveGroup(func() { Logger.UpdatePrivacyDB(group) })
+		auditGroup("restrict", group, group.Members, msgObj, "set to public")
 		return fmt.Sprintf("I've set %q to public, now it can be used in any room.", groupName)
 	}
 
 	group.IsPrivate = true
 	group.PrivacyRoomID = msgObj.Room.GID
 
-	go Logger.UpdatePrivacyDB(group)
+	saveGroup(func() { Logger.UpdatePrivacyDB(group) })
+	auditGroup("restrict", group, group.Members, msgObj, "set to private")
 	return fmt.Sprintf("I've set %q to be private, the group can only be used in this room now.", groupName)
 }
 
 //Notify method is the bread and butter of this bot. It's it will take your message, and
 //replace the botname and specified group, with the users in the list.
 func (gm GroupMap) Notify(groupName string, msgObj messageResponse) string {
+	message, err := gm.Expand(groupName, msgObj)
+	if err != nil {
+		return err.Error()
+	}
+
+	return message
+}
+
+//The reasons a group's mention can't be expanded
+const (
+	NotifyMissing = "missing"
+	NotifyPrivate = "private"
+	NotifyLimited = "limited"
+	NotifyTooLong = "too long"
+)
+
+//NotifyError explains why a group's mention couldn't be expanded. The error
+//reads as the reply sent back in chat.
+type NotifyError struct {
+	Reason string
+	Reply  string
+}
+
+func (ne *NotifyError) Error() string {
+	return ne.Reply
+}
+
+//Expand builds the message Notify sends, with the bot's mention of the group
+//swapped for the group's members. It's split from Notify so callers outside of
+//chat can tell why a group couldn't be notified.
+func (gm GroupMap) Expand(groupName string, msgObj messageResponse) (string, error) {
 	saveName, meta := gm.checkGroup(groupName, msgObj)
 	if !strings.Contains(meta, "exist") {
-		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
+		return "", &NotifyError{NotifyMissing, fmt.Sprintf("Group %q does not seem to exist.", groupName)}
 	}
 
 	if strings.Contains(meta, "private") {
-		return fmt.Sprintf("The group %q is private, and you may not use it.", groupName)
+		if gm[saveName].RoomRemoved {
+			return "", &NotifyError{NotifyPrivate, fmt.Sprintf("The group %q is restricted to a room I've been removed from. An admin can make it public or disband it.", groupName)}
+		}
+
+		return "", &NotifyError{NotifyPrivate, fmt.Sprintf("The group %q is private, and you may not use it.", groupName)}
+	}
+
+	if scope, wait := Limiter.Allow(saveName, msgObj); scope != "" {
+		return "", &NotifyError{NotifyLimited, Limiter.CooldownMessage(groupName, scope, wait)}
 	}
 
 	group := gm[saveName]
 
-	var memberList string
+	var memberList []string
 	//TODO: Check if users are in the room before adding them to list
 	for _, member := range group.Members {
-		memberList += "<" + member.GID + "> "
+		memberList = append(memberList, "<"+member.GID+">")
 	}
 
+	//The bot's mention through the group's name is swapped for the members
 	message := msgObj.Message.Text
+	if mention, found := findGroupMention(msgObj.Message); found {
+		message = message[:mention.Start] + strings.Join(memberList, " ") + message[mention.End:]
+	} else {
+		message = strings.Join(memberList, " ") + " " + message
+	}
 
-	botLen := len(BotName)
-	botIndex := strings.Index(message, BotName)
-
-	tmpMessage := string([]byte(message)[botLen+botIndex:])
-
-	groupLen := len(groupName)
-	groupIndex := strings.Index(tmpMessage, groupName)
-
-	newMessage := fmt.Sprintf("%s said:\n\n%s",
-		msgObj.Message.Sender.Name,
-		strings.Replace(
-			message,
-			//This bit of nonsense is how I actually do the replacing. I cast the message
-			//string to an array of bytes, go to the beginning of the bot, select up until
-			//the end of the group name, then cast that bit into a string to be replaced
-			//by the memberList. It's gross, but efficient. Like me?
-			string([]byte(message)[botIndex:botIndex+botLen+groupIndex+groupLen]),
-			memberList,
-			1,
-		),
-	)
+	newMessage := fmt.Sprintf("%s said:\n\n%s", msgObj.Message.Sender.Name, message)
 
 	if len(newMessage) >= 4000 {
-		return "My apologies, your message with the group added would exceed Google Chat's character limit. :("
+		return "", &NotifyError{NotifyTooLong, "My apologies, your message with the group added would exceed Google Chat's character limit. :("}
 	}
 
-	return newMessage
+	return newMessage, nil
 }
 
 //List method will show you either a list of all of the groups available for use, or details
@@ -465,7 +600,7 @@ func (gm GroupMap) List(groupName string, msgObj messageResponse) string {
 		var allGroupNames string
 		for name := range gm {
 			_, meta := gm.checkGroup(name, msgObj)
-			if !strings.Contains(meta, "private") {
+			if !strings.Contains(meta, "private") || strings.Contains(meta, "audit") {
 				allGroupNames += " | " + gm[name].Name
 			}
 		}
@@ -484,7 +619,7 @@ func (gm GroupMap) List(groupName string, msgObj messageResponse) string {
 		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
 	}
 
-	if strings.Contains(meta, "private") {
+	if strings.Contains(meta, "private") && !strings.Contains(meta, "audit") {
 		return fmt.Sprintf("The group %q is private, and you may not view it.", groupName)
 	}
 
@@ -494,53 +629,155 @@ func (gm GroupMap) List(groupName string, msgObj messageResponse) string {
 	return fmt.Sprintf("Here are details for %q: ```%s```", groupName, string(yamlList))
 }
 
+//VisibleGroups returns the names of the groups that can be used from the room
+//the message came from. Private groups from other rooms are left out, even
+//for auditors, since the names are offered back to whoever asked.
+func (gm GroupMap) VisibleGroups(msgObj messageResponse) []string {
+	var names []string
+	for saveName, group := range gm {
+		if _, meta := gm.checkGroup(saveName, msgObj); !strings.Contains(meta, "private") {
+			names = append(names, group.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+//Whois method lists every group the mentioned users belong to. Private groups
+//are only listed when they'd be usable from the room the question was asked in.
+func (gm GroupMap) Whois(msgObj messageResponse) string {
+	var (
+		text string
+		seen = checkSeen()
+	)
+
+	for _, mention := range msgObj.Message.Mentions {
+		user := mention.Called.User
+
+		if user.Type == "BOT" || mention.Type != "USER_MENTION" || seen(user.GID) {
+			continue
+		}
+
+		var groupNames []string
+		for name, group := range gm {
+			if _, meta := gm.checkGroup(name, msgObj); strings.Contains(meta, "private") && !strings.Contains(meta, "audit") {
+				continue
+			}
+
+			for _, member := range group.Members {
+				if member.GID == user.GID {
+					groupNames = append(groupNames, group.Name)
+					break
+				}
+			}
+		}
+
+		sort.Strings(groupNames)
+
+		displayName := Users.Name(user.GID, user.Name)
+		if len(groupNames) == 0 {
+			text += fmt.Sprintf("%s isn't in any groups I can show you here.\n", displayName)
+			continue
+		}
+
+		text += fmt.Sprintf("%s is in: ```%s```\n", displayName, strings.Join(groupNames, " | "))
+	}
+
+	if text == "" {
+		return fmt.Sprintf("Please @ the person you'd like to look up. ```%s```", usage("whois"))
+	}
+
+	return strings.TrimSuffix(text, "\n")
+}
+
 //SyncGroupMembers is a hidden route for the bot's admin. It's purpose is to sync the
 //in-memory groups with the information in the database. Typically the database is only used
 //for logging, and not really influencing the in-memory group list. However, there are some
 //special circumstances which may call for manual intervention. With this method, the admin
 //would be able to modify the database manually, then call this method to sync a single group.
-func (gm GroupMap) SyncGroupMembers(groupName string, msgObj messageResponse) string {
-	if !msgObj.FromMaster {
-		return "Invalid option received. I'm not sure what to do about \"syncgroup\"."
-	}
+//Passing a dryRun shows who would be added or removed without changing anything.
+//Moderators can sync the groups restricted to their room, and auditors can do
+//a dry run of any group.
+func (gm GroupMap) SyncGroupMembers(groupName, dryRun string, msgObj messageResponse) string {
+	sender := msgObj.Message.Sender.GID
+	denied := "Invalid option received. I'm not sure what to do about \"syncgroup\"."
 
 	saveName, meta := gm.checkGroup(groupName, msgObj)
 	if !strings.Contains(meta, "exist") {
+		if !msgObj.FromMaster {
+			return denied
+		}
+
 		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
 	}
 
 	group := gm[saveName]
+	allowed := msgObj.FromMaster ||
+		(group.IsPrivate && Roles.IsModerator(sender, group.PrivacyRoomID)) ||
+		(dryRun != "" && auditing(msgObj))
 
-	//Storing old member list to check later if a change has occured
-	oldMembers := group.Members
-	Logger.SyncGroup(group)
-	syncedMembers := group.Members
+	if !allowed {
+		return denied
+	}
 
-	text := fmt.Sprintf("Group %q synced, ", groupName)
+	before := group.Members
+	diff := Logger.SyncGroup(group, dryRun != "")
 
-	//At this point, I don't believe I am too concerned with the specific
-	//members so much as, if a change occured. Maybe in the future, this
-	//can be updated to be more specific.
-	if reflect.DeepEqual(oldMembers, syncedMembers) {
-		text += "and no changes were made."
-	} else {
-		text += "and some changes were made."
+	if !diff.HasChanges() {
+		return fmt.Sprintf("Group %q is in sync, no changes to make.", groupName)
 	}
 
-	return text
+	if dryRun != "" {
+		return fmt.Sprintf("Dry run, nothing was changed. Syncing %q would make these changes: ```%s```", groupName, diff)
+	}
+
+	auditGroup("sync", group, before, msgObj, "")
+
+	return fmt.Sprintf("Group %q synced with these changes: ```%s```", groupName, diff)
 }
 
 //SyncAllGroups is similar to the philosophy of the above method. The main difference, is this
-//one does a sync for all of the groups, as opposed to just one.
-func (gm GroupMap) SyncAllGroups(msgObj messageResponse) string {
-	if !msgObj.FromMaster {
+//one does a sync for all of the groups, as opposed to just one. Auditors may
+//only do a dry run.
+func (gm GroupMap) SyncAllGroups(dryRun string, msgObj messageResponse) string {
+	if !msgObj.FromMaster && !(dryRun != "" && auditing(msgObj)) {
 		return "Invalid option received. I'm not sure what to do about \"syncallgroups\"."
 	}
 
-	Logger.SyncAllGroups(gm)
+	before := make(map[string][]Member)
+	for saveName, group := range gm {
+		before[saveName] = group.Members
+	}
+
+	diffs := Logger.SyncAllGroups(gm, dryRun != "")
+	changes := formatDiffs(diffs)
+
+	if dryRun == "" {
+		for _, diff := range diffs {
+			saveName := strings.ToLower(diff.GroupName)
+
+			if diff.HasChanges() {
+				auditGroup("sync", gm[saveName], before[saveName], msgObj, "")
+			}
+		}
+	}
+
+	if dryRun != "" {
+		if changes == "" {
+			return "Dry run, nothing was changed. All groups are already in sync."
+		}
+
+		return fmt.Sprintf("Dry run, nothing was changed. Syncing all groups would make these changes: ```%s```", changes)
+	}
 
 	fmt.Println("All groups synced")
-	return "All groups synced."
+
+	if changes == "" {
+		return "All groups synced, and no changes were made."
+	}
+
+	return fmt.Sprintf("All groups synced with these changes: ```%s```", changes)
 }
 
 //checkGroups method checks the group and returns data about the group to be processed and
@@ -564,10 +801,30 @@ func (gm GroupMap) checkGroup(groupName string, msgObj messageResponse) (saveNam
 		return
 	}
 
-	//Nothing is private for bot admin.
-	if group.IsPrivate && !msgObj.FromMaster {
-		if group.PrivacyRoomID != msgObj.Room.GID {
+	if Manifest.Manages(saveName) {
+		meta += "managed"
+	}
+
+	if Directory.Manages(saveName) {
+		meta += "directory"
+	}
+
+	if group.SyncRoomID != "" {
+		meta += "synced"
+	}
+
+	//Nothing is private for bot admin, or for the moderators of the room the
+	//group is restricted to. Auditors can still see the group from a DM, but
+	//not use it.
+	if group.IsPrivate && !msgObj.FromMaster && group.PrivacyRoomID != msgObj.Room.GID {
+		sender := msgObj.Message.Sender.GID
+
+		if !Roles.IsModerator(sender, group.PrivacyRoomID) {
 			meta += "private"
+
+			if auditing(msgObj) {
+				meta += "audit"
+			}
 		}
 	}
 
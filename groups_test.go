@@ -851,6 +851,72 @@ func TestListGroups(t *testing.T) {
 	})
 }
 
+func TestWhois(t *testing.T) {
+	Logger.Active(false)
+
+	wantedGID := genUserGID(0)
+	roomGID := genRoomGID(0)
+
+	msgObj := messageResponse{
+		Message: message{
+			Mentions: []annotation{{
+				Called: userMention{
+					User: User{
+						Name: genRandName(10),
+						GID:  wantedGID,
+						Type: "HUMAN",
+					},
+				},
+				Type: "USER_MENTION",
+			}},
+		},
+		Room: space{
+			GID:  roomGID,
+			Type: "ROOM",
+		},
+	}
+
+	Groups := make(GroupMap)
+	Groups["group1"] = &Group{Name: "group1", Members: []Member{{GID: wantedGID}}}
+	Groups["group2"] = &Group{Name: "group2", Members: []Member{{GID: genUserGID(0)}}}
+	Groups["privatehere"] = &Group{
+		Name:          "privatehere",
+		Members:       []Member{{GID: wantedGID}},
+		IsPrivate:     true,
+		PrivacyRoomID: roomGID,
+	}
+	Groups["privateelsewhere"] = &Group{
+		Name:          "privateelsewhere",
+		Members:       []Member{{GID: wantedGID}},
+		IsPrivate:     true,
+		PrivacyRoomID: genRoomGID(0),
+	}
+
+	t.Run("Lists groups the user belongs to", func(t *testing.T) {
+		gotText := Groups.Whois(msgObj)
+
+		if !strings.Contains(gotText, "group1") || !strings.Contains(gotText, "privatehere") {
+			t.Fatalf("Wanted groups not in whois output\nGot: %q", gotText)
+		}
+
+		if strings.Contains(gotText, "group2") {
+			t.Fatal("Should not list groups the user isn't in")
+		}
+
+		if strings.Contains(gotText, "privateelsewhere") {
+			t.Fatal("Should not list private groups from other rooms")
+		}
+	})
+
+	t.Run("Asks for a mention when none given", func(t *testing.T) {
+		gotText := Groups.Whois(messageResponse{})
+
+		if !strings.Contains(gotText, "Please @ the person") {
+			t.Fatalf("Should ask for a mention\nGot: %q", gotText)
+		}
+	})
+}
+
 func TestSyncGroup(t *testing.T) {
 	if tf := os.Getenv("RUN_INTEGRATION"); tf != "true" {
 		t.Skip("Must set env variable RUN_INTEGRATION to 'true' to run this test")
@@ -2,21 +2,18 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 )
 
 func getRequestHandler(Groups GroupMgr, Scheduler ScheduleMgr) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
-			msgObj   messageResponse
-			jsonReq  []byte
-			jsonResp []byte
-			e        error
+			msgObj  messageResponse
+			jsonReq []byte
+			e       error
 		)
 
 		var authToken string
@@ -31,7 +28,7 @@ func getRequestHandler(Groups GroupMgr, Scheduler ScheduleMgr) http.HandlerFunc
 				r.RemoteAddr,
 			)
 
-			if os.Getenv("VERIFY_REQUEST") == "true" {
+			if Config.VerifyRequest == "true" {
 				log.Println("Denying response")
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -44,42 +41,99 @@ func getRequestHandler(Groups GroupMgr, Scheduler ScheduleMgr) http.HandlerFunc
 		e = json.Unmarshal(jsonReq, &msgObj)
 		checkError(e)
 
+		var reply Reply
+
 		switch msgObj.Type {
 		case "ADDED_TO_SPACE":
-			resp := map[string]string{
-				"text": "Thank you for inviting me! Here's what I'm about:" + usage(""),
+			intro := "Thank you for inviting me! Here's what I'm about:"
+
+			stateLock.Lock()
+			if resumed := rejoinRoom(Groups, Scheduler, msgObj); resumed != "" {
+				intro = "Thanks for having me back! " + resumed + " Here's what I'm about:"
+			}
+			stateLock.Unlock()
+
+			reply = newReply(intro+usage(""), helpCard())
+			if reply.CardsV2 != nil {
+				reply.Text = intro
+			}
+
+		case "CARD_CLICKED":
+			if fn := msgObj.Action.MethodName; fn == confirmFunction || fn == cancelFunction {
+				stateLock.Lock()
+				reply = Confirmations.Resolve(Groups, Scheduler, msgObj)
+				stateLock.Unlock()
+
+				break
 			}
-			jsonResp, e = json.Marshal(resp)
+
+			//Clicking any other button runs its command as if it had been typed
+			msgObj.fromClick()
+			fallthrough
 
 		case "MESSAGE":
+
 			//Log every usage of hgnotify to the db.
 			go Logger.CreateLogEntry(msgObj)
+			Users.ObserveMessage(msgObj)
 
-			var msg string
-
-			args, errMsg, okay := msgObj.ParseArgs(Groups)
-			if okay {
-				msg = inspectMessage(Groups, Scheduler, msgObj, args)
-			} else {
-				msg = errMsg
-			}
+			reply = respond(Groups, Scheduler, &msgObj)
 
-			resp := map[string]string{
-				"text": msg,
-			}
-			jsonResp, e = json.Marshal(resp)
+		case "REMOVED_FROM_SPACE":
+			stateLock.Lock()
+			leaveRoom(Groups, Scheduler, msgObj)
+			stateLock.Unlock()
 
 		default:
-			//Not too sure of any message type that's not Added or Message, there is removed
-			//But that one doesn't allow messages to be sent, sooooooooo?
-			resp := map[string]string{
-				"text": "Oh, ummm! I'm not exactly sure what happened, or what type of request this is. But here's what I was made to do, if it helps." + usage(""),
+			//Not too sure of any other message type, but just in case
+			reply = Reply{
+				Text: "Oh, ummm! I'm not exactly sure what happened, or what type of request this is. But here's what I was made to do, if it helps." + usage(""),
 			}
-			jsonResp, e = json.Marshal(resp)
 		}
 
-		fmt.Fprintf(w, "%s", string(jsonResp))
+		writeReply(w, reply)
+	}
+}
+
+//respond parses the message and runs the command it asks for. The reply is
+//laid out as a card when the command has one. It takes stateLock itself, and
+//lets go of it while the command looks anything up.
+func respond(Groups GroupMgr, Scheduler ScheduleMgr, msgObj *messageResponse) Reply {
+	stateLock.Lock()
+	args, errMsg, okay := msgObj.ParseArgs(Groups)
+	stateLock.Unlock()
+
+	if !okay {
+		return Reply{Text: errMsg}
+	}
+
+	cmd := Commands.Get(args["action"])
+
+	//Anything read from outside the bot is read without the lock, so a
+	//slow service only holds up the one message.
+	if cmd != nil {
+		cmd.lookup(msgObj, args)
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	//Destructive commands wait for the sender to confirm them, which needs
+	//a card to click.
+	if cmd != nil && UseCards {
+		if prompt := cmd.confirm(Groups, Scheduler, *msgObj, args); prompt != "" {
+			return Confirmations.Ask(prompt, *msgObj, args)
+		}
+	}
+
+	text := inspectMessage(Groups, Scheduler, *msgObj, args)
+
+	var card *CardV2
+	if cmd != nil && UseCards {
+		card = cmd.card(Groups, Scheduler, *msgObj, args)
 	}
+
+	return newReply(text, card)
 }
 
 // ReadinessCheck returns a healthcheck handler
@@ -91,3 +145,39 @@ func ReadinessCheck() http.HandlerFunc {
 		w.Write([]byte("{}"))
 	}
 }
+
+// ReconcilerStatus returns a handler showing when the
+// reconciler last ran and how many discrepancies of each
+// kind it found. The discrepancies themselves name groups
+// and members, so they're only listed for admin clients.
+func ReconcilerStatus(r *Reconciler, clients *APIClients) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		lastRun, found := r.Status()
+
+		counts := make(map[string]int)
+		for _, d := range found {
+			counts[d.Kind]++
+		}
+
+		status := map[string]interface{}{
+			"direction": r.Direction,
+			"interval":  r.Interval.String(),
+			"lastRun":   lastRun,
+			"counts":    counts,
+		}
+
+		if client := clients.Authenticate(bearerToken(req)); client != nil && client.Admin {
+			if found == nil {
+				found = []Discrepancy{}
+			}
+
+			status["discrepancies"] = found
+		}
+
+		resp, err := json.Marshal(status)
+		checkError(err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
@@ -176,7 +176,7 @@ func TestEndToEnd(t *testing.T) {
 		}
 
 		for i, wantedMember := range wantedMembers {
-			if wantedMember.Name != gotMembers[i].Name {
+			if wantedMember.GID != gotMembers[i].GID {
 				t.Fatal("Incorrect member saved in memory")
 			}
 		}
@@ -405,9 +405,9 @@ func TestEndToEnd(t *testing.T) {
 		}
 
 		var gotMember Member
-		db.Raw("SELECT * FROM members WHERE deleted_at IS NULL AND name = ?", memberToRemove.Name).Scan(&gotMember)
+		db.Raw("SELECT * FROM members WHERE deleted_at IS NULL AND g_id = ?", memberToRemove.GID).Scan(&gotMember)
 
-		if gotMember.Name == memberToRemove.Name {
+		if gotMember.GID == memberToRemove.GID {
 			t.Fatal("Did not remove member from DB")
 		}
 
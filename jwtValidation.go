@@ -12,7 +12,10 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -26,10 +29,28 @@ import (
 // I can nuke this whole file and use the module. I feel gross, having ripped all this
 // code, but I guess it's the same as pulling in an import.
 //
-// AAAANNNYYYY WAY, that's why I'm not going to add tests for this file
+// The claim checks and key caching were added on top of that, so those are
+// what the tests cover.
 
 const es256KeySize int = 32
 
+// How far off our clock is allowed to be from google's when checking
+// when the token was issued and when it expires.
+const clockSkew = time.Minute
+
+// How often the keys can be fetched again for a token signed with a
+// key we don't know, so forged tokens can't make us fetch them on
+// every request.
+const keyRefreshCooldown = time.Minute
+
+// The keys are kept at least this long, even when google doesn't say
+// they can be cached, and a fetch gives up after keyFetchTimeout so a
+// hung endpoint can't hold up every event.
+const (
+	minKeyCacheAge  = time.Minute * 5
+	keyFetchTimeout = time.Second * 10
+)
+
 // Information used to get data for validation
 const (
 	Issuer        = "chat@system.gserviceaccount.com"
@@ -80,17 +101,55 @@ type certResponse struct {
 	Keys []JWK `json:"keys"`
 }
 
-// Validator is used to communicate with the given url
-// to retrieve the cert data.
+// certFetch is a fetch of the keys in progress, which every request
+// that needs the keys meanwhile waits on rather than fetching them too.
+type certFetch struct {
+	done chan struct{}
+	keys *certResponse
+	err  error
+}
+
+// Validator is used to validate the tokens google sends along with
+// each event. The client is used to retrieve the cert data, and the
+// keys it returns are cached for as long as google allows.
 type Validator struct {
-	client *http.Client
+	client   *http.Client
+	certURL  string
+	audience string
+	now      func() time.Time
+
+	mu          sync.Mutex
+	keys        *certResponse
+	keysExpires time.Time
+	keysFetched time.Time
+	fetch       *certFetch
+}
+
+// newValidator sets up a validator expecting tokens for the given
+// audience, which for chat bots is the project number.
+func newValidator(client *http.Client, audience string) *Validator {
+	return &Validator{
+		client:   client,
+		certURL:  CertURLPrefix + Issuer,
+		audience: audience,
+		now:      time.Now,
+	}
 }
 
 func validateJWT(authString string) (bool, error) {
+	if err := jwtValidator.Validate(authString); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Validate checks the token's signature along with its claims
+func (v *Validator) Validate(authString string) error {
 	segments := strings.Split(authString, ".")
 
 	if len(segments) != 3 {
-		return false, errors.New("invalid JWT, expected 3 segments")
+		return errors.New("invalid JWT, expected 3 segments")
 	}
 
 	jwt := JWT{
@@ -99,64 +158,99 @@ func validateJWT(authString string) (bool, error) {
 		signature: segments[2],
 	}
 
-	v := Validator{client: http.DefaultClient}
+	header, err := jwt.parseHeader()
+	if err != nil {
+		return err
+	}
 
-	header := jwt.parseHeader()
-	sig := jwt.parseSignature()
+	payload, err := jwt.parsePayload()
+	if err != nil {
+		return err
+	}
+
+	sig, err := jwt.parseSignature()
+	if err != nil {
+		return err
+	}
 
 	switch header.Algorithm {
 	case "RS256":
 		if err := v.validateRS256(header.KeyID, jwt.hashedContent(), []byte(sig)); err != nil {
-			return false, err
+			return err
 		}
 	case "ES256":
 		if err := v.validateES256(header.KeyID, jwt.hashedContent(), []byte(sig)); err != nil {
-			return false, err
+			return err
 		}
 	default:
-		return false, fmt.Errorf("idtoken: expected JWT signed with RS256 or ES256 but found %q", header.Algorithm)
+		return fmt.Errorf("idtoken: expected JWT signed with RS256 or ES256 but found %q", header.Algorithm)
 	}
 
-	return true, nil
+	return v.validateClaims(payload)
+}
+
+// validateClaims makes sure the token was issued by chat, for this
+// bot, and is being used within its lifetime. clockSkew is allowed
+// on either end of the lifetime.
+func (v *Validator) validateClaims(payload Payload) error {
+	now := v.now()
+
+	if payload.Issuer != Issuer {
+		return fmt.Errorf("idtoken: expected issuer %q but found %q", Issuer, payload.Issuer)
+	}
+
+	if v.audience == "" {
+		return errors.New("idtoken: no audience configured to validate against")
+	}
+
+	if payload.Audience != v.audience {
+		return fmt.Errorf("idtoken: expected audience %q but found %q", v.audience, payload.Audience)
+	}
+
+	if payload.Expires == 0 || now.Add(-clockSkew).After(time.Unix(payload.Expires, 0)) {
+		return errors.New("idtoken: token expired")
+	}
+
+	if now.Add(clockSkew).Before(time.Unix(payload.IssuedAt, 0)) {
+		return errors.New("idtoken: token used before it was issued")
+	}
+
+	return nil
 }
 
-func (j JWT) parseHeader() Header {
+func (j JWT) parseHeader() (Header, error) {
 	var header Header
 
 	h, err := jwt.DecodeSegment(j.header)
 	if err != nil {
-		panic(err)
+		return header, err
 	}
 
-	if err := json.Unmarshal(h, &header); err != nil {
-		panic(err)
-	}
+	err = json.Unmarshal(h, &header)
 
-	return header
+	return header, err
 }
 
-func (j JWT) parsePayload() Payload {
+func (j JWT) parsePayload() (Payload, error) {
 	var payload Payload
 
 	p, err := jwt.DecodeSegment(j.payload)
 	if err != nil {
-		panic(err)
+		return payload, err
 	}
 
-	if err := json.Unmarshal(p, &payload); err != nil {
-		panic(err)
-	}
+	err = json.Unmarshal(p, &payload)
 
-	return payload
+	return payload, err
 }
 
-func (j JWT) parseSignature() string {
+func (j JWT) parseSignature() (string, error) {
 	signature, err := jwt.DecodeSegment(j.signature)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return string(signature)
+	return string(signature), nil
 }
 
 func (j JWT) hashedContent() []byte {
@@ -166,12 +260,7 @@ func (j JWT) hashedContent() []byte {
 }
 
 func (v *Validator) validateRS256(keyID string, hashedContent []byte, sig []byte) error {
-	certResp, err := v.getCert(CertURLPrefix + Issuer)
-	if err != nil {
-		return err
-	}
-
-	j, err := findMatchingKey(certResp, keyID)
+	j, err := v.findKey(keyID)
 	if err != nil {
 		return err
 	}
@@ -192,11 +281,7 @@ func (v *Validator) validateRS256(keyID string, hashedContent []byte, sig []byte
 }
 
 func (v *Validator) validateES256(keyID string, hashedContent []byte, sig []byte) error {
-	certResp, err := v.getCert(CertURLPrefix + Issuer)
-	if err != nil {
-		return err
-	}
-	j, err := findMatchingKey(certResp, keyID)
+	j, err := v.findKey(keyID)
 	if err != nil {
 		return err
 	}
@@ -209,6 +294,10 @@ func (v *Validator) validateES256(keyID string, hashedContent []byte, sig []byte
 		return err
 	}
 
+	if len(sig) != 2*es256KeySize {
+		return fmt.Errorf("idtoken: ES256 signature not valid")
+	}
+
 	pk := &ecdsa.PublicKey{
 		Curve: elliptic.P256(),
 		X:     new(big.Int).SetBytes(dx),
@@ -222,6 +311,27 @@ func (v *Validator) validateES256(keyID string, hashedContent []byte, sig []byte
 	return nil
 }
 
+// findKey looks for the key in the cached certs. If it isn't there
+// google may have rotated keys, so the certs are fetched once more,
+// unless they were fetched within keyRefreshCooldown.
+func (v *Validator) findKey(keyID string) (*JWK, error) {
+	certResp, err := v.getCachedCert(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if j, err := findMatchingKey(certResp, keyID); err == nil {
+		return j, nil
+	}
+
+	certResp, err = v.getCachedCert(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return findMatchingKey(certResp, keyID)
+}
+
 func findMatchingKey(response *certResponse, keyID string) (*JWK, error) {
 	if response == nil {
 		return nil, fmt.Errorf("idtoken: cert response is nil")
@@ -234,29 +344,101 @@ func findMatchingKey(response *certResponse, keyID string) (*JWK, error) {
 	return nil, fmt.Errorf("idtoken: could not find matching cert keyId for the token provided")
 }
 
-func (v Validator) getCert(url string) (*certResponse, error) {
+// getCachedCert returns the cached certs while they're fresh, and
+// fetches them again once they've expired or a refresh is forced. A
+// forced refresh is skipped within keyRefreshCooldown of the last
+// fetch. The fetch is made without holding the lock, and requests
+// that come in meanwhile wait for it instead of starting their own.
+func (v *Validator) getCachedCert(refresh bool) (*certResponse, error) {
+	v.mu.Lock()
+
+	if v.keys != nil && v.now().Before(v.keysExpires) {
+		if !refresh || v.now().Before(v.keysFetched.Add(keyRefreshCooldown)) {
+			keys := v.keys
+			v.mu.Unlock()
+
+			return keys, nil
+		}
+	}
+
+	if fetch := v.fetch; fetch != nil {
+		v.mu.Unlock()
+		<-fetch.done
+
+		return fetch.keys, fetch.err
+	}
+
+	fetch := &certFetch{done: make(chan struct{})}
+	v.fetch = fetch
+	v.mu.Unlock()
+
+	var maxAge time.Duration
+	fetch.keys, maxAge, fetch.err = v.getCert(v.certURL)
+
+	if maxAge < minKeyCacheAge {
+		maxAge = minKeyCacheAge
+	}
+
+	v.mu.Lock()
+	if fetch.err == nil {
+		v.keys = fetch.keys
+		v.keysExpires = v.now().Add(maxAge)
+		v.keysFetched = v.now()
+	}
+	v.fetch = nil
+	v.mu.Unlock()
+
+	close(fetch.done)
+
+	return fetch.keys, fetch.err
+}
+
+func (v *Validator) getCert(url string) (*certResponse, time.Duration, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	resp, err := v.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("idtoken: unable to retrieve cert, got status code %d", resp.StatusCode)
+		return nil, 0, fmt.Errorf("idtoken: unable to retrieve cert, got status code %d", resp.StatusCode)
 	}
 
 	certResp := &certResponse{}
 	if err := json.NewDecoder(resp.Body).Decode(certResp); err != nil {
-		return nil, err
+		return nil, 0, err
 
 	}
 
-	return certResp, nil
+	return certResp, cacheMaxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// cacheMaxAge reads how long a response may be cached from its
+// Cache-Control header. Anything that can't be cached returns 0.
+func cacheMaxAge(cacheControl string) time.Duration {
+	var maxAge time.Duration
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			maxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return maxAge
 }
 
 func decode(s string) ([]byte, error) {
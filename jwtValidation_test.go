@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testAudience = "1234567890"
+
+type testKeyServer struct {
+	*httptest.Server
+	hits int
+}
+
+func newTestKeyServer(t *testing.T, key *rsa.PrivateKey, keyID, cacheControl string) *testKeyServer {
+	ks := new(testKeyServer)
+
+	ks.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.hits++
+
+		resp, err := json.Marshal(certResponse{Keys: []JWK{{
+			Alg: "RS256",
+			Kid: keyID,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write(resp)
+	}))
+
+	return ks
+}
+
+func newTestValidator(ks *testKeyServer) *Validator {
+	v := newValidator(ks.Client(), testAudience)
+	v.certURL = ks.URL
+
+	return v
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, keyID string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Error signing token: %q", err.Error())
+	}
+
+	return signed
+}
+
+func validTestClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": Issuer,
+		"aud": testAudience,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidateClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := newTestKeyServer(t, key, "key1", "public, max-age=3600")
+	defer ks.Close()
+
+	v := newTestValidator(ks)
+
+	testCases := []struct {
+		name    string
+		change  func(jwt.MapClaims)
+		wantErr bool
+	}{
+		{"Valid token", func(jwt.MapClaims) {}, false},
+		{"Wrong issuer", func(c jwt.MapClaims) { c["iss"] = "someone@else.com" }, true},
+		{"Wrong audience", func(c jwt.MapClaims) { c["aud"] = "0987654321" }, true},
+		{"Missing expiry", func(c jwt.MapClaims) { delete(c, "exp") }, true},
+		{"Expired token", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, true},
+		{"Expired within clock skew", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-clockSkew / 2).Unix() }, false},
+		{"Issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, true},
+		{"Issued within clock skew", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(clockSkew / 2).Unix() }, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := validTestClaims()
+			tc.change(claims)
+
+			err := v.Validate(signTestToken(t, key, "key1", claims))
+
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected token to be rejected")
+			}
+
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Expected token to be accepted, got: %q", err.Error())
+			}
+		})
+	}
+
+	t.Run("Rejects token signed by another key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := v.Validate(signTestToken(t, otherKey, "key1", validTestClaims())); err == nil {
+			t.Fatal("Expected token to be rejected")
+		}
+	})
+
+	t.Run("Rejects unknown key ID", func(t *testing.T) {
+		if err := v.Validate(signTestToken(t, key, "key2", validTestClaims())); err == nil {
+			t.Fatal("Expected token to be rejected")
+		}
+	})
+
+	t.Run("Rejects malformed token", func(t *testing.T) {
+		if err := v.Validate("not.a.token"); err == nil {
+			t.Fatal("Expected token to be rejected")
+		}
+	})
+
+	t.Run("Rejects when no audience is configured", func(t *testing.T) {
+		noAudience := newTestValidator(ks)
+		noAudience.audience = ""
+
+		if err := noAudience.Validate(signTestToken(t, key, "key1", validTestClaims())); err == nil {
+			t.Fatal("Expected token to be rejected")
+		}
+	})
+}
+
+func TestJWKCache(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signTestToken(t, key, "key1", validTestClaims())
+
+	t.Run("Keys are cached for max-age", func(t *testing.T) {
+		ks := newTestKeyServer(t, key, "key1", "public, max-age=3600")
+		defer ks.Close()
+
+		v := newTestValidator(ks)
+
+		v.Validate(token)
+		v.Validate(token)
+
+		if ks.hits != 1 {
+			t.Fatalf("Keys should be fetched once\nGot: %d", ks.hits)
+		}
+
+		//Jumping past the max-age
+		v.now = func() time.Time { return time.Now().Add(time.Hour * 2) }
+		v.getCachedCert(false)
+
+		if ks.hits != 2 {
+			t.Fatalf("Keys should be fetched again once expired\nGot: %d", ks.hits)
+		}
+	})
+
+	t.Run("Keys are kept for a while with no-cache", func(t *testing.T) {
+		ks := newTestKeyServer(t, key, "key1", "no-cache")
+		defer ks.Close()
+
+		v := newTestValidator(ks)
+
+		v.Validate(token)
+		v.Validate(token)
+
+		if ks.hits != 1 {
+			t.Fatalf("Keys should be kept for the minimum cache age\nGot: %d", ks.hits)
+		}
+
+		//Jumping past the minimum
+		v.now = func() time.Time { return time.Now().Add(minKeyCacheAge + time.Second) }
+		v.Validate(token)
+
+		if ks.hits != 2 {
+			t.Fatalf("Keys should be fetched again after the minimum cache age\nGot: %d", ks.hits)
+		}
+	})
+
+	t.Run("Requests waiting on the keys share one fetch", func(t *testing.T) {
+		ks := newTestKeyServer(t, key, "key1", "public, max-age=3600")
+		defer ks.Close()
+
+		release := make(chan struct{})
+		handler := ks.Config.Handler
+		ks.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			handler.ServeHTTP(w, r)
+		})
+
+		v := newTestValidator(ks)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- v.Validate(token)
+			}()
+		}
+
+		//Every request is waiting on the same fetch
+		for {
+			v.mu.Lock()
+			fetching := v.fetch != nil
+			v.mu.Unlock()
+
+			if fetching {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Token should be valid\nGot: %v", err)
+			}
+		}
+
+		if ks.hits != 1 {
+			t.Fatalf("Keys should be fetched once\nGot: %d", ks.hits)
+		}
+	})
+
+	t.Run("Unknown key ID refreshes the keys", func(t *testing.T) {
+		ks := newTestKeyServer(t, key, "key1", "public, max-age=3600")
+		defer ks.Close()
+
+		v := newTestValidator(ks)
+		rotated := signTestToken(t, key, "rotated", validTestClaims())
+
+		v.Validate(token)
+		v.Validate(rotated)
+
+		if ks.hits != 1 {
+			t.Fatalf("Keys should not be fetched again right after they were\nGot: %d", ks.hits)
+		}
+
+		//Jumping past the cooldown
+		v.now = func() time.Time { return time.Now().Add(keyRefreshCooldown + time.Second) }
+		v.Validate(rotated)
+		v.Validate(rotated)
+
+		if ks.hits != 2 {
+			t.Fatalf("Keys should be fetched again once for an unknown key\nGot: %d", ks.hits)
+		}
+	})
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Run("Verifying requests needs an audience", func(t *testing.T) {
+		if err := checkConfig(HGNConfig{VerifyRequest: "true"}); err == nil || !strings.Contains(err.Error(), "HGNOTIFY_AUDIENCE") {
+			t.Fatalf("Missing audience should fail\nGot: %v", err)
+		}
+
+		if err := checkConfig(HGNConfig{VerifyRequest: "true", Audience: testAudience}); err != nil {
+			t.Fatalf("Audience is set\nGot: %v", err)
+		}
+
+		if err := checkConfig(HGNConfig{}); err != nil {
+			t.Fatalf("Requests aren't verified\nGot: %v", err)
+		}
+	})
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"public, max-age=19868, must-revalidate, no-transform": time.Second * 19868,
+		"max-age=60":           time.Minute,
+		"no-store, max-age=60": 0,
+		"":                     0,
+		"max-age=nope":         0,
+	}
+
+	for header, wanted := range testCases {
+		if got := cacheMaxAge(header); got != wanted {
+			t.Errorf("Incorrect max age for %q\nWanted: %s\nGot: %s", header, wanted, got)
+		}
+	}
+}
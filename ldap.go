@@ -0,0 +1,495 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+//ldapTimeout is how long a connection to an LDAP server is given for each
+//request
+const ldapTimeout = 30 * time.Second
+
+//The LDAP operations the directory sync uses, along with the filters it can
+//search with
+const (
+	ldapBindRequest     ber.Tag = 0
+	ldapBindResponse    ber.Tag = 1
+	ldapUnbindRequest   ber.Tag = 2
+	ldapSearchRequest   ber.Tag = 3
+	ldapSearchEntry     ber.Tag = 4
+	ldapSearchDone      ber.Tag = 5
+	ldapSearchReference ber.Tag = 19
+	ldapExtendedRequest ber.Tag = 23
+	ldapExtendedReply   ber.Tag = 24
+
+	ldapFilterAnd        ber.Tag = 0
+	ldapFilterOr         ber.Tag = 1
+	ldapFilterNot        ber.Tag = 2
+	ldapFilterEquality   ber.Tag = 3
+	ldapFilterSubstrings ber.Tag = 4
+	ldapFilterPresent    ber.Tag = 7
+)
+
+//ldapStartTLSOID names the extended operation that encrypts the connection
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+//ldapEntry is an entry found by a search, with its attributes keyed by their
+//name in lowercase
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+//Get returns the first value of the attribute, or nothing if the entry
+//doesn't have it
+func (le ldapEntry) Get(attribute string) string {
+	if values := le.Attributes[strings.ToLower(attribute)]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+//ldapConn is a connection to an LDAP server. It only speaks as much LDAPv3
+//as the directory sync needs, StartTLS, a simple bind, and a subtree search.
+type ldapConn struct {
+	conn  net.Conn
+	msgID int64
+}
+
+//dialLDAP connects to the server at an ldap:// or ldaps:// url. With startTLS
+//an ldap:// connection is encrypted before anything else is sent. The server's
+//certificate is checked against rootCAs, or the system's when there are none.
+func dialLDAP(rawURL string, startTLS bool, rootCAs *x509.CertPool) (*ldapConn, error) {
+	serverURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := serverURL.Host
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	tlsConfig := &tls.Config{ServerName: serverURL.Hostname(), RootCAs: rootCAs}
+
+	var conn net.Conn
+
+	switch serverURL.Scheme {
+	case "ldap":
+		if serverURL.Port() == "" {
+			host = net.JoinHostPort(host, "389")
+		}
+
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if startTLS {
+			return nil, fmt.Errorf("startTLS is for ldap:// urls, %q is already encrypted", rawURL)
+		}
+
+		if serverURL.Port() == "" {
+			host = net.JoinHostPort(host, "636")
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("expected an ldap:// or ldaps:// url, got %q", rawURL)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	lc := &ldapConn{conn: conn}
+
+	if startTLS {
+		if err := lc.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("couldn't start TLS: %s", err.Error())
+		}
+	}
+
+	return lc, nil
+}
+
+//StartTLS asks the server to encrypt the connection, then does the TLS
+//handshake over it
+func (lc *ldapConn) StartTLS(config *tls.Config) error {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapExtendedRequest, nil, "Extended Request")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, ldapStartTLSOID, "Request Name"))
+
+	if err := lc.send(request); err != nil {
+		return err
+	}
+
+	response, err := lc.read()
+	if err != nil {
+		return err
+	}
+
+	if response.Tag != ldapExtendedReply {
+		return fmt.Errorf("expected an extended response, got operation %d", response.Tag)
+	}
+
+	if err := ldapResult(response); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(lc.conn, config)
+	tlsConn.SetDeadline(time.Now().Add(ldapTimeout))
+
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	lc.conn = tlsConn
+	return nil
+}
+
+//Close unbinds from the server and closes the connection
+func (lc *ldapConn) Close() error {
+	lc.send(ber.Encode(ber.ClassApplication, ber.TypePrimitive, ldapUnbindRequest, nil, "Unbind Request"))
+	return lc.conn.Close()
+}
+
+//Bind signs in to the server. Without a DN the connection stays anonymous.
+func (lc *ldapConn) Bind(dn, password string) error {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Name"))
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, password, "Password"))
+
+	if err := lc.send(request); err != nil {
+		return err
+	}
+
+	response, err := lc.read()
+	if err != nil {
+		return err
+	}
+
+	if response.Tag != ldapBindResponse {
+		return fmt.Errorf("expected a bind response, got operation %d", response.Tag)
+	}
+
+	return ldapResult(response)
+}
+
+//Search finds the entries under the base DN matching the filter, with only
+//the attributes asked for
+func (lc *ldapConn) Search(baseDN, filter string, attributes []string) ([]ldapEntry, error) {
+	filterPacket, err := compileFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %s", filter, err.Error())
+	}
+
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchRequest, nil, "Search Request")
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, baseDN, "Base DN"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 2, "Scope"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 0, "Deref Aliases"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Size Limit"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Time Limit"))
+	request.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Types Only"))
+	request.AppendChild(filterPacket)
+
+	attributeList := ber.NewSequence("Attributes")
+	for _, attribute := range attributes {
+		attributeList.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+	}
+	request.AppendChild(attributeList)
+
+	if err := lc.send(request); err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+
+	for {
+		response, err := lc.read()
+		if err != nil {
+			return nil, err
+		}
+
+		switch response.Tag {
+		case ldapSearchEntry:
+			entry, err := readLDAPEntry(response)
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, entry)
+		case ldapSearchReference:
+			//Referrals to other servers aren't followed
+		case ldapSearchDone:
+			return entries, ldapResult(response)
+		default:
+			return nil, fmt.Errorf("expected search results, got operation %d", response.Tag)
+		}
+	}
+}
+
+//send wraps the operation in a message with the next message ID, and sends it
+func (lc *ldapConn) send(op *ber.Packet) error {
+	lc.msgID++
+
+	envelope := ber.NewSequence("LDAP Message")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, lc.msgID, "Message ID"))
+	envelope.AppendChild(op)
+
+	lc.conn.SetDeadline(time.Now().Add(ldapTimeout))
+	_, err := lc.conn.Write(envelope.Bytes())
+
+	return err
+}
+
+//read reads the next response to the last message sent, returning its
+//operation
+func (lc *ldapConn) read() (*ber.Packet, error) {
+	lc.conn.SetDeadline(time.Now().Add(ldapTimeout))
+
+	envelope, err := ber.ReadPacket(lc.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope.Children) < 2 {
+		return nil, errors.New("malformed response from the server")
+	}
+
+	if id, _ := envelope.Children[0].Value.(int64); id != lc.msgID {
+		return nil, fmt.Errorf("expected a response to message %d, got %d", lc.msgID, id)
+	}
+
+	return envelope.Children[1], nil
+}
+
+//ldapResult turns the result of an operation into an error, unless it
+//succeeded
+func ldapResult(response *ber.Packet) error {
+	if len(response.Children) < 3 {
+		return errors.New("malformed result from the server")
+	}
+
+	code, _ := response.Children[0].Value.(int64)
+	if code == 0 {
+		return nil
+	}
+
+	message, _ := response.Children[2].Value.(string)
+	if message == "" {
+		message = "no message given"
+	}
+
+	return fmt.Errorf("the server returned result %d: %s", code, message)
+}
+
+//readLDAPEntry reads the DN and attributes of an entry found by a search
+func readLDAPEntry(response *ber.Packet) (ldapEntry, error) {
+	if len(response.Children) < 2 {
+		return ldapEntry{}, errors.New("malformed search entry from the server")
+	}
+
+	dn, _ := response.Children[0].Value.(string)
+	entry := ldapEntry{DN: dn, Attributes: make(map[string][]string)}
+
+	for _, attribute := range response.Children[1].Children {
+		if len(attribute.Children) < 2 {
+			return ldapEntry{}, fmt.Errorf("malformed attribute in %q", dn)
+		}
+
+		name, _ := attribute.Children[0].Value.(string)
+		name = strings.ToLower(name)
+
+		for _, value := range attribute.Children[1].Children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.Data.String())
+		}
+	}
+
+	return entry, nil
+}
+
+//compileFilter turns a search filter such as (&(objectClass=person)(mail=*))
+//into the form sent to the server. It supports and, or, not, presence,
+//equality, and substring filters. Ordering, approximate, and extensible
+//matches are rejected rather than sent as something they aren't.
+func compileFilter(filter string) (*ber.Packet, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+
+	packet, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q after the filter", rest)
+	}
+
+	return packet, nil
+}
+
+//parseFilter reads the filter in parentheses at the start of the text,
+//returning it along with the text left after it
+func parseFilter(text string) (*ber.Packet, string, error) {
+	if !strings.HasPrefix(text, "(") || len(text) < 2 {
+		return nil, "", fmt.Errorf("expected a filter in parentheses at %q", text)
+	}
+
+	text = text[1:]
+
+	switch text[0] {
+	case '&', '|':
+		tag := ldapFilterAnd
+		if text[0] == '|' {
+			tag = ldapFilterOr
+		}
+
+		packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, "Filter")
+		text = text[1:]
+
+		for strings.HasPrefix(text, "(") {
+			child, rest, err := parseFilter(text)
+			if err != nil {
+				return nil, "", err
+			}
+
+			packet.AppendChild(child)
+			text = rest
+		}
+
+		rest, err := closeFilter(text)
+		return packet, rest, err
+	case '!':
+		child, rest, err := parseFilter(text[1:])
+		if err != nil {
+			return nil, "", err
+		}
+
+		packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldapFilterNot, nil, "Not")
+		packet.AppendChild(child)
+
+		rest, err = closeFilter(rest)
+		return packet, rest, err
+	}
+
+	end := strings.IndexByte(text, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("unclosed filter %q", text)
+	}
+
+	item, rest := text[:end], text[end+1:]
+
+	equals := strings.IndexByte(item, '=')
+	if equals <= 0 {
+		return nil, "", fmt.Errorf("expected attribute=value, got %q", item)
+	}
+
+	attribute, value := item[:equals], item[equals+1:]
+
+	switch {
+	case strings.ContainsAny(attribute[len(attribute)-1:], "<>~"):
+		return nil, "", fmt.Errorf("%s= matches aren't supported, in %q", attribute[len(attribute)-1:], item)
+	case strings.Contains(attribute, ":"):
+		return nil, "", fmt.Errorf("extensible matches aren't supported, in %q", item)
+	}
+
+	if value == "*" {
+		return ber.NewString(ber.ClassContext, ber.TypePrimitive, ldapFilterPresent, attribute, "Present"), rest, nil
+	}
+
+	if !strings.Contains(value, "*") {
+		value, err := unescapeFilterValue(value)
+		if err != nil {
+			return nil, "", err
+		}
+
+		packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldapFilterEquality, nil, "Equality Match")
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+
+		return packet, rest, nil
+	}
+
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldapFilterSubstrings, nil, "Substrings")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+
+	parts := strings.Split(value, "*")
+	substrings := ber.NewSequence("Substrings")
+
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		part, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, "", err
+		}
+
+		//Substrings are the initial one, any in the middle, or the final one
+		tag := ber.Tag(1)
+		switch i {
+		case 0:
+			tag = 0
+		case len(parts) - 1:
+			tag = 2
+		}
+
+		substrings.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, tag, part, "Substring"))
+	}
+
+	packet.AppendChild(substrings)
+	return packet, rest, nil
+}
+
+//closeFilter expects the closing parenthesis of a filter, returning the text
+//after it
+func closeFilter(text string) (string, error) {
+	if !strings.HasPrefix(text, ")") {
+		return "", fmt.Errorf("expected ) at %q", text)
+	}
+
+	return text[1:], nil
+}
+
+//unescapeFilterValue decodes the \XX hex escapes in a filter value
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, `\`) {
+		return value, nil
+	}
+
+	var unescaped []byte
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			unescaped = append(unescaped, value[i])
+			continue
+		}
+
+		if i+3 > len(value) {
+			return "", fmt.Errorf("incomplete escape in %q", value)
+		}
+
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+
+		unescaped = append(unescaped, decoded...)
+		i += 2
+	}
+
+	return string(unescaped), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+//Lookups are what a command reads from outside the bot, such as the company
+//directory, a room's members, or the users the emails belong to. They're read
+//before stateLock is taken, so a slow service doesn't hold up every other
+//request, and kept on the message so a confirmed command is run with what was
+//shown when it was asked.
+type Lookups struct {
+	Directory *directoryLookup
+	Room      *roomLookup
+	Emails    *emailLookup
+}
+
+//directoryLookup is what was read from the directory for the dirsync command
+type directoryLookup struct {
+	Results []directoryResult
+	Err     error
+}
+
+//roomLookup is the room's members, read for create --from-room
+type roomLookup struct {
+	Members []User
+	Err     error
+}
+
+//lookup runs the command's Lookup, if it has one, without holding stateLock
+func (c *Command) lookup(msgObj *messageResponse, args Arguments) {
+	cmd := c.picked(args)
+	if cmd == nil || cmd.Lookup == nil {
+		return
+	}
+
+	if msgObj.lookups == nil {
+		msgObj.lookups = new(Lookups)
+	}
+
+	cmd.Lookup(msgObj, args)
+}
+
+//lookupDirectory reads the sources of the group, or every group, for dirsync
+func lookupDirectory(msgObj *messageResponse, args Arguments) {
+	results, err := Directory.Fetch(args["groupName"])
+	msgObj.lookups.Directory = &directoryLookup{Results: results, Err: err}
+}
+
+//directoryResults returns what was read from the directory before stateLock
+//was taken, reading it now for callers that didn't look it up first
+func (mr messageResponse) directoryResults(groupName string) ([]directoryResult, error) {
+	if mr.lookups != nil && mr.lookups.Directory != nil {
+		return mr.lookups.Directory.Results, mr.lookups.Directory.Err
+	}
+
+	return Directory.Fetch(groupName)
+}
+
+//lookupCreate reads the room's members when the group is made from the room,
+//and otherwise resolves the emails the members are given by
+func lookupCreate(msgObj *messageResponse, args Arguments) {
+	if args["fromRoom"] == "" {
+		lookupMembers(msgObj, args)
+		return
+	}
+
+	if msgObj.Room.Type != "DM" {
+		members, err := Rooms.Members(msgObj.Room.GID)
+		msgObj.lookups.Room = &roomLookup{Members: members, Err: err}
+	}
+}
+
+//lookupMembers resolves the emails the members are given by
+func lookupMembers(msgObj *messageResponse, _ Arguments) {
+	msgObj.lookups.Emails = lookupEmails(msgObj.Message.Text)
+}
+
+//roomMembers returns the room's members read before stateLock was taken,
+//reading them now for callers that didn't look them up first
+func (mr messageResponse) roomMembers() ([]User, error) {
+	if mr.lookups != nil && mr.lookups.Room != nil {
+		return mr.lookups.Room.Members, mr.lookups.Room.Err
+	}
+
+	return Rooms.Members(mr.Room.GID)
+}
+
+//emailLookup returns the emails resolved before stateLock was taken,
+//resolving them now for callers that didn't look them up first
+func (mr messageResponse) emailLookup() *emailLookup {
+	if mr.lookups != nil && mr.lookups.Emails != nil {
+		return mr.lookups.Emails
+	}
+
+	return lookupEmails(mr.Message.Text)
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"sync"
 )
 
 //Initializing global variables
@@ -10,6 +13,28 @@ var (
 	Config = initConfig()
 
 	Logger = startDBLogger(initDBConfig())
+
+	Users = newUserDirectory()
+
+	Roles = newRoleDirectory()
+
+	Limiter = newRateLimiter(Config)
+
+	Confirmations = newConfirmationStore()
+
+	//Messages are only logged and rooms can't be listed until main sets up
+	//the Chat API.
+	Messages Messenger = skipMessenger{}
+
+	Rooms Roster = skipRoster{}
+
+	Webhooks = newWebhookDispatcher(loadWebhooks(Config.Webhooks))
+
+	Manifest = newManifestSync(Config)
+
+	Directory = loadDirectorySync(Config.DirectorySync)
+
+	Emails = newEmailResolver(Directory)
 )
 
 //Setting up general configurations for usage of the bot
@@ -20,10 +45,26 @@ var (
 	BotName  = Config.BotName
 	MasterID = Config.MasterID
 
+	//Replies are laid out as cards unless they're turned off, in which case
+	//only the text is sent.
+	UseCards = Config.UseCards != "false"
+
+	//The slash commands set up in Google's console, by ID or name, and the
+	//commands they run.
+	SlashCommands = parseSlashCommands(Config.SlashCommands)
+
+	//Setting a replica ID turns on the lease and change feed, so
+	//more than one copy of the bot can share the same database.
+	ReplicaID = Config.ReplicaID
+
 	baseRoute = "/"
 	port      = ":8888"
 )
 
+//stateLock guards the in-memory groups, since they can be changed by both
+//incoming requests and the background reconciler.
+var stateLock sync.Mutex
+
 //Arguments is generic type for passing arguments as a map
 //between functions. I feel this is kinda an artifact of
 //learing perl as my first language, but it sure does make
@@ -35,14 +76,73 @@ func main() {
 	Schedules := make(ScheduleMap)
 
 	Logger.SetupTables()
+	Logger.GetUsersFromDB(Users)
+	Logger.GetRolesFromDB(Roles)
+	Logger.GetRateCountersFromDB(Limiter)
 	Logger.GetGroupsFromDB(Groups)
+
+	//Exporting and importing groups can be done from the command line, in
+	//place of running the bot.
+	if len(os.Args) > 1 {
+		//The replicas skip the changes they recorded themselves, so the
+		//command line records its changes under a name of its own.
+		if ReplicaID != "" {
+			ReplicaID += "-cli"
+		}
+
+		code := runCLI(os.Args[1:], Groups, os.Stdin, os.Stdout, os.Stderr)
+		Webhooks.Wait()
+		os.Exit(code)
+	}
+
+	if err := checkConfig(Config); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := setupChat(Config); err != nil {
+		log.Fatal(err)
+	}
+
+	//The elector is set up before the schedules are loaded, so no timers are
+	//started until this replica has won the lease.
+	if ReplicaID != "" {
+		SchedulerLease = newLeaderElector(schedulerLeaseName, ReplicaID)
+		SchedulerLease.OnElected = func() {
+			stateLock.Lock()
+			Schedules.StartTimers()
+			stateLock.Unlock()
+		}
+		SchedulerLease.OnDemoted = func() {
+			stateLock.Lock()
+			Schedules.StopTimers()
+			stateLock.Unlock()
+		}
+	}
+
 	Logger.GetSchedulesFromDB(Schedules)
 
+	if SchedulerLease != nil {
+		SchedulerLease.Start()
+		newChangeFeed(ReplicaID, Groups, Schedules).Start()
+	}
+
+	Manifest.Start(Groups)
+	Directory.Start(Groups)
+	newRoomSync(Config).Start(Groups)
+
+	reconciler := newReconciler(Groups, Config)
+	reconciler.Start()
+
 	fmt.Println("Running!! on port " + port)
 
 	http.HandleFunc(baseRoute, getRequestHandler(Groups, Schedules))
 	http.HandleFunc(baseRoute+"readiness/", ReadinessCheck())
 
+	apiClients := loadAPIClients(Config.APIClients)
+	http.HandleFunc(baseRoute+"reconciler/", ReconcilerStatus(reconciler, apiClients))
+	http.HandleFunc(baseRoute+"api/v1/notify", NotifyAPI(Groups, apiClients))
+	http.HandleFunc(baseRoute+"api/v1/", AdminAPI(Groups, Schedules, apiClients))
+
 	var err error
 
 	if Config.UseSSL == "true" {
@@ -54,63 +154,16 @@ func main() {
 	checkError(err)
 }
 
+//usage returns the help text generated from the command registry. Passing a
+//command's name returns just its usage, and subcommands are passed as
+//command:subcommand, i.e. schedule:onetime.
 func usage(option string) string {
-	options := make(map[string]string)
-
-	options["create"] = `
-create groupName [mentions]
-    Create a group containing mentioned members. While I'm not sure why you would, you can initialize an empty group. Add "self" to the list of mentions to add yourself.`
-
-	options["disband"] = `
-disband groupName
-    Delete a group. CAUTION: This can be done to a group containing members. I'd recommend only using delete when necessary.`
-
-	options["add"] = `
-add groupName mentions
-    Add mentioned members to the specified GroupName. This can only be used for groups that already exist. If you intend to create a new group use create. Add "self" to the list of mentions to add yourself.`
-
-	options["remove"] = `
-remove groupName mentions
-    Remove mentioned members from the specified GroupName. Add "self" to the list of mentions to remove yourself.`
-
-	options["restrict"] = `
-restrict groupName
-    Toggles group privacy, this disallows any interaction with the group outside the room it was restricted in. (Default: Public)`
-
-	options["usage"] = `
-help|usage
-    Reprint's this message`
-
-	options["list"] = `
-list [groupName]
-  If used with no groupName, you will receive a list of all groups you can currently use. This will not show any private group that you do not have access to. If used with a groupName, you will see more information about the group specified.`
-
-	options["notify"] = `
-groupName
-  Replaces groupName with mentions for the group members along with the following/surrounding/leading message.`
-
-	options["schedule:onetime"] = `
-schedule onetime <label> <time RFC3339> <groupName> <Message>
-  Schedules a message to be sent to the specified group at the given time. If you'd like to edit the created message, just reuse the label and that will update the message. The timestamp passed would need to be written in RFC3339 format, ex: 2020-08-25T22:57:00-05:00 (YYYY-MM-DDTHH:MM:SS-TZ).`
-
-	options["schedule:recurring"] = `
-schedule recurring <label> <time RFC3339> <groupName> <Message>
-  Schedules a message to be sent to the specified group at the given time on a weekly cycle. More specifically, the message will repeat on a 7 day cycle until it's removed. If you'd like to edit the created message, just reuse the label and that will update the message. The timestamp passed would need to be written in RFC3339 format, ex: 2020-08-25T22:57:00-05:00 (YYYY-MM-DDTHH:MM:SS-TZ).`
-
-	options["schedule:remove"] = `
-schedule remove <label>
-	Removes the given label and stops the schedule from executing.`
-
-	options["schedule:list"] = `
-schedule list
-  Lists information about the scheduled events for the room`
-
 	usageShort := "`@HGNotify [options] [GroupName] [mentions...]`"
 
 	if option == "usageShort" {
 		return usageShort
 	} else if option != "" {
-		return options[option]
+		return Commands.Usage(option)
 	}
 
 	summary := "I was created to @ groups of people by using user created groups, since gchat doesn't seem to already have this functionality."
@@ -144,20 +197,7 @@ Delete a group: "@HGNotify disband Umbrella"`
 		summary,
 		limitation,
 		examples,
-		fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n",
-			options["create"],
-			options["add"],
-			options["remove"],
-			options["disband"],
-			options["restrict"],
-			options["list"],
-			options["notify"],
-			options["schedule:onetime"],
-			options["schedule:recurring"],
-			options["schedule:remove"],
-			options["schedule:list"],
-			options["usage"],
-		),
+		Commands.Help(),
 		notes,
 	)
 }
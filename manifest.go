@@ -0,0 +1,372 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//manifestPolicy is the import policy the manifest is applied with. It makes
+//the groups match the manifest the same as ImportReplace, but doesn't skip
+//the groups the manifest manages.
+const manifestPolicy = "manifest"
+
+//manifestDetail is noted on the audit entries of the changes the manifest
+//makes
+const manifestDetail = "from the groups manifest"
+
+//defaultManifestInterval is how often the manifest is checked for changes
+//when no interval is configured
+const defaultManifestInterval = 30 * time.Second
+
+//manifestMsgObj is who the changes made by the manifest are made by
+var manifestMsgObj = messageResponse{
+	Message:    message{Sender: User{Name: "groups manifest", GID: "manifest", Type: "BOT"}},
+	FromMaster: true,
+}
+
+//ManifestGroup is a group as it's listed in the groups manifest. Owners are
+//the people to ask about changing it, since it can't be changed from chat.
+type ManifestGroup struct {
+	ExportedGroup `yaml:",inline"`
+	Owners        []string `yaml:"owners"`
+}
+
+//GroupManifest is the groups manifest, laid out the same as an export along
+//with the owners of each group.
+type GroupManifest struct {
+	Groups []ManifestGroup `yaml:"groups"`
+}
+
+//ManifestPlan is what applying the manifest would change. Released are the
+//groups that were taken out of the manifest, which are left as they are but
+//can be changed from chat again.
+type ManifestPlan struct {
+	ImportPlan
+	Released []string
+}
+
+//HasChanges tells if applying the manifest would change anything
+func (mp ManifestPlan) HasChanges() bool {
+	return mp.ImportPlan.HasChanges() || len(mp.Released) > 0
+}
+
+//String lists the changes to each group, followed by the groups released
+func (mp ManifestPlan) String() string {
+	lines := []string{mp.ImportPlan.String()}
+	if lines[0] == "" {
+		lines = nil
+	}
+
+	for _, name := range mp.Released {
+		lines = append(lines, name+": released, it's no longer in the manifest")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+//ManifestSync keeps the groups listed in the manifest at Path matching it.
+//The groups it manages are read-only in chat. The file is checked for changes
+//every Interval, and can be reloaded by the bot's admin at any time.
+type ManifestSync struct {
+	Path     string
+	Interval time.Duration
+
+	mu        sync.RWMutex
+	managed   map[string][]string
+	modTime   time.Time
+	unapplied bool
+}
+
+//newManifestSync sets up the manifest from the bot's configuration. Without a
+//path there's no manifest, and an interval of 0 only reloads it on request.
+func newManifestSync(conf HGNConfig) *ManifestSync {
+	ms := &ManifestSync{
+		Path:     conf.GroupsManifest,
+		Interval: defaultManifestInterval,
+		managed:  make(map[string][]string),
+	}
+
+	if conf.ManifestInterval != "" {
+		interval, err := time.ParseDuration(conf.ManifestInterval)
+		if err != nil {
+			log.Printf("Invalid manifest interval %q, the manifest is only reloaded on request: %s", conf.ManifestInterval, err)
+			interval = 0
+		}
+
+		ms.Interval = interval
+	}
+
+	return ms
+}
+
+//Manages tells if the group is managed by the manifest
+func (ms *ManifestSync) Manages(groupName string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	_, managed := ms.managed[strings.ToLower(groupName)]
+	return managed
+}
+
+//Owners returns the GIDs of the people who own the managed group
+func (ms *ManifestSync) Owners(groupName string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.managed[strings.ToLower(groupName)]
+}
+
+//Start applies the manifest, then checks it for changes in the background on
+//every interval. It does nothing if there's no manifest.
+func (ms *ManifestSync) Start(Groups GroupMap) {
+	if ms.Path == "" {
+		return
+	}
+
+	ms.check(Groups)
+
+	if ms.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(ms.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ms.check(Groups)
+		}
+	}()
+}
+
+//check applies the manifest if the file has changed since it was last applied.
+//A replica that doesn't own the scheduler only tracks which groups it manages,
+//and applies it once it takes over.
+func (ms *ManifestSync) check(Groups GroupMap) {
+	info, err := os.Stat(ms.Path)
+	if err != nil {
+		log.Printf("Error checking the groups manifest: %s", err.Error())
+		return
+	}
+
+	ms.mu.RLock()
+	changed := info.ModTime().After(ms.modTime)
+	unapplied := ms.unapplied
+	ms.mu.RUnlock()
+
+	if !changed && !unapplied {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if !ownsScheduler() {
+		if !changed {
+			return
+		}
+
+		manifest, modTime, err := ms.load()
+		if err != nil {
+			log.Printf("Error loading the groups manifest: %s", err.Error())
+			return
+		}
+
+		ms.track(manifest, modTime, false)
+		return
+	}
+
+	plan, err := ms.Reload(Groups, manifestMsgObj)
+	if err != nil {
+		log.Printf("Error loading the groups manifest, the groups are left as they are: %s", err.Error())
+		return
+	}
+
+	if plan.HasChanges() {
+		log.Printf("Groups manifest applied with these changes:\n%s", plan)
+	}
+}
+
+//Plan reads the manifest and works out what applying it would change
+func (ms *ManifestSync) Plan(Groups GroupMgr) (ManifestPlan, error) {
+	manifest, _, err := ms.load()
+	if err != nil {
+		return ManifestPlan{}, err
+	}
+
+	return ms.plan(Groups, manifest), nil
+}
+
+//Reload reads the manifest and makes the groups it lists match it. Nothing is
+//changed if the manifest can't be read.
+func (ms *ManifestSync) Reload(Groups GroupMap, msgObj messageResponse) (ManifestPlan, error) {
+	manifest, modTime, err := ms.load()
+	if err != nil {
+		return ManifestPlan{}, err
+	}
+
+	plan := ms.plan(Groups, manifest)
+	Groups.applyImport(plan.ImportPlan, manifestDetail, msgObj)
+	ms.track(manifest, modTime, true)
+
+	return plan, nil
+}
+
+//load reads and checks the manifest, along with when the file was changed
+func (ms *ManifestSync) load() (GroupManifest, time.Time, error) {
+	var manifest GroupManifest
+
+	if ms.Path == "" {
+		return manifest, time.Time{}, errors.New("there's no groups manifest set up")
+	}
+
+	info, err := os.Stat(ms.Path)
+	if err != nil {
+		return manifest, time.Time{}, err
+	}
+
+	data, err := ioutil.ReadFile(ms.Path)
+	if err != nil {
+		return manifest, time.Time{}, err
+	}
+
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return manifest, time.Time{}, err
+	}
+
+	seen := checkSeen()
+	for i := range manifest.Groups {
+		group := &manifest.Groups[i]
+
+		if err := group.validate(); err != nil {
+			return manifest, time.Time{}, err
+		}
+
+		if seen(strings.ToLower(group.Name)) {
+			return manifest, time.Time{}, fmt.Errorf("the group %q is listed more than once", group.Name)
+		}
+
+		for _, owner := range group.Owners {
+			if !strings.HasPrefix(owner, "users/") {
+				return manifest, time.Time{}, fmt.Errorf("%q isn't a valid owner id for %q", owner, group.Name)
+			}
+		}
+	}
+
+	return manifest, info.ModTime(), nil
+}
+
+//plan works out what applying the manifest would change
+func (ms *ManifestSync) plan(Groups GroupMgr, manifest GroupManifest) ManifestPlan {
+	var doc GroupExport
+	listed := make(map[string]bool)
+
+	for _, group := range manifest.Groups {
+		doc.Groups = append(doc.Groups, group.ExportedGroup)
+		listed[strings.ToLower(group.Name)] = true
+	}
+
+	plan := ManifestPlan{ImportPlan: planImport(Groups, doc, manifestPolicy)}
+
+	ms.mu.RLock()
+	for saveName := range ms.managed {
+		if !listed[saveName] {
+			name := saveName
+			if group := Groups.GetGroup(saveName); group != nil {
+				name = group.Name
+			}
+
+			plan.Released = append(plan.Released, name)
+		}
+	}
+	ms.mu.RUnlock()
+
+	sort.Strings(plan.Released)
+	return plan
+}
+
+//track marks the groups in the manifest as managed, releasing the rest, and
+//notes which version of the file they're from and whether it was applied.
+func (ms *ManifestSync) track(manifest GroupManifest, modTime time.Time, applied bool) {
+	managed := make(map[string][]string)
+	for _, group := range manifest.Groups {
+		managed[strings.ToLower(group.Name)] = group.Owners
+	}
+
+	ms.mu.Lock()
+	ms.managed = managed
+	ms.modTime = modTime
+	ms.unapplied = !applied
+	ms.mu.Unlock()
+}
+
+//ReloadManifest method reloads the groups manifest for the bot's admin,
+//replying with what was changed. Passing a dryRun only shows what would
+//change.
+func (gm GroupMap) ReloadManifest(dryRun string, msgObj messageResponse) string {
+	var (
+		plan ManifestPlan
+		err  error
+	)
+
+	if dryRun != "" {
+		plan, err = Manifest.Plan(gm)
+	} else {
+		plan, err = Manifest.Reload(gm, msgObj)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("I couldn't load the groups manifest, so nothing was changed: %s", err.Error())
+	}
+
+	if !plan.HasChanges() {
+		return "The groups already match the manifest."
+	}
+
+	if dryRun != "" {
+		return fmt.Sprintf("Dry run, nothing was changed. Reloading the manifest would make these changes: ```%s```", plan)
+	}
+
+	return fmt.Sprintf("Reloaded the groups manifest with these changes: ```%s```", plan)
+}
+
+//confirmReload asks before reloading the manifest, showing what it would
+//change
+func confirmReload(Groups GroupMgr, _ ScheduleMgr, _ messageResponse, args Arguments) string {
+	if args["dryRun"] != "" {
+		return ""
+	}
+
+	plan, err := Manifest.Plan(Groups)
+	if err != nil || !plan.HasChanges() {
+		return ""
+	}
+
+	return fmt.Sprintf("Apply these changes from the groups manifest? ```%s```", plan)
+}
+
+//managedReply tells the sender the group can only be changed in the manifest,
+//and who to ask about changing it
+func managedReply(groupName string) string {
+	text := fmt.Sprintf("The group %q is managed by the groups manifest, and can only be changed there.", groupName)
+
+	var owners []string
+	for _, owner := range Manifest.Owners(groupName) {
+		owners = append(owners, Users.Name(owner, owner))
+	}
+
+	if len(owners) > 0 {
+		text += fmt.Sprintf(" Ask %s about changing it.", strings.Join(owners, ", "))
+	}
+
+	return text
+}
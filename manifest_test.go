@@ -0,0 +1,185 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//writeManifest writes the manifest's contents, moving its modified time on so
+//the change is noticed
+func writeManifest(t *testing.T, path, contents string, modTime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Chtimes(path, modTime, modTime)
+}
+
+func TestManifestSync(t *testing.T) {
+	Logger.Active(false)
+
+	file, err := ioutil.TempFile("", "manifest*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	manifest := Manifest
+	defer func() { Manifest = manifest }()
+	Manifest = newManifestSync(HGNConfig{GroupsManifest: file.Name(), ManifestInterval: "0"})
+
+	roomGID := genRoomGID(10)
+	msgObj := messageResponse{Room: space{GID: roomGID}, Message: message{Sender: User{Name: "Someone", GID: genUserGID(0)}}}
+
+	Groups := GroupMap{
+		"oncall":    &Group{Name: "OnCall", Members: []Member{{GID: "users/1"}}},
+		"unmanaged": &Group{Name: "unmanaged"},
+	}
+
+	modTime := time.Now().Add(-time.Hour)
+	writeManifest(t, file.Name(), `groups:
+  - groupName: oncall
+    owners: [users/9]
+    members:
+      - gchatID: users/2
+  - groupName: backend
+    private: true
+    room: `+roomGID+`
+    members:
+      - gchatID: users/3
+`, modTime)
+
+	t.Run("Plans without changing anything", func(t *testing.T) {
+		gotText := Groups.ReloadManifest("dryRun", messageResponse{FromMaster: true})
+
+		for _, want := range []string{"Dry run", "backend (new):\n  + users/3\n  privacy: private to " + roomGID, "OnCall:\n  + users/2\n  - users/1"} {
+			if !strings.Contains(gotText, want) {
+				t.Fatalf("%q not in plan\nGot: %q", want, gotText)
+			}
+		}
+
+		if Groups.IsGroup("backend") || Manifest.Manages("oncall") {
+			t.Fatal("Dry run should not change anything")
+		}
+	})
+
+	t.Run("Makes the groups match the manifest", func(t *testing.T) {
+		Manifest.check(Groups)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/2" {
+			t.Fatalf("Group not replaced\nGot: %q", got)
+		}
+
+		if backend := Groups["backend"]; backend == nil || !backend.IsPrivate || backend.PrivacyRoomID != roomGID {
+			t.Fatalf("Group not created\nGot: %+v", backend)
+		}
+
+		if !Manifest.Manages("OnCall") || !Manifest.Manages("backend") || Manifest.Manages("unmanaged") {
+			t.Fatal("Managed groups not tracked")
+		}
+
+		if gotText := Groups.ReloadManifest("", messageResponse{FromMaster: true}); gotText != "The groups already match the manifest." {
+			t.Fatalf("Reload should change nothing\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Managed groups are read-only", func(t *testing.T) {
+		msgObj.Message.Mentions = []annotation{{Type: "USER_MENTION", Called: userMention{User{GID: "users/4", Type: "HUMAN"}}}}
+
+		gotText := Groups.AddMembers("oncall", "", msgObj)
+		if !strings.Contains(gotText, "managed by the groups manifest") || !strings.Contains(gotText, "users/9") {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+
+		for _, gotText := range []string{Groups.RemoveMembers("oncall", "", msgObj), Groups.Restrict("oncall", msgObj), Groups.Disband("oncall", msgObj)} {
+			if !strings.Contains(gotText, "managed by the groups manifest") {
+				t.Fatalf("Incorrect reply\nGot: %q", gotText)
+			}
+		}
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/2" || !Groups.IsGroup("oncall") {
+			t.Fatalf("Managed group should not change\nGot: %q", got)
+		}
+
+		if gotText := Groups.AddMembers("unmanaged", "", msgObj); strings.Contains(gotText, "managed by") {
+			t.Fatalf("Unmanaged group should change\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Imports leave managed groups alone", func(t *testing.T) {
+		gotText := Groups.Import("groups:\n  - groupName: oncall\n    members:\n      - gchatID: users/5\n", ImportReplace, "", messageResponse{FromMaster: true})
+
+		if !strings.Contains(gotText, "OnCall: skipped, it's managed by the groups manifest") || memberGIDs(Groups["oncall"].Members) != "users/2" {
+			t.Fatalf("Managed group should be skipped\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("The admin API can't change managed groups", func(t *testing.T) {
+		clients := &APIClients{clients: []APIClient{{Name: "ops", TokenHash: hashToken("admin-token"), Admin: true}}}
+
+		server := httptest.NewServer(AdminAPI(Groups, make(ScheduleMap), clients))
+		defer server.Close()
+
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/v1/groups/oncall", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusConflict || !Groups.IsGroup("oncall") {
+			t.Fatalf("Incorrect status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Groups taken out of the manifest are released", func(t *testing.T) {
+		writeManifest(t, file.Name(), "groups:\n  - groupName: backend\n    private: true\n    room: "+roomGID+"\n    members:\n      - gchatID: users/3\n", modTime.Add(time.Minute))
+
+		gotText := Groups.ReloadManifest("", messageResponse{FromMaster: true})
+		if !strings.Contains(gotText, "OnCall: released") || Manifest.Manages("oncall") || !Groups.IsGroup("oncall") {
+			t.Fatalf("Group not released\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Invalid manifests don't change anything", func(t *testing.T) {
+		writeManifest(t, file.Name(), "groups:\n  - groupName: backend\n    owners: [someone]\n", modTime.Add(time.Minute*2))
+
+		gotText := Groups.ReloadManifest("", messageResponse{FromMaster: true})
+		if !strings.Contains(gotText, "nothing was changed") || !Manifest.Manages("backend") || len(Groups["backend"].Members) != 1 {
+			t.Fatalf("Invalid manifest should be rejected\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Followers track the manifest and apply it once they take over", func(t *testing.T) {
+		defer func() { SchedulerLease = nil }()
+		SchedulerLease = newLeaderElector("scheduler", "follower")
+
+		followedAt := modTime.Add(time.Minute * 3)
+		writeManifest(t, file.Name(), "groups:\n  - groupName: oncall\n    members:\n      - gchatID: users/5\n", followedAt)
+
+		Manifest.check(Groups)
+
+		if !Manifest.Manages("oncall") || Manifest.Manages("backend") || memberGIDs(Groups["oncall"].Members) == "users/5" {
+			t.Fatal("Follower should only track the managed groups")
+		}
+
+		if !Manifest.modTime.Equal(followedAt) {
+			t.Fatalf("Follower should keep the file's modified time\nGot: %s", Manifest.modTime)
+		}
+
+		SchedulerLease.held = true
+		Manifest.check(Groups)
+
+		if got := memberGIDs(Groups["oncall"].Members); got != "users/5" || Manifest.unapplied {
+			t.Fatalf("Manifest not applied after taking over\nGot: %q", got)
+		}
+	})
+}
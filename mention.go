@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//groupMention is where a group was called in a message. Start and End are
+//byte offsets into the message text, covering the bot's mention through the
+//end of the group's name, which is the part replaced by the group's members.
+type groupMention struct {
+	Start     int
+	End       int
+	GroupName string
+}
+
+//findGroupMention finds the bot's mention in the message and the group name
+//that follows it. Google's annotations say exactly where the bot was
+//mentioned, so they are used when there are any. Messages without them, such
+//as scheduled ones, are searched for the bot's name as a whole word instead.
+//The group name is the run of letters, numbers, underscores, and dashes right
+//after the mention, so punctuation like "HG6," is left in the message.
+func findGroupMention(msg message) (mention groupMention, found bool) {
+	for _, span := range msg.botMentions() {
+		mention.Start = span[0]
+		mention.GroupName, mention.End = groupNameAt(msg.Text, span[1])
+
+		if mention.GroupName != "" {
+			return mention, true
+		}
+	}
+
+	return groupMention{}, false
+}
+
+//botMentions returns the start and end byte offsets of every place the bot was
+//mentioned, in the order they appear. Mentions of other bots in the same room
+//are skipped.
+func (m message) botMentions() [][2]int {
+	var spans [][2]int
+
+	for _, a := range m.Mentions {
+		if a.Type != "USER_MENTION" || a.Called.User.Type != "BOT" || a.Length <= 0 {
+			continue
+		}
+
+		start, startOk := utf16ToByteOffset(m.Text, a.StartIndex)
+		end, endOk := utf16ToByteOffset(m.Text, a.StartIndex+a.Length)
+
+		if startOk && endOk && isThisBot(a.Called.User, m.Text[start:end]) {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+
+	if len(spans) > 0 {
+		return spans
+	}
+
+	for offset := 0; BotName != "" && offset < len(m.Text); {
+		i := indexFold(m.Text[offset:], BotName)
+		if i < 0 {
+			break
+		}
+
+		start, end := offset+i, offset+i+len(BotName)
+		if isWordBoundary(m.Text, start, end) {
+			spans = append(spans, [2]int{start, end})
+		}
+
+		offset = end
+	}
+
+	return spans
+}
+
+//isThisBot tells if the mentioned bot is this one, by the text of the mention
+//or the bot's display name, which Google leaves off the @.
+func isThisBot(user User, mentionText string) bool {
+	name := strings.TrimPrefix(BotName, "@")
+
+	return name != "" && (strings.EqualFold(mentionText, BotName) || strings.EqualFold(strings.TrimPrefix(user.Name, "@"), name))
+}
+
+//groupNameAt reads the group name that starts after any whitespace at the
+//given offset, returning it along with the offset it ends at.
+func groupNameAt(text string, offset int) (string, int) {
+	start := offset
+	for start < len(text) {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+
+		start += size
+	}
+
+	end := start
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isGroupNameRune(r) {
+			break
+		}
+
+		end += size
+	}
+
+	return text[start:end], end
+}
+
+//isGroupNameRune tells if the letter can be part of a group name, which
+//matches the `^[\w-]{0,40}$` that checkGroup holds names to.
+func isGroupNameRune(r rune) bool {
+	return r == '_' || r == '-' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+//isWordBoundary tells if text[start:end] isn't part of a longer word
+func isWordBoundary(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if isGroupNameRune(r) {
+			return false
+		}
+	}
+
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if isGroupNameRune(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//indexFold is strings.Index, ignoring case
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+//utf16ToByteOffset turns an offset counted in UTF-16 code units, which is how
+//Google counts annotation indexes, into a byte offset into the text. It's not
+//ok if the offset falls outside the text or in the middle of a letter.
+func utf16ToByteOffset(text string, units int) (int, bool) {
+	if units < 0 {
+		return 0, false
+	}
+
+	var counted int
+	for i, r := range text {
+		if counted == units {
+			return i, true
+		}
+
+		if counted > units {
+			return 0, false
+		}
+
+		counted++
+		if r >= 0x10000 {
+			counted++
+		}
+	}
+
+	return len(text), counted == units
+}
+
+//utf16Len counts the UTF-16 code units in the text
+func utf16Len(text string) int {
+	var units int
+	for _, r := range text {
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+
+	return units
+}
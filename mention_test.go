@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+//botAnnotation builds the annotation Google sends for the bot's mention, with
+//the index counted in UTF-16 code units.
+func botAnnotation(text string) annotation {
+	start := utf16Len(text[:strings.Index(text, BotName)])
+
+	return annotation{
+		Called:     userMention{User{Name: BotName, Type: "BOT"}},
+		Type:       "USER_MENTION",
+		StartIndex: start,
+		Length:     utf16Len(BotName),
+	}
+}
+
+func TestFindGroupMention(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		annotated bool
+		wantGroup string
+		wantText  string
+	}{
+		{"Group after the bot", BotName + " oncall hello", true, "oncall", "X hello"},
+		{"Trailing punctuation", "HEY! " + BotName + " HG6, great job", true, "HG6", "HEY! X, great job"},
+		{"Keeps the case typed", BotName + " OnCall: hi", true, "OnCall", "X: hi"},
+		{"Group name in an earlier word", "oncallers " + BotName + " oncall now", true, "oncall", "oncallers X now"},
+		{"Repeated words", BotName + " oncall oncall is down, oncall", true, "oncall", "X oncall is down, oncall"},
+		{"Text before in other scripts", "🔥 ünïcode " + BotName + " backend!", true, "backend", "🔥 ünïcode X!"},
+		{"Newline before the group", BotName + "\noncall\nhi", true, "oncall", "X\nhi"},
+		{"No annotations", "hi " + BotName + " oncall.", false, "oncall", "hi X."},
+		{"Bot name inside a word", "x" + BotName + " oncall " + BotName + " backend", false, "backend", "x" + BotName + " oncall X"},
+		{"Bot name in another case", strings.ToUpper(BotName) + " oncall", false, "oncall", "X"},
+		{"No group after the bot", "hello " + BotName + " , there", true, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := message{Text: test.text}
+			if test.annotated {
+				msg.Mentions = []annotation{botAnnotation(test.text)}
+			}
+
+			mention, found := findGroupMention(msg)
+
+			if test.wantGroup == "" {
+				if found {
+					t.Fatalf("No group should be found\nGot: %+v", mention)
+				}
+
+				return
+			}
+
+			if !found || mention.GroupName != test.wantGroup {
+				t.Fatalf("Incorrect group found\nGot: %+v\nWanted: %q", mention, test.wantGroup)
+			}
+
+			if got := test.text[:mention.Start] + "X" + test.text[mention.End:]; got != test.wantText {
+				t.Fatalf("Incorrect mention span\nGot: %q\nWanted: %q", got, test.wantText)
+			}
+		})
+	}
+
+	t.Run("Annotations moved with prepended text", func(t *testing.T) {
+		text := "oncall " + BotName + " backend"
+		msg := message{Text: text, Mentions: []annotation{botAnnotation(text)}}
+
+		msg.replaceSpan(0, 0, BotName+" ")
+
+		if mention, found := findGroupMention(msg); !found || mention.GroupName != "backend" {
+			t.Fatalf("Annotation not moved\nGot: %+v", mention)
+		}
+	})
+
+	t.Run("Other bots aren't taken for this one", func(t *testing.T) {
+		text := "@Jira HG6 " + BotName + " oncall hi"
+		other := annotation{
+			Called:     userMention{User{Name: "Jira", GID: "users/jira", Type: "BOT"}},
+			Type:       "USER_MENTION",
+			StartIndex: 0,
+			Length:     utf16Len("@Jira"),
+		}
+
+		msg := message{Text: text, Mentions: []annotation{other, botAnnotation(text)}}
+
+		mention, found := findGroupMention(msg)
+		if !found || mention.GroupName != "oncall" {
+			t.Fatalf("Incorrect group found\nGot: %+v", mention)
+		}
+
+		if spans := msg.botMentions(); len(spans) != 1 {
+			t.Fatalf("Other bot's mention included\nGot: %v", spans)
+		}
+	})
+
+	t.Run("Bad annotations fall back to the text", func(t *testing.T) {
+		text := BotName + " oncall"
+		bad := botAnnotation(text)
+		bad.StartIndex = len(text) + 10
+
+		mention, found := findGroupMention(message{Text: text, Mentions: []annotation{bad}})
+		if !found || mention.GroupName != "oncall" {
+			t.Fatalf("Did not fall back to the text\nGot: %+v", mention)
+		}
+	})
+}
+
+func TestNotifyReplacesMention(t *testing.T) {
+	Logger.Active(false)
+
+	Groups := GroupMap{"hg6": &Group{Name: "HG6", Members: []Member{{GID: "users/1"}, {GID: "users/2"}}}}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"README example", "HEY! " + BotName + " HG6, great job!", "HEY! <users/1> <users/2>, great job!"},
+		{"Lowercased group", BotName + " hg6 standup", "<users/1> <users/2> standup"},
+		{"Group in an earlier word", "HG6ers " + BotName + " HG6 hi", "HG6ers <users/1> <users/2> hi"},
+		{"Multiple lines", BotName + " HG6\nline one\n\nline two", "<users/1> <users/2>\nline one\n\nline two"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msgObj := messageResponse{
+				Message: message{
+					Sender:   User{Name: "Sender"},
+					Text:     test.text,
+					Mentions: []annotation{botAnnotation(test.text)},
+				},
+				Room: space{GID: genRoomGID(0), Type: "ROOM"},
+			}
+
+			want := "Sender said:\n\n" + test.want
+			if got := Groups.Notify("HG6", msgObj); got != want {
+				t.Fatalf("Incorrect notification\nGot: %q\nWanted: %q", got, want)
+			}
+		})
+	}
+}
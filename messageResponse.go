@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -23,7 +22,16 @@ type messageResponse struct {
 	Time    string  `json:"eventTime"`
 	Type    string  `json:"type"`
 
+	//User and Action are who clicked a card's button, and what the button
+	//does, for CARD_CLICKED events.
+	User   User       `json:"user"`
+	Action cardAction `json:"action"`
+
 	FromMaster bool
+
+	//lookups are what the message's command read from outside the bot
+	//before stateLock was taken
+	lookups *Lookups
 }
 
 type message struct {
@@ -31,11 +39,17 @@ type message struct {
 	Mentions []annotation `json:"annotations"`
 	Thread   thread       `json:"thread"`
 	Text     string       `json:"text"`
+
+	SlashCommand slashCommand `json:"slashCommand"`
+	ArgumentText string       `json:"argumentText"`
 }
 
 type annotation struct {
-	Called userMention `json:"userMention"`
-	Type   string      `json:"type"`
+	Called       userMention           `json:"userMention"`
+	SlashCommand *slashCommandMetadata `json:"slashCommand"`
+	Type         string                `json:"type"`
+	StartIndex   int                   `json:"startIndex"`
+	Length       int                   `json:"length"`
 }
 
 type thread struct {
@@ -46,6 +60,13 @@ type userMention struct {
 	User `json:"user"`
 }
 
+//cardAction is the action of a card's button that was clicked, as Google
+//sends it back.
+type cardAction struct {
+	MethodName string            `json:"actionMethodName"`
+	Parameters []ActionParameter `json:"parameters"`
+}
+
 type space struct {
 	GID  string `json:"name"`
 	Type string `json:"type"`
@@ -55,22 +76,30 @@ type space struct {
 //sense of it for the bot.
 func (mr *messageResponse) ParseArgs(Groups GroupMgr) (args Arguments, msg string, ok bool) {
 	mr.FromMaster = false
-	//The admin of the bot can be changed via configs, but they are defined by
-	//the id google gives them, incase their name changes, and how they reach out.
-	//i.e. The bot will only recognize the admin if messaged via DM. an admin
-	//shouldn't be doing admin things in front of the common folk.
-	if mr.Room.Type == "DM" && mr.Message.Sender.GID == MasterID {
+
+	//Slash commands are turned into the text syntax, so they're handled the
+	//same from here on.
+	isSlash, reply := mr.Message.expandSlashCommand()
+	if reply != "" {
+		return nil, reply, false
+	}
+
+	//The admins of the bot are the one set via configs plus any granted with the
+	//admin command, they are defined by the id google gives them, incase their
+	//name changes, and how they reach out. i.e. The bot will only recognize an
+	//admin if messaged via DM. an admin shouldn't be doing admin things in front
+	//of the common folk.
+	if mr.Room.Type == "DM" && Roles.IsAdmin(mr.Message.Sender.GID) {
 		mr.FromMaster = true
 		//This prepends the botname to the message so that the admin doesn't have to
 		//@ the bot when DM-ing it. The conditional allows you to do either.
-		if !strings.HasPrefix(mr.Message.Text, BotName) {
-			mr.Message.Text = BotName + " " + mr.Message.Text
+		if !isSlash && !strings.HasPrefix(mr.Message.Text, BotName) {
+			mr.Message.replaceSpan(0, 0, BotName+" ")
 		}
 	}
 
-	tempArgs := strings.Fields(mr.Message.Text)
-	nArgs := len(tempArgs)
-	if nArgs < 2 {
+	tokens := tokenize(mr.Message.Text)
+	if len(tokens) < 2 {
 		msg = BotName + " seems to have been called with no params. Just a heads up."
 		ok = false
 
@@ -81,200 +110,156 @@ func (mr *messageResponse) ParseArgs(Groups GroupMgr) (args Arguments, msg strin
 	ok = true
 	msg = ""
 
-	if tempArgs[0] == BotName {
-		option := strings.ToLower(tempArgs[1])
-
-		//I'd like to find a cleaner way to triage the string, but this seems
-		//to be the best as of now. I do worry, that this could get hard to maintain.
-		if option != "create" &&
-			option != "add" &&
-			option != "remove" &&
-			option != "disband" &&
-			option != "restrict" &&
-			option != "list" &&
-			option != "syncgroup" &&
-			option != "syncallgroups" &&
-			option != "schedule" &&
-			option != "usage" &&
-			option != "help" {
-			if Groups.IsGroup(tempArgs[1]) {
-				args["action"] = "notify"
-				args["groupName"] = tempArgs[1]
-			} else {
-				msg = fmt.Sprintf("Invalid option received. I'm not sure what to do about %q.", tempArgs[1])
+	//Everything the bot can do is in the command registry. Anything that isn't
+	//a command is taken as a group to notify.
+	cmd := Commands.Get("notify")
+
+	if tokens[0].Value == BotName {
+		if cmd = Commands.Lookup(tokens[1].Value); cmd == nil {
+			//Punctuation can follow a group's name, as in "@HGNotify HG6, hello"
+			if groupName, _ := groupNameAt(tokens[1].Value, 0); !Groups.IsGroup(groupName) {
+				msg = didYouMean(tokens[1].Value, Groups, *mr)
+				if msg == "" {
+					msg = fmt.Sprintf("Invalid option received. I'm not sure what to do about %q.", tokens[1].Value)
+				}
 				ok = false
+
+				return
 			}
-		} else {
-			args["action"] = option
+
+			cmd = Commands.Get("notify")
 		}
-	} else {
-		args["action"] = "notify"
 	}
 
-	if args["action"] == "schedule" {
-		err := parseScheduleArgs(Groups, tempArgs, &args)
-		if err != nil {
-			ok = false
-			msg = err.Error()
-			return
-		}
-	} else {
-		if nArgs < 3 {
-			args["groupName"] = ""
+	if !cmd.Allowed(*mr) {
+		ok = false
+
+		if cmd.Hidden {
+			msg = fmt.Sprintf("Invalid option received. I'm not sure what to do about %q.", tokens[1].Value)
 		} else {
-			args["groupName"] = tempArgs[2]
+			msg = fmt.Sprintf("My apologies, you don't have permission to use %q.", cmd.Name)
 		}
-	}
 
-	//Logic introduced for adding/removing yourself from a group
-	if args["action"] == "add" || args["action"] == "remove" || args["action"] == "create" {
-		for _, item := range tempArgs {
-			if strings.ToLower(item) == "self" {
-				args["self"] = "self"
-				break
-			}
-		}
+		return
 	}
 
-	//This one is a bit jank, I'll admit (PR's Welcome :D). What's happening is gi
-	//is a value set to be arbitrarily high, it stands for group index. The for loop
-	//loops through the words given by the message text, separated by whitespace. When
-	//When it identified the bot name, it sets gi. After gi is set, the next thing should
-	//be the group name. So the loop just sets the next item to be the group name and
-	//proceeds
-	if args["action"] == "notify" {
-		gi := 100000
-
-		for i, v := range tempArgs {
-			if v == BotName {
-				gi = i
-			}
+	args["action"] = cmd.Name
 
-			if i == gi+1 {
-				args["groupName"] = v
-				break
-			}
-		}
+	if err := cmd.parseArgs(Groups, *mr, tokens, args); err != nil {
+		ok = false
+		msg = err.Error()
 	}
 
 	return
 }
 
-//inspectMessage method (maybe should be renamed) takes the parsed arguments
-//then reacts accordingly.
-func inspectMessage(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) (msg string) {
-	switch args["action"] {
-	case "create":
-		msg = Groups.Create(args["groupName"], args["self"], msgObj)
-
-	case "disband":
-		msg = Groups.Disband(args["groupName"], msgObj)
-
-	case "add":
-		msg = Groups.AddMembers(args["groupName"], args["self"], msgObj)
-
-	case "remove":
-		msg = Groups.RemoveMembers(args["groupName"], args["self"], msgObj)
-
-	case "restrict":
-		msg = Groups.Restrict(args["groupName"], msgObj)
-
-	case "notify":
-		msg = Groups.Notify(args["groupName"], msgObj)
+//parseNotifyArgs finds the group to notify, which is the name right after
+//the bot's mention.
+func parseNotifyArgs(Groups GroupMgr, msgObj messageResponse, tokens []Token, args Arguments) error {
+	args["groupName"] = ""
 
-	case "list":
-		msg = Groups.List(args["groupName"], msgObj)
-
-	case "syncgroup":
-		msg = Groups.SyncGroupMembers(args["groupName"], msgObj)
-
-	case "syncallgroups":
-		msg = Groups.SyncAllGroups(msgObj)
+	if mention, found := findGroupMention(msgObj.Message); found {
+		args["groupName"] = mention.GroupName
+	}
 
-	case "usageShort":
-		msg = usage("usageShort")
+	return nil
+}
 
-	case "usage":
-		msg = getUsageWithLink(usage(""))
+//fromClick turns a click of a card's button into the message that would have
+//run the same command. The message the card was in is the bot's, so the one
+//who clicked is taken as the sender.
+func (mr *messageResponse) fromClick() {
+	words := []string{BotName, mr.Action.MethodName}
+	for _, param := range mr.Action.Parameters {
+		words = append(words, param.Value)
+	}
 
-	case "help":
-		msg = usage("")
+	mr.Message.Sender = mr.User
+	mr.Message.Text = strings.Join(words, " ")
+	mr.Message.Mentions = nil
+}
 
-	case "schedule":
-		switch args["subAction"] {
-		case "onetime":
-			msg = Scheduler.CreateOnetime(args, Groups, msgObj)
-		case "recurring":
-			msg = Scheduler.CreateRecurring(args, Groups, msgObj)
-		case "remove":
-			msg = Scheduler.Remove(args, msgObj)
-		case "list":
-			msg = Scheduler.List(msgObj)
+//replaceSpan swaps text[start:end] of the message for the given text. The
+//annotations after it are moved along with the text they point at, and any
+//annotations in the part replaced are dropped.
+func (m *message) replaceSpan(start, end int, text string) {
+	startUnits := utf16Len(m.Text[:start])
+	endUnits := utf16Len(m.Text[:end])
+	shift := utf16Len(text) - (endUnits - startUnits)
+
+	m.Text = m.Text[:start] + text + m.Text[end:]
+
+	mentions := make([]annotation, 0, len(m.Mentions))
+	for _, a := range m.Mentions {
+		if a.StartIndex >= endUnits {
+			a.StartIndex += shift
+		} else if a.StartIndex >= startUnits && start != end {
+			continue
 		}
 
-	default:
-		//All of the argument things should be taken care of by the time we get here,
-		//BUT It's better to handle the exceptions than let them bite you.
-		msg = "Unknown action? Shouldn't have gotten here tho... reach out for someone to check my innards. You should seriously never see this message."
+		mentions = append(mentions, a)
 	}
 
-	return
+	m.Mentions = mentions
 }
 
-func parseScheduleArgs(Groups GroupMgr, elems []string, args *Arguments) error {
-	if len(elems) < 3 {
-		return errors.New("Not enough arguments for schedule action")
+//inspectMessage method (maybe should be renamed) takes the parsed arguments
+//then reacts accordingly.
+func inspectMessage(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse, args Arguments) (msg string) {
+	cmd := Commands.Get(args["action"])
+	if cmd == nil {
+		//All of the argument things should be taken care of by the time we get here,
+		//BUT It's better to handle the exceptions than let them bite you.
+		return "Unknown action? Shouldn't have gotten here tho... reach out for someone to check my innards. You should seriously never see this message."
 	}
 
-	(*args)["subAction"] = elems[2]
+	return cmd.run(Groups, Scheduler, msgObj, args)
+}
 
-	switch (*args)["subAction"] {
-	case "recurring":
-		fallthrough
-	case "onetime":
-		if len(elems) < 7 {
-			return fmt.Errorf("Not enough arguments for schedule %s action\n ```%s``` ", (*args)["subAction"], usage("schedule:"+(*args)["subAction"]))
-		}
+//labelPattern is what a schedule's label has to look like
+var labelPattern = regexp.MustCompile(`^\w{3,20}$`)
 
-		ptrn := regexp.MustCompile(`^\w{3,20}$`)
-		if !ptrn.Match([]byte(elems[3])) {
-			return fmt.Errorf("Label must be alphanumeric between 3 and 20 characters\n ```%s```", usage("schedule:"+(*args)["subAction"]))
-		}
-		(*args)["label"] = elems[3]
+//checkScheduleArgs checks the arguments for the schedule subactions, since
+//they need more checking than the other commands. The message is taken as it
+//was typed, so its spacing and newlines are kept.
+func checkScheduleArgs(Groups GroupMgr, args Arguments) error {
+	subAction := args["subAction"]
 
-		datetime, err := time.Parse(time.RFC3339, elems[4])
-		if err != nil {
-			return fmt.Errorf("Error parsing your time %q. Must be formatted in RFC3339 format, please try again", elems[4])
+	switch subAction {
+	case "onetime", "recurring":
+		if args["label"] == "" || args["dateTime"] == "" || args["groupName"] == "" || strings.TrimSpace(args["message"]) == "" {
+			return fmt.Errorf("Not enough arguments for schedule %s action\n ```%s``` ", subAction, usage("schedule:"+subAction))
 		}
 
-		//the scheduled message has to be at least 10 minutes out.
-		if !datetime.After(time.Now().Add(time.Minute * 9)) {
-			return fmt.Errorf("Scheduled message must be at least 10 minutes away from now")
+	case "remove":
+		if args["label"] == "" {
+			return fmt.Errorf("Not enough arguments for schedule %s action\n ```%s``` ", subAction, usage("schedule:"+subAction))
 		}
-		(*args)["dateTime"] = elems[4]
 
-		if !Groups.IsGroup(elems[5]) {
-			return fmt.Errorf("Specificed group %q not found", elems[5])
-		}
-		(*args)["groupName"] = elems[5]
+	default:
+		return nil
+	}
 
-		(*args)["message"] = strings.Join(elems[6:], " ")
+	if !labelPattern.MatchString(args["label"]) {
+		return fmt.Errorf("Label must be alphanumeric between 3 and 20 characters\n ```%s```", usage("schedule:"+subAction))
+	}
 
-	case "list":
+	if subAction == "remove" {
+		return nil
+	}
 
-	case "remove":
-		if len(elems) < 4 {
-			return fmt.Errorf("Not enough arguments for schedule %s action\n ```%s``` ", (*args)["subAction"], usage("schedule:"+(*args)["subAction"]))
-		}
+	datetime, err := time.Parse(time.RFC3339, args["dateTime"])
+	if err != nil {
+		return fmt.Errorf("Error parsing your time %q. Must be formatted in RFC3339 format, please try again", args["dateTime"])
+	}
 
-		ptrn := regexp.MustCompile(`^\w{3,20}$`)
-		if !ptrn.Match([]byte(elems[3])) {
-			return fmt.Errorf("Label must be alphanumeric between 3 and 20 characters\n ```%s```", usage("schedule:"+(*args)["subAction"]))
-		}
-		(*args)["label"] = elems[3]
+	//the scheduled message has to be at least 10 minutes out.
+	if !datetime.After(time.Now().Add(time.Minute * 9)) {
+		return fmt.Errorf("Scheduled message must be at least 10 minutes away from now")
+	}
 
-	default:
-		return fmt.Errorf("Unknown schedule subaction %q called", elems[2])
+	if !Groups.IsGroup(args["groupName"]) {
+		return fmt.Errorf("Specificed group %q not found", args["groupName"])
 	}
 
 	return nil
@@ -22,11 +22,18 @@ func TestParseArgs(t *testing.T) {
 		},
 	}
 
+	roles := Roles
+	defer func() { Roles = roles }()
+
+	//The sender needs a role to use the staff only commands
+	Roles = newRoleDirectory()
+	Roles.Grant(RoleGrant{GID: newMsgObj.Message.Sender.GID, Role: RoleAuditor})
+
 	t.Run("Action and Group args are parsed and returned", func(t *testing.T) {
 		Groups := make(GroupMap)
 		wantedGroupName := genRandName(10)
 		msgObj := newMsgObj
-		actions := []string{"create", "add", "remove", "disband", "restrict", "list", "syncgroup", "syncallgroups", "usage", "help"}
+		actions := []string{"create", "add", "remove", "disband", "restrict", "list", "whois", "history", "syncgroup", "syncallgroups", "usage", "help"}
 
 		for _, wantedAction := range actions {
 			msgObj.Message.Text = BotName + " " + wantedAction + " " + wantedGroupName
@@ -46,6 +53,22 @@ func TestParseArgs(t *testing.T) {
 		}
 	})
 
+	t.Run("Notify group found through punctuation", func(t *testing.T) {
+		Groups := GroupMap{"hg6": &Group{Name: "HG6"}}
+		msgObj := newMsgObj
+		msgObj.Message.Text = BotName + " HG6, great job"
+
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Error parsing notify request: %s", msg)
+		}
+
+		if args["action"] != "notify" || args["groupName"] != "HG6" {
+			t.Fatalf("Notify not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
 	wantedSubActions := [2]string{"onetime", "recurring"}
 
 	for _, wantedSubAction := range wantedSubActions {
@@ -106,6 +129,70 @@ func TestParseArgs(t *testing.T) {
 		})
 	}
 
+	t.Run("Schedule keeps the message as typed", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		wantedDatetime := time.Now().Add(time.Hour).Format(time.RFC3339)
+		wantedMessage := "Standup in 5!\n\n  - updates\n  - blockers"
+
+		Groups["oncall"] = new(Group)
+
+		msgObj.Message.Text = fmt.Sprintf("%s schedule onetime standup %s oncall %s", BotName, wantedDatetime, wantedMessage)
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Error parsing schedule request: %s", msg)
+		}
+
+		if args["message"] != wantedMessage {
+			t.Fatalf("Message not kept as typed\nGot: %q\nWanted: %q", args["message"], wantedMessage)
+		}
+	})
+
+	t.Run("Schedule args can be given as options", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		wantedDatetime := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+		Groups["oncall"] = new(Group)
+
+		msgObj.Message.Text = fmt.Sprintf(`%s schedule recurring --group=oncall --time=%s --label=standup "Standup   time"`, BotName, wantedDatetime)
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Error parsing schedule request: %s", msg)
+		}
+
+		if args["label"] != "standup" || args["dateTime"] != wantedDatetime || args["groupName"] != "oncall" || args["message"] != "Standup   time" {
+			t.Fatalf("Options not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Schedule rejects bad arguments", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		later := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+		Groups["oncall"] = new(Group)
+
+		for _, text := range []string{
+			"schedule",
+			"schedule onetime standup " + later + " oncall",
+			"schedule onetime st " + later + " oncall hello",
+			"schedule onetime standup tomorrow oncall hello",
+			"schedule onetime standup " + time.Now().Format(time.RFC3339) + " oncall hello",
+			"schedule onetime standup " + later + " nobody hello",
+			"schedule onetime --when=" + later + " standup oncall hello",
+			"schedule remove",
+		} {
+			msgObj.Message.Text = BotName + " " + text
+
+			if _, _, okay := msgObj.ParseArgs(Groups); okay {
+				t.Fatalf("Schedule request %q should have been rejected", text)
+			}
+		}
+	})
+
 	t.Run("Properly dispatches list action", func(t *testing.T) {
 		Groups := make(GroupMap)
 		msgObj := newMsgObj
@@ -200,6 +287,77 @@ func TestParseArgs(t *testing.T) {
 		}
 	})
 
+	t.Run("Admin args parsed and returned", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+
+		msgObj.Message.Text = BotName + " admin GRANT moderator @Someone"
+
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Something went wrong: %q", msg)
+		}
+
+		if args["action"] != "admin" || args["subAction"] != "grant" || args["role"] != "moderator" {
+			t.Fatalf("Admin action not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Staff commands hidden from everyone else", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		msgObj.Message.Sender.GID = genUserGID(0)
+
+		msgObj.Message.Text = BotName + " syncallgroups"
+
+		_, msg, okay := msgObj.ParseArgs(Groups)
+
+		if okay || !strings.Contains(msg, "Invalid option received") {
+			t.Fatalf("Staff command should look like it doesn't exist\nGot: %q", msg)
+		}
+	})
+
+	t.Run("Alias parsed as the command", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		wantedGroupName := genRandName(10)
+
+		msgObj.Message.Text = BotName + " DELETE " + wantedGroupName
+
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Something went wrong: %q", msg)
+		}
+
+		if args["action"] != "disband" || args["groupName"] != wantedGroupName {
+			t.Fatalf("Alias not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Properly identifies granted admin", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+
+		roles := Roles
+		defer func() { Roles = roles }()
+
+		Roles = newRoleDirectory()
+		Roles.Grant(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAdmin})
+
+		msgObj.Room.Type = "DM"
+		msgObj.Message.Text = "list"
+
+		if _, msg, okay := msgObj.ParseArgs(Groups); !okay {
+			t.Fatalf("Something went wrong: %q", msg)
+		}
+
+		if !msgObj.FromMaster {
+			t.Fatal("Message object is not noted as from an admin")
+		}
+	})
+
 	t.Run("Properly finds group name for notify", func(t *testing.T) {
 		Groups := make(GroupMap)
 		wantedGroupName := strings.ToLower(genRandName(10))
@@ -236,6 +394,28 @@ func TestParseArgs(t *testing.T) {
 		})
 	})
 
+	t.Run("Properly notes dry run for sync commands", func(t *testing.T) {
+		Groups := make(GroupMap)
+		msgObj := newMsgObj
+		wantedGroupName := genRandName(10)
+
+		msgObj.Message.Text = BotName + " syncgroup --dry-run " + wantedGroupName
+
+		args, msg, okay := msgObj.ParseArgs(Groups)
+
+		if !okay {
+			t.Fatalf("Something went wrong: %q", msg)
+		}
+
+		if args["dryRun"] == "" {
+			t.Fatal("Dry run not successfully returned")
+		}
+
+		if args["groupName"] != wantedGroupName {
+			t.Fatalf("Group name not returned, got: %q", args["groupName"])
+		}
+	})
+
 	t.Run("Properly notes self when provided", func(t *testing.T) {
 		Groups := make(GroupMap)
 		msgObj := newMsgObj
@@ -269,7 +449,7 @@ func TestInspectMessage(t *testing.T) {
 		},
 	}
 
-	actions := []string{"notify", "create", "add", "remove", "disband", "restrict", "list", "syncgroup", "syncallgroups"}
+	actions := []string{"notify", "create", "add", "remove", "disband", "restrict", "list", "whois", "history", "syncgroup", "syncallgroups"}
 
 	t.Run("Correctly calls method for given action", func(t *testing.T) {
 		for _, action := range actions {
@@ -338,18 +518,63 @@ func (mgm MockGroupMap) Notify(string, messageResponse) string {
 	mgm["notify"] = true
 	return ""
 }
+func (mgm MockGroupMap) Expand(string, messageResponse) (string, error) {
+	mgm["expand"] = true
+	return "", nil
+}
 func (mgm MockGroupMap) List(string, messageResponse) string {
 	mgm["list"] = true
 	return ""
 }
-func (mgm MockGroupMap) SyncGroupMembers(string, messageResponse) string {
+func (mgm MockGroupMap) ListCard(string, messageResponse) *CardV2 {
+	return nil
+}
+func (mgm MockGroupMap) Whois(messageResponse) string {
+	mgm["whois"] = true
+	return ""
+}
+func (mgm MockGroupMap) History(string, messageResponse) string {
+	mgm["history"] = true
+	return ""
+}
+func (mgm MockGroupMap) VisibleGroups(messageResponse) []string {
+	return nil
+}
+func (mgm MockGroupMap) FlagRoom(bool, messageResponse) []string {
+	return nil
+}
+func (mgm MockGroupMap) SyncGroupMembers(string, string, messageResponse) string {
 	mgm["syncgroup"] = true
 	return ""
 }
-func (mgm MockGroupMap) SyncAllGroups(messageResponse) string {
+func (mgm MockGroupMap) SyncAllGroups(string, messageResponse) string {
 	mgm["syncallgroups"] = true
 	return ""
 }
+func (mgm MockGroupMap) ReloadManifest(string, messageResponse) string {
+	mgm["reload"] = true
+	return ""
+}
+func (mgm MockGroupMap) CreateFromRoom(string, string, messageResponse) string {
+	mgm["createfromroom"] = true
+	return ""
+}
+func (mgm MockGroupMap) Unsync(string, messageResponse) string {
+	mgm["unsync"] = true
+	return ""
+}
+func (mgm MockGroupMap) SyncDirectory(string, string, messageResponse) string {
+	mgm["dirsync"] = true
+	return ""
+}
+func (mgm MockGroupMap) Export(string, string, messageResponse) string {
+	mgm["export"] = true
+	return ""
+}
+func (mgm MockGroupMap) Import(string, string, string, messageResponse) string {
+	mgm["import"] = true
+	return ""
+}
 
 //Unused, just needs to exist for the interface
 func (mgm MockGroupMap) GetGroup(string) *Group { return new(Group) }
@@ -357,6 +582,11 @@ func (mgm MockGroupMap) IsGroup(string) bool    { return true }
 
 type MockScheduler map[string]bool
 
+func (ms MockScheduler) Upcoming(string) []*Schedule {
+	ms["upcoming"] = true
+	return nil
+}
+
 func (ms MockScheduler) CreateOnetime(args Arguments, Groups GroupMgr, msgObj messageResponse) string {
 	ms["onetime"] = true
 	return ""
@@ -376,3 +606,15 @@ func (ms MockScheduler) List(msgObj messageResponse) string {
 	ms["list"] = true
 	return ""
 }
+
+func (ms MockScheduler) ListCard(msgObj messageResponse) *CardV2 {
+	return nil
+}
+
+func (ms MockScheduler) PauseRoom(msgObj messageResponse) []string {
+	return nil
+}
+
+func (ms MockScheduler) ResumeRoom(msgObj messageResponse) ([]string, []string) {
+	return nil, nil
+}
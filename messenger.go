@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	chat "google.golang.org/api/chat/v1"
+)
+
+//Messenger posts messages into rooms on the bot's behalf, outside of a reply to
+//someone's message
+type Messenger interface {
+	Send(room, thread, text string) error
+}
+
+//ChatMessenger sends messages through Google's Chat API
+type ChatMessenger struct {
+	messages *chat.SpacesMessagesService
+}
+
+//newChatMessenger creates a messenger using the client given, which should
+//already be authorized as the bot. The Chat API's address can be swapped with
+//baseURL, such as for a stand-in while testing, and is Google's when empty.
+func newChatMessenger(client *http.Client, baseURL string) *ChatMessenger {
+	service := getChatService(client)
+	if baseURL != "" {
+		service.BasePath = strings.TrimSuffix(baseURL, "/") + "/"
+	}
+
+	return &ChatMessenger{messages: chat.NewSpacesMessagesService(service)}
+}
+
+//Send posts the text into the room, in the thread given if there is one
+func (cm *ChatMessenger) Send(room, thread, text string) error {
+	msg := &chat.Message{Text: text}
+	if thread != "" {
+		msg.Thread = &chat.Thread{Name: thread}
+	}
+
+	_, err := cm.messages.Create(room, msg).Do()
+	return err
+}
+
+//skipMessenger logs the messages it's given without sending them
+type skipMessenger struct{}
+
+//Send logs the message that would've been sent
+func (skipMessenger) Send(room, thread, text string) error {
+	log.Printf("Skipping send to %s... to send set SERVICE_SEND to true", room)
+	return nil
+}
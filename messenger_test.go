@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatMessenger(t *testing.T) {
+	chat := newFakeChat()
+	defer chat.Close()
+
+	messenger := chat.messenger()
+
+	t.Run("Posts into the room and thread", func(t *testing.T) {
+		if err := messenger.Send("spaces/AAAA", "spaces/AAAA/threads/BBBB", "hello"); err != nil {
+			t.Fatalf("Error sending message: %s", err.Error())
+		}
+
+		want := []SentMessage{{Room: "spaces/AAAA", Thread: "spaces/AAAA/threads/BBBB", Text: "hello"}}
+		if got := chat.sent(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Incorrect message sent\nGot: %+v\nWanted: %+v", got, want)
+		}
+	})
+
+	t.Run("Errors from the API are returned", func(t *testing.T) {
+		chat.failWith = http.StatusForbidden
+		defer func() { chat.failWith = 0 }()
+
+		if err := messenger.Send("spaces/AAAA", "", "hello"); err == nil {
+			t.Fatal("Error from the API not returned")
+		}
+	})
+}
+
+func TestMessageRecorder(t *testing.T) {
+	recorder := &MessageRecorder{}
+
+	recorder.Send("spaces/AAAA", "", "one")
+	recorder.Send("spaces/BBBB", "spaces/BBBB/threads/1", "two")
+
+	want := []SentMessage{{Room: "spaces/AAAA", Text: "one"}, {Room: "spaces/BBBB", Thread: "spaces/BBBB/threads/1", Text: "two"}}
+	if got := recorder.Messages(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Incorrect messages recorded\nGot: %+v\nWanted: %+v", got, want)
+	}
+
+	recorder.Err = errors.New("down")
+	if err := recorder.Send("spaces/AAAA", "", "three"); err == nil || len(recorder.Messages()) != 2 {
+		t.Fatal("Recorder should fail with its error")
+	}
+}
+
+func TestScheduleDelivery(t *testing.T) {
+	Logger.Active(false)
+
+	chat := newFakeChat()
+	defer chat.Close()
+
+	roomGID := genRoomGID(10)
+	group := &Group{Name: "OnCall", Members: []Member{{GID: "users/1"}, {GID: "users/2"}}}
+
+	schedule := &Schedule{
+		SessKey:     roomGID + ":standup",
+		ThreadKey:   roomGID + "/threads/1",
+		Creator:     "Sender",
+		MessageText: "standup in 5!\nbring coffee",
+	}
+
+	t.Run("Scheduled messages reach the room", func(t *testing.T) {
+		if err := schedule.deliver(group, chat.messenger()); err != nil {
+			t.Fatalf("Error delivering schedule: %s", err.Error())
+		}
+
+		sent := chat.sent()
+		if len(sent) != 1 {
+			t.Fatalf("Expected one message sent\nGot: %+v", sent)
+		}
+
+		want := SentMessage{Room: roomGID, Thread: roomGID + "/threads/1", Text: "Sender said:\n\n<users/1> <users/2> standup in 5!\nbring coffee"}
+		if sent[0] != want {
+			t.Fatalf("Incorrect message sent\nGot: %+v\nWanted: %+v", sent[0], want)
+		}
+	})
+
+	t.Run("Restricted groups can be sent in their room", func(t *testing.T) {
+		recorder := &MessageRecorder{}
+		restricted := &Group{Name: "local", IsPrivate: true, PrivacyRoomID: roomGID, Members: []Member{{GID: "users/1"}}}
+
+		schedule.deliver(restricted, recorder)
+
+		if sent := recorder.Messages(); len(sent) != 1 || !strings.Contains(sent[0].Text, "<users/1> standup") {
+			t.Fatalf("Restricted group not notified\nGot: %+v", sent)
+		}
+	})
+
+	t.Run("Errors are returned", func(t *testing.T) {
+		recorder := &MessageRecorder{Err: errors.New("down")}
+
+		if err := schedule.deliver(group, recorder); err == nil {
+			t.Fatal("Error sending not returned")
+		}
+	})
+}
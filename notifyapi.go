@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//APIClient is a service allowed to send notifications through the API, such as
+//a CI pipeline. Only the SHA-256 of its token is kept. Clients can be limited
+//to some groups or rooms, and an empty list allows any. Admin clients can also
+//manage every group and schedule through the admin API.
+type APIClient struct {
+	Name      string   `yaml:"name"`
+	TokenHash string   `yaml:"tokenHash"`
+	Groups    []string `yaml:"groups"`
+	Rooms     []string `yaml:"rooms"`
+	Admin     bool     `yaml:"admin"`
+}
+
+//APIClients holds every client that can use the API
+type APIClients struct {
+	clients []APIClient
+}
+
+//loadAPIClients reads the clients from the YAML file at path, as a list under
+//clients. Without a file no client can use the API, and invalid clients are
+//skipped.
+func loadAPIClients(path string) *APIClients {
+	ac := new(APIClients)
+	if path == "" {
+		return ac
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading API clients, the API is disabled: %s", err.Error())
+		return ac
+	}
+
+	var file struct {
+		Clients []APIClient `yaml:"clients"`
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		log.Printf("Error parsing API clients, the API is disabled: %s", err.Error())
+		return ac
+	}
+
+	for _, client := range file.Clients {
+		if client.Name == "" || len(client.TokenHash) != sha256.Size*2 {
+			log.Printf("Invalid API client %q, it is skipped: expected a name and a SHA-256 tokenHash", client.Name)
+			continue
+		}
+
+		client.TokenHash = strings.ToLower(client.TokenHash)
+		ac.clients = append(ac.clients, client)
+	}
+
+	return ac
+}
+
+//hashToken gives the SHA-256 of the token, as it's kept for a client
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//Authenticate finds the client the token belongs to, or nil if it's unknown
+func (ac *APIClients) Authenticate(token string) *APIClient {
+	if token == "" {
+		return nil
+	}
+
+	hash := []byte(hashToken(token))
+
+	var found *APIClient
+	for i := range ac.clients {
+		if subtle.ConstantTimeCompare(hash, []byte(ac.clients[i].TokenHash)) == 1 {
+			found = &ac.clients[i]
+		}
+	}
+
+	return found
+}
+
+//Allows tells if the client may notify the group in the room
+func (c *APIClient) Allows(groupName, room string) bool {
+	return inScope(c.Groups, groupName) && inScope(c.Rooms, room)
+}
+
+//inScope tells if the value is in the scope, where an empty scope holds anything
+func inScope(scope []string, value string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+
+	for _, allowed := range scope {
+		if strings.EqualFold(allowed, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//bearerToken pulls the token from the request's Authorization header
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+//writeAPIResponse sends the body as JSON with the status given
+func writeAPIResponse(w http.ResponseWriter, status int, body interface{}) {
+	resp, err := json.Marshal(body)
+	checkError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+//decodeAPIBody reads the request's JSON body into body, up to maxAPIBody,
+//replying with an error if it can't
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody)).Decode(body)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body can't be over %d bytes", maxAPIBody))
+		return false
+	}
+
+	writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	return false
+}
+
+//writeAPIError sends the error as JSON with the status given
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIResponse(w, status, map[string]string{"error": msg})
+}
+
+//notifyRequest is the body of a request to the notify API
+type notifyRequest struct {
+	Group  string `json:"group"`
+	Room   string `json:"room"`
+	Thread string `json:"thread"`
+	Text   string `json:"text"`
+}
+
+//maxAPIBody is the most a request to the API may send, so a client can't tie
+//up the bot with a huge body
+const maxAPIBody = 1 << 20
+
+//notifyStatus is the response status for each reason a group can't be notified
+var notifyStatus = map[string]int{
+	NotifyMissing: http.StatusNotFound,
+	NotifyPrivate: http.StatusForbidden,
+	NotifyLimited: http.StatusTooManyRequests,
+	NotifyTooLong: http.StatusRequestEntityTooLarge,
+}
+
+// NotifyAPI returns a handler letting API clients notify a
+// group in a room, the same as mentioning the group in chat
+func NotifyAPI(Groups GroupMgr, clients *APIClients) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+			return
+		}
+
+		client := clients.Authenticate(bearerToken(r))
+		if client == nil {
+			log.Printf("Unauthorized API request received from: %s\n", r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "a valid API token is required")
+			return
+		}
+
+		var req notifyRequest
+		if !decodeAPIBody(w, r, &req) {
+			return
+		}
+
+		req.Group = strings.TrimSpace(req.Group)
+		req.Room = strings.TrimSpace(req.Room)
+		req.Thread = strings.TrimSpace(req.Thread)
+
+		switch {
+		case req.Group == "":
+			writeAPIError(w, http.StatusBadRequest, "group is required")
+			return
+		case !strings.HasPrefix(req.Room, "spaces/"):
+			writeAPIError(w, http.StatusBadRequest, "room is required, such as spaces/AAAA")
+			return
+		case req.Thread != "" && !strings.HasPrefix(req.Thread, req.Room+"/threads/"):
+			writeAPIError(w, http.StatusBadRequest, "thread must be in the room, such as "+req.Room+"/threads/BBBB")
+			return
+		}
+
+		if !client.Allows(req.Group, req.Room) {
+			log.Printf("API client %q refused for group %q in %s", client.Name, req.Group, req.Room)
+			writeAPIError(w, http.StatusForbidden, "this token can't notify that group in that room")
+			return
+		}
+
+		msgObj := messageResponse{}
+		// Mimicking how the message would look from chat
+		msgObj.Message.Text = BotName + " " + req.Group + " " + req.Text
+		msgObj.Message.Sender = User{Name: client.Name, GID: "clients/" + client.Name, Type: "BOT"}
+		msgObj.Room = space{GID: req.Room, Type: "ROOM"}
+
+		stateLock.Lock()
+		msg, err := Groups.Expand(req.Group, msgObj)
+		stateLock.Unlock()
+
+		if err != nil {
+			status := http.StatusUnprocessableEntity
+			if notifyErr, ok := err.(*NotifyError); ok && notifyStatus[notifyErr.Reason] != 0 {
+				status = notifyStatus[notifyErr.Reason]
+			}
+
+			writeAPIError(w, status, err.Error())
+			return
+		}
+
+		if err := Messages.Send(req.Room, req.Thread, msg); err != nil {
+			log.Printf("Error sending notification for API client %q: %s", client.Name, err.Error())
+			writeAPIError(w, http.StatusBadGateway, "the message couldn't be sent to Google Chat")
+			return
+		}
+
+		log.Printf("API client %q notified %q in %s", client.Name, req.Group, req.Room)
+		writeAPIResponse(w, http.StatusOK, map[string]string{
+			"group":  req.Group,
+			"room":   req.Room,
+			"thread": req.Thread,
+			"text":   msg,
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadAPIClients(t *testing.T) {
+	file, err := ioutil.TempFile("", "clients*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString(`clients:
+  - name: jenkins
+    tokenHash: ` + strings.ToUpper(hashToken("jenkins-token")) + `
+    groups: [backend]
+  - name: broken
+    tokenHash: abc
+  - tokenHash: ` + hashToken("nameless") + `
+`)
+	file.Close()
+
+	clients := loadAPIClients(file.Name())
+
+	if len(clients.clients) != 1 {
+		t.Fatalf("Invalid clients should be skipped\nGot: %+v", clients.clients)
+	}
+
+	if client := clients.Authenticate("jenkins-token"); client == nil || client.Name != "jenkins" {
+		t.Fatalf("Token not matched to its client\nGot: %+v", client)
+	}
+
+	for _, token := range []string{"", "nameless", "jenkins-token "} {
+		if client := clients.Authenticate(token); client != nil {
+			t.Fatalf("Token %q should not match a client\nGot: %+v", token, client)
+		}
+	}
+
+	if len(loadAPIClients("").clients) != 0 || len(loadAPIClients("/does/not/exist").clients) != 0 {
+		t.Fatal("Missing files should leave no clients")
+	}
+}
+
+func TestNotifyAPI(t *testing.T) {
+	Logger.Active(false)
+
+	chat := newFakeChat()
+	defer chat.Close()
+
+	messages := Messages
+	defer func() { Messages = messages }()
+	Messages = chat.messenger()
+
+	roomGID := genRoomGID(10)
+	otherRoomGID := genRoomGID(10)
+
+	Groups := GroupMap{
+		"backend":  &Group{Name: "backend", Members: []Member{{GID: "users/1"}, {GID: "users/2"}}},
+		"local":    &Group{Name: "local", IsPrivate: true, PrivacyRoomID: roomGID, Members: []Member{{GID: "users/3"}}},
+		"frontend": &Group{Name: "frontend", Members: []Member{{GID: "users/4"}}},
+	}
+
+	clients := &APIClients{clients: []APIClient{
+		{Name: "jenkins", TokenHash: hashToken("jenkins-token"), Groups: []string{"backend", "local"}},
+		{Name: "alerts", TokenHash: hashToken("alerts-token"), Rooms: []string{otherRoomGID}},
+	}}
+
+	server := httptest.NewServer(NotifyAPI(Groups, clients))
+	defer server.Close()
+
+	post := func(t *testing.T, token string, body interface{}) (int, map[string]string) {
+		data, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewBuffer(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error posting data: %q", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var got map[string]string
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		return resp.StatusCode, got
+	}
+
+	t.Run("Notifies the group in the room and thread", func(t *testing.T) {
+		thread := roomGID + "/threads/1"
+		status, got := post(t, "jenkins-token", notifyRequest{Group: "Backend", Room: roomGID, Thread: thread, Text: "build #42 failed"})
+
+		if status != http.StatusOK {
+			t.Fatalf("Incorrect status %d: %+v", status, got)
+		}
+
+		want := SentMessage{Room: roomGID, Thread: thread, Text: "jenkins said:\n\n<users/1> <users/2> build #42 failed"}
+		if sent := chat.sent(); len(sent) != 1 || sent[0] != want || got["text"] != want.Text {
+			t.Fatalf("Incorrect message sent\nGot: %+v\nWanted: %+v", sent, want)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		body   interface{}
+		status int
+	}{
+		{"Missing token", "", notifyRequest{Group: "backend", Room: roomGID}, http.StatusUnauthorized},
+		{"Unknown token", "nope", notifyRequest{Group: "backend", Room: roomGID}, http.StatusUnauthorized},
+		{"Invalid JSON", "jenkins-token", "backend", http.StatusBadRequest},
+		{"Body too large", "jenkins-token", notifyRequest{Group: "backend", Room: roomGID, Text: strings.Repeat("a", maxAPIBody)}, http.StatusRequestEntityTooLarge},
+		{"Missing group", "jenkins-token", notifyRequest{Room: roomGID}, http.StatusBadRequest},
+		{"Missing room", "jenkins-token", notifyRequest{Group: "backend"}, http.StatusBadRequest},
+		{"Thread in another room", "jenkins-token", notifyRequest{Group: "backend", Room: roomGID, Thread: otherRoomGID + "/threads/1"}, http.StatusBadRequest},
+		{"Group outside the token's scope", "jenkins-token", notifyRequest{Group: "frontend", Room: roomGID}, http.StatusForbidden},
+		{"Room outside the token's scope", "alerts-token", notifyRequest{Group: "backend", Room: roomGID}, http.StatusForbidden},
+		{"Group that doesn't exist", "alerts-token", notifyRequest{Group: "nothere", Room: otherRoomGID}, http.StatusNotFound},
+		{"Restricted group in another room", "jenkins-token", notifyRequest{Group: "local", Room: otherRoomGID}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := len(chat.sent())
+
+			if status, got := post(t, test.token, test.body); status != test.status || got["error"] == "" {
+				t.Fatalf("Incorrect response\nGot: %d %+v\nWanted: %d", status, got, test.status)
+			}
+
+			if len(chat.sent()) != before {
+				t.Fatal("Nothing should be sent")
+			}
+		})
+	}
+
+	t.Run("Restricted group in its room", func(t *testing.T) {
+		if status, got := post(t, "jenkins-token", notifyRequest{Group: "local", Room: roomGID, Text: "hi"}); status != http.StatusOK {
+			t.Fatalf("Incorrect status %d: %+v", status, got)
+		}
+	})
+
+	t.Run("Only POST is allowed", func(t *testing.T) {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("Incorrect status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Failed sends are reported", func(t *testing.T) {
+		chat.failWith = http.StatusInternalServerError
+		defer func() { chat.failWith = 0 }()
+
+		if status, _ := post(t, "alerts-token", notifyRequest{Group: "frontend", Room: otherRoomGID}); status != http.StatusBadGateway {
+			t.Fatalf("Incorrect status %d", status)
+		}
+	})
+}
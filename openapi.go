@@ -0,0 +1,253 @@
+package main
+
+//openAPIDocument describes the notify and admin APIs. It's served at
+///api/v1/openapi.json, and should be kept up to date as the APIs change.
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "HGNotify API",
+    "version": "1.0.0",
+    "description": "Notify groups from other services, and manage groups and scheduled messages. Every endpoint but this document needs an API token sent as a bearer token, and the admin endpoints need an admin token."
+  },
+  "servers": [{"url": "/api/v1"}],
+  "security": [{"bearerToken": []}],
+  "paths": {
+    "/notify": {
+      "post": {
+        "summary": "Notify a group in a room",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NotifyRequest"}}}},
+        "responses": {
+          "200": {"description": "The message was sent", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NotifyResponse"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/groups": {
+      "get": {
+        "summary": "List every group",
+        "responses": {
+          "200": {"description": "Every group", "content": {"application/json": {"schema": {"type": "object", "properties": {"groups": {"type": "array", "items": {"$ref": "#/components/schemas/Group"}}}}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create a group",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "members": {"type": "array", "items": {"$ref": "#/components/schemas/Member"}}}}}}},
+        "responses": {
+          "201": {"$ref": "#/components/responses/GroupChanged"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/groups/{group}": {
+      "parameters": [{"$ref": "#/components/parameters/Group"}],
+      "get": {
+        "summary": "Show a group",
+        "responses": {
+          "200": {"description": "The group", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Group"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Disband a group",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Message"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/groups/{group}/members": {
+      "parameters": [{"$ref": "#/components/parameters/Group"}],
+      "post": {
+        "summary": "Add members to a group",
+        "requestBody": {"$ref": "#/components/requestBodies/Members"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/GroupChanged"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Remove members from a group",
+        "requestBody": {"$ref": "#/components/requestBodies/Members"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/GroupChanged"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/groups/{group}/members/users/{user}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Group"},
+        {"name": "user", "in": "path", "required": true, "description": "The number from the member's users/ GID", "schema": {"type": "string"}}
+      ],
+      "delete": {
+        "summary": "Remove a member from a group",
+        "responses": {
+          "200": {"$ref": "#/components/responses/GroupChanged"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/groups/{group}/privacy": {
+      "parameters": [{"$ref": "#/components/parameters/Group"}],
+      "put": {
+        "summary": "Make a group public, or restrict it to a room",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["private"], "properties": {"private": {"type": "boolean"}, "room": {"type": "string", "example": "spaces/AAAA"}}}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/GroupChanged"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/schedules": {
+      "get": {
+        "summary": "List the upcoming scheduled messages",
+        "parameters": [{"name": "room", "in": "query", "description": "Only list the room's messages", "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "The scheduled messages", "content": {"application/json": {"schema": {"type": "object", "properties": {"schedules": {"type": "array", "items": {"$ref": "#/components/schemas/Schedule"}}}}}}}
+        }
+      },
+      "post": {
+        "summary": "Schedule a message, replacing one with the same label in the room",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Schedule"}}}},
+        "responses": {
+          "201": {"description": "The message was scheduled", "content": {"application/json": {"schema": {"type": "object", "properties": {"message": {"type": "string"}, "schedule": {"$ref": "#/components/schemas/Schedule"}}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/deliveries": {
+      "get": {
+        "summary": "List the latest webhook delivery attempts, oldest first",
+        "responses": {
+          "200": {"description": "The delivery attempts", "content": {"application/json": {"schema": {"type": "object", "properties": {"deliveries": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookDelivery"}}}}}}}
+        }
+      }
+    },
+    "/schedules/spaces/{room}/{label}": {
+      "parameters": [
+        {"name": "room", "in": "path", "required": true, "description": "The ID from the room's spaces/ name", "schema": {"type": "string"}},
+        {"name": "label", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Show a scheduled message",
+        "responses": {
+          "200": {"description": "The scheduled message", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Schedule"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Remove a scheduled message",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Message"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearerToken": {"type": "http", "scheme": "bearer"}
+    },
+    "parameters": {
+      "Group": {"name": "group", "in": "path", "required": true, "schema": {"type": "string"}}
+    },
+    "requestBodies": {
+      "Members": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["members"], "properties": {"members": {"type": "array", "items": {"$ref": "#/components/schemas/Member"}}}}}}}
+    },
+    "responses": {
+      "Error": {"description": "The request failed", "content": {"application/json": {"schema": {"type": "object", "properties": {"error": {"type": "string"}}}}}},
+      "Message": {"description": "What was done, as the bot would say it in chat", "content": {"application/json": {"schema": {"type": "object", "properties": {"message": {"type": "string"}}}}}},
+      "GroupChanged": {"description": "The group after the change, and what was done as the bot would say it in chat", "content": {"application/json": {"schema": {"type": "object", "properties": {"message": {"type": "string"}, "group": {"$ref": "#/components/schemas/Group"}}}}}}
+    },
+    "schemas": {
+      "NotifyRequest": {
+        "type": "object",
+        "required": ["group", "room"],
+        "properties": {
+          "group": {"type": "string"},
+          "room": {"type": "string", "example": "spaces/AAAA"},
+          "thread": {"type": "string", "example": "spaces/AAAA/threads/BBBB"},
+          "text": {"type": "string"}
+        }
+      },
+      "NotifyResponse": {
+        "type": "object",
+        "properties": {
+          "group": {"type": "string"},
+          "room": {"type": "string"},
+          "thread": {"type": "string"},
+          "text": {"type": "string", "description": "The message sent"}
+        }
+      },
+      "Member": {
+        "type": "object",
+        "required": ["gid"],
+        "properties": {
+          "gid": {"type": "string", "example": "users/123"},
+          "name": {"type": "string"}
+        }
+      },
+      "Group": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "members": {"type": "array", "items": {"$ref": "#/components/schemas/Member"}},
+          "private": {"type": "boolean"},
+          "room": {"type": "string", "description": "The room a private group is restricted to"},
+          "roomRemoved": {"type": "boolean", "description": "The bot was removed from the room the group is restricted to"},
+          "managed": {"type": "boolean", "description": "The group is managed by the groups manifest, and can't be changed through the API"}
+        }
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "properties": {
+          "DeliveryID": {"type": "string", "description": "The id of the payload, the same across attempts"},
+          "URL": {"type": "string"},
+          "Event": {"type": "string"},
+          "Attempt": {"type": "integer"},
+          "StatusCode": {"type": "integer"},
+          "Error": {"type": "string"},
+          "Delivered": {"type": "boolean"},
+          "CreatedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Schedule": {
+        "type": "object",
+        "required": ["room", "label", "group", "message", "time"],
+        "properties": {
+          "room": {"type": "string", "example": "spaces/AAAA"},
+          "label": {"type": "string"},
+          "group": {"type": "string"},
+          "message": {"type": "string"},
+          "time": {"type": "string", "format": "date-time"},
+          "recurring": {"type": "boolean", "description": "Sent weekly from the time given"},
+          "thread": {"type": "string", "example": "spaces/AAAA/threads/BBBB"},
+          "creator": {"type": "string", "readOnly": true},
+          "paused": {"type": "boolean", "readOnly": true}
+        }
+      }
+    }
+  }
+}`
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//The scopes a notification can be rate limited in
+const (
+	LimitSender = "sender"
+	LimitGroup  = "group"
+	LimitRoom   = "room"
+)
+
+//rateSweepInterval is how often counters whose window has reset are dropped, so
+//senders, groups, and rooms that stopped notifying don't stay in memory.
+const rateSweepInterval = time.Minute
+
+//RateLimit is how many notifications are allowed in a window of time
+type RateLimit struct {
+	Count  int
+	Window time.Duration
+}
+
+//RateCounter defines the database schema for a rate limit counter. Keeping
+//them in the database means restarting the bot doesn't reset the limits.
+type RateCounter struct {
+	Key     string    `gorm:"primary_key"`
+	Count   int       `gorm:"not null"`
+	ResetAt time.Time `gorm:"not null;index"`
+}
+
+//RateLimiter counts the notifications sent by each sender, to each group, and
+//in each room, and turns them away once a limit is hit until its window resets.
+type RateLimiter struct {
+	limits map[string]RateLimit
+	now    func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*RateCounter
+	sweptAt  time.Time
+}
+
+//newRateLimiter sets up the limits from the bot's configuration. Limits are
+//written as count/window, such as 5/1m. An empty or invalid limit leaves that
+//scope unlimited.
+func newRateLimiter(conf HGNConfig) *RateLimiter {
+	rl := &RateLimiter{
+		limits:   make(map[string]RateLimit),
+		now:      time.Now,
+		counters: make(map[string]*RateCounter),
+	}
+
+	configured := map[string]string{
+		LimitSender: conf.RateLimitSender,
+		LimitGroup:  conf.RateLimitGroup,
+		LimitRoom:   conf.RateLimitRoom,
+	}
+
+	for scope, value := range configured {
+		if value == "" {
+			continue
+		}
+
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			log.Printf("Invalid %s rate limit %q, it is disabled: %s", scope, value, err)
+			continue
+		}
+
+		rl.limits[scope] = limit
+	}
+
+	return rl
+}
+
+//parseRateLimit reads a limit written as count/window
+func parseRateLimit(value string) (RateLimit, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("expected count/window")
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return RateLimit{}, fmt.Errorf("count must be a positive number")
+	}
+
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("window must be a positive duration")
+	}
+
+	return RateLimit{Count: count, Window: window}, nil
+}
+
+//Load places already persisted counters in the limiter without saving them
+//again. This is used when the counters are pulled from the database at startup.
+func (rl *RateLimiter) Load(counters []RateCounter) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for i := range counters {
+		rl.counters[counters[i].Key] = &counters[i]
+	}
+}
+
+//Allow checks the notification against every limit. If any of them have been
+//hit, nothing is counted and the scope that was hit is returned along with how
+//long until it resets. Admins are never limited, and neither are scheduled
+//messages, since they have no sender and were allowed when they were set up.
+func (rl *RateLimiter) Allow(saveName string, msgObj messageResponse) (scope string, wait time.Duration) {
+	sender := msgObj.Message.Sender.GID
+
+	if len(rl.limits) == 0 || sender == "" || Roles.IsAdmin(sender) {
+		return "", 0
+	}
+
+	keys := map[string]string{
+		LimitSender: LimitSender + ":" + sender,
+		LimitGroup:  LimitGroup + ":" + saveName,
+		LimitRoom:   LimitRoom + ":" + msgObj.Room.GID,
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	for limitScope, limit := range rl.limits {
+		counter := rl.counter(keys[limitScope], now)
+
+		if counter.Count >= limit.Count && counter.ResetAt.Sub(now) > wait {
+			scope = limitScope
+			wait = counter.ResetAt.Sub(now)
+		}
+	}
+
+	if scope != "" {
+		return
+	}
+
+	for limitScope, limit := range rl.limits {
+		counter := rl.counter(keys[limitScope], now)
+
+		if counter.Count == 0 {
+			counter.ResetAt = now.Add(limit.Window)
+		}
+		counter.Count++
+
+		saved := *counter
+		go Logger.SaveRateCounter(&saved)
+	}
+
+	return
+}
+
+//sweep drops the counters whose window has reset, at most once every
+//rateSweepInterval, and clears them out of the database as well.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.sweptAt) < rateSweepInterval {
+		return
+	}
+	rl.sweptAt = now
+
+	for key, counter := range rl.counters {
+		if !now.Before(counter.ResetAt) {
+			delete(rl.counters, key)
+		}
+	}
+
+	go Logger.PruneRateCounters(now)
+}
+
+//counter returns the counter for the key, starting it over if its window has
+//already reset.
+func (rl *RateLimiter) counter(key string, now time.Time) *RateCounter {
+	counter, exist := rl.counters[key]
+
+	if !exist || !now.Before(counter.ResetAt) {
+		counter = &RateCounter{Key: key}
+		rl.counters[key] = counter
+	}
+
+	return counter
+}
+
+//CooldownMessage tells the sender which limit they hit and when they can try
+//again.
+func (rl *RateLimiter) CooldownMessage(groupName, scope string, wait time.Duration) string {
+	limit := rl.limits[scope]
+	wait = wait.Round(time.Second)
+
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	switch scope {
+	case LimitGroup:
+		return fmt.Sprintf("Slow down! The group %q can only be notified %d times every %s. Please try again in %s.", groupName, limit.Count, limit.Window, wait)
+	case LimitRoom:
+		return fmt.Sprintf("Slow down! This room can only send %d notifications every %s. Please try again in %s.", limit.Count, limit.Window, wait)
+	default:
+		return fmt.Sprintf("Slow down! You can only send %d notifications every %s. Please try again in %s.", limit.Count, limit.Window, wait)
+	}
+}
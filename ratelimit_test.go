@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	testCases := []struct {
+		value   string
+		wanted  RateLimit
+		wantErr bool
+	}{
+		{"5/1m", RateLimit{Count: 5, Window: time.Minute}, false},
+		{"100/24h", RateLimit{Count: 100, Window: time.Hour * 24}, false},
+		{"5", RateLimit{}, true},
+		{"0/1m", RateLimit{}, true},
+		{"five/1m", RateLimit{}, true},
+		{"5/soon", RateLimit{}, true},
+		{"5/-1m", RateLimit{}, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseRateLimit(tc.value)
+
+		if tc.wantErr != (err != nil) {
+			t.Errorf("Unexpected error result for %q: %v", tc.value, err)
+			continue
+		}
+
+		if got != tc.wanted {
+			t.Errorf("Incorrect limit for %q\nWanted: %+v\nGot: %+v", tc.value, tc.wanted, got)
+		}
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	rl := newRateLimiter(HGNConfig{
+		RateLimitSender: "5/1m",
+		RateLimitRoom:   "not a limit",
+	})
+
+	if rl.limits[LimitSender] != (RateLimit{Count: 5, Window: time.Minute}) {
+		t.Fatalf("Sender limit not set\nGot: %+v", rl.limits)
+	}
+
+	if _, exist := rl.limits[LimitRoom]; exist {
+		t.Fatal("Invalid room limit should be disabled")
+	}
+
+	if _, exist := rl.limits[LimitGroup]; exist {
+		t.Fatal("Unset group limit should be disabled")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	Logger.Active(false)
+
+	now := time.Now()
+
+	newLimiter := func(conf HGNConfig) *RateLimiter {
+		rl := newRateLimiter(conf)
+		rl.now = func() time.Time { return now }
+		return rl
+	}
+
+	newMsg := func() messageResponse {
+		return messageResponse{
+			Message: message{Sender: User{GID: genUserGID(0)}},
+			Room:    space{GID: genRoomGID(0)},
+		}
+	}
+
+	t.Run("Limits the sender", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitSender: "2/1m"})
+		msgObj := newMsg()
+
+		for i := 0; i < 2; i++ {
+			if scope, _ := rl.Allow("oncall", msgObj); scope != "" {
+				t.Fatalf("Notification %d should be allowed", i+1)
+			}
+		}
+
+		scope, wait := rl.Allow("oncall", msgObj)
+		if scope != LimitSender || wait != time.Minute {
+			t.Fatalf("Sender should be limited\nGot scope %q, wait %s", scope, wait)
+		}
+
+		if scope, _ := rl.Allow("oncall", newMsg()); scope != "" {
+			t.Fatal("Another sender should not be limited")
+		}
+	})
+
+	t.Run("Limits the group across senders", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitGroup: "1/1h"})
+
+		rl.Allow("oncall", newMsg())
+
+		if scope, _ := rl.Allow("oncall", newMsg()); scope != LimitGroup {
+			t.Fatalf("Group should be limited, got scope %q", scope)
+		}
+
+		if scope, _ := rl.Allow("frontend", newMsg()); scope != "" {
+			t.Fatal("Another group should not be limited")
+		}
+	})
+
+	t.Run("Limits the room across senders", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitRoom: "1/1h"})
+		first, second := newMsg(), newMsg()
+		second.Room = first.Room
+
+		rl.Allow("oncall", first)
+
+		if scope, _ := rl.Allow("frontend", second); scope != LimitRoom {
+			t.Fatalf("Room should be limited, got scope %q", scope)
+		}
+	})
+
+	t.Run("Resets once the window passes", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitSender: "1/1m"})
+		msgObj := newMsg()
+
+		rl.Allow("oncall", msgObj)
+
+		rl.now = func() time.Time { return now.Add(time.Minute) }
+
+		if scope, _ := rl.Allow("oncall", msgObj); scope != "" {
+			t.Fatal("Sender should be allowed once the window resets")
+		}
+	})
+
+	t.Run("Counters are dropped once they reset", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitSender: "1/1m"})
+
+		rl.Allow("oncall", newMsg())
+		rl.Allow("oncall", newMsg())
+
+		rl.now = func() time.Time { return now.Add(time.Minute) }
+		rl.Allow("oncall", newMsg())
+
+		if len(rl.counters) != 1 {
+			t.Fatalf("Reset counters should be dropped\nGot: %d counters", len(rl.counters))
+		}
+	})
+
+	t.Run("Turned away notifications aren't counted", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitSender: "1/1m", RateLimitGroup: "2/1m"})
+		msgObj := newMsg()
+
+		rl.Allow("oncall", msgObj)
+		rl.Allow("oncall", msgObj)
+
+		if scope, _ := rl.Allow("oncall", newMsg()); scope != "" {
+			t.Fatal("Group should not count the notification that was turned away")
+		}
+	})
+
+	t.Run("Admins are exempt", func(t *testing.T) {
+		rl := newLimiter(HGNConfig{RateLimitSender: "1/1m"})
+		msgObj := newMsg()
+		MasterID = msgObj.Message.Sender.GID
+
+		rl.Allow("oncall", msgObj)
+
+		if scope, _ := rl.Allow("oncall", msgObj); scope != "" {
+			t.Fatal("Admin should not be limited")
+		}
+	})
+
+	t.Run("Counters survive a restart", func(t *testing.T) {
+		msgObj := newMsg()
+
+		rl := newLimiter(HGNConfig{RateLimitSender: "1/1m"})
+		rl.Load([]RateCounter{{
+			Key:     LimitSender + ":" + msgObj.Message.Sender.GID,
+			Count:   1,
+			ResetAt: now.Add(time.Second * 30),
+		}})
+
+		scope, wait := rl.Allow("oncall", msgObj)
+		if scope != LimitSender || wait != time.Second*30 {
+			t.Fatalf("Loaded counter should limit the sender\nGot scope %q, wait %s", scope, wait)
+		}
+	})
+}
+
+func TestNotifyRateLimited(t *testing.T) {
+	Logger.Active(false)
+
+	limiter := Limiter
+	defer func() { Limiter = limiter }()
+
+	Limiter = newRateLimiter(HGNConfig{RateLimitGroup: "1/1m"})
+
+	Groups := make(GroupMap)
+	groupName := genRandName(10)
+	Groups[strings.ToLower(groupName)] = &Group{Name: groupName}
+
+	msgObj := messageResponse{
+		Message: message{
+			Sender: User{Name: genRandName(10), GID: genUserGID(0)},
+			Text:   BotName + " " + groupName + " hello",
+		},
+		Room: space{GID: genRoomGID(0)},
+	}
+
+	if text := Groups.Notify(groupName, msgObj); strings.Contains(text, "Slow down") {
+		t.Fatalf("First notification should be sent\nGot: %q", text)
+	}
+
+	if text := Groups.Notify(groupName, msgObj); !strings.Contains(text, "Slow down! The group") {
+		t.Fatalf("Second notification should get a cooldown message\nGot: %q", text)
+	}
+}
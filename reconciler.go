@@ -0,0 +1,239 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//The directions the reconciler is able to repair drift in. With
+//ReconcileReport nothing is repaired, the drift is only logged.
+const (
+	ReconcileStoreToMemory = "store-to-memory"
+	ReconcileMemoryToStore = "memory-to-store"
+	ReconcileReport        = "report"
+)
+
+//Discrepancy describes a single difference found between the groups in
+//memory and the groups in the database.
+type Discrepancy struct {
+	GroupName string `json:"group"`
+	Kind      string `json:"kind"`
+	Detail    string `json:"detail"`
+	Repaired  bool   `json:"repaired"`
+}
+
+//Reconciler periodically compares the in-memory groups against the database
+//and repairs any drift in the configured direction.
+type Reconciler struct {
+	Groups    GroupMap
+	Interval  time.Duration
+	Direction string
+
+	mu      sync.Mutex
+	lastRun time.Time
+	found   []Discrepancy
+}
+
+//newReconciler sets up a reconciler from the bot's configuration. An empty or
+//invalid interval leaves the reconciler disabled, and an empty or invalid
+//direction only reports drift.
+func newReconciler(groups GroupMap, conf HGNConfig) *Reconciler {
+	r := &Reconciler{
+		Groups:    groups,
+		Direction: conf.ReconcileDirection,
+	}
+
+	switch r.Direction {
+	case ReconcileStoreToMemory, ReconcileMemoryToStore, ReconcileReport:
+	case "":
+		r.Direction = ReconcileReport
+	default:
+		log.Printf("Invalid reconcile direction %q, drift is only reported: expected %s, %s, or %s",
+			conf.ReconcileDirection, ReconcileStoreToMemory, ReconcileMemoryToStore, ReconcileReport)
+		r.Direction = ReconcileReport
+	}
+
+	if conf.ReconcileInterval != "" {
+		interval, err := time.ParseDuration(conf.ReconcileInterval)
+		if err != nil {
+			log.Printf("Invalid reconcile interval %q, the reconciler is disabled: %s", conf.ReconcileInterval, err)
+		} else {
+			r.Interval = interval
+		}
+	}
+
+	return r
+}
+
+//Start runs the reconciler in the background on every interval. It does
+//nothing if the reconciler is disabled.
+func (r *Reconciler) Start() {
+	if r.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			r.Run()
+		}
+	}()
+}
+
+//Run loads the groups from the database and reconciles them with the groups
+//in memory. The groups are read while holding stateLock, once the saves still
+//running in the background have finished, so a group changed just before the
+//pass isn't mistaken for drift.
+func (r *Reconciler) Run() []Discrepancy {
+	if !Logger.isActive {
+		return nil
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	pendingSaves.Wait()
+
+	store := make(GroupMap)
+	Logger.GetGroupsFromDB(store)
+
+	return r.reconcile(store)
+}
+
+//Status returns when the reconciler last ran, and what it found
+func (r *Reconciler) Status() (time.Time, []Discrepancy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastRun, r.found
+}
+
+//reconcile detects the drift between the in-memory groups and the given store
+//groups, logs each discrepancy, and repairs it unless only reporting. The
+//caller must hold stateLock.
+func (r *Reconciler) reconcile(store GroupMap) []Discrepancy {
+	found := detectDrift(r.Groups, store)
+
+	for i := range found {
+		if r.Direction != ReconcileReport {
+			r.repair(&found[i], store)
+		}
+
+		log.Printf("Reconciler found %s drift for group %q: %s (repaired: %t)",
+			found[i].Kind,
+			found[i].GroupName,
+			found[i].Detail,
+			found[i].Repaired,
+		)
+	}
+
+	r.mu.Lock()
+	r.lastRun = time.Now()
+	r.found = found
+	r.mu.Unlock()
+
+	return found
+}
+
+//detectDrift compares the groups in memory to the groups in the store.
+func detectDrift(memory, store GroupMap) (found []Discrepancy) {
+	for saveName, group := range memory {
+		storeGroup, exist := store[saveName]
+		if !exist {
+			found = append(found, Discrepancy{
+				GroupName: saveName,
+				Kind:      "missing-in-store",
+				Detail:    "group exists in memory but not in the database",
+			})
+			continue
+		}
+
+		if diff := diffMembers(group.Name, group.Members, storeGroup.Members); diff.HasChanges() {
+			found = append(found, Discrepancy{
+				GroupName: saveName,
+				Kind:      "members",
+				Detail:    strings.Replace(diff.String(), "\n", "", -1),
+			})
+		}
+
+		if group.IsPrivate != storeGroup.IsPrivate || group.PrivacyRoomID != storeGroup.PrivacyRoomID {
+			found = append(found, Discrepancy{
+				GroupName: saveName,
+				Kind:      "privacy",
+				Detail:    "privacy settings differ between memory and the database",
+			})
+		}
+	}
+
+	for saveName := range store {
+		if _, exist := memory[saveName]; !exist {
+			found = append(found, Discrepancy{
+				GroupName: saveName,
+				Kind:      "missing-in-memory",
+				Detail:    "group exists in the database but not in memory",
+			})
+		}
+	}
+
+	return
+}
+
+//repair fixes a single discrepancy in the reconciler's direction
+func (r *Reconciler) repair(d *Discrepancy, store GroupMap) {
+	memoryGroup := r.Groups[d.GroupName]
+	storeGroup := store[d.GroupName]
+
+	switch r.Direction {
+	case ReconcileStoreToMemory:
+		switch d.Kind {
+		case "missing-in-store":
+			delete(r.Groups, d.GroupName)
+		case "missing-in-memory":
+			r.Groups[d.GroupName] = storeGroup
+		case "members":
+			memoryGroup.Members = storeGroup.Members
+		case "privacy":
+			memoryGroup.IsPrivate = storeGroup.IsPrivate
+			memoryGroup.PrivacyRoomID = storeGroup.PrivacyRoomID
+		}
+
+	case ReconcileMemoryToStore:
+		switch d.Kind {
+		case "missing-in-store":
+			memoryGroup.ID = 0
+			for i := range memoryGroup.Members {
+				memoryGroup.Members[i].ID = 0
+				memoryGroup.Members[i].GroupID = 0
+			}
+			Logger.SaveCreatedGroup(memoryGroup)
+		case "missing-in-memory":
+			Logger.DisbandGroup(storeGroup)
+		case "members":
+			diff := diffMembers(memoryGroup.Name, memoryGroup.Members, storeGroup.Members)
+
+			Logger.SaveMemberRemoval(storeGroup, diff.Added)
+
+			saved := Logger.SaveMembers(storeGroup, diff.Removed)
+			for _, member := range saved {
+				for i := range memoryGroup.Members {
+					if memoryGroup.Members[i].GID == member.GID {
+						memoryGroup.Members[i] = member
+					}
+				}
+			}
+		case "privacy":
+			storeGroup.IsPrivate = memoryGroup.IsPrivate
+			storeGroup.PrivacyRoomID = memoryGroup.PrivacyRoomID
+			Logger.UpdatePrivacyDB(storeGroup)
+		}
+
+	default:
+		return
+	}
+
+	d.Repaired = true
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDetectDrift(t *testing.T) {
+	sharedGID := genUserGID(0)
+
+	memory := GroupMap{
+		"memoryonly": &Group{Name: "memoryonly"},
+		"members":    &Group{Name: "members", Members: []Member{{GID: sharedGID}}},
+		"privacy":    &Group{Name: "privacy", IsPrivate: true, PrivacyRoomID: genRoomGID(0)},
+		"insync":     &Group{Name: "insync", Members: []Member{{GID: sharedGID}}},
+	}
+
+	store := GroupMap{
+		"storeonly": &Group{Name: "storeonly"},
+		"members":   &Group{Name: "members", Members: []Member{{GID: genUserGID(0)}}},
+		"privacy":   &Group{Name: "privacy"},
+		"insync":    &Group{Name: "insync", Members: []Member{{GID: sharedGID}}},
+	}
+
+	t.Run("Finds each kind of drift", func(t *testing.T) {
+		found := detectDrift(memory, store)
+
+		wantedKinds := map[string]string{
+			"memoryonly": "missing-in-store",
+			"storeonly":  "missing-in-memory",
+			"members":    "members",
+			"privacy":    "privacy",
+		}
+
+		if len(found) != len(wantedKinds) {
+			t.Fatalf("Incorrect number of discrepancies\nWanted: %d\nGot: %+v", len(wantedKinds), found)
+		}
+
+		for _, d := range found {
+			if wantedKinds[d.GroupName] != d.Kind {
+				t.Errorf("Incorrect discrepancy for %q\nWanted: %q\nGot: %q",
+					d.GroupName,
+					wantedKinds[d.GroupName],
+					d.Kind,
+				)
+			}
+		}
+	})
+}
+
+func TestReconcileStoreToMemory(t *testing.T) {
+	Logger.Active(false)
+
+	wantedGID := genUserGID(0)
+
+	memory := GroupMap{
+		"memoryonly": &Group{Name: "memoryonly"},
+		"members":    &Group{Name: "members", Members: []Member{{GID: genUserGID(0)}}},
+	}
+
+	store := GroupMap{
+		"storeonly": &Group{Name: "storeonly"},
+		"members":   &Group{Name: "members", Members: []Member{{GID: wantedGID}}},
+	}
+
+	r := &Reconciler{Groups: memory, Direction: ReconcileStoreToMemory}
+
+	t.Run("Repairs memory from the store", func(t *testing.T) {
+		found := r.reconcile(store)
+
+		for _, d := range found {
+			if !d.Repaired {
+				t.Errorf("Discrepancy not repaired: %+v", d)
+			}
+		}
+
+		if _, exist := memory["memoryonly"]; exist {
+			t.Error("Group missing from the store should be removed from memory")
+		}
+
+		if _, exist := memory["storeonly"]; !exist {
+			t.Error("Group missing from memory should be loaded from the store")
+		}
+
+		if len(memory["members"].Members) != 1 || memory["members"].Members[0].GID != wantedGID {
+			t.Errorf("Members not synced from the store\nGot: %+v", memory["members"].Members)
+		}
+	})
+
+	t.Run("Nothing left to repair", func(t *testing.T) {
+		if found := r.reconcile(store); len(found) != 0 {
+			t.Fatalf("Should not find drift after repairing\nGot: %+v", found)
+		}
+	})
+}
+
+func TestReconcileReport(t *testing.T) {
+	Logger.Active(false)
+
+	memory := GroupMap{"memoryonly": &Group{Name: "memoryonly"}}
+	r := &Reconciler{Groups: memory, Direction: ReconcileReport}
+
+	t.Run("Only reports drift", func(t *testing.T) {
+		found := r.reconcile(GroupMap{})
+
+		if len(found) != 1 || found[0].Repaired {
+			t.Fatalf("Drift should be found but not repaired\nGot: %+v", found)
+		}
+
+		if _, exist := memory["memoryonly"]; !exist {
+			t.Fatal("Report mode should not change memory")
+		}
+
+		if lastRun, _ := r.Status(); lastRun.IsZero() {
+			t.Fatal("Last run not recorded")
+		}
+	})
+}
+
+func TestNewReconciler(t *testing.T) {
+	t.Run("Parses configuration", func(t *testing.T) {
+		r := newReconciler(GroupMap{}, HGNConfig{
+			ReconcileInterval:  "15m",
+			ReconcileDirection: ReconcileMemoryToStore,
+		})
+
+		if r.Interval != time.Minute*15 || r.Direction != ReconcileMemoryToStore {
+			t.Fatalf("Configuration not parsed\nGot: %+v", r)
+		}
+	})
+
+	t.Run("Defaults to reporting and disabled", func(t *testing.T) {
+		r := newReconciler(GroupMap{}, HGNConfig{ReconcileInterval: "not a duration"})
+
+		if r.Interval != 0 || r.Direction != ReconcileReport {
+			t.Fatalf("Incorrect defaults\nGot: %+v", r)
+		}
+
+		if r := newReconciler(GroupMap{}, HGNConfig{ReconcileDirection: "sideways"}); r.Direction != ReconcileReport {
+			t.Fatalf("Invalid direction should only report\nGot: %q", r.Direction)
+		}
+	})
+}
+
+func TestReconcilerStatus(t *testing.T) {
+	Logger.Active(false)
+
+	r := &Reconciler{Groups: GroupMap{"memoryonly": &Group{Name: "memoryonly"}}, Direction: ReconcileReport}
+	r.reconcile(GroupMap{})
+
+	clients := &APIClients{clients: []APIClient{
+		{Name: "ops", TokenHash: hashToken("admin-token"), Admin: true},
+		{Name: "jenkins", TokenHash: hashToken("jenkins-token")},
+	}}
+
+	server := httptest.NewServer(ReconcilerStatus(r, clients))
+	defer server.Close()
+
+	getStatus := func(t *testing.T, token string) (status struct {
+		Counts        map[string]int `json:"counts"`
+		Discrepancies []Discrepancy  `json:"discrepancies"`
+	}) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error getting reconciler route: %q", err.Error())
+		}
+
+		respText, _ := ioutil.ReadAll(resp.Body)
+		defer resp.Body.Close()
+
+		if err := json.Unmarshal(respText, &status); err != nil {
+			t.Fatalf("Invalid json returned: %q", string(respText))
+		}
+
+		return
+	}
+
+	t.Run("Only counts discrepancies without an admin token", func(t *testing.T) {
+		for _, token := range []string{"", "jenkins-token"} {
+			status := getStatus(t, token)
+
+			if status.Counts["missing-in-store"] != 1 || status.Discrepancies != nil {
+				t.Fatalf("Incorrect status returned\nGot: %+v", status)
+			}
+		}
+	})
+
+	t.Run("Exposes discrepancies to admins", func(t *testing.T) {
+		status := getStatus(t, "admin-token")
+
+		if len(status.Discrepancies) != 1 || status.Discrepancies[0].GroupName != "memoryonly" {
+			t.Fatalf("Incorrect discrepancies returned\nGot: %+v", status)
+		}
+	})
+}
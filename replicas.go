@@ -0,0 +1,262 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//How long a replica holds on to the scheduler lease before it has to renew
+//it, and how often the change feed is checked for edits from other replicas.
+//Each check reaches back changeOverlap before the last one, since entries can
+//be committed out of order, and the replicas' clocks may drift apart.
+const (
+	leaseTTL           = time.Second * 30
+	changePollInterval = time.Second * 5
+	changeOverlap      = time.Minute
+	changeRetention    = time.Hour * 24
+
+	schedulerLeaseName = "scheduler"
+)
+
+//SchedulerLease is the lease a replica needs to hold to send scheduled
+//messages. When it's nil there's only the one replica, and it always owns the
+//scheduler.
+var SchedulerLease *LeaderElector
+
+//Lease defines the database schema for a lease shared between replicas. Only
+//the holder may act on the lease until it expires.
+type Lease struct {
+	Name      string    `gorm:"primary_key"`
+	Holder    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+//ChangeLog defines the database schema for the change feed. Each entry notes a
+//group or schedule that was changed, and by which replica.
+type ChangeLog struct {
+	ID        uint   `gorm:"primary_key"`
+	Replica   string `gorm:"not null"`
+	Kind      string `gorm:"not null"`
+	Key       string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+//LeaderElector keeps trying to hold a lease in the database. OnElected and
+//OnDemoted are called whenever the replica gains or loses the lease.
+type LeaderElector struct {
+	Name   string
+	Holder string
+	TTL    time.Duration
+
+	OnElected func()
+	OnDemoted func()
+
+	mu   sync.Mutex
+	held bool
+	stop chan struct{}
+}
+
+//newLeaderElector sets up an elector for the named lease
+func newLeaderElector(name, holder string) *LeaderElector {
+	return &LeaderElector{
+		Name:   name,
+		Holder: holder,
+		TTL:    leaseTTL,
+		stop:   make(chan struct{}),
+	}
+}
+
+//Held tells if this replica currently holds the lease
+func (le *LeaderElector) Held() bool {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	return le.held
+}
+
+//TryAcquire takes or renews the lease and calls the matching hook if the
+//replica's leadership changed.
+func (le *LeaderElector) TryAcquire() bool {
+	held := Logger.AcquireLease(le.Name, le.Holder, le.TTL)
+
+	le.mu.Lock()
+	changed := held != le.held
+	le.held = held
+	le.mu.Unlock()
+
+	if changed && held {
+		log.Printf("Replica %q acquired the %q lease", le.Holder, le.Name)
+
+		if le.OnElected != nil {
+			le.OnElected()
+		}
+	}
+
+	if changed && !held {
+		log.Printf("Replica %q lost the %q lease", le.Holder, le.Name)
+
+		if le.OnDemoted != nil {
+			le.OnDemoted()
+		}
+	}
+
+	return held
+}
+
+//Start tries for the lease right away, then keeps renewing it in the
+//background well before it would expire.
+func (le *LeaderElector) Start() {
+	le.TryAcquire()
+
+	go func() {
+		ticker := time.NewTicker(le.TTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if le.TryAcquire() {
+					Logger.PruneChanges(changeRetention)
+				}
+			case <-le.stop:
+				return
+			}
+		}
+	}()
+}
+
+//Stop quits renewing the lease and gives it up so another replica can take
+//over right away.
+func (le *LeaderElector) Stop() {
+	close(le.stop)
+	Logger.ReleaseLease(le.Name, le.Holder)
+
+	le.mu.Lock()
+	wasHeld := le.held
+	le.held = false
+	le.mu.Unlock()
+
+	if wasHeld && le.OnDemoted != nil {
+		le.OnDemoted()
+	}
+}
+
+//ownsScheduler tells if this replica is the one that should be sending
+//scheduled messages. A replica that hasn't won the lease yet doesn't own it.
+//The owner also applies the groups manifest and runs the directory and room
+//syncs, and the other replicas pick up their changes from the change feed.
+func ownsScheduler() bool {
+	return SchedulerLease == nil || SchedulerLease.Held()
+}
+
+//ChangeFeed follows the change log so edits made on other replicas show up in
+//this replica's groups, schedules, and roles.
+type ChangeFeed struct {
+	Replica   string
+	Groups    GroupMap
+	Schedules ScheduleMap
+
+	polledAt time.Time
+	seen     map[uint]time.Time
+}
+
+//newChangeFeed starts following the change log from now, since everything
+//before that was loaded from the database at startup. The first poll still
+//reaches back over the overlap, but reloading a group or schedule twice is
+//harmless.
+func newChangeFeed(replica string, groups GroupMap, schedules ScheduleMap) *ChangeFeed {
+	return &ChangeFeed{
+		Replica:   replica,
+		Groups:    groups,
+		Schedules: schedules,
+		polledAt:  time.Now(),
+		seen:      make(map[uint]time.Time),
+	}
+}
+
+//Start polls the change feed in the background
+func (cf *ChangeFeed) Start() {
+	go func() {
+		for range time.Tick(changePollInterval) {
+			cf.Poll()
+		}
+	}()
+}
+
+//Poll applies every change made by other replicas since the last poll, and
+//returns how many were applied. Entries already applied are remembered until
+//they fall out of the overlap, so each one is only applied once.
+func (cf *ChangeFeed) Poll() int {
+	var applied int
+
+	now := time.Now()
+	since := cf.polledAt.Add(-changeOverlap)
+
+	for _, change := range Logger.GetChangesSince(since) {
+		if _, seen := cf.seen[change.ID]; seen {
+			continue
+		}
+
+		cf.seen[change.ID] = change.CreatedAt
+
+		if change.Replica == cf.Replica {
+			continue
+		}
+
+		stateLock.Lock()
+		switch change.Kind {
+		case "group":
+			cf.reloadGroup(change.Key)
+		case "schedule":
+			cf.reloadSchedule(change.Key)
+		case "role":
+			Logger.GetRolesFromDB(Roles)
+		}
+		stateLock.Unlock()
+
+		applied++
+	}
+
+	cf.polledAt = now
+
+	for id, createdAt := range cf.seen {
+		if createdAt.Before(now.Add(-changeOverlap)) {
+			delete(cf.seen, id)
+		}
+	}
+
+	return applied
+}
+
+//reloadGroup replaces the in-memory group with the one in the database. The
+//group is swapped for the new one rather than overwritten, since saves still
+//running in the background hold on to the old one.
+func (cf *ChangeFeed) reloadGroup(saveName string) {
+	group := Logger.GetGroupByName(saveName)
+
+	if group == nil {
+		delete(cf.Groups, saveName)
+		return
+	}
+
+	cf.Groups[strings.ToLower(group.Name)] = group
+}
+
+//reloadSchedule replaces the in-memory schedule with the one in the database.
+//Finished or removed schedules are stopped and dropped.
+func (cf *ChangeFeed) reloadSchedule(schedKey string) {
+	if existing, exist := cf.Schedules[schedKey]; exist {
+		existing.stopTimer()
+		delete(cf.Schedules, schedKey)
+	}
+
+	schedule := Logger.GetScheduleByKey(schedKey)
+	if schedule == nil {
+		return
+	}
+
+	schedule.StartTimer()
+	cf.Schedules[schedule.Key()] = schedule
+}
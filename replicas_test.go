@@ -0,0 +1,223 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeaderElectorHooks(t *testing.T) {
+	Logger.Active(false)
+
+	var elected, demoted int
+
+	leader := newLeaderElector("scheduler", "replica")
+	leader.OnElected = func() { elected++ }
+	leader.OnDemoted = func() { demoted++ }
+
+	t.Run("Elected once when lease is acquired", func(t *testing.T) {
+		leader.TryAcquire()
+		leader.TryAcquire()
+
+		if !leader.Held() || elected != 1 {
+			t.Fatalf("Incorrect election\nHeld: %t\nElected: %d", leader.Held(), elected)
+		}
+	})
+
+	t.Run("Demoted when stopped", func(t *testing.T) {
+		leader.Stop()
+
+		if leader.Held() || demoted != 1 {
+			t.Fatalf("Incorrect demotion\nHeld: %t\nDemoted: %d", leader.Held(), demoted)
+		}
+	})
+}
+
+func TestOwnsScheduler(t *testing.T) {
+	defer func() { SchedulerLease = nil }()
+
+	t.Run("Single replica always owns the scheduler", func(t *testing.T) {
+		SchedulerLease = nil
+
+		if !ownsScheduler() {
+			t.Fatal("Should own the scheduler without a lease")
+		}
+	})
+
+	t.Run("Follower does not start timers", func(t *testing.T) {
+		SchedulerLease = newLeaderElector("scheduler", "follower")
+
+		schedule := &Schedule{ExecuteOn: time.Now().Add(time.Hour)}
+		schedule.StartTimer()
+
+		if schedule.timer != nil {
+			t.Fatal("Timer should not be started without the lease")
+		}
+	})
+}
+
+func TestReplicaLease(t *testing.T) {
+	Logger.Active(true)
+	defer Logger.Active(false)
+
+	leaseName := "test-" + RandString(10)
+
+	leaderA := newLeaderElector(leaseName, "replica-a")
+	leaderA.TTL = time.Second * 2
+
+	leaderB := newLeaderElector(leaseName, "replica-b")
+	leaderB.TTL = time.Second * 2
+
+	t.Run("Only one replica holds the lease", func(t *testing.T) {
+		if !leaderA.TryAcquire() {
+			t.Fatal("First replica should get the lease")
+		}
+
+		if leaderB.TryAcquire() {
+			t.Fatal("Second replica should not get a held lease")
+		}
+
+		if !leaderA.TryAcquire() {
+			t.Fatal("Holder should be able to renew the lease")
+		}
+	})
+
+	t.Run("Released lease moves to the other replica", func(t *testing.T) {
+		Logger.ReleaseLease(leaseName, "replica-a")
+
+		if !leaderB.TryAcquire() {
+			t.Fatal("Second replica should get the released lease")
+		}
+
+		if leaderA.TryAcquire() {
+			t.Fatal("First replica should no longer hold the lease")
+		}
+	})
+
+	t.Run("Expired lease moves to the other replica", func(t *testing.T) {
+		//Replica B stops renewing, and its lease runs out
+		Logger.Exec("UPDATE leases SET expires_at = DATE_SUB(NOW(), INTERVAL 1 SECOND) WHERE name = ?", leaseName)
+
+		if !leaderA.TryAcquire() {
+			t.Fatal("First replica should get the expired lease")
+		}
+	})
+}
+
+func TestReplicaChangeFeed(t *testing.T) {
+	Logger.Active(true)
+	defer Logger.Active(false)
+
+	origReplicaID := ReplicaID
+	defer func() { ReplicaID = origReplicaID }()
+
+	groupsA, schedulesA := make(GroupMap), make(ScheduleMap)
+	groupsB, schedulesB := make(GroupMap), make(ScheduleMap)
+
+	feedA := newChangeFeed("replica-a", groupsA, schedulesA)
+	feedB := newChangeFeed("replica-b", groupsB, schedulesB)
+
+	groupName := genRandName(0)
+	saveName := strings.ToLower(groupName)
+	memberGID := genUserGID(0)
+
+	msgObj := messageResponse{
+		Message: message{
+			Sender: User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"},
+			Mentions: []annotation{{
+				Called: userMention{
+					User: User{Name: genRandName(10), GID: memberGID, Type: "HUMAN"},
+				},
+				Type: "USER_MENTION",
+			}},
+		},
+		Room: space{GID: genRoomGID(0), Type: "ROOM"},
+	}
+
+	//Changes are made as replica A
+	ReplicaID = "replica-a"
+
+	t.Run("Group created on one replica shows up on the other", func(t *testing.T) {
+		groupsA.Create(groupName, "", msgObj)
+		pendingSaves.Wait()
+
+		feedB.Poll()
+
+		group, exist := groupsB[saveName]
+		if !exist {
+			t.Fatal("Group not picked up by the other replica")
+		}
+
+		if len(group.Members) != 1 || group.Members[0].GID != memberGID {
+			t.Fatalf("Incorrect members picked up\nGot: %+v", group.Members)
+		}
+	})
+
+	t.Run("Replica skips its own changes", func(t *testing.T) {
+		if applied := feedA.Poll(); applied != 0 {
+			t.Fatalf("Replica applied %d of its own changes", applied)
+		}
+	})
+
+	t.Run("Member removal shows up on the other replica", func(t *testing.T) {
+		groupsA.RemoveMembers(groupName, "", msgObj)
+		pendingSaves.Wait()
+
+		feedB.Poll()
+
+		if groupB := groupsB[saveName]; len(groupB.Members) != 0 {
+			t.Fatalf("Member removal not picked up\nGot: %+v", groupB.Members)
+		}
+	})
+
+	t.Run("Disband shows up on the other replica", func(t *testing.T) {
+		groupsA.Disband(groupName, msgObj)
+		pendingSaves.Wait()
+
+		feedB.Poll()
+
+		if _, exist := groupsB[saveName]; exist {
+			t.Fatal("Disbanded group still on the other replica")
+		}
+	})
+
+	t.Run("Change committed late is still picked up", func(t *testing.T) {
+		//An entry written before the last poll, but only committed after it
+		lateName := genRandName(0)
+		Logger.Create(&ChangeLog{
+			Replica:   "replica-a",
+			Kind:      "group",
+			Key:       strings.ToLower(lateName),
+			CreatedAt: time.Now().Add(-changePollInterval),
+		})
+
+		groupsB[strings.ToLower(lateName)] = &Group{Name: lateName}
+
+		if applied := feedB.Poll(); applied != 1 {
+			t.Fatalf("Late change applied %d times", applied)
+		}
+
+		if _, exist := groupsB[strings.ToLower(lateName)]; exist {
+			t.Fatal("Late change not applied")
+		}
+
+		if applied := feedB.Poll(); applied != 0 {
+			t.Fatalf("Change applied again on the next poll\nApplied: %d", applied)
+		}
+	})
+
+	t.Run("Nothing is recorded without a replica ID", func(t *testing.T) {
+		ReplicaID = ""
+		since := time.Now().Add(-time.Second)
+		unrecordedName := genRandName(0)
+
+		groupsA.Create(unrecordedName, "", msgObj)
+		pendingSaves.Wait()
+
+		for _, change := range Logger.GetChangesSince(since) {
+			if change.Key == strings.ToLower(unrecordedName) {
+				t.Fatalf("Change recorded without a replica\nGot: %+v", change)
+			}
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+//The roles that can be granted. Admins can do anything from a DM, moderators
+//can manage every group restricted to their room, and auditors can see every
+//group without being able to change any of them.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleAuditor   = "auditor"
+)
+
+//RoleGrant defines the database schema for a role given to a user. RoomGID is
+//only set for moderators, since the other roles apply everywhere.
+type RoleGrant struct {
+	gorm.Model
+	GID     string `gorm:"not null;unique_index:idx_role_grant"`
+	Role    string `gorm:"not null;unique_index:idx_role_grant"`
+	RoomGID string `gorm:"not null;default:'';unique_index:idx_role_grant"`
+}
+
+//RoleDirectory holds every role grant in memory. The MasterID from the config
+//is always an admin, and can't be revoked through chat.
+type RoleDirectory struct {
+	sync.RWMutex
+	grants []RoleGrant
+}
+
+//newRoleDirectory initializes an empty role directory
+func newRoleDirectory() *RoleDirectory {
+	return new(RoleDirectory)
+}
+
+//Replace swaps every grant in the directory for the given ones. This is used
+//when the grants are pulled from the database.
+func (rd *RoleDirectory) Replace(grants []RoleGrant) {
+	rd.Lock()
+	defer rd.Unlock()
+
+	rd.grants = grants
+}
+
+//has tells if the user was granted the role for the room
+func (rd *RoleDirectory) has(gid, role, roomGID string) bool {
+	rd.RLock()
+	defer rd.RUnlock()
+
+	for _, grant := range rd.grants {
+		if grant.GID == gid && grant.Role == role && grant.RoomGID == roomGID {
+			return true
+		}
+	}
+
+	return false
+}
+
+//IsAdmin tells if the user is a global admin
+func (rd *RoleDirectory) IsAdmin(gid string) bool {
+	if gid == "" {
+		return false
+	}
+
+	return gid == MasterID || rd.has(gid, RoleAdmin, "")
+}
+
+//IsModerator tells if the user moderates the given room
+func (rd *RoleDirectory) IsModerator(gid, roomGID string) bool {
+	if gid == "" || roomGID == "" {
+		return false
+	}
+
+	return rd.has(gid, RoleModerator, roomGID)
+}
+
+//IsAuditor tells if the user is allowed to see every group
+func (rd *RoleDirectory) IsAuditor(gid string) bool {
+	if gid == "" {
+		return false
+	}
+
+	return rd.has(gid, RoleAuditor, "")
+}
+
+//auditing tells if the sender of the message may see every group. Auditors
+//only can from a DM, the same as admins, so private groups aren't shown in
+//front of everyone in a room.
+func auditing(msgObj messageResponse) bool {
+	return msgObj.Room.Type == "DM" && Roles.IsAuditor(msgObj.Message.Sender.GID)
+}
+
+//HasRole tells if the user was granted any role at all
+func (rd *RoleDirectory) HasRole(gid string) bool {
+	rd.RLock()
+	defer rd.RUnlock()
+
+	for _, grant := range rd.grants {
+		if grant.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Grant gives the role to the user, returning false if they already had it.
+func (rd *RoleDirectory) Grant(grant RoleGrant) bool {
+	if rd.has(grant.GID, grant.Role, grant.RoomGID) {
+		return false
+	}
+
+	rd.Lock()
+	rd.grants = append(rd.grants, grant)
+	rd.Unlock()
+
+	go Logger.SaveRoleGrant(&grant)
+	return true
+}
+
+//Revoke takes the role away from the user, returning false if they didn't
+//have it.
+func (rd *RoleDirectory) Revoke(grant RoleGrant) bool {
+	rd.Lock()
+	defer rd.Unlock()
+
+	for i, existing := range rd.grants {
+		if existing.GID == grant.GID && existing.Role == grant.Role && existing.RoomGID == grant.RoomGID {
+			rd.grants = append(rd.grants[:i], rd.grants[i+1:]...)
+
+			go Logger.DeleteRoleGrant(&grant)
+			return true
+		}
+	}
+
+	return false
+}
+
+//List returns the grants, in order of role then name. If roomGID is given only
+//the moderators of that room are returned.
+func (rd *RoleDirectory) List(roomGID string) []RoleGrant {
+	rd.RLock()
+	defer rd.RUnlock()
+
+	var grants []RoleGrant
+	for _, grant := range rd.grants {
+		if roomGID == "" || (grant.Role == RoleModerator && grant.RoomGID == roomGID) {
+			grants = append(grants, grant)
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Role != grants[j].Role {
+			return grants[i].Role < grants[j].Role
+		}
+
+		return Users.Name(grants[i].GID, grants[i].GID) < Users.Name(grants[j].GID, grants[j].GID)
+	})
+
+	return grants
+}
+
+//Manage handles the admin command. Admins and auditors are granted from a DM
+//by an admin, while moderators are granted in the room they'll moderate, by an
+//admin or another moderator of that room.
+func (rd *RoleDirectory) Manage(subAction, role string, msgObj messageResponse) string {
+	sender := msgObj.Message.Sender.GID
+	room := msgObj.Room.GID
+
+	switch subAction {
+	case "list":
+		if !msgObj.FromMaster && !rd.IsAuditor(sender) && !rd.IsModerator(sender, room) {
+			return "Only admins, auditors, and moderators may list roles."
+		}
+
+		listRoom := ""
+		if !msgObj.FromMaster && !rd.IsAuditor(sender) {
+			listRoom = room
+		}
+
+		grants := rd.List(listRoom)
+		if len(grants) == 0 {
+			return "No roles have been granted."
+		}
+
+		var text string
+		for _, grant := range grants {
+			text += fmt.Sprintf("\n%s: %s (%s)", grant.Role, Users.Name(grant.GID, grant.GID), grant.GID)
+
+			if grant.RoomGID != "" {
+				text += " in " + grant.RoomGID
+			}
+		}
+
+		return fmt.Sprintf("Here are the granted roles: ```%s```", strings.TrimPrefix(text, "\n"))
+
+	case "grant", "revoke":
+
+	default:
+		return fmt.Sprintf("Unknown admin action %q. ```%s```", subAction, usage("admin"))
+	}
+
+	grant := RoleGrant{Role: strings.ToLower(role)}
+
+	switch grant.Role {
+	case RoleAdmin, RoleAuditor:
+		if !msgObj.FromMaster {
+			return fmt.Sprintf("Only admins may %s the %s role, and only from a DM.", subAction, grant.Role)
+		}
+
+	case RoleModerator:
+		if msgObj.Room.Type == "DM" {
+			return "Moderators are given to a room, please do this in the room they'll moderate."
+		}
+
+		if !rd.IsAdmin(sender) && !rd.IsModerator(sender, room) {
+			return fmt.Sprintf("Only admins and moderators of this room may %s the moderator role.", subAction)
+		}
+
+		grant.RoomGID = room
+
+	default:
+		return fmt.Sprintf("Unknown role %q. ```%s```", role, usage("admin"))
+	}
+
+	var (
+		changed   []string
+		unchanged []string
+
+		seen = checkSeen()
+	)
+
+	for _, mention := range msgObj.Message.Mentions {
+		user := mention.Called.User
+
+		if user.Type == "BOT" || mention.Type != "USER_MENTION" || seen(user.GID) {
+			continue
+		}
+
+		grant.GID = user.GID
+
+		var ok bool
+		if subAction == "grant" {
+			ok = rd.Grant(grant)
+		} else {
+			ok = rd.Revoke(grant)
+		}
+
+		if ok {
+			changed = append(changed, user.Name)
+		} else {
+			unchanged = append(unchanged, user.Name)
+		}
+	}
+
+	if len(changed) == 0 && len(unchanged) == 0 {
+		return fmt.Sprintf("Please @ the people you'd like to %s the %s role. ```%s```", subAction, grant.Role, usage("admin"))
+	}
+
+	var text string
+
+	if len(changed) > 0 {
+		if subAction == "grant" {
+			text += fmt.Sprintf("I've made %s %s. ", strings.Join(changed, ", "), grant.Role)
+		} else {
+			text += fmt.Sprintf("I've taken the %s role from %s. ", grant.Role, strings.Join(changed, ", "))
+		}
+	}
+
+	if len(unchanged) > 0 {
+		if subAction == "grant" {
+			text += fmt.Sprintf("%s already had the %s role.", strings.Join(unchanged, ", "), grant.Role)
+		} else {
+			text += fmt.Sprintf("%s didn't have the %s role.", strings.Join(unchanged, ", "), grant.Role)
+		}
+	}
+
+	return strings.TrimSpace(text)
+}
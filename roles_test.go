@@ -0,0 +1,268 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleDirectory(t *testing.T) {
+	Logger.Active(false)
+
+	roles := newRoleDirectory()
+	userGID := genUserGID(0)
+	roomGID := genRoomGID(0)
+
+	t.Run("Grants and revokes global roles", func(t *testing.T) {
+		if !roles.Grant(RoleGrant{GID: userGID, Role: RoleAuditor}) {
+			t.Fatal("New grant should be reported as a change")
+		}
+
+		if roles.Grant(RoleGrant{GID: userGID, Role: RoleAuditor}) {
+			t.Fatal("Repeated grant should not be reported as a change")
+		}
+
+		if !roles.IsAuditor(userGID) {
+			t.Fatal("User should be an auditor")
+		}
+
+		if roles.IsAdmin(userGID) {
+			t.Fatal("Auditor should not be an admin")
+		}
+
+		if !roles.Revoke(RoleGrant{GID: userGID, Role: RoleAuditor}) {
+			t.Fatal("Revoke should be reported as a change")
+		}
+
+		if roles.IsAuditor(userGID) {
+			t.Fatal("Auditor role was not revoked")
+		}
+	})
+
+	t.Run("Moderators only moderate their room", func(t *testing.T) {
+		roles.Grant(RoleGrant{GID: userGID, Role: RoleModerator, RoomGID: roomGID})
+
+		if !roles.IsModerator(userGID, roomGID) {
+			t.Fatal("User should moderate the room")
+		}
+
+		if roles.IsModerator(userGID, genRoomGID(0)) {
+			t.Fatal("User should not moderate another room")
+		}
+	})
+
+	t.Run("MasterID is always an admin", func(t *testing.T) {
+		MasterID = genUserGID(0)
+
+		if !roles.IsAdmin(MasterID) {
+			t.Fatal("MasterID should be an admin")
+		}
+	})
+
+	t.Run("Lists only the room's moderators", func(t *testing.T) {
+		roles.Grant(RoleGrant{GID: genUserGID(0), Role: RoleAdmin})
+
+		if got := len(roles.List("")); got != 2 {
+			t.Fatalf("Incorrect number of grants listed\nWanted: 2\nGot: %d", got)
+		}
+
+		grants := roles.List(roomGID)
+		if len(grants) != 1 || grants[0].GID != userGID {
+			t.Fatalf("Incorrect grants listed for the room\nGot: %+v", grants)
+		}
+	})
+}
+
+func TestManageRoles(t *testing.T) {
+	Logger.Active(false)
+
+	roles := Roles
+	defer func() { Roles = roles }()
+
+	Roles = newRoleDirectory()
+	MasterID = genUserGID(0)
+
+	target := User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"}
+	mentions := []annotation{{
+		Called: userMention{User: target},
+		Type:   "USER_MENTION",
+	}}
+
+	adminDM := messageResponse{
+		Message:    message{Sender: User{GID: MasterID}, Mentions: mentions},
+		Room:       space{GID: genRoomGID(0), Type: "DM"},
+		FromMaster: true,
+	}
+
+	room := messageResponse{
+		Message: message{Sender: User{GID: genUserGID(0)}, Mentions: mentions},
+		Room:    space{GID: genRoomGID(0), Type: "ROOM"},
+	}
+
+	t.Run("Admin grants auditor from a DM", func(t *testing.T) {
+		Roles.Manage("grant", "auditor", adminDM)
+
+		if !Roles.IsAuditor(target.GID) {
+			t.Fatal("Auditor role was not granted")
+		}
+	})
+
+	t.Run("Non-admin can't grant admin", func(t *testing.T) {
+		Roles.Manage("grant", "admin", room)
+
+		if Roles.IsAdmin(target.GID) {
+			t.Fatal("Admin role was granted by a non-admin")
+		}
+	})
+
+	t.Run("Moderator can't be granted from a DM", func(t *testing.T) {
+		Roles.Manage("grant", "moderator", adminDM)
+
+		if Roles.IsModerator(target.GID, adminDM.Room.GID) {
+			t.Fatal("Moderator role was granted to a DM")
+		}
+	})
+
+	t.Run("Admin grants moderator in the room", func(t *testing.T) {
+		msgObj := room
+		msgObj.Message.Sender.GID = MasterID
+
+		Roles.Manage("grant", "moderator", msgObj)
+
+		if !Roles.IsModerator(target.GID, room.Room.GID) {
+			t.Fatal("Moderator role was not granted")
+		}
+	})
+
+	t.Run("Moderator grants and revokes moderator in their room", func(t *testing.T) {
+		other := User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"}
+
+		msgObj := room
+		msgObj.Message.Sender.GID = target.GID
+		msgObj.Message.Mentions = []annotation{{
+			Called: userMention{User: other},
+			Type:   "USER_MENTION",
+		}}
+
+		Roles.Manage("grant", "moderator", msgObj)
+
+		if !Roles.IsModerator(other.GID, room.Room.GID) {
+			t.Fatal("Moderator role was not granted by a moderator")
+		}
+
+		Roles.Manage("revoke", "moderator", msgObj)
+
+		if Roles.IsModerator(other.GID, room.Room.GID) {
+			t.Fatal("Moderator role was not revoked by a moderator")
+		}
+	})
+
+	t.Run("Lists roles for admin", func(t *testing.T) {
+		text := Roles.Manage("list", "", adminDM)
+
+		if !strings.Contains(text, target.GID) {
+			t.Fatalf("Granted user not listed\nGot: %q", text)
+		}
+	})
+
+	t.Run("Doesn't list roles for everyone", func(t *testing.T) {
+		msgObj := room
+		msgObj.Message.Sender.GID = genUserGID(0)
+
+		if text := Roles.Manage("list", "", msgObj); strings.Contains(text, target.GID) {
+			t.Fatalf("Roles listed for a regular user\nGot: %q", text)
+		}
+	})
+
+	t.Run("Rejects unknown role", func(t *testing.T) {
+		text := Roles.Manage("grant", "overlord", adminDM)
+
+		if !strings.Contains(text, "Unknown role") {
+			t.Fatalf("Unknown role not rejected\nGot: %q", text)
+		}
+	})
+}
+
+func TestCheckGroupRoles(t *testing.T) {
+	Logger.Active(false)
+
+	roles := Roles
+	defer func() { Roles = roles }()
+
+	Roles = newRoleDirectory()
+
+	Groups := make(GroupMap)
+	privateRoom := genRoomGID(0)
+	saveName := strings.ToLower(genRandName(10))
+
+	Groups[saveName] = &Group{
+		Name:          saveName,
+		IsPrivate:     true,
+		PrivacyRoomID: privateRoom,
+	}
+
+	msgObj := messageResponse{
+		Message: message{Sender: User{GID: genUserGID(0)}},
+		Room:    space{GID: genRoomGID(0), Type: "ROOM"},
+	}
+
+	t.Run("Private to regular users", func(t *testing.T) {
+		_, meta := Groups.checkGroup(saveName, msgObj)
+
+		if !strings.Contains(meta, "private") || strings.Contains(meta, "audit") {
+			t.Fatalf("Group should be private\nGot: %q", meta)
+		}
+	})
+
+	t.Run("Visible but read only for auditors in a DM", func(t *testing.T) {
+		Roles.Grant(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAuditor})
+		defer Roles.Revoke(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAuditor})
+
+		dm := msgObj
+		dm.Room = space{GID: genRoomGID(0), Type: "DM"}
+
+		_, meta := Groups.checkGroup(saveName, dm)
+
+		if !strings.Contains(meta, "private") || !strings.Contains(meta, "audit") {
+			t.Fatalf("Group should be auditable\nGot: %q", meta)
+		}
+
+		if text := Groups.List(saveName, dm); !strings.Contains(text, "Here are details") {
+			t.Fatalf("Auditor couldn't view the group\nGot: %q", text)
+		}
+
+		if Groups.Disband(saveName, dm); Groups[saveName] == nil {
+			t.Fatal("Auditor was able to disband the group")
+		}
+	})
+
+	t.Run("Private to auditors in a room", func(t *testing.T) {
+		Roles.Grant(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAuditor})
+		defer Roles.Revoke(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleAuditor})
+
+		if _, meta := Groups.checkGroup(saveName, msgObj); strings.Contains(meta, "audit") {
+			t.Fatalf("Group should not be auditable outside a DM\nGot: %q", meta)
+		}
+
+		if text := Groups.List(saveName, msgObj); strings.Contains(text, "Here are details") {
+			t.Fatalf("Auditor viewed the group in a room\nGot: %q", text)
+		}
+
+		if text := Groups.SyncAllGroups("dryRun", msgObj); !strings.Contains(text, "Invalid option") {
+			t.Fatalf("Auditor ran a dry run in a room\nGot: %q", text)
+		}
+	})
+
+	t.Run("Manageable by the room's moderators", func(t *testing.T) {
+		Roles.Grant(RoleGrant{GID: msgObj.Message.Sender.GID, Role: RoleModerator, RoomGID: privateRoom})
+
+		_, meta := Groups.checkGroup(saveName, msgObj)
+
+		if strings.Contains(meta, "private") {
+			t.Fatalf("Group should not be private to the moderator\nGot: %q", meta)
+		}
+
+		if text := Groups.SyncGroupMembers(saveName, "", msgObj); strings.Contains(text, "Invalid option") {
+			t.Fatalf("Moderator couldn't sync the group\nGot: %q", text)
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	chat "google.golang.org/api/chat/v1"
+)
+
+//roomSyncDetail is noted on the audit entries of the changes made to keep a
+//group matching its room
+const roomSyncDetail = "from the room's members"
+
+//defaultRoomSyncInterval is how often synced groups are checked against their
+//room when no interval is configured
+const defaultRoomSyncInterval = 15 * time.Minute
+
+//roomSyncMsgObj is who the changes made to keep groups matching their rooms
+//are made by
+var roomSyncMsgObj = messageResponse{
+	Message:    message{Sender: User{Name: "room sync", GID: "roomsync", Type: "BOT"}},
+	FromMaster: true,
+}
+
+//Roster lists the people in a room, leaving out bots
+type Roster interface {
+	Members(room string) ([]User, error)
+}
+
+//ChatRoster lists room members through Google's Chat API
+type ChatRoster struct {
+	members *chat.SpacesMembersService
+}
+
+//newChatRoster creates a roster using the client given, which should already
+//be authorized as the bot. The Chat API's address can be swapped with
+//baseURL, the same as for the ChatMessenger.
+func newChatRoster(client *http.Client, baseURL string) *ChatRoster {
+	service := getChatService(client)
+	if baseURL != "" {
+		service.BasePath = strings.TrimSuffix(baseURL, "/") + "/"
+	}
+
+	return &ChatRoster{members: chat.NewSpacesMembersService(service)}
+}
+
+//Members lists everyone who has joined the room, page by page
+func (cr *ChatRoster) Members(room string) ([]User, error) {
+	var users []User
+
+	err := cr.members.List(room).PageSize(100).Pages(context.Background(), func(page *chat.ListMembershipsResponse) error {
+		for _, membership := range page.Memberships {
+			member := membership.Member
+			if member == nil || member.Type == "BOT" || membership.State != "" && membership.State != "JOINED" {
+				continue
+			}
+
+			users = append(users, User{Name: member.DisplayName, GID: member.Name, Type: member.Type})
+		}
+
+		return nil
+	})
+
+	return users, err
+}
+
+//skipRoster can't list anyone, since the Chat API isn't set up
+type skipRoster struct{}
+
+//Members fails, saying how to set up the Chat API
+func (skipRoster) Members(room string) ([]User, error) {
+	return nil, errors.New("listing a room's members needs the Chat API, set SERVICE_SEND to true")
+}
+
+//CreateFromRoom method creates a group out of everyone in the room the
+//message was sent in. Passing sync keeps the group matching the room's
+//members from then on. The members are read by the command's Lookup.
+func (gm GroupMap) CreateFromRoom(groupName, sync string, msgObj messageResponse) string {
+	saveName, reply := gm.checkNewGroup(groupName, msgObj)
+	if reply != "" {
+		return reply
+	}
+
+	if msgObj.Room.Type == "DM" {
+		return "A group can only be made from the members of a room, not a DM."
+	}
+
+	users, err := msgObj.roomMembers()
+	if err != nil {
+		log.Printf("Error listing the members of %s: %s", msgObj.Room.GID, err.Error())
+		return fmt.Sprintf("I couldn't list the members of this room, so the group %q wasn't created.", groupName)
+	}
+
+	var (
+		newGroup   = &Group{Name: groupName}
+		newMembers string
+
+		numAdded    int
+		lastNameLen int
+	)
+
+	for _, user := range users {
+		Users.Observe(user)
+		newGroup.manageMember("add", &newMembers, &numAdded, &lastNameLen, user)
+	}
+
+	if numAdded == 0 {
+		newMembers = "no users"
+	} else {
+		newMembers = correctGP(newMembers, numAdded, lastNameLen)
+	}
+
+	detail := roomSyncDetail
+	text := fmt.Sprintf("Created group %q with %s from this room.", groupName, newMembers)
+
+	if sync != "" {
+		newGroup.SyncRoomID = msgObj.Room.GID
+		detail += ", kept in sync"
+		text += fmt.Sprintf(" I'll keep it matching the room's members, say \"%s unsync %s\" to stop.", BotName, groupName)
+	}
+
+	saveGroup(func() { Logger.SaveCreatedGroup(newGroup) })
+	gm[saveName] = newGroup
+
+	auditGroup("create", newGroup, nil, msgObj, detail)
+	return text
+}
+
+//Unsync method stops keeping the group matching its room. The members are
+//left as they are, and can be changed from chat again.
+func (gm GroupMap) Unsync(groupName string, msgObj messageResponse) string {
+	if groupName == "" {
+		return fmt.Sprintf("You'd need to pass a group name to stop syncing it. ```%s```", usage("unsync"))
+	}
+
+	saveName, meta := gm.checkGroup(groupName, msgObj)
+
+	if !strings.Contains(meta, "exist") {
+		return fmt.Sprintf("Group %q does not seem to exist.", groupName)
+	}
+
+	if strings.Contains(meta, "private") {
+		return fmt.Sprintf("The group %q is private, and you may not mutate it.", groupName)
+	}
+
+	if !strings.Contains(meta, "synced") {
+		return fmt.Sprintf("The group %q isn't kept matching a room.", groupName)
+	}
+
+	group := gm[saveName]
+	group.SyncRoomID = ""
+
+	saveGroup(func() { Logger.SaveRoomSync(group) })
+
+	auditGroup("unsync", group, group.Members, msgObj, "stopped matching the room's members")
+	return fmt.Sprintf("The group %q is no longer kept matching its room, its members can be changed again.", groupName)
+}
+
+//syncedReply tells the sender the group's members come from its room, and
+//how to change them anyway
+func syncedReply(groupName string) string {
+	return fmt.Sprintf("The group %q is kept matching the members of its room, so changes to its members would be undone. Say \"%s unsync %s\" first to change them by hand.", groupName, BotName, groupName)
+}
+
+//RoomSync keeps the groups created with --sync matching their room's
+//members, checking every Interval
+type RoomSync struct {
+	Interval time.Duration
+}
+
+//newRoomSync sets up the room sync from the bot's configuration. An interval
+//of 0 turns the checks off.
+func newRoomSync(conf HGNConfig) *RoomSync {
+	rs := &RoomSync{Interval: defaultRoomSyncInterval}
+
+	if conf.RoomSyncInterval != "" {
+		interval, err := time.ParseDuration(conf.RoomSyncInterval)
+		if err != nil {
+			log.Printf("Invalid room sync interval %q, groups aren't kept matching their rooms: %s", conf.RoomSyncInterval, err)
+			interval = 0
+		}
+
+		rs.Interval = interval
+	}
+
+	return rs
+}
+
+//Start checks the synced groups in the background on every interval
+func (rs *RoomSync) Start(Groups GroupMap) {
+	if rs.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(rs.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			rs.run(Groups)
+		}
+	}()
+}
+
+//run makes every synced group match its room, if this replica owns the
+//scheduler. The rooms are read without holding stateLock. Groups whose room
+//couldn't be read, or has nobody left in it, are left as they are.
+func (rs *RoomSync) run(Groups GroupMap) {
+	stateLock.Lock()
+
+	if !ownsScheduler() {
+		stateLock.Unlock()
+		return
+	}
+
+	rooms := make(map[string]bool)
+	for _, group := range Groups {
+		if group.SyncRoomID != "" {
+			rooms[group.SyncRoomID] = true
+		}
+	}
+
+	stateLock.Unlock()
+
+	roomMembers := make(map[string][]Member)
+	for room := range rooms {
+		users, err := Rooms.Members(room)
+		if err != nil {
+			log.Printf("Error listing the members of %s, its groups are left as they are: %s", room, err.Error())
+			continue
+		}
+
+		for _, user := range users {
+			roomMembers[room] = append(roomMembers[room], Member{Name: user.Name, GID: user.GID})
+		}
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if !ownsScheduler() {
+		return
+	}
+
+	var doc GroupExport
+	for _, group := range Groups {
+		if members := roomMembers[group.SyncRoomID]; group.SyncRoomID != "" && len(members) > 0 {
+			doc.Groups = append(doc.Groups, ExportedGroup{Group: Group{Name: group.Name, Members: members}})
+		}
+	}
+
+	plan := planImport(Groups, doc, directoryPolicy)
+	Groups.applyImport(plan, roomSyncDetail, roomSyncMsgObj)
+
+	if plan.HasChanges() {
+		log.Printf("Groups synced with their rooms:\n%s", plan)
+	}
+}
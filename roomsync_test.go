@@ -0,0 +1,232 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChatRoster(t *testing.T) {
+	fake := newFakeChat()
+	defer fake.Close()
+
+	roomGID := genRoomGID(10)
+	fake.setMembers(roomGID,
+		User{Name: "Ana", GID: "users/1", Type: "HUMAN"},
+		User{Name: "HGNotify", GID: "users/2", Type: "BOT"},
+		User{Name: "Bo", GID: "users/3", Type: "HUMAN"},
+		User{Name: "Cy", GID: "users/4", Type: "INVITED"},
+		User{Name: "Di", GID: "users/5", Type: "HUMAN"},
+	)
+
+	t.Run("Lists the people in every page, skipping bots", func(t *testing.T) {
+		users, err := fake.roster().Members(roomGID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gids []string
+		for _, user := range users {
+			gids = append(gids, user.GID)
+		}
+
+		if got := strings.Join(gids, ","); got != "users/1,users/3,users/5" || users[0].Name != "Ana" {
+			t.Fatalf("Incorrect members\nGot: %+v", users)
+		}
+	})
+
+	t.Run("Fails for rooms it can't read", func(t *testing.T) {
+		if _, err := fake.roster().Members(genRoomGID(10)); err == nil {
+			t.Fatal("Unknown room should fail")
+		}
+	})
+}
+
+func TestCreateFromRoom(t *testing.T) {
+	Logger.Active(false)
+
+	fake := newFakeChat()
+	defer fake.Close()
+
+	rooms, users := Rooms, Users
+	defer func() { Rooms, Users = rooms, users }()
+	Rooms, Users = fake.roster(), newUserDirectory()
+
+	roomGID := genRoomGID(10)
+	fake.setMembers(roomGID,
+		User{Name: "Ana", GID: "users/1", Type: "HUMAN"},
+		User{Name: "HGNotify", GID: "users/2", Type: "BOT"},
+		User{Name: "Bo", GID: "users/3", Type: "HUMAN"},
+	)
+
+	msgObj := messageResponse{Room: space{GID: roomGID, Type: "ROOM"}, Message: message{Sender: User{Name: "Ana", GID: "users/1"}}}
+	Groups := make(GroupMap)
+
+	t.Run("Parses the flags", func(t *testing.T) {
+		args := make(Arguments)
+		if err := Commands.Get("create").parseArgs(Groups, msgObj, tokenize(BotName+" create team --from-room --sync"), args); err != nil {
+			t.Fatal(err)
+		}
+
+		if args["groupName"] != "team" || args["fromRoom"] == "" || args["sync"] == "" {
+			t.Fatalf("Args not properly parsed\nObject Result: %+v", args)
+		}
+	})
+
+	t.Run("Fills the group with the room's members", func(t *testing.T) {
+		gotText := Groups.CreateFromRoom("team", "", msgObj)
+
+		group := Groups["team"]
+		if group == nil || memberGIDs(group.Members) != "users/1,users/3" || group.SyncRoomID != "" {
+			t.Fatalf("Group not created from the room\nGot: %q %+v", gotText, group)
+		}
+
+		if Users.Name("users/3", "") != "Bo" {
+			t.Fatal("Members not added to the directory")
+		}
+
+		if gotText := Groups.AddMembers("team", "self", msgObj); strings.Contains(gotText, "kept matching") {
+			t.Fatalf("Unsynced group should change\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Keeps the group in sync when asked", func(t *testing.T) {
+		gotText := Groups.CreateFromRoom("synced", "sync", msgObj)
+		if !strings.Contains(gotText, "unsync synced") || Groups["synced"].SyncRoomID != roomGID {
+			t.Fatalf("Group not synced\nGot: %q", gotText)
+		}
+
+		msgObj.Message.Mentions = []annotation{{Type: "USER_MENTION", Called: userMention{User{Name: "Cy", GID: "users/4", Type: "HUMAN"}}}}
+		defer func() { msgObj.Message.Mentions = nil }()
+
+		for _, gotText := range []string{Groups.AddMembers("synced", "", msgObj), Groups.RemoveMembers("synced", "", msgObj)} {
+			if !strings.Contains(gotText, "kept matching the members of its room") {
+				t.Fatalf("Synced group should not change\nGot: %q", gotText)
+			}
+		}
+	})
+
+	t.Run("Stops syncing", func(t *testing.T) {
+		if gotText := Groups.Unsync("synced", msgObj); !strings.Contains(gotText, "no longer kept matching") || Groups["synced"].SyncRoomID != "" {
+			t.Fatalf("Group still synced\nGot: %q", gotText)
+		}
+
+		if gotText := Groups.Unsync("synced", msgObj); !strings.Contains(gotText, "isn't kept matching") {
+			t.Fatalf("Incorrect reply\nGot: %q", gotText)
+		}
+	})
+
+	t.Run("Only works in rooms it can read", func(t *testing.T) {
+		dm := msgObj
+		dm.Room.Type = "DM"
+
+		if gotText := Groups.CreateFromRoom("fromdm", "", dm); Groups.IsGroup("fromdm") || !strings.Contains(gotText, "not a DM") {
+			t.Fatalf("Group should not be created from a DM\nGot: %q", gotText)
+		}
+
+		elsewhere := msgObj
+		elsewhere.Room.GID = genRoomGID(10)
+
+		if gotText := Groups.CreateFromRoom("elsewhere", "", elsewhere); Groups.IsGroup("elsewhere") || !strings.Contains(gotText, "couldn't list") {
+			t.Fatalf("Group should not be created\nGot: %q", gotText)
+		}
+
+		if gotText := Groups.CreateFromRoom("team", "", msgObj); !strings.Contains(gotText, "already exist") {
+			t.Fatalf("Existing group should not be recreated\nGot: %q", gotText)
+		}
+	})
+}
+
+func TestRoomSync(t *testing.T) {
+	Logger.Active(false)
+
+	fake := newFakeChat()
+	defer fake.Close()
+
+	rooms, users := Rooms, Users
+	defer func() { Rooms, Users = rooms, users }()
+	Rooms, Users = fake.roster(), newUserDirectory()
+
+	roomGID, goneGID := genRoomGID(10), genRoomGID(10)
+	fake.setMembers(roomGID, User{Name: "Ana", GID: "users/1", Type: "HUMAN"}, User{Name: "Bo", GID: "users/3", Type: "HUMAN"})
+
+	Groups := GroupMap{
+		"synced":   &Group{Name: "synced", Members: []Member{{GID: "users/1"}, {GID: "users/2"}}, IsPrivate: true, PrivacyRoomID: roomGID, SyncRoomID: roomGID},
+		"unsynced": &Group{Name: "unsynced", Members: []Member{{GID: "users/2"}}},
+		"gone":     &Group{Name: "gone", Members: []Member{{GID: "users/2"}}, SyncRoomID: goneGID},
+	}
+
+	t.Run("Makes synced groups match their room", func(t *testing.T) {
+		newRoomSync(HGNConfig{}).run(Groups)
+
+		synced := Groups["synced"]
+		if got := memberGIDs(synced.Members); got != "users/1,users/3" || !synced.IsPrivate {
+			t.Fatalf("Group not synced\nGot: %q %+v", got, synced)
+		}
+
+		if memberGIDs(Groups["unsynced"].Members) != "users/2" || memberGIDs(Groups["gone"].Members) != "users/2" {
+			t.Fatal("Groups without a readable room should be left alone")
+		}
+	})
+
+	t.Run("Leaves groups alone when the room can't be read", func(t *testing.T) {
+		fake.failWith = http.StatusForbidden
+		fake.setMembers(roomGID, User{Name: "Ana", GID: "users/1", Type: "HUMAN"})
+
+		newRoomSync(HGNConfig{}).run(Groups)
+		fake.failWith = 0
+
+		if got := memberGIDs(Groups["synced"].Members); got != "users/1,users/3" {
+			t.Fatalf("Group should be left alone\nGot: %q", got)
+		}
+	})
+
+	t.Run("Reads the interval", func(t *testing.T) {
+		if rs := newRoomSync(HGNConfig{RoomSyncInterval: "nope"}); rs.Interval != 0 {
+			t.Fatalf("Invalid interval should turn the sync off\nGot: %s", rs.Interval)
+		}
+
+		if rs := newRoomSync(HGNConfig{}); rs.Interval != defaultRoomSyncInterval {
+			t.Fatalf("Incorrect default interval\nGot: %s", rs.Interval)
+		}
+	})
+}
+
+//lockCheckingRoster lists the same people for every room, noting whether
+//stateLock was held each time
+type lockCheckingRoster struct {
+	users []User
+	held  *[]bool
+}
+
+func (lr lockCheckingRoster) Members(room string) ([]User, error) {
+	*lr.held = append(*lr.held, stateLockHeld())
+	return lr.users, nil
+}
+
+func TestCreateFromRoomLookup(t *testing.T) {
+	Logger.Active(false)
+
+	var held []bool
+
+	rooms, users, useCards := Rooms, Users, UseCards
+	defer func() { Rooms, Users, UseCards = rooms, users, useCards }()
+	Rooms = lockCheckingRoster{users: []User{{Name: "Ana", GID: "users/1", Type: "HUMAN"}}, held: &held}
+	Users, UseCards = newUserDirectory(), false
+
+	Groups := make(GroupMap)
+	msgObj := messageResponse{
+		Room:    space{GID: genRoomGID(10), Type: "ROOM"},
+		Message: message{Sender: User{Name: "Ana", GID: "users/1"}, Text: BotName + " create team --from-room"},
+	}
+
+	reply := respond(Groups, ScheduleMap{}, &msgObj)
+
+	if Groups["team"] == nil || memberGIDs(Groups["team"].Members) != "users/1" {
+		t.Fatalf("Group not created from the room\nGot: %q", reply.Text)
+	}
+
+	if len(held) != 1 || held[0] {
+		t.Fatalf("The room's members should be read once, without stateLock\nGot: %v", held)
+	}
+}
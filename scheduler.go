@@ -3,11 +3,11 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	chat "google.golang.org/api/chat/v1"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -18,6 +18,10 @@ type ScheduleMgr interface {
 	CreateRecurring(Arguments, GroupMgr, messageResponse) string
 	Remove(Arguments, messageResponse) string
 	List(messageResponse) string
+	ListCard(messageResponse) *CardV2
+	PauseRoom(messageResponse) []string
+	ResumeRoom(messageResponse) ([]string, []string)
+	Upcoming(string) []*Schedule
 }
 
 // ScheduleMap should be the thing that holds the information
@@ -41,7 +45,9 @@ type Schedule struct {
 	MessageLabel string    `gorm:"not null" yaml:"label"`
 	MessageText  string    `gorm:"not null" yaml:"message"`
 	IsFinished   bool      `gorm:"not null;default:false" yaml:"-"`
+	IsPaused     bool      `gorm:"not null;default:false" yaml:"paused,omitempty"`
 	timer        *time.Timer
+	failures     int
 }
 
 // CreateOnetime schedules a message to be sent out once in the future
@@ -72,6 +78,7 @@ func (sm ScheduleMap) CreateOnetime(args Arguments, Groups GroupMgr, msgObj mess
 	sm[schedKey] = schedule
 
 	go Logger.SaveSchedule(schedule)
+	auditSchedule("schedule onetime", args["groupName"], schedKey, msgObj, fmt.Sprintf("%q for %s", schedule.MessageLabel, args["dateTime"]))
 
 	return fmt.Sprintf("Scheduled onetime message %q for group %q to be sent on %q",
 		schedule.MessageLabel,
@@ -109,6 +116,7 @@ func (sm ScheduleMap) CreateRecurring(args Arguments, Groups GroupMgr, msgObj me
 	sm[schedKey] = schedule
 
 	go Logger.SaveSchedule(schedule)
+	auditSchedule("schedule recurring", args["groupName"], schedKey, msgObj, fmt.Sprintf("%q for %s", schedule.MessageLabel, args["dateTime"]))
 
 	return fmt.Sprintf("Scheduled recurring message %q for group %q to be sent on %s.\n",
 		schedule.MessageLabel,
@@ -152,6 +160,29 @@ func (sm ScheduleMap) List(msgObj messageResponse) string {
 	return fmt.Sprintf("Here are a list of the scheduled messages for this room ```%s```", schedList)
 }
 
+// Upcoming returns the schedules that haven't finished, sorted by
+// their keys. Passing a room only returns the schedules for it.
+func (sm ScheduleMap) Upcoming(roomID string) []*Schedule {
+	var keys []string
+
+	for schedKey, schedule := range sm {
+		if schedule.IsFinished || (roomID != "" && strings.Split(schedKey, ":")[0] != roomID) {
+			continue
+		}
+
+		keys = append(keys, schedKey)
+	}
+
+	sort.Strings(keys)
+
+	schedules := make([]*Schedule, 0, len(keys))
+	for _, schedKey := range keys {
+		schedules = append(schedules, sm[schedKey])
+	}
+
+	return schedules
+}
+
 // Remove marks the specified schedule as finished, saves these changes to
 // the database, then deletes the key for the schedule.
 func (sm ScheduleMap) Remove(args Arguments, msgObj messageResponse) string {
@@ -162,12 +193,13 @@ func (sm ScheduleMap) Remove(args Arguments, msgObj messageResponse) string {
 
 	if sm.hasSchedule(schedKey) {
 		schedule := sm.getSchedule(schedKey)
-		schedule.timer.Stop()
+		schedule.stopTimer()
 		schedule.IsFinished = true
 
 		Logger.SaveSchedule(schedule)
 
 		delete(sm, schedKey)
+		auditSchedule("schedule remove", "", schedKey, msgObj, fmt.Sprintf("%q", label))
 
 		return fmt.Sprintf("Removed %q from scheduler.", label)
 	}
@@ -175,6 +207,23 @@ func (sm ScheduleMap) Remove(args Arguments, msgObj messageResponse) string {
 	return fmt.Sprintf("Message %q not found to be removed.", label)
 }
 
+// StartTimers starts the timers for every schedule. This is used
+// when a replica takes over the scheduler.
+func (sm ScheduleMap) StartTimers() {
+	for _, schedule := range sm {
+		schedule.StartTimer()
+	}
+}
+
+// StopTimers stops the timers for every schedule, without marking
+// any of them finished. This is used when a replica hands off the
+// scheduler to another replica.
+func (sm ScheduleMap) StopTimers() {
+	for _, schedule := range sm {
+		schedule.stopTimer()
+	}
+}
+
 // GetLabels returns a list of the rooms schedules have been created for
 func (sm ScheduleMap) GetLabels() []string {
 	var labels []string
@@ -198,34 +247,111 @@ func (sm ScheduleMap) hasSchedule(schedKey string) bool {
 	return exists
 }
 
+// Key returns the room:label key the schedule is stored under
+func (s *Schedule) Key() string {
+	return strings.Split(s.SessKey, ":")[0] + ":" + s.MessageLabel
+}
+
+// timerLock guards the timers of every schedule, since they're
+// started from the timers themselves as well as from requests and
+// the scheduler lease, which stops them when the lease is lost.
+var timerLock sync.Mutex
+
+// How many times a scheduled message is tried before it's given up
+// on, and how long to wait before trying it again the first time.
+// sendRetryDelay is a variable so tests don't have to wait on it.
+const sendAttempts = 5
+
+var sendRetryDelay = time.Minute
+
 // StartTimer begins the countdown until the message is sent or sends
-// immediately if message is overdue
+// immediately if message is overdue. Only the replica that owns the
+// scheduler runs timers, and paused schedules don't run at all.
 func (s *Schedule) StartTimer() {
-	go func() {
-		if s.timer != nil {
-			s.timer.Stop()
-		}
+	if !ownsScheduler() || s.IsPaused {
+		return
+	}
 
-		if !s.IsFinished && time.Now().After(s.ExecuteOn) {
-			s.Send()
-			return
-		}
+	timerLock.Lock()
+	defer timerLock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
 
-		s.timer = time.AfterFunc(
-			time.Until(s.ExecuteOn),
-			func() { s.Send() },
-		)
-	}()
+	if !s.IsFinished && time.Now().After(s.ExecuteOn) {
+		go s.Send()
+		return
+	}
+
+	s.timer = time.AfterFunc(
+		time.Until(s.ExecuteOn),
+		func() { s.Send() },
+	)
+}
+
+// stopTimer stops the countdown, if there is one
+func (s *Schedule) stopTimer() {
+	timerLock.Lock()
+	defer timerLock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
 }
 
 // Send will send out the message scheduled
 func (s *Schedule) Send() {
-	if os.Getenv("SERVICE_SEND") != "true" {
-		log.Printf("Skipping send for schedule %d... to send set USE_CHAT_SERVICE to true", s.ID)
+	// Leadership could have moved to another replica since the timer
+	// was started, in which case that replica sends it instead.
+	if !ownsScheduler() || s.IsPaused {
+		return
+	}
+
+	group := Logger.GetGroupByID(s.GroupID)
+	if group == nil || group.Name == "" {
+		log.Printf("Skipping send for schedule %d... its group no longer exists", s.ID)
 		s.complete()
 		return
 	}
 
+	s.finish(s.deliver(group, Messages))
+}
+
+// finish completes the schedule once its message was sent. A failed
+// send is tried again, waiting twice as long each time, and only
+// given up on after sendAttempts, when the schedule moves on without
+// being marked as sent.
+func (s *Schedule) finish(err error) {
+	if err == nil {
+		s.failures = 0
+		s.complete()
+		return
+	}
+
+	s.failures++
+
+	if s.failures < sendAttempts {
+		wait := sendRetryDelay << uint(s.failures-1)
+		log.Printf("Error sending scheduled notification %d, trying again in %s: %s", s.ID, wait, err.Error())
+
+		timerLock.Lock()
+		s.timer = time.AfterFunc(wait, func() { s.Send() })
+		timerLock.Unlock()
+
+		return
+	}
+
+	log.Printf("Giving up on scheduled notification %d after %d attempts: %s", s.ID, s.failures, err.Error())
+
+	s.failures = 0
+	s.advance()
+}
+
+// deliver notifies the group with the scheduled message, in the room
+// and thread it was scheduled from
+func (s *Schedule) deliver(group *Group, messenger Messenger) error {
 	// As of right now, because the logic to generate the "Notify"
 	// message soley lives within a method for GroupMap and requires
 	// a messageResponse object to create, to get the message I have
@@ -233,37 +359,38 @@ func (s *Schedule) Send() {
 	// the message. Even for MVP this is grody, but a baby's gotta do
 	// what a baby's gotta do.
 	groups := make(GroupMap)
-	group := Logger.GetGroupByID(s.GroupID)
-	groups[group.Name] = group
+	groups[strings.ToLower(group.Name)] = group
+
+	room := strings.Split(s.SessKey, ":")[0]
 
 	msgObj := messageResponse{}
 	// Mimicking how the message would normally look
 	msgObj.Message.Text = BotName + " " + group.Name + " " + s.MessageText
 	msgObj.Message.Sender.Name = s.Creator
+	msgObj.Room.GID = room
 
 	msg := groups.Notify(group.Name, msgObj)
 
-	chatService := getChatService(getChatClient())
-	msgService := chat.NewSpacesMessagesService(chatService)
-
-	room := strings.Split(s.SessKey, ":")[0]
-
-	_, err := msgService.Create(room, &chat.Message{
-		Text: msg,
-		Thread: &chat.Thread{
-			Name: s.ThreadKey,
-		},
-	}).Do()
-	if err != nil {
-		log.Fatal("Error sending scheduled notification: " + err.Error())
+	if err := messenger.Send(room, s.ThreadKey, msg); err != nil {
+		return err
 	}
 
-	s.complete()
+	entry := newAuditEntry("schedule send", group.Name, msgObj)
+	entry.Schedule = s.Key()
+	entry.Detail = fmt.Sprintf("%q", s.MessageLabel)
+
+	Webhooks.Fire(entry)
+	return nil
 }
 
 func (s *Schedule) complete() {
 	s.CompletedOn = time.Now()
+	s.advance()
+}
 
+// advance moves a recurring schedule on to next week, and finishes
+// one that's only sent once
+func (s *Schedule) advance() {
 	if s.IsRecurring {
 		// Since the scheduled messages are all weekly, once they've
 		// completed a run, add 7 days (168 hours)
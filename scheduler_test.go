@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -307,3 +308,44 @@ func TestRecurring(t *testing.T) {
 		}
 	})
 }
+
+func TestScheduleRetry(t *testing.T) {
+	Logger.Active(false)
+
+	delay := sendRetryDelay
+	defer func() { sendRetryDelay = delay }()
+	sendRetryDelay = time.Hour
+
+	failed := errors.New("chat is down")
+
+	t.Run("Failed sends are tried again", func(t *testing.T) {
+		schedule := &Schedule{ExecuteOn: time.Now(), MessageLabel: "standup"}
+		defer schedule.stopTimer()
+
+		schedule.finish(failed)
+
+		if schedule.IsFinished || !schedule.CompletedOn.IsZero() || schedule.timer == nil {
+			t.Fatalf("Schedule should wait to be sent again\nGot: %+v", schedule)
+		}
+
+		schedule.finish(nil)
+
+		if !schedule.IsFinished || schedule.CompletedOn.IsZero() || schedule.failures != 0 {
+			t.Fatalf("Schedule should be completed once it's sent\nGot: %+v", schedule)
+		}
+	})
+
+	t.Run("Gives up after the last attempt", func(t *testing.T) {
+		executeOn := time.Now()
+		schedule := &Schedule{ExecuteOn: executeOn, IsRecurring: true, MessageLabel: "standup"}
+		defer schedule.stopTimer()
+
+		for i := 0; i < sendAttempts; i++ {
+			schedule.finish(failed)
+		}
+
+		if !schedule.ExecuteOn.Equal(executeOn.Add(time.Hour*168)) || !schedule.CompletedOn.IsZero() || schedule.failures != 0 {
+			t.Fatalf("Schedule should move on to next week without being sent\nGot: %+v", schedule)
+		}
+	})
+}
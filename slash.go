@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+//slashCommand is the slash command a message was sent with
+type slashCommand struct {
+	CommandID string `json:"commandId"`
+}
+
+//slashCommandMetadata is the annotation Google adds for the slash command at
+//the start of a message
+type slashCommandMetadata struct {
+	Bot         User   `json:"bot"`
+	Type        string `json:"type"`
+	CommandName string `json:"commandName"`
+	CommandID   string `json:"commandId"`
+}
+
+//parseSlashCommands reads the slash commands set up for the bot in Google's
+//console, written as a comma separated list of id=command, such as
+//1=create,2=schedule. The name of the slash command, such as /hgcreate, can be
+//used instead of its ID. Invalid entries are skipped.
+func parseSlashCommands(value string) map[string]string {
+	commands := make(map[string]string)
+
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			log.Printf("Invalid slash command %q, it is skipped: expected id=command", entry)
+			continue
+		}
+
+		commands[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+
+	return commands
+}
+
+//slashCommandSpan finds the slash command at the start of the message, and
+//returns the name of the command it's mapped to along with where it ends. ok
+//is false when the message wasn't sent with a slash command, and reply tells
+//the sender why a slash command can't be run.
+func (m message) slashCommandSpan() (name string, end int, ok bool, reply string) {
+	id := m.SlashCommand.CommandID
+
+	var commandName string
+	end = -1
+
+	for _, a := range m.Mentions {
+		if a.Type != "SLASH_COMMAND" || a.SlashCommand == nil {
+			continue
+		}
+
+		if id == "" {
+			id = a.SlashCommand.CommandID
+		}
+		commandName = a.SlashCommand.CommandName
+
+		if e, valid := utf16ToByteOffset(m.Text, a.StartIndex+a.Length); valid {
+			end = e
+		}
+
+		break
+	}
+
+	if id == "" && commandName == "" {
+		return "", 0, false, ""
+	}
+
+	//Without an annotation, the command is whatever comes before the
+	//argument text Google splits out for us.
+	if end < 0 {
+		end = 0
+		if strings.HasSuffix(m.Text, m.ArgumentText) {
+			end = len(m.Text) - len(m.ArgumentText)
+		}
+	}
+
+	name, mapped := SlashCommands[strings.ToLower(id)]
+	if !mapped {
+		name, mapped = SlashCommands[strings.ToLower(commandName)]
+	}
+
+	called := commandName
+	if called == "" {
+		called = "#" + id
+	}
+
+	if !mapped {
+		return "", end, true, fmt.Sprintf("My apologies, the slash command %s hasn't been set up for me yet.", called)
+	}
+
+	if Commands.Get(name) == nil {
+		return "", end, true, fmt.Sprintf("My apologies, the slash command %s is set up for %q, which I don't know how to do.", called, name)
+	}
+
+	return name, end, true, ""
+}
+
+//expandSlashCommand swaps the slash command at the start of the message for
+//the bot's name and the command it's mapped to, so the rest of the message is
+//handled just like the text syntax. Slash commands mapped to notify only get
+//the bot's name, since the group's name follows it. reply is why the slash
+//command can't be run, if it can't.
+func (m *message) expandSlashCommand() (ok bool, reply string) {
+	name, end, ok, reply := m.slashCommandSpan()
+	if !ok || reply != "" {
+		return ok, reply
+	}
+
+	replacement := BotName + " " + name + " "
+	if name == "notify" {
+		replacement = BotName + " "
+	}
+
+	m.replaceSpan(0, end, replacement)
+	return true, ""
+}
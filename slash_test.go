@@ -0,0 +1,156 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSlashCommands(t *testing.T) {
+	got := parseSlashCommands(" 1=create, 2 = schedule,/HGList=list,,broken,=list,3=")
+	want := map[string]string{"1": "create", "2": "schedule", "/hglist": "list"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Incorrect slash commands\nGot: %v\nWanted: %v", got, want)
+	}
+}
+
+func TestSlashCommands(t *testing.T) {
+	slashCommands := SlashCommands
+	defer func() { SlashCommands = slashCommands }()
+
+	SlashCommands = map[string]string{"1": "create", "/hgschedule": "schedule", "3": "notify", "4": "teleport"}
+
+	sender := User{Name: "Sender", GID: genUserGID(0), Type: "HUMAN"}
+	someone := User{Name: "Someone", GID: genUserGID(0), Type: "HUMAN"}
+
+	//slashMessage builds a message the way Google sends a slash command, with
+	//an annotation for the command and one for each mention after it.
+	slashMessage := func(id, name, argumentText string, mentions ...User) messageResponse {
+		text := name + argumentText
+
+		msg := message{
+			Sender:       sender,
+			Text:         text,
+			ArgumentText: argumentText,
+			SlashCommand: slashCommand{CommandID: id},
+			Mentions: []annotation{{
+				Type:         "SLASH_COMMAND",
+				Length:       utf16Len(name),
+				SlashCommand: &slashCommandMetadata{CommandName: name, CommandID: id, Type: "INVOKE"},
+			}},
+		}
+
+		for _, user := range mentions {
+			mention := "@" + user.Name
+			msg.Mentions = append(msg.Mentions, annotation{
+				Type:       "USER_MENTION",
+				Called:     userMention{user},
+				StartIndex: utf16Len(text[:strings.Index(text, mention)]),
+				Length:     utf16Len(mention),
+			})
+		}
+
+		return messageResponse{Message: msg, Room: space{GID: genRoomGID(0), Type: "ROOM"}}
+	}
+
+	t.Run("Runs the mapped command", func(t *testing.T) {
+		msgObj := slashMessage("1", "/hgcreate", " oncall @Someone", someone)
+
+		args, msg, okay := msgObj.ParseArgs(make(GroupMap))
+		if !okay {
+			t.Fatalf("Error parsing slash command: %s", msg)
+		}
+
+		if args["action"] != "create" || args["groupName"] != "oncall" {
+			t.Fatalf("Slash command not properly parsed\nObject Result: %+v", args)
+		}
+
+		if msgObj.Message.Text != BotName+" create  oncall @Someone" {
+			t.Fatalf("Slash command not expanded\nGot: %q", msgObj.Message.Text)
+		}
+
+		mention := msgObj.Message.Mentions[0]
+		if len(msgObj.Message.Mentions) != 1 || msgObj.Message.Text[mention.StartIndex:mention.StartIndex+mention.Length] != "@Someone" {
+			t.Fatalf("Mentions not moved with the text\nGot: %+v", msgObj.Message.Mentions)
+		}
+	})
+
+	t.Run("Matches by the command's name", func(t *testing.T) {
+		msgObj := slashMessage("99", "/hgschedule", " list")
+
+		args, msg, okay := msgObj.ParseArgs(make(GroupMap))
+		if !okay || args["action"] != "schedule" || args["subAction"] != "list" {
+			t.Fatalf("Slash command not matched by name\nGot: %q %+v", msg, args)
+		}
+	})
+
+	t.Run("Works without an annotation", func(t *testing.T) {
+		msgObj := slashMessage("1", "/hgcreate", " oncall")
+		msgObj.Message.Mentions = nil
+
+		args, msg, okay := msgObj.ParseArgs(make(GroupMap))
+		if !okay || args["action"] != "create" || args["groupName"] != "oncall" {
+			t.Fatalf("Slash command not parsed\nGot: %q %+v", msg, args)
+		}
+	})
+
+	t.Run("Notifies a group", func(t *testing.T) {
+		Groups := GroupMap{"oncall": &Group{Name: "oncall", Members: []Member{{GID: "users/1"}}}}
+		msgObj := slashMessage("3", "/hgnotify", " oncall the build is broken")
+
+		args, msg, okay := msgObj.ParseArgs(Groups)
+		if !okay || args["action"] != "notify" || args["groupName"] != "oncall" {
+			t.Fatalf("Slash command not parsed\nGot: %q %+v", msg, args)
+		}
+
+		if got := Groups.Notify(args["groupName"], msgObj); !strings.HasSuffix(got, "<users/1> the build is broken") {
+			t.Fatalf("Group not notified\nGot: %q", got)
+		}
+	})
+
+	t.Run("Admins can use slash commands from a DM", func(t *testing.T) {
+		roles := Roles
+		defer func() { Roles = roles }()
+
+		Roles = newRoleDirectory()
+		Roles.Replace([]RoleGrant{{GID: sender.GID, Role: RoleAdmin}})
+
+		msgObj := slashMessage("1", "/hgcreate", " oncall")
+		msgObj.Room.Type = "DM"
+
+		args, msg, okay := msgObj.ParseArgs(make(GroupMap))
+		if !okay || !msgObj.FromMaster || args["action"] != "create" || args["groupName"] != "oncall" {
+			t.Fatalf("Slash command not parsed for admin\nGot: %q %+v", msg, args)
+		}
+	})
+
+	t.Run("Unknown slash commands are refused", func(t *testing.T) {
+		msgObj := slashMessage("42", "/hgmystery", " oncall")
+
+		if _, msg, okay := msgObj.ParseArgs(make(GroupMap)); okay || !strings.Contains(msg, "/hgmystery hasn't been set up") {
+			t.Fatalf("Unknown slash command not refused\nGot: %q", msg)
+		}
+
+		msgObj = slashMessage("4", "/hgteleport", " oncall")
+
+		if _, msg, okay := msgObj.ParseArgs(make(GroupMap)); okay || !strings.Contains(msg, `"teleport"`) {
+			t.Fatalf("Slash command for an unknown action not refused\nGot: %q", msg)
+		}
+
+		msgObj.Message.Mentions = nil
+
+		if _, msg, okay := msgObj.ParseArgs(make(GroupMap)); okay || !strings.Contains(msg, `slash command #4 is set up for "teleport"`) {
+			t.Fatalf("Slash command without an annotation not named\nGot: %q", msg)
+		}
+	})
+
+	t.Run("Text syntax still works", func(t *testing.T) {
+		msgObj := messageResponse{Message: message{Sender: sender, Text: BotName + " create oncall"}, Room: space{Type: "ROOM"}}
+
+		args, msg, okay := msgObj.ParseArgs(make(GroupMap))
+		if !okay || args["action"] != "create" {
+			t.Fatalf("Text syntax not parsed\nGot: %q %+v", msg, args)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+//PauseRoom pauses every schedule in the room the bot was removed from, since
+//their messages can't be posted there anymore. The labels of the paused
+//schedules are returned.
+func (sm ScheduleMap) PauseRoom(msgObj messageResponse) []string {
+	var labels []string
+
+	for schedKey, schedule := range sm {
+		if schedule.IsFinished || schedule.IsPaused || strings.Split(schedKey, ":")[0] != msgObj.Room.GID {
+			continue
+		}
+
+		schedule.stopTimer()
+		schedule.IsPaused = true
+
+		go Logger.SaveSchedule(schedule)
+		auditSchedule("schedule pause", "", schedKey, msgObj, "removed from the room")
+
+		labels = append(labels, schedule.MessageLabel)
+	}
+
+	sort.Strings(labels)
+	return labels
+}
+
+//ResumeRoom picks back up every schedule paused in the room the bot was added
+//back to. Recurring messages that were missed skip ahead to their next week,
+//rather than all being sent at once. Messages only sent once that were missed
+//are finished without being sent, since they'd arrive late. The labels of the
+//resumed schedules are returned, along with the ones that expired.
+func (sm ScheduleMap) ResumeRoom(msgObj messageResponse) (resumed, expired []string) {
+	for schedKey, schedule := range sm {
+		if !schedule.IsPaused || strings.Split(schedKey, ":")[0] != msgObj.Room.GID {
+			continue
+		}
+
+		schedule.IsPaused = false
+
+		if !schedule.IsRecurring && schedule.ExecuteOn.Before(time.Now()) {
+			schedule.IsFinished = true
+
+			go Logger.SaveSchedule(schedule)
+			auditSchedule("schedule expire", "", schedKey, msgObj, "missed while removed from the room")
+
+			expired = append(expired, schedule.MessageLabel)
+			continue
+		}
+
+		for schedule.ExecuteOn.Before(time.Now()) {
+			schedule.ExecuteOn = schedule.ExecuteOn.Add(time.Hour * 168)
+		}
+
+		schedule.StartTimer()
+
+		go Logger.SaveSchedule(schedule)
+		auditSchedule("schedule resume", "", schedKey, msgObj, "added back to the room")
+
+		resumed = append(resumed, schedule.MessageLabel)
+	}
+
+	sort.Strings(resumed)
+	sort.Strings(expired)
+
+	return
+}
+
+//FlagRoom marks every group restricted to the room as having lost it, or
+//clears the mark when the bot is added back. Nobody outside the room can use
+//these groups, so while the bot is gone only an admin can make them public or
+//disband them. The names of the groups that changed are returned.
+func (gm GroupMap) FlagRoom(removed bool, msgObj messageResponse) []string {
+	var names []string
+
+	for _, group := range gm {
+		if !group.IsPrivate || group.PrivacyRoomID != msgObj.Room.GID || group.RoomRemoved == removed {
+			continue
+		}
+
+		group := group
+		group.RoomRemoved = removed
+
+		saveGroup(func() { Logger.UpdatePrivacyDB(group) })
+
+		if removed {
+			auditGroup("room removed", group, group.Members, msgObj, "the bot was removed from the room")
+		} else {
+			auditGroup("room restored", group, group.Members, msgObj, "the bot was added back to the room")
+		}
+
+		names = append(names, group.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+//leaveRoom handles the bot being removed from a room. Google doesn't show a
+//reply to the removal, so what was changed is only logged.
+func leaveRoom(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse) {
+	msgObj.Message.Sender = msgObj.User
+
+	paused := Scheduler.PauseRoom(msgObj)
+	flagged := Groups.FlagRoom(true, msgObj)
+
+	log.Printf("Removed from %s: paused %d schedules %q, flagged %d groups %q",
+		msgObj.Room.GID, len(paused), paused, len(flagged), flagged,
+	)
+}
+
+//rejoinRoom handles the bot being added to a room, resuming whatever was
+//paused if it had been removed from the room before. The reply says what was
+//resumed, and is empty if there was nothing.
+func rejoinRoom(Groups GroupMgr, Scheduler ScheduleMgr, msgObj messageResponse) string {
+	msgObj.Message.Sender = msgObj.User
+
+	resumed, expired := Scheduler.ResumeRoom(msgObj)
+	restored := Groups.FlagRoom(false, msgObj)
+
+	var text string
+
+	if len(resumed) > 0 {
+		text += fmt.Sprintf(" I've resumed the scheduled messages %s.", strings.Join(quoteAll(resumed), ", "))
+	}
+
+	if len(expired) > 0 {
+		text += fmt.Sprintf(" The scheduled messages %s were due while I was away, so they won't be sent.", strings.Join(quoteAll(expired), ", "))
+	}
+
+	if len(restored) > 0 {
+		text += fmt.Sprintf(" The groups %s restricted to this room can be used again.", strings.Join(quoteAll(restored), ", "))
+	}
+
+	return strings.TrimSpace(text)
+}
+
+//quoteAll quotes each of the names
+func quoteAll(names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", name))
+	}
+
+	return quoted
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomLifecycle(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	otherRoomGID := genRoomGID(10)
+	remover := User{Name: "Remover", GID: genUserGID(0), Type: "HUMAN"}
+	msgObj := messageResponse{Room: space{GID: roomGID, Type: "ROOM"}, User: remover, Message: message{Sender: remover}}
+
+	lastWeek := time.Now().Add(-time.Hour * 160)
+	tomorrow := time.Now().Add(time.Hour * 24)
+
+	Schedules := ScheduleMap{
+		roomGID + ":weekly":     &Schedule{MessageLabel: "weekly", IsRecurring: true, ExecuteOn: tomorrow},
+		roomGID + ":once":       &Schedule{MessageLabel: "once", ExecuteOn: tomorrow},
+		roomGID + ":done":       &Schedule{MessageLabel: "done", IsFinished: true},
+		otherRoomGID + ":other": &Schedule{MessageLabel: "other", ExecuteOn: tomorrow},
+	}
+
+	Groups := GroupMap{
+		"local":  &Group{Name: "local", IsPrivate: true, PrivacyRoomID: roomGID},
+		"remote": &Group{Name: "remote", IsPrivate: true, PrivacyRoomID: otherRoomGID},
+		"public": &Group{Name: "public"},
+	}
+
+	t.Run("Removal pauses the room's schedules", func(t *testing.T) {
+		paused := Schedules.PauseRoom(msgObj)
+
+		if strings.Join(paused, " ") != "once weekly" {
+			t.Fatalf("Incorrect schedules paused\nGot: %q", paused)
+		}
+
+		if Schedules[roomGID+":done"].IsPaused || Schedules[otherRoomGID+":other"].IsPaused {
+			t.Fatal("Schedules outside the room or finished should not be paused")
+		}
+
+		if again := Schedules.PauseRoom(msgObj); len(again) != 0 {
+			t.Fatalf("Paused schedules should not be paused again\nGot: %q", again)
+		}
+	})
+
+	t.Run("Removal flags the room's restricted groups", func(t *testing.T) {
+		flagged := Groups.FlagRoom(true, msgObj)
+
+		if strings.Join(flagged, " ") != "local" || !Groups["local"].RoomRemoved {
+			t.Fatalf("Incorrect groups flagged\nGot: %q", flagged)
+		}
+
+		if Groups["remote"].RoomRemoved || Groups["public"].RoomRemoved {
+			t.Fatal("Groups of other rooms should not be flagged")
+		}
+	})
+
+	t.Run("Flagged groups say why they can't be used", func(t *testing.T) {
+		elsewhere := messageResponse{Room: space{GID: otherRoomGID, Type: "ROOM"}, Message: message{Sender: remover}}
+
+		if got := Groups.Notify("local", elsewhere); !strings.Contains(got, "removed from") {
+			t.Fatalf("Flagged group not explained\nGot: %q", got)
+		}
+	})
+
+	t.Run("Missed one-time schedules expire instead of sending late", func(t *testing.T) {
+		Schedules.PauseRoom(msgObj)
+		Schedules[roomGID+":once"].ExecuteOn = time.Now().Add(-time.Hour)
+		defer func() {
+			once := Schedules[roomGID+":once"]
+			once.IsFinished, once.IsPaused, once.ExecuteOn = false, true, tomorrow
+		}()
+
+		resumed, expired := Schedules.ResumeRoom(msgObj)
+
+		if strings.Join(resumed, " ") != "weekly" || strings.Join(expired, " ") != "once" {
+			t.Fatalf("Incorrect schedules resumed\nGot: %q %q", resumed, expired)
+		}
+
+		if once := Schedules[roomGID+":once"]; !once.IsFinished || once.IsPaused || once.timer != nil {
+			t.Fatalf("Missed schedule should be finished without a timer\nGot: %+v", once)
+		}
+
+		Schedules.PauseRoom(msgObj)
+	})
+
+	t.Run("Adding back resumes and clears the flags", func(t *testing.T) {
+		Schedules[roomGID+":weekly"].ExecuteOn = lastWeek
+
+		got := rejoinRoom(Groups, Schedules, msgObj)
+
+		if !strings.Contains(got, `"once", "weekly"`) || !strings.Contains(got, `"local"`) {
+			t.Fatalf("Incorrect reply\nGot: %q", got)
+		}
+
+		weekly := Schedules[roomGID+":weekly"]
+		if weekly.IsPaused || Schedules[roomGID+":once"].IsPaused || Groups["local"].RoomRemoved {
+			t.Fatal("Room not resumed")
+		}
+
+		if !weekly.ExecuteOn.After(time.Now()) || !weekly.ExecuteOn.Equal(lastWeek.Add(time.Hour*168)) {
+			t.Fatalf("Missed recurring schedule should skip to its next week\nGot: %s", weekly.ExecuteOn)
+		}
+
+		if got := rejoinRoom(Groups, Schedules, msgObj); got != "" {
+			t.Fatalf("Nothing should be resumed twice\nGot: %q", got)
+		}
+	})
+}
+
+func TestRoomLifecycleEvents(t *testing.T) {
+	Logger.Active(false)
+
+	useCards := UseCards
+	defer func() { UseCards = useCards }()
+	UseCards = false
+
+	roomGID := genRoomGID(10)
+	Schedules := ScheduleMap{roomGID + ":standup": &Schedule{MessageLabel: "standup", ExecuteOn: time.Now().Add(time.Hour)}}
+	Groups := GroupMap{"local": &Group{Name: "local", IsPrivate: true, PrivacyRoomID: roomGID}}
+
+	server := httptest.NewServer(getRequestHandler(Groups, Schedules))
+	defer server.Close()
+
+	post := func(t *testing.T, eventType string) Reply {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":  eventType,
+			"space": map[string]string{"name": roomGID, "type": "ROOM"},
+			"user":  map[string]string{"name": "users/1", "displayName": "Someone", "type": "HUMAN"},
+		})
+
+		resp, err := http.Post(server.URL, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Error posting data: %q", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var reply Reply
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+
+		return reply
+	}
+
+	post(t, "REMOVED_FROM_SPACE")
+
+	if !Schedules[roomGID+":standup"].IsPaused || !Groups["local"].RoomRemoved {
+		t.Fatal("Room not paused when removed")
+	}
+
+	reply := post(t, "ADDED_TO_SPACE")
+
+	if Schedules[roomGID+":standup"].IsPaused || Groups["local"].RoomRemoved {
+		t.Fatal("Room not resumed when added back")
+	}
+
+	if !strings.Contains(reply.Text, "Thanks for having me back!") || !strings.Contains(reply.Text, `"standup"`) {
+		t.Fatalf("Resumed schedules not mentioned\nGot: %q", reply.Text)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//maxSuggestions is how many names are offered when something isn't found
+const maxSuggestions = 3
+
+//suggest finds the candidates closest to the word, ignoring case. Only names
+//close enough to be a typo of the word are returned, closest first.
+func suggest(word string, candidates []string) []string {
+	word = strings.ToLower(word)
+
+	//About one typo is allowed for every three letters
+	allowed := len(word) / 3
+	if allowed < 1 {
+		allowed = 1
+	}
+
+	type match struct {
+		name     string
+		distance int
+	}
+
+	var (
+		matches []match
+		seen    = checkSeen()
+	)
+
+	for _, candidate := range candidates {
+		lower := strings.ToLower(candidate)
+		if lower == word || seen(lower) {
+			continue
+		}
+
+		if distance := editDistance(word, lower); distance <= allowed {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+
+		return strings.ToLower(matches[i].name) < strings.ToLower(matches[j].name)
+	})
+
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.name)
+	}
+
+	return names
+}
+
+//editDistance counts the letters that have to be added, removed, changed, or
+//swapped with their neighbour to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	//Each row is the distance from the first i letters of a to every prefix
+	//of b. Only the last two rows are needed to build the next one.
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = minInt(curr[j], prevPrev[j-2]+1)
+			}
+		}
+
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return prev[len(rb)]
+}
+
+//minInt returns the smallest of the numbers
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+
+	return first
+}
+
+//didYouMean tells the sender that the word isn't a command or a group they
+//can use, and offers the closest ones that are. Private groups the sender
+//can't use from this room are never offered. An empty string is returned if
+//nothing is close.
+func didYouMean(word string, Groups GroupMgr, msgObj messageResponse) string {
+	groups := Groups.VisibleGroups(msgObj)
+	commands := Commands.Names()
+
+	suggestions := suggest(word, append(append([]string(nil), commands...), groups...))
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	isGroup := make(map[string]bool)
+	for _, name := range groups {
+		isGroup[strings.ToLower(name)] = true
+	}
+
+	var groupCount int
+	quoted := make([]string, 0, len(suggestions))
+	for _, name := range suggestions {
+		if isGroup[strings.ToLower(name)] {
+			groupCount++
+		}
+
+		quoted = append(quoted, "`"+name+"`")
+	}
+
+	kind := "command or group"
+	switch groupCount {
+	case len(suggestions):
+		kind = "group"
+	case 0:
+		kind = "command"
+	}
+
+	options := quoted[0]
+	if len(quoted) > 1 {
+		options = strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+	}
+
+	return fmt.Sprintf("No %s `%s`, did you mean %s?", kind, word, options)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"backend", "backend", 0},
+		{"bakend", "backend", 1},
+		{"lsit", "list", 1},
+		{"frontend", "backend", 5},
+		{"", "add", 3},
+		{"café", "cafe", 1},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Fatalf("Incorrect distance from %q to %q\nGot: %d\nWanted: %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"backend", "Backends", "frontend", "list", "add", "ads"}
+
+	t.Run("Closest names come first", func(t *testing.T) {
+		got := suggest("bakend", candidates)
+
+		if !reflect.DeepEqual(got, []string{"backend", "Backends"}) {
+			t.Fatalf("Incorrect suggestions\nGot: %q", got)
+		}
+	})
+
+	t.Run("Ignores case", func(t *testing.T) {
+		got := suggest("LSIT", candidates)
+
+		if !reflect.DeepEqual(got, []string{"list"}) {
+			t.Fatalf("Incorrect suggestions\nGot: %q", got)
+		}
+	})
+
+	t.Run("Nothing close is nothing suggested", func(t *testing.T) {
+		if got := suggest("zzzzzz", candidates); len(got) != 0 {
+			t.Fatalf("Nothing should be suggested\nGot: %q", got)
+		}
+	})
+}
+
+func TestDidYouMean(t *testing.T) {
+	Logger.Active(false)
+
+	roomGID := genRoomGID(10)
+	msgObj := messageResponse{Room: space{GID: roomGID, Type: "ROOM"}, Message: message{Sender: User{GID: genUserGID(0)}}}
+
+	Groups := GroupMap{
+		"backend":  &Group{Name: "backend"},
+		"backends": &Group{Name: "backends", IsPrivate: true, PrivacyRoomID: genRoomGID(10)},
+		"frontend": &Group{Name: "frontend", IsPrivate: true, PrivacyRoomID: roomGID},
+	}
+
+	t.Run("Suggests groups", func(t *testing.T) {
+		got := didYouMean("bakend", Groups, msgObj)
+
+		if got != "No group `bakend`, did you mean `backend`?" {
+			t.Fatalf("Incorrect suggestion\nGot: %q", got)
+		}
+	})
+
+	t.Run("Suggests private groups of this room", func(t *testing.T) {
+		got := didYouMean("frontnd", Groups, msgObj)
+
+		if got != "No group `frontnd`, did you mean `frontend`?" {
+			t.Fatalf("Incorrect suggestion\nGot: %q", got)
+		}
+	})
+
+	t.Run("Never leaks private groups from other rooms", func(t *testing.T) {
+		roles := Roles
+		defer func() { Roles = roles }()
+
+		Roles = newRoleDirectory()
+		Roles.Replace([]RoleGrant{{GID: msgObj.Message.Sender.GID, Role: RoleAuditor}})
+
+		if got := didYouMean("backendz", Groups, msgObj); strings.Contains(got, "`backends`") {
+			t.Fatalf("Private group leaked\nGot: %q", got)
+		}
+	})
+
+	t.Run("Suggests commands", func(t *testing.T) {
+		got := didYouMean("lsit", Groups, msgObj)
+
+		if got != "No command `lsit`, did you mean `list`?" {
+			t.Fatalf("Incorrect suggestion\nGot: %q", got)
+		}
+	})
+
+	t.Run("ParseArgs replies with suggestions", func(t *testing.T) {
+		msg := msgObj
+		msg.Message.Text = BotName + " bakend are you there?"
+
+		_, reply, okay := msg.ParseArgs(Groups)
+
+		if okay || reply != "No group `bakend`, did you mean `backend`?" {
+			t.Fatalf("Suggestion not replied\nGot: %q", reply)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//quotePairs are the quotes that can wrap an argument, along with the quote
+//that closes each. Phones and some keyboards swap straight quotes for curly
+//ones, so both are understood.
+var quotePairs = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'‘':  '’',
+}
+
+//Token is a single argument of a message. Value has any quotes taken out,
+//while Raw is the argument exactly as it was typed. Rest is the message from
+//the start of the token on, untouched, so the spacing and newlines of a
+//message body can be kept.
+type Token struct {
+	Value  string
+	Raw    string
+	Rest   string
+	Quoted bool
+}
+
+//tokenize splits the text into arguments on whitespace. Quotes keep the text
+//inside of them together as one argument, newlines included. A quote only
+//counts when it opens an argument, or the value of an option such as
+//--label="my label", so apostrophes in a message are left alone, as is a
+//quote that's never closed.
+func tokenize(text string) []Token {
+	var tokens []Token
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		quoted := false
+
+		var value strings.Builder
+
+		for i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+			if unicode.IsSpace(r) {
+				break
+			}
+
+			if closer, isQuote := quotePairs[r]; isQuote && (i == start || text[i-1] == '=') {
+				if end := strings.IndexRune(text[i+size:], closer); end >= 0 {
+					value.WriteString(text[i+size : i+size+end])
+					i += size + end + utf8.RuneLen(closer)
+					quoted = true
+
+					continue
+				}
+			}
+
+			value.WriteString(text[i : i+size])
+			i += size
+		}
+
+		tokens = append(tokens, Token{
+			Value:  value.String(),
+			Raw:    text[start:i],
+			Rest:   text[start:],
+			Quoted: quoted,
+		})
+	}
+
+	return tokens
+}
+
+//isOption tells if the token is written as --name or --name=value
+func (t Token) isOption() bool {
+	if !strings.HasPrefix(t.Raw, "--") || len(t.Raw) < 3 {
+		return false
+	}
+
+	r, _ := utf8.DecodeRuneInString(t.Raw[2:])
+	return unicode.IsLetter(r)
+}
+
+//option splits an option token into its lowercased name and its value. The
+//value is empty for options written without one.
+func (t Token) option() (name, value string) {
+	parts := strings.SplitN(strings.TrimPrefix(t.Value, "--"), "=", 2)
+
+	name = strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+
+	return
+}
+
+//restValue is the remainder of the message from this token on, as it was
+//typed. If all that's left is a single quoted argument, its value is used so
+//the quotes aren't kept.
+func (t Token) restValue() string {
+	rest := strings.TrimRightFunc(t.Rest, unicode.IsSpace)
+
+	if t.Quoted && rest == t.Raw {
+		return t.Value
+	}
+
+	return rest
+}
+
+//tokenValues returns the value of each token
+func tokenValues(tokens []Token) []string {
+	values := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		values = append(values, token.Value)
+	}
+
+	return values
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"Splits on any whitespace", "one  two\tthree\nfour", []string{"one", "two", "three", "four"}},
+		{"Keeps quoted text together", `say "hello there" everyone`, []string{"say", "hello there", "everyone"}},
+		{"Keeps newlines in quotes", "say 'line one\nline two'", []string{"say", "line one\nline two"}},
+		{"Understands curly quotes", "say “hello there”", []string{"say", "hello there"}},
+		{"Quotes option values", `--label="my label" next`, []string{"--label=my label", "next"}},
+		{"Leaves apostrophes alone", "don't stop", []string{"don't", "stop"}},
+		{"Leaves unclosed quotes alone", `say "hello there`, []string{"say", `"hello`, "there"}},
+		{"Handles empty text", "   ", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tokenValues(tokenize(test.text))
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Incorrect tokens\nGot: %q\nWanted: %q", got, test.want)
+			}
+		})
+	}
+
+	t.Run("Rest keeps the text as typed", func(t *testing.T) {
+		tokens := tokenize("say  first line\n\n  second line  \n")
+
+		if got := tokens[1].restValue(); got != "first line\n\n  second line" {
+			t.Fatalf("Rest not kept as typed\nGot: %q", got)
+		}
+	})
+
+	t.Run("Rest of a lone quoted token drops the quotes", func(t *testing.T) {
+		tokens := tokenize(`say "first line  second line"`)
+
+		if got := tokens[1].restValue(); got != "first line  second line" {
+			t.Fatalf("Quotes not dropped\nGot: %q", got)
+		}
+	})
+
+	t.Run("Identifies options", func(t *testing.T) {
+		tokens := tokenize(`--Label=standup --dry-run -- --- -x`)
+		wanted := []bool{true, true, false, false, false}
+
+		for i, token := range tokens {
+			if token.isOption() != wanted[i] {
+				t.Fatalf("Token %q option should be %v", token.Raw, wanted[i])
+			}
+		}
+
+		if name, value := tokens[0].option(); name != "label" || value != "standup" {
+			t.Fatalf("Option not split\nGot: %q %q", name, value)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//ChatUser struct is the single copy of a person the bot knows about. Members
+//of a group only hold on to the GID, and the display name is looked up here,
+//so when someone changes their name it's only changed in one place.
+type ChatUser struct {
+	gorm.Model
+	GID      string    `gorm:"not null;unique_index"`
+	Name     string    `gorm:"not null"`
+	LastSeen time.Time `gorm:"not null"`
+}
+
+//UserDirectory holds every ChatUser in memory, keyed by their GID. The mutex
+//is there because names get refreshed on every incoming message, which can
+//happen from many requests at the same time.
+type UserDirectory struct {
+	sync.RWMutex
+	users map[string]*ChatUser
+}
+
+//newUserDirectory initializes an empty user directory
+func newUserDirectory() *UserDirectory {
+	return &UserDirectory{users: make(map[string]*ChatUser)}
+}
+
+//Observe records the user in the directory. If the user is new, or their
+//display name has changed since they were last seen, the change is saved to
+//the database and true is returned.
+func (ud *UserDirectory) Observe(user User) bool {
+	saved := ud.observe(user)
+	if saved == nil {
+		return false
+	}
+
+	go Logger.SaveUser(saved)
+	return true
+}
+
+//observe records the user in the directory, returning a copy of them to save
+//if they're new or their display name has changed, and nil otherwise.
+func (ud *UserDirectory) observe(user User) *ChatUser {
+	if user.GID == "" || user.Name == "" || user.Type == "BOT" {
+		return nil
+	}
+
+	ud.Lock()
+	defer ud.Unlock()
+
+	known, exist := ud.users[user.GID]
+	if exist && known.Name == user.Name {
+		known.LastSeen = time.Now()
+		return nil
+	}
+
+	if !exist {
+		known = &ChatUser{GID: user.GID}
+		ud.users[user.GID] = known
+	}
+
+	known.Name = user.Name
+	known.LastSeen = time.Now()
+
+	saved := *known
+	return &saved
+}
+
+//ObserveMessage refreshes the directory from everyone involved in the message,
+//meaning the sender and anyone mentioned.
+func (ud *UserDirectory) ObserveMessage(msgObj messageResponse) {
+	ud.Observe(msgObj.Message.Sender)
+
+	for _, mention := range msgObj.Message.Mentions {
+		if mention.Type == "USER_MENTION" {
+			ud.Observe(mention.Called.User)
+		}
+	}
+}
+
+//Load places an already persisted user in the directory without saving it
+//again. This is used when the users are pulled from the database at startup.
+func (ud *UserDirectory) Load(user *ChatUser) {
+	ud.Lock()
+	defer ud.Unlock()
+
+	ud.users[user.GID] = user
+}
+
+//Name returns the display name for the given GID. If the user isn't known
+//the fallback is returned instead.
+func (ud *UserDirectory) Name(gid, fallback string) string {
+	ud.RLock()
+	defer ud.RUnlock()
+
+	if user, exist := ud.users[gid]; exist {
+		return user.Name
+	}
+
+	return fallback
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUserDirectoryObserve(t *testing.T) {
+	Logger.Active(false)
+
+	users := newUserDirectory()
+	wantedGID := genUserGID(0)
+
+	t.Run("Adds new user", func(t *testing.T) {
+		wantedName := genRandName(10)
+
+		changed := users.Observe(User{Name: wantedName, GID: wantedGID, Type: "HUMAN"})
+
+		if !changed {
+			t.Fatal("New user should be reported as a change")
+		}
+
+		if gotName := users.Name(wantedGID, ""); gotName != wantedName {
+			t.Fatalf("Incorrect name stored\nWanted: %q\nGot: %q", wantedName, gotName)
+		}
+	})
+
+	t.Run("Refreshes changed display name", func(t *testing.T) {
+		wantedName := genRandName(10)
+
+		changed := users.Observe(User{Name: wantedName, GID: wantedGID, Type: "HUMAN"})
+
+		if !changed {
+			t.Fatal("Renamed user should be reported as a change")
+		}
+
+		if gotName := users.Name(wantedGID, ""); gotName != wantedName {
+			t.Fatalf("Name not refreshed\nWanted: %q\nGot: %q", wantedName, gotName)
+		}
+	})
+
+	t.Run("Does not report unchanged user", func(t *testing.T) {
+		name := users.Name(wantedGID, "")
+
+		if users.Observe(User{Name: name, GID: wantedGID, Type: "HUMAN"}) {
+			t.Fatal("Unchanged user should not be reported as a change")
+		}
+	})
+
+	t.Run("Ignores bots", func(t *testing.T) {
+		botGID := genUserGID(0)
+
+		users.Observe(User{Name: genRandName(10), GID: botGID, Type: "BOT"})
+
+		if gotName := users.Name(botGID, "fallback"); gotName != "fallback" {
+			t.Fatalf("Bot should not be stored, got name %q", gotName)
+		}
+	})
+}
+
+func TestUserDirectoryObserveMessage(t *testing.T) {
+	Logger.Active(false)
+
+	users := newUserDirectory()
+
+	sender := User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"}
+	mentioned := User{Name: genRandName(10), GID: genUserGID(0), Type: "HUMAN"}
+
+	msgObj := messageResponse{
+		Message: message{
+			Sender: sender,
+			Mentions: []annotation{{
+				Called: userMention{User: mentioned},
+				Type:   "USER_MENTION",
+			}},
+		},
+	}
+
+	t.Run("Records sender and mentions", func(t *testing.T) {
+		users.ObserveMessage(msgObj)
+
+		if users.Name(sender.GID, "") != sender.Name {
+			t.Fatal("Sender not recorded")
+		}
+
+		if users.Name(mentioned.GID, "") != mentioned.Name {
+			t.Fatal("Mentioned user not recorded")
+		}
+	})
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//The events webhooks can be sent for
+const (
+	EventGroupCreated   = "group.created"
+	EventGroupDisbanded = "group.disbanded"
+	EventMembersAdded   = "group.members.added"
+	EventMembersRemoved = "group.members.removed"
+	EventPrivacyChanged = "group.privacy.changed"
+	EventScheduleSent   = "schedule.sent"
+)
+
+//webhookEvents maps the audited actions onto the events sent for them. Actions
+//that aren't here don't send webhooks, except for syncs, which send the events
+//for whichever members they added or removed.
+var webhookEvents = map[string]string{
+	"create":        EventGroupCreated,
+	"disband":       EventGroupDisbanded,
+	"add":           EventMembersAdded,
+	"remove":        EventMembersRemoved,
+	"restrict":      EventPrivacyChanged,
+	"room removed":  EventPrivacyChanged,
+	"room restored": EventPrivacyChanged,
+	"schedule send": EventScheduleSent,
+}
+
+//entryEvents gives the events sent for the audited change
+func entryEvents(entry *AuditEntry) []string {
+	if entry.Action != "sync" {
+		if event, exists := webhookEvents[entry.Action]; exists {
+			return []string{event}
+		}
+
+		return nil
+	}
+
+	diff := diffMembers(entry.GroupName, membersFromGIDs(entry.Before), membersFromGIDs(entry.After))
+
+	var events []string
+	if len(diff.Added) > 0 {
+		events = append(events, EventMembersAdded)
+	}
+
+	if len(diff.Removed) > 0 {
+		events = append(events, EventMembersRemoved)
+	}
+
+	return events
+}
+
+//deliveryLogSize is how many deliveries are kept in memory for the admin API.
+//Every delivery is still kept in the database.
+const deliveryLogSize = 100
+
+//Webhook is a URL told about group and schedule events. Its payloads are
+//signed with the secret, and only the events listed are sent to it, or every
+//event when there are none.
+type Webhook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+//WebhookPayload is the body posted to a webhook
+type WebhookPayload struct {
+	ID       string    `json:"id"`
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor,omitempty"`
+	Room     string    `json:"room,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	Schedule string    `json:"schedule,omitempty"`
+	Before   []string  `json:"before,omitempty"`
+	After    []string  `json:"after,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+//WebhookDelivery defines the database schema for the delivery log. Every
+//attempt to deliver a payload is kept.
+type WebhookDelivery struct {
+	ID         uint      `gorm:"primary_key"`
+	CreatedAt  time.Time `gorm:"index"`
+	DeliveryID string    `gorm:"not null;index"`
+	URL        string    `gorm:"not null"`
+	Event      string    `gorm:"not null"`
+	Attempt    int       `gorm:"not null"`
+	StatusCode int       `gorm:"not null"`
+	Error      string    `gorm:"type:varchar(4000)"`
+	Delivered  bool      `gorm:"not null;default:false"`
+}
+
+//WebhookDispatcher sends the payloads for every event to the webhooks that
+//want them. Failed deliveries are tried again, waiting twice as long each
+//time, until they've been tried MaxAttempts times.
+type WebhookDispatcher struct {
+	Hooks       []Webhook
+	MaxAttempts int
+	Backoff     time.Duration
+
+	client *http.Client
+	sleep  func(time.Duration)
+
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+	pending    sync.WaitGroup
+}
+
+//newWebhookDispatcher sets up a dispatcher for the hooks
+func newWebhookDispatcher(hooks []Webhook) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Hooks:       hooks,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		client:      &http.Client{Timeout: time.Second * 10},
+		sleep:       time.Sleep,
+	}
+}
+
+//loadWebhooks reads the webhooks from the YAML file at path, as a list under
+//webhooks. Webhooks without a URL or secret are skipped.
+func loadWebhooks(path string) []Webhook {
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading webhooks, they are disabled: %s", err.Error())
+		return nil
+	}
+
+	var file struct {
+		Webhooks []Webhook `yaml:"webhooks"`
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		log.Printf("Error parsing webhooks, they are disabled: %s", err.Error())
+		return nil
+	}
+
+	var hooks []Webhook
+	for _, hook := range file.Webhooks {
+		if !strings.HasPrefix(hook.URL, "http://") && !strings.HasPrefix(hook.URL, "https://") || hook.Secret == "" {
+			log.Printf("Invalid webhook %q, it is skipped: expected an http(s) url and a secret", hook.URL)
+			continue
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks
+}
+
+//wants tells if the hook should be sent the event
+func (h Webhook) wants(event string) bool {
+	return inScope(h.Events, event)
+}
+
+//signWebhook gives the signature of a payload sent at the timestamp, which is
+//the hex HMAC-SHA256 of the timestamp and body joined by a period. Receivers
+//should check the timestamp is recent so old payloads can't be replayed.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Fire sends the webhooks for the audited change, if its action has an event.
+//Deliveries happen in the background.
+func (d *WebhookDispatcher) Fire(entry *AuditEntry) {
+	if len(d.Hooks) == 0 {
+		return
+	}
+
+	for _, event := range entryEvents(entry) {
+		d.send(event, entry)
+	}
+}
+
+//send delivers the event for the audited change to every hook that wants it
+func (d *WebhookDispatcher) send(event string, entry *AuditEntry) {
+	payload := WebhookPayload{
+		ID:       newConfirmToken(),
+		Event:    event,
+		Time:     entry.CreatedAt,
+		Actor:    entry.ActorGID,
+		Room:     entry.RoomGID,
+		Group:    entry.GroupName,
+		Schedule: entry.Schedule,
+		Before:   splitGIDs(entry.Before),
+		After:    splitGIDs(entry.After),
+		Detail:   entry.Detail,
+	}
+
+	body, err := json.Marshal(payload)
+	checkError(err)
+
+	for _, hook := range d.Hooks {
+		if hook.wants(event) {
+			d.pending.Add(1)
+			go d.deliver(hook, payload, body)
+		}
+	}
+}
+
+//deliver posts the payload to the hook, trying again when it fails
+func (d *WebhookDispatcher) deliver(hook Webhook, payload WebhookPayload, body []byte) {
+	defer d.pending.Done()
+
+	wait := d.Backoff
+
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		status, err := d.post(hook, payload, body)
+
+		delivery := WebhookDelivery{
+			CreatedAt:  time.Now(),
+			DeliveryID: payload.ID,
+			URL:        hook.URL,
+			Event:      payload.Event,
+			Attempt:    attempt,
+			StatusCode: status,
+			Delivered:  err == nil,
+		}
+
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		d.record(delivery)
+
+		if err == nil {
+			return
+		}
+
+		//Besides rate limits, a 4xx means the hook won't take the payload
+		//no matter how many times it's sent.
+		if status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+			log.Printf("Webhook %s refused %s delivery %s: %s", hook.URL, payload.Event, payload.ID, err.Error())
+			return
+		}
+
+		if attempt < d.MaxAttempts {
+			d.sleep(wait)
+			wait *= 2
+		}
+	}
+
+	log.Printf("Webhook %s failed %s delivery %s after %d attempts", hook.URL, payload.Event, payload.ID, d.MaxAttempts)
+}
+
+//post sends the signed payload once
+func (d *WebhookDispatcher) post(hook Webhook, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-HGNotify-Event", payload.Event)
+	req.Header.Set("X-HGNotify-Delivery", payload.ID)
+	req.Header.Set("X-HGNotify-Timestamp", timestamp)
+	req.Header.Set("X-HGNotify-Signature", signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("received status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+//record adds the attempt to the delivery log
+func (d *WebhookDispatcher) record(delivery WebhookDelivery) {
+	d.mu.Lock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > deliveryLogSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-deliveryLogSize:]
+	}
+	d.mu.Unlock()
+
+	go Logger.SaveWebhookDelivery(&delivery)
+}
+
+//Wait blocks until every payload fired so far is delivered or given up on.
+//The command line tools use it so their webhooks are sent before exiting.
+func (d *WebhookDispatcher) Wait() {
+	d.pending.Wait()
+}
+
+//Deliveries lists the latest delivery attempts, oldest first
+func (d *WebhookDispatcher) Deliveries() []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]WebhookDelivery(nil), d.deliveries...)
+}
+
+//splitGIDs turns the GIDs stored for an audit entry back into a list
+func splitGIDs(gids string) []string {
+	if gids == "" {
+		return nil
+	}
+
+	return strings.Split(gids, ",")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//webhookReceiver is a local endpoint for webhooks, answering with the statuses
+//queued up and then 200 once they run out
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received chan WebhookPayload
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	wr := &webhookReceiver{statuses: statuses, received: make(chan WebhookPayload, 10)}
+
+	wr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if got := r.Header.Get("X-HGNotify-Signature"); got != signWebhook(secret, r.Header.Get("X-HGNotify-Timestamp"), body) {
+			t.Errorf("Incorrect signature %q", got)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		wr.mu.Lock()
+		status := http.StatusOK
+		if len(wr.statuses) > 0 {
+			status, wr.statuses = wr.statuses[0], wr.statuses[1:]
+		}
+		wr.mu.Unlock()
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			return
+		}
+
+		var payload WebhookPayload
+		json.Unmarshal(body, &payload)
+
+		if r.Header.Get("X-HGNotify-Event") != payload.Event || r.Header.Get("X-HGNotify-Delivery") != payload.ID {
+			t.Errorf("Headers don't match the payload\nGot: %v", r.Header)
+		}
+
+		wr.received <- payload
+	}))
+
+	return wr
+}
+
+//next waits for the next payload received
+func (wr *webhookReceiver) next(t *testing.T) WebhookPayload {
+	select {
+	case payload := <-wr.received:
+		return payload
+	case <-time.After(time.Second * 2):
+		t.Fatal("No webhook received")
+		return WebhookPayload{}
+	}
+}
+
+//waitForDeliveries waits for the dispatcher to log count attempts
+func waitForDeliveries(t *testing.T, d *WebhookDispatcher, count int) []WebhookDelivery {
+	deadline := time.Now().Add(time.Second * 2)
+
+	for time.Now().Before(deadline) {
+		if deliveries := d.Deliveries(); len(deliveries) >= count {
+			return deliveries
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	t.Fatalf("Expected %d delivery attempts\nGot: %+v", count, d.Deliveries())
+	return nil
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	file, err := ioutil.TempFile("", "webhooks*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString(`webhooks:
+  - url: https://dashboard.example.com/hook
+    secret: shh
+    events: [group.members.added, group.members.removed]
+  - url: https://nosecret.example.com/hook
+  - url: ftp://example.com
+    secret: shh
+`)
+	file.Close()
+
+	want := []Webhook{{URL: "https://dashboard.example.com/hook", Secret: "shh", Events: []string{EventMembersAdded, EventMembersRemoved}}}
+	if got := loadWebhooks(file.Name()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Incorrect webhooks\nGot: %+v\nWanted: %+v", got, want)
+	}
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	Logger.Active(false)
+
+	entry := &AuditEntry{CreatedAt: time.Now(), ActorGID: "users/1", RoomGID: "spaces/A", Action: "add", GroupName: "oncall", Before: "users/1", After: "users/1,users/2"}
+
+	t.Run("Signed payloads are delivered", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "shh")
+		defer receiver.Close()
+
+		d := newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh"}})
+		d.Fire(entry)
+
+		payload := receiver.next(t)
+		if payload.Event != EventMembersAdded || payload.Group != "oncall" || payload.Actor != "users/1" ||
+			!reflect.DeepEqual(payload.Before, []string{"users/1"}) || !reflect.DeepEqual(payload.After, []string{"users/1", "users/2"}) {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+
+		if deliveries := waitForDeliveries(t, d, 1); !deliveries[0].Delivered || deliveries[0].DeliveryID != payload.ID {
+			t.Fatalf("Delivery not logged\nGot: %+v", deliveries)
+		}
+	})
+
+	t.Run("Failed deliveries are retried with backoff", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "shh", http.StatusInternalServerError, http.StatusTooManyRequests)
+		defer receiver.Close()
+
+		var (
+			mu    sync.Mutex
+			waits []time.Duration
+		)
+
+		d := newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh"}})
+		d.Backoff = time.Millisecond
+		d.sleep = func(wait time.Duration) {
+			mu.Lock()
+			waits = append(waits, wait)
+			mu.Unlock()
+		}
+
+		d.Fire(entry)
+		receiver.next(t)
+
+		deliveries := waitForDeliveries(t, d, 3)
+		if deliveries[0].StatusCode != 500 || deliveries[1].StatusCode != 429 || !deliveries[2].Delivered || deliveries[2].Attempt != 3 {
+			t.Fatalf("Incorrect attempts\nGot: %+v", deliveries)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(waits, []time.Duration{time.Millisecond, time.Millisecond * 2}) {
+			t.Fatalf("Incorrect backoff\nGot: %v", waits)
+		}
+	})
+
+	t.Run("Gives up after the last attempt", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "shh", 500, 500, 500)
+		defer receiver.Close()
+
+		d := newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh"}})
+		d.MaxAttempts = 3
+		d.sleep = func(time.Duration) {}
+
+		d.Fire(entry)
+
+		deliveries := waitForDeliveries(t, d, 3)
+		time.Sleep(time.Millisecond * 20)
+
+		if len(d.Deliveries()) != 3 || deliveries[2].Delivered {
+			t.Fatalf("Should stop after the last attempt\nGot: %+v", d.Deliveries())
+		}
+	})
+
+	t.Run("Refused deliveries aren't retried", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "shh", http.StatusBadRequest)
+		defer receiver.Close()
+
+		d := newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh"}})
+		d.sleep = func(time.Duration) {}
+
+		d.Fire(entry)
+
+		waitForDeliveries(t, d, 1)
+		time.Sleep(time.Millisecond * 20)
+
+		if len(d.Deliveries()) != 1 {
+			t.Fatalf("Refused delivery should not be retried\nGot: %+v", d.Deliveries())
+		}
+	})
+
+	t.Run("Only the events asked for are sent", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "shh")
+		defer receiver.Close()
+
+		d := newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh", Events: []string{EventGroupCreated}}})
+
+		d.Fire(entry)
+		d.Fire(&AuditEntry{Action: "history"})
+		d.Fire(&AuditEntry{Action: "create", GroupName: "new"})
+
+		if payload := receiver.next(t); payload.Event != EventGroupCreated {
+			t.Fatalf("Incorrect event sent\nGot: %+v", payload)
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		if len(d.Deliveries()) != 1 {
+			t.Fatalf("Only one event should be sent\nGot: %+v", d.Deliveries())
+		}
+	})
+}
+
+func TestWebhookEvents(t *testing.T) {
+	Logger.Active(false)
+
+	receiver := newWebhookReceiver(t, "shh")
+	defer receiver.Close()
+
+	webhooks := Webhooks
+	defer func() { Webhooks = webhooks }()
+	Webhooks = newWebhookDispatcher([]Webhook{{URL: receiver.URL, Secret: "shh"}})
+
+	roomGID := genRoomGID(10)
+	sender := User{Name: "Sender", GID: "users/1", Type: "HUMAN"}
+	msgObj := messageResponse{Room: space{GID: roomGID, Type: "ROOM"}, Message: message{Sender: sender}}
+
+	Groups := make(GroupMap)
+
+	t.Run("Group changes", func(t *testing.T) {
+		Groups.Create("oncall", "self", msgObj)
+		if payload := receiver.next(t); payload.Event != EventGroupCreated || payload.Group != "oncall" || payload.Room != roomGID {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+
+		Groups.Restrict("oncall", msgObj)
+		if payload := receiver.next(t); payload.Event != EventPrivacyChanged || payload.Detail != "set to private" {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+
+		Groups.Disband("oncall", msgObj)
+		if payload := receiver.next(t); payload.Event != EventGroupDisbanded || !reflect.DeepEqual(payload.Before, []string{"users/1"}) {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+	})
+
+	t.Run("Syncs send the members they changed", func(t *testing.T) {
+		Webhooks.Fire(&AuditEntry{Action: "sync", GroupName: "oncall", Before: "users/1,users/2", After: "users/1,users/3"})
+
+		events := []string{receiver.next(t).Event, receiver.next(t).Event}
+		sort.Strings(events)
+
+		if !reflect.DeepEqual(events, []string{EventMembersAdded, EventMembersRemoved}) {
+			t.Fatalf("Incorrect events\nGot: %v", events)
+		}
+
+		Webhooks.Fire(&AuditEntry{Action: "sync", GroupName: "oncall", Before: "users/1", After: "users/1"})
+
+		select {
+		case payload := <-receiver.received:
+			t.Fatalf("Syncs that changed nothing should not send a webhook\nGot: %+v", payload)
+		case <-time.After(time.Millisecond * 50):
+		}
+	})
+
+	t.Run("Losing the room changes privacy", func(t *testing.T) {
+		Groups.Create("private", "self", msgObj)
+		receiver.next(t)
+		Groups.Restrict("private", msgObj)
+		receiver.next(t)
+
+		Groups.FlagRoom(true, msgObj)
+		if payload := receiver.next(t); payload.Event != EventPrivacyChanged || payload.Detail != "the bot was removed from the room" {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+
+		Groups.FlagRoom(false, msgObj)
+		if payload := receiver.next(t); payload.Event != EventPrivacyChanged || payload.Detail != "the bot was added back to the room" {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+	})
+
+	t.Run("Scheduled messages sent", func(t *testing.T) {
+		schedule := &Schedule{SessKey: roomGID + ":users/1", MessageLabel: "standup", MessageText: "hi"}
+
+		if err := schedule.deliver(&Group{Name: "backend"}, &MessageRecorder{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if payload := receiver.next(t); payload.Event != EventScheduleSent || payload.Schedule != roomGID+":standup" || payload.Group != "backend" {
+			t.Fatalf("Incorrect payload\nGot: %+v", payload)
+		}
+
+		schedule.deliver(&Group{Name: "backend"}, &MessageRecorder{Err: os.ErrClosed})
+
+		select {
+		case payload := <-receiver.received:
+			t.Fatalf("Failed sends should not send a webhook\nGot: %+v", payload)
+		case <-time.After(time.Millisecond * 50):
+		}
+	})
+}